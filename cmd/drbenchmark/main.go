@@ -41,12 +41,14 @@ import (
 	"github.com/telekom/aml-jens/internal/persistence/datatypes"
 	"github.com/telekom/aml-jens/internal/persistence/jsonp"
 	"github.com/telekom/aml-jens/internal/persistence/psql"
+	"github.com/telekom/aml-jens/pkg/drp_player/trafficcontrol"
 )
 
 var DEBUG, INFO, WARN, FATAL = logging.GetLogger()
 
 func ArgParse() (*datatypes.DB_benchmark, error) {
 	var dev string = ""
+	var backend string = ""
 	var benchmark string = ""
 	var tag string = ""
 	var callback_path string = ""
@@ -54,6 +56,8 @@ func ArgParse() (*datatypes.DB_benchmark, error) {
 	version := flag.Bool("v", false, "prints build version")
 	flag.StringVar(&dev, "dev", "",
 		"nic to play data rate pattern on, default 'lo'")
+	flag.StringVar(&backend, "backend", config.PlayCfg().A_Session.Backend,
+		"queue to shape: janz (custom qdisc, needs root), sim (userspace simulation, no dev needed), a fallback using standard qdiscs (tbf, htb, fq_codel, cake) or auto (janz if available, else the first supported fallback)")
 	flag.StringVar(&benchmark, "benchmark", "/etc/jens-cli/benchmark_example.json",
 		"JSON file containing a benchmark definition")
 	flag.StringVar(&tag, "tag", "<interactive>",
@@ -69,10 +73,16 @@ func ArgParse() (*datatypes.DB_benchmark, error) {
 	if len(flag.Args()) > 0 {
 		logging.FlagParseExit("Unexpected Argument(s): '%v'", flag.Args())
 	}
+	var err error
+	if backend, err = trafficcontrol.ResolveBackend(backend); err != nil {
+		logging.FlagParseExit("Flag: 'backend': %s", err)
+	}
 	if dev == "" {
-		logging.FlagParseExit("Flag: 'dev' was not set")
+		if backend != trafficcontrol.BACKEND_SIM {
+			logging.FlagParseExit("Flag: 'dev' was not set")
+		}
+		dev = trafficcontrol.BACKEND_SIM
 	}
-	var err error
 	if tag == "<interactive>" {
 		tag, err = askTag()
 	}
@@ -93,11 +103,14 @@ func ArgParse() (*datatypes.DB_benchmark, error) {
 		return nil, err
 	}
 
-	if _, err := net.InterfaceByName(dev); err != nil {
-		return nil, fmt.Errorf("'%s' is not a recognized interface -> %v", dev, err)
+	if backend != trafficcontrol.BACKEND_SIM {
+		if _, err := net.InterfaceByName(dev); err != nil {
+			return nil, fmt.Errorf("'%s' is not a recognized interface -> %v", dev, err)
+		}
 	}
 	for _, v := range res.Sessions {
 		v.Dev = dev
+		v.Backend = backend
 	}
 	return res, nil
 }
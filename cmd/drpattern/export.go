@@ -0,0 +1,68 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/telekom/aml-jens/internal/errortypes"
+	"github.com/telekom/aml-jens/pkg/drp"
+)
+
+var exporters = map[string]func(p *drp.DataRatePattern, path string, freq int) error{
+	"mahimahi": (*drp.DataRatePattern).SaveMahimahi,
+	"ns3":      (*drp.DataRatePattern).SaveNs3,
+	"csv": func(p *drp.DataRatePattern, path string, _ int) error {
+		return p.SaveCSV(path)
+	},
+}
+
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	in := fs.String("in", "", "pattern to export (csv file, gen:, synth: or lib: identifier)")
+	out := fs.String("out", "", "file to write")
+	to := fs.String("format", "", "output format: mahimahi, ns3 or csv")
+	freq := fs.Int("freq", 10, "samples per second the (untimed) pattern is played at")
+	format := addInputFlags(fs)
+	fs.Parse(args)
+	if *in == "" || *out == "" {
+		return errortypes.NewUserInputError("export: -in and -out need to be set")
+	}
+	export, ok := exporters[*to]
+	if !ok {
+		return errortypes.NewUserInputError("export: unknown format '%s'", *to)
+	}
+	if format.mahimahi != 0 {
+		*freq = format.mahimahi
+	}
+	pattern, err := format.load(*in)
+	if err != nil {
+		return err
+	}
+	if err := export(pattern, *out, *freq); err != nil {
+		return err
+	}
+	INFO.Printf("Exported %s as %s to %s\n", *in, *to, *out)
+	fmt.Printf("%s: %d samples exported as %s\n", *out, pattern.SampleCount(), *to)
+	return nil
+}
@@ -0,0 +1,82 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package main
+
+import (
+	"flag"
+
+	"github.com/telekom/aml-jens/internal/errortypes"
+	"github.com/telekom/aml-jens/pkg/drp"
+)
+
+// Format of the patterns read by a command
+type inputFormat struct {
+	timed bool
+	//Frequency to convert Mahimahi traces at, 0 if inputs are no Mahimahi traces
+	mahimahi int
+	//KPIConversion config for radio KPI logs ("default" for built-in tables), empty if inputs are no KPI logs
+	kpi string
+}
+
+func addInputFlags(fs *flag.FlagSet) *inputFormat {
+	res := &inputFormat{}
+	fs.BoolVar(&res.timed, "timed", false, "inputs are csvs of 'time_ms,rate_kbits'")
+	fs.IntVar(&res.mahimahi, "mahimahi", 0, "inputs are Mahimahi traces, converted to kbit/s at the given freq")
+	fs.StringVar(&res.kpi, "kpi", "", "inputs are radio KPI logs, converted using the given json config or 'default'")
+	return res
+}
+
+func (f *inputFormat) load(identifier string) (*drp.DataRatePattern, error) {
+	var provider drp.DataRatePatternProvider
+	var err error
+	formats := 0
+	for _, set := range []bool{f.timed, f.mahimahi != 0, f.kpi != ""} {
+		if set {
+			formats++
+		}
+	}
+	switch {
+	case formats > 1:
+		return nil, errortypes.NewUserInputError("-timed, -mahimahi and -kpi are mutually exclusive")
+	case f.kpi != "":
+		conv := drp.DefaultKPIConversion()
+		if f.kpi != "default" {
+			if conv, err = drp.LoadKPIConversion(f.kpi); err != nil {
+				return nil, err
+			}
+		}
+		provider = drp.NewDataRatePatternKPIProvider(identifier, conv)
+	case f.timed:
+		provider = drp.NewDataRatePatternTimedFileProvider(identifier)
+	case f.mahimahi != 0:
+		provider = drp.NewDataRatePatternMahimahiProvider(identifier, f.mahimahi)
+	default:
+		if provider, err = drp.NewDataRatePatternProvider(identifier); err != nil {
+			return nil, err
+		}
+	}
+	res, err := provider.Provide(1, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
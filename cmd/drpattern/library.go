@@ -0,0 +1,172 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/telekom/aml-jens/internal/assets/paths"
+	"github.com/telekom/aml-jens/internal/errortypes"
+	"github.com/telekom/aml-jens/pkg/drp"
+)
+
+var libraryCommands = map[string]command{
+	"list": {
+		usage: "list [-dir DIR] [-tags A,B] [-json]",
+		help:  "lists all patterns",
+		run:   func(args []string) error { return runLibrarySearch("list", args) },
+	},
+	"search": {
+		usage: "search [-dir DIR] [-tags A,B] [-json] TERM...",
+		help:  "lists patterns whose name, description, tags or mappings contain all TERMs",
+		run:   func(args []string) error { return runLibrarySearch("search", args) },
+	},
+	"add": {
+		usage: "add [-dir DIR] [-name NAME] [-tags A,B] PATTERN",
+		help:  "stores PATTERN by its hash",
+		run:   runLibraryAdd,
+	},
+	"resolve": {
+		usage: "resolve [-dir DIR] NAME|HASH",
+		help:  "prints the path of the stored csv",
+		run:   runLibraryResolve,
+	},
+}
+
+func printLibraryUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: drpattern library COMMAND [ARGS]\n\nCommands:\n")
+	names := make([]string, 0, len(libraryCommands))
+	for k := range libraryCommands {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		fmt.Fprintf(os.Stderr, "  %-50s %s\n", libraryCommands[k].usage, libraryCommands[k].help)
+	}
+	fmt.Fprintf(os.Stderr, "\nThe library defaults to %s; its patterns can be used as lib:NAME or lib:HASH.\n", paths.LIBRARY_PATH())
+}
+
+func runLibrary(args []string) error {
+	if len(args) < 1 {
+		printLibraryUsage()
+		return errortypes.NewUserInputError("library: COMMAND needs to be set")
+	}
+	cmd, ok := libraryCommands[args[0]]
+	if !ok {
+		printLibraryUsage()
+		return errortypes.NewUserInputError("library: unknown command '%s'", args[0])
+	}
+	return cmd.run(args[1:])
+}
+
+func addLibraryFlag(fs *flag.FlagSet) *string {
+	return fs.String("dir", paths.LIBRARY_PATH(), "directory of the library")
+}
+
+func splitTags(tags string) []string {
+	if tags == "" {
+		return nil
+	}
+	return strings.Split(tags, ",")
+}
+
+func writeLibraryEntries(w io.Writer, entries []drp.PatternLibraryEntry) {
+	fmt.Fprintf(w, "%-12s %-24s %8s %10s %s\n", "HASH", "NAME", "SAMPLES", "AVG", "TAGS")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%-12.12s %-24s %8d %10.0f %s\n", e.Hash, e.Name, e.Stats.Samples, e.Stats.Avg, strings.Join(e.Tags, ","))
+	}
+}
+
+func runLibrarySearch(name string, args []string) error {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	dir := addLibraryFlag(fs)
+	tags := fs.String("tags", "", "comma separated tags all listed patterns carry")
+	asJson := fs.Bool("json", false, "print index entries as json")
+	fs.Parse(args)
+	if name == "list" && fs.NArg() > 0 {
+		return errortypes.NewUserInputError("list: unexpected arguments %v", fs.Args())
+	}
+	lib, err := drp.OpenPatternLibrary(*dir)
+	if err != nil {
+		return err
+	}
+	entries := lib.Search(strings.Join(fs.Args(), " "), splitTags(*tags)...)
+	if *asJson {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	}
+	writeLibraryEntries(os.Stdout, entries)
+	return nil
+}
+
+func runLibraryAdd(args []string) error {
+	fs := flag.NewFlagSet("add", flag.ExitOnError)
+	dir := addLibraryFlag(fs)
+	name := fs.String("name", "", "name of the pattern (default: file name without extension)")
+	tags := fs.String("tags", "", "comma separated tags, added to the ones of the comment header")
+	format := addInputFlags(fs)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errortypes.NewUserInputError("add: exactly one PATTERN needs to be set")
+	}
+	pattern, err := format.load(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	lib, err := drp.OpenPatternLibrary(*dir)
+	if err != nil {
+		return err
+	}
+	entry, err := lib.Add(pattern, *name, splitTags(*tags))
+	if err != nil {
+		return err
+	}
+	INFO.Printf("Added %s to %s as %s (%s)\n", fs.Arg(0), *dir, entry.Name, entry.Hash)
+	writeLibraryEntries(os.Stdout, []drp.PatternLibraryEntry{entry})
+	return nil
+}
+
+func runLibraryResolve(args []string) error {
+	fs := flag.NewFlagSet("resolve", flag.ExitOnError)
+	dir := addLibraryFlag(fs)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errortypes.NewUserInputError("resolve: exactly one NAME or HASH needs to be set")
+	}
+	lib, err := drp.OpenPatternLibrary(*dir)
+	if err != nil {
+		return err
+	}
+	entry, err := lib.Resolve(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	fmt.Println(lib.PatternPath(entry))
+	return nil
+}
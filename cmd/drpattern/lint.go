@@ -0,0 +1,74 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/telekom/aml-jens/internal/errortypes"
+	"github.com/telekom/aml-jens/pkg/drp"
+)
+
+// Returned if a linted pattern has problems; results in exit code 1
+var errLintFailed = errors.New("lint failed")
+
+func runLint(args []string) error {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	params := drp.DefaultLintParams()
+	fs.BoolVar(&params.Timed, "timed", false, "patterns are csvs of 'time_ms,rate_kbits'")
+	fs.Float64Var(&params.MinRateKbits, "minrate", 0, "report rates below (kbit/s), 0 = off")
+	fs.Float64Var(&params.JumpFactor, "jump", params.JumpFactor, "report consecutive rates differing by more than this factor, 0 = off")
+	strict := fs.Bool("strict", false, "fail on warnings, too")
+	fs.Parse(args)
+	if fs.NArg() < 1 {
+		return errortypes.NewUserInputError("lint: at least one csv needs to be set")
+	}
+	severity := drp.LINT_ERROR
+	if *strict {
+		severity = drp.LINT_WARNING
+	}
+	failed, errs, warns := 0, 0, 0
+	for _, path := range fs.Args() {
+		diags, err := drp.Lint(path, params)
+		if err != nil {
+			return err
+		}
+		for _, d := range diags {
+			fmt.Println(d)
+			if d.Severity == drp.LINT_ERROR {
+				errs++
+			} else {
+				warns++
+			}
+		}
+		if drp.HasLintDiagnostics(diags, severity) {
+			failed++
+		}
+	}
+	fmt.Printf("%d file(s) checked, %d failed: %d error(s), %d warning(s)\n", fs.NArg(), failed, errs, warns)
+	if failed > 0 {
+		return errLintFailed
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/telekom/aml-jens/internal/assets"
+	"github.com/telekom/aml-jens/internal/logging"
+)
+
+var DEBUG, INFO, WARN, FATAL = logging.GetLogger()
+
+type command struct {
+	usage string
+	help  string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"transform": {
+		usage: "transform -in PATTERN -out CSV OP...",
+		help:  "applies OPs in order",
+		run:   runTransform,
+	},
+	"export": {
+		usage: "export -format mahimahi|ns3|csv [-freq N] -in PATTERN -out FILE",
+		help:  "converts PATTERN to another format",
+		run:   runExport,
+	},
+	"lint": {
+		usage: "lint [-timed] [-minrate KBITS] [-jump F] [-strict] CSV...",
+		help:  "reports problems with their line, fails on errors",
+		run:   runLint,
+	},
+	"library": {
+		usage: "library list|search|add|resolve [-dir DIR] ...",
+		help:  "manages the pattern library (see 'drpattern library')",
+		run:   runLibrary,
+	},
+	"concat": {
+		usage: "concat -out CSV PATTERN...",
+		help:  "appends PATTERNs",
+		run:   runConcat,
+	},
+}
+
+func printUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: drpattern COMMAND [ARGS]\n\nCommands:\n")
+	names := make([]string, 0, len(commands))
+	for k := range commands {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		fmt.Fprintf(os.Stderr, "  %-66s %s\n", commands[k].usage, commands[k].help)
+	}
+	fmt.Fprintf(os.Stderr, "\nPatterns are csv files, gen:, synth: or lib: identifiers; use -timed, -mahimahi FREQ or -kpi CONFIG for other inputs.\n")
+	fmt.Fprintf(os.Stderr, "\nOPs:\n  %s\n", strings.Join(opUsage, "\n  "))
+}
+
+func main() {
+	logging.InitLogger(assets.NAME_DRPATTERN)
+	if len(os.Args) < 2 {
+		printUsage()
+		os.Exit(2)
+	}
+	switch os.Args[1] {
+	case "-v", "--version", "version":
+		fmt.Printf("Version      : %s\n", assets.VERSION)
+		fmt.Printf("Compiletime  : %s\n", assets.BUILD_TIME)
+		os.Exit(0)
+	case "-h", "--help", "help":
+		printUsage()
+		os.Exit(0)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command '%s'\n\n", os.Args[1])
+		printUsage()
+		os.Exit(2)
+	}
+	INFO.Printf("Called with Args: %v\n", os.Args)
+	err := cmd.run(os.Args[2:])
+	if errors.Is(err, errLintFailed) {
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		FATAL.Exit(err)
+	}
+}
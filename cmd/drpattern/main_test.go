@@ -0,0 +1,59 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package main
+
+import (
+	"testing"
+
+	"github.com/telekom/aml-jens/pkg/drp"
+)
+
+func TestApplyOps(t *testing.T) {
+	pattern, err := (&inputFormat{}).load("../../test/testdata/drp/saw.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := applyOps(pattern, []string{"crop=0:4", "reverse", "repeat=2", "clamp=15000:30000", "scale=2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.SampleCount() != 8 || res.Max != 60000 || res.Min != 30000 {
+		t.Fatalf("Unexpected result: %d samples [%f,%f]", res.SampleCount(), res.Min, res.Max)
+	}
+}
+
+func TestApplyOpsNOK(t *testing.T) {
+	pattern := &drp.DataRatePattern{}
+	for _, ops := range [][]string{
+		{"crop=1"},
+		{"repeat"},
+		{"reverse=1"},
+		{"stretch=a"},
+		{"unknown=1"},
+		{"clamp=1:b"},
+		{"resample=10:cubic"},
+	} {
+		if _, err := applyOps(pattern, ops); err == nil {
+			t.Fatalf("%v did not fail", ops)
+		}
+	}
+}
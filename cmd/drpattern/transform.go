@@ -0,0 +1,193 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/telekom/aml-jens/internal/errortypes"
+	"github.com/telekom/aml-jens/pkg/drp"
+)
+
+var opUsage = []string{
+	"crop=FROM:TO     keep samples [FROM,TO)",
+	"repeat=N         play pattern N times",
+	"reverse          play pattern backwards",
+	"stretch=F        stretch in time by factor F",
+	"smooth=N         moving average over N samples",
+	"clamp=MIN:MAX    limit rates to [MIN,MAX]",
+	"rescale=MIN:MAX  map rates linearly onto [MIN,MAX]",
+	"scale=F          multiply rates by F",
+	"resample=FREQ[:METHOD]  resample from the native freq (#:freq=N) to FREQ; hold, linear or average (default)",
+}
+
+type transformation func(*drp.DataRatePattern) (*drp.DataRatePattern, error)
+
+func parseRange(op string, arg string) (float64, float64, error) {
+	parts := strings.Split(arg, ":")
+	if len(parts) != 2 {
+		return 0, 0, errortypes.NewUserInputError("%s: expected MIN:MAX, got '%s'", op, arg)
+	}
+	a, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return 0, 0, errortypes.NewUserInputError("%s: %v", op, err)
+	}
+	b, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil {
+		return 0, 0, errortypes.NewUserInputError("%s: %v", op, err)
+	}
+	return a, b, nil
+}
+
+// Parses a single OP (see opUsage) into a transformation
+func parseOp(op string) (transformation, error) {
+	name, arg, has_arg := strings.Cut(op, "=")
+	if !has_arg && name != "reverse" {
+		return nil, errortypes.NewUserInputError("%s: missing argument", op)
+	}
+	switch name {
+	case "reverse":
+		if has_arg {
+			return nil, errortypes.NewUserInputError("%s: does not take an argument", op)
+		}
+		return (*drp.DataRatePattern).Reverse, nil
+	case "repeat", "smooth":
+		n, err := strconv.Atoi(arg)
+		if err != nil {
+			return nil, errortypes.NewUserInputError("%s: %v", op, err)
+		}
+		if name == "repeat" {
+			return func(p *drp.DataRatePattern) (*drp.DataRatePattern, error) { return p.Repeat(n) }, nil
+		}
+		return func(p *drp.DataRatePattern) (*drp.DataRatePattern, error) { return p.Smooth(n) }, nil
+	case "stretch", "scale":
+		f, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return nil, errortypes.NewUserInputError("%s: %v", op, err)
+		}
+		if name == "stretch" {
+			return func(p *drp.DataRatePattern) (*drp.DataRatePattern, error) { return p.Stretch(f) }, nil
+		}
+		return func(p *drp.DataRatePattern) (*drp.DataRatePattern, error) { return p.Scaled(f) }, nil
+	case "resample":
+		freq_str, method_str, _ := strings.Cut(arg, ":")
+		freq, err := strconv.Atoi(freq_str)
+		if err != nil {
+			return nil, errortypes.NewUserInputError("%s: %v", op, err)
+		}
+		method, err := drp.ParseResampleMethod(method_str)
+		if err != nil {
+			return nil, err
+		}
+		return func(p *drp.DataRatePattern) (*drp.DataRatePattern, error) { return p.Resample(freq, method) }, nil
+	case "crop":
+		from, to, err := parseRange(name, arg)
+		if err != nil {
+			return nil, err
+		}
+		return func(p *drp.DataRatePattern) (*drp.DataRatePattern, error) { return p.Crop(int(from), int(to)) }, nil
+	case "clamp", "rescale":
+		min, max, err := parseRange(name, arg)
+		if err != nil {
+			return nil, err
+		}
+		if name == "clamp" {
+			return func(p *drp.DataRatePattern) (*drp.DataRatePattern, error) { return p.Clamp(min, max) }, nil
+		}
+		return func(p *drp.DataRatePattern) (*drp.DataRatePattern, error) { return p.Rescale(min, max) }, nil
+	}
+	return nil, errortypes.NewUserInputError("Unknown op '%s'", op)
+}
+
+// Parses all ops before applying any of them
+func applyOps(pattern *drp.DataRatePattern, ops []string) (*drp.DataRatePattern, error) {
+	parsed := make([]transformation, len(ops))
+	for i, op := range ops {
+		f, err := parseOp(op)
+		if err != nil {
+			return nil, err
+		}
+		parsed[i] = f
+	}
+	var err error
+	for i, f := range parsed {
+		if pattern, err = f(pattern); err != nil {
+			return nil, err
+		}
+		DEBUG.Printf("Applied %s: %d samples\n", ops[i], pattern.SampleCount())
+	}
+	return pattern, nil
+}
+
+func save(pattern *drp.DataRatePattern, out string) error {
+	if err := pattern.SaveCSV(out); err != nil {
+		return err
+	}
+	INFO.Printf("Saved %s (%d samples, hash %s)\n", out, pattern.SampleCount(), pattern.GetHashStr())
+	fmt.Printf("%s: %d samples, hash %s\n", out, pattern.SampleCount(), pattern.GetHashStr())
+	return nil
+}
+
+func runTransform(args []string) error {
+	fs := flag.NewFlagSet("transform", flag.ExitOnError)
+	in := fs.String("in", "", "pattern to transform (csv file, gen:, synth: or lib: identifier)")
+	out := fs.String("out", "", "csv file to write")
+	format := addInputFlags(fs)
+	fs.Parse(args)
+	if *in == "" || *out == "" {
+		return errortypes.NewUserInputError("transform: -in and -out need to be set")
+	}
+	pattern, err := format.load(*in)
+	if err != nil {
+		return err
+	}
+	if pattern, err = applyOps(pattern, fs.Args()); err != nil {
+		return err
+	}
+	return save(pattern, *out)
+}
+
+func runConcat(args []string) error {
+	fs := flag.NewFlagSet("concat", flag.ExitOnError)
+	out := fs.String("out", "", "csv file to write")
+	format := addInputFlags(fs)
+	fs.Parse(args)
+	if *out == "" || fs.NArg() < 2 {
+		return errortypes.NewUserInputError("concat: -out and at least two patterns need to be set")
+	}
+	patterns := make([]*drp.DataRatePattern, fs.NArg())
+	for i, identifier := range fs.Args() {
+		p, err := format.load(identifier)
+		if err != nil {
+			return err
+		}
+		patterns[i] = p
+	}
+	res, err := patterns[0].Concat(patterns[1:]...)
+	if err != nil {
+		return err
+	}
+	return save(res, *out)
+}
@@ -0,0 +1,172 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/viper"
+	"github.com/telekom/aml-jens/internal/assets/paths"
+	"github.com/telekom/aml-jens/internal/config"
+	"github.com/telekom/aml-jens/internal/persistence/psql"
+	"github.com/telekom/aml-jens/pkg/drp_player/trafficcontrol"
+)
+
+type checkStatus string
+
+const (
+	CHECK_OK   checkStatus = "ok"
+	CHECK_WARN checkStatus = "warn"
+	CHECK_FAIL checkStatus = "FAIL"
+	CHECK_SKIP checkStatus = "skip"
+)
+
+// Outcome of one check of drplay doctor
+type checkResult struct {
+	name   string
+	status checkStatus
+	detail string
+	//How to fix a failed check
+	hint string
+}
+
+// Returns the result of check: ok with detail if err is nil,
+// else failed (or warn if !required) with err and hint
+func newCheckResult(name string, detail string, err error, required bool, hint string) checkResult {
+	if err == nil {
+		return checkResult{name: name, status: CHECK_OK, detail: detail}
+	}
+	status := CHECK_FAIL
+	if !required {
+		status = CHECK_WARN
+	}
+	return checkResult{name: name, status: status, detail: err.Error(), hint: hint}
+}
+
+func skipped(name string, reason string) checkResult {
+	return checkResult{name: name, status: CHECK_SKIP, detail: reason}
+}
+
+// Checks the host environment drplay needs and prints the results
+// with hints. Returns the exit code: 1 if a check failed, 0 otherwise.
+func runDoctor(args []string) int {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	dev := fs.String("dev", "", "nic to check, default: none")
+	backend := fs.String("backend", "", "backend to check for, default: the configured one")
+	postgres := fs.Bool("psql", false, "check the configured postgresql db")
+	fs.Parse(args)
+	results := doctorChecks(*dev, *backend, *postgres)
+	printChecks(os.Stdout, results)
+	if hasFailedCheck(results) {
+		return 1
+	}
+	return 0
+}
+
+// Runs all checks for dev (if set) and backend (the configured one if empty)
+func doctorChecks(dev string, backend string, postgres bool) []checkResult {
+	results := []checkResult{checkConfig(paths.RELEASE_CFG_PATH())}
+	if backend == "" {
+		backend = config.PlayCfg().A_Session.Backend
+	}
+	if backend == trafficcontrol.BACKEND_SIM {
+		for _, name := range []string{"CAP_NET_ADMIN", "tc", "sch_janz module", "sch_janz debugfs", "backend", "nftables", "interface"} {
+			results = append(results, skipped(name, "not needed by sim"))
+		}
+	} else {
+		results = append(results, hostChecks(dev, backend)...)
+	}
+	if postgres {
+		login := config.PlayCfg().Psql
+		err := psql.CheckSchema(&login)
+		hint := "check [postgres] of the config and that the server accepts connections of its user"
+		if errors.Is(err, psql.ErrSchemaIncomplete) {
+			hint = "create the missing tables and columns in " + login.Dbname
+		}
+		results = append(results, newCheckResult("postgresql", fmt.Sprintf("%s:%d/%s, schema complete", login.Host, login.Port, login.Dbname), err, true, hint))
+	} else {
+		results = append(results, skipped("postgresql", "-psql not set"))
+	}
+	return results
+}
+
+// Checks the config file in dir: missing is a warning, as defaults are used
+func checkConfig(dir string) checkResult {
+	path, err := config.CheckConfigFile(dir)
+	if errors.As(err, &viper.ConfigFileNotFoundError{}) {
+		return newCheckResult("config", "", fmt.Errorf("no config in %s, defaults are used", dir), false,
+			fmt.Sprintf("install assets/default_bundle/config.toml as %sconfig.toml", dir))
+	}
+	return newCheckResult("config", path, err, true, fmt.Sprintf("fix the toml syntax of %s", path))
+}
+
+// Checks the kernel, tools and privileges the qdisc backends need
+func hostChecks(dev string, backend string) []checkResult {
+	//Only required if janz or a fallback is to be used
+	janz := backend == trafficcontrol.BACKEND_JANZ
+	fallback := !janz && backend != trafficcontrol.BACKEND_AUTO
+	results := []checkResult{newCheckResult("CAP_NET_ADMIN", "effective", trafficcontrol.CheckNetAdmin(), true,
+		"run as root or grant it: setcap cap_net_admin+ep $(which drplay)")}
+	can_probe := results[0].status == CHECK_OK
+	tc, err := trafficcontrol.CheckTc()
+	results = append(results,
+		newCheckResult("tc", tc, err, fallback, "install iproute2"),
+		newCheckResult("sch_janz module", "loaded", trafficcontrol.CheckJanzModule(), janz, "build and load the module: modprobe sch_janz"),
+		newCheckResult("sch_janz debugfs", trafficcontrol.JANZ_DEBUGFS, trafficcontrol.CheckJanzDebugfs(), janz,
+			"mount -t debugfs none /sys/kernel/debug; the sch_janz directory appears once the module is loaded"))
+	if can_probe {
+		resolved, err := trafficcontrol.CheckBackend(backend)
+		results = append(results, newCheckResult("backend", fmt.Sprintf("%s uses %s", backend, resolved), err, true,
+			"use -backend auto to pick a backend the host supports, or load the missing qdisc module"))
+		results = append(results, newCheckResult("nftables", "available over netlink", trafficcontrol.CheckNftables(), true,
+			"load nf_tables: modprobe nf_tables (the nft binary is not needed)"))
+	} else {
+		results = append(results, skipped("backend", "needs CAP_NET_ADMIN"), skipped("nftables", "needs CAP_NET_ADMIN"))
+	}
+	if dev == "" {
+		return append(results, skipped("interface", "-dev not set"))
+	}
+	return append(results, newCheckResult("interface", dev+" is up", trafficcontrol.CheckLink(dev), true,
+		fmt.Sprintf("check -dev against 'ip link' and bring it up: ip link set %s up", dev)))
+}
+
+func printChecks(w io.Writer, results []checkResult) {
+	for _, r := range results {
+		fmt.Fprintf(w, "%-4s  %-16s  %s\n", r.status, r.name, r.detail)
+		if r.hint != "" {
+			fmt.Fprintf(w, "      %-16s  -> %s\n", "", r.hint)
+		}
+	}
+}
+
+func hasFailedCheck(results []checkResult) bool {
+	for _, r := range results {
+		if r.status == CHECK_FAIL {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckConfig(t *testing.T) {
+	dir := t.TempDir() + "/"
+	if r := checkConfig(dir); r.status != CHECK_WARN || r.hint == "" {
+		t.Fatalf("Missing config: expected a warning with hint, got %+v", r)
+	}
+	path := filepath.Join(dir, "config.toml")
+	if err := os.WriteFile(path, []byte("[tccommands\nmarkfree=1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if r := checkConfig(dir); r.status != CHECK_FAIL || !strings.Contains(r.hint, path) {
+		t.Fatalf("Broken config: expected a failure naming %s, got %+v", path, r)
+	}
+	if err := os.WriteFile(path, []byte("[tccommands]\nmarkfree=1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if r := checkConfig(dir); r.status != CHECK_OK || r.detail != path {
+		t.Fatalf("Expected %s to be ok, got %+v", path, r)
+	}
+}
+
+func TestSimDoctorChecks(t *testing.T) {
+	for _, r := range doctorChecks("", "sim", false)[1:] {
+		if r.status != CHECK_SKIP {
+			t.Fatalf("sim needs no %s, got %+v", r.name, r)
+		}
+	}
+}
+
+func TestPrintChecks(t *testing.T) {
+	results := []checkResult{
+		{name: "nftables", status: CHECK_OK, detail: "available over netlink"},
+		{name: "sch_janz module", status: CHECK_WARN, detail: "sch_janz is not loaded", hint: "modprobe sch_janz"},
+	}
+	var out bytes.Buffer
+	printChecks(&out, results)
+	expected := "ok    nftables          available over netlink\n" +
+		"warn  sch_janz module   sch_janz is not loaded\n" +
+		"                        -> modprobe sch_janz\n"
+	if out.String() != expected {
+		t.Fatalf("Expected\n%s\ngot\n%s", expected, out.String())
+	}
+	if hasFailedCheck(results) {
+		t.Fatal("Warnings were taken as failures")
+	}
+	if !hasFailedCheck(append(results, checkResult{status: CHECK_FAIL})) {
+		t.Fatal("Failure was not detected")
+	}
+}
@@ -26,12 +26,14 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/telekom/aml-jens/internal/assets"
 	"github.com/telekom/aml-jens/internal/config"
+	"github.com/telekom/aml-jens/internal/errortypes"
 	"github.com/telekom/aml-jens/internal/logging"
 	"github.com/telekom/aml-jens/internal/persistence"
 	"github.com/telekom/aml-jens/internal/persistence/datatypes"
@@ -39,13 +41,21 @@ import (
 	"github.com/telekom/aml-jens/internal/persistence/psql"
 	"github.com/telekom/aml-jens/pkg/drp"
 	drplay "github.com/telekom/aml-jens/pkg/drp_player"
+	"github.com/telekom/aml-jens/pkg/drp_player/control"
+	"github.com/telekom/aml-jens/pkg/drp_player/measuresession"
+	"github.com/telekom/aml-jens/pkg/drp_player/trafficcontrol"
 )
 
 var DEBUG, INFO, WARN, FATAL = logging.GetLogger()
 
+// Loads patterns swapped to through the control api, set by ArgParse
+var swapPatternLoader control.PatternLoader
+
 func ArgParse() (err error) {
 	result := config.PlayCfg().A_Session
 	var looping bool
+	var timed bool
+	var mahimahi bool
 	// parse parameters
 	version := flag.Bool("v", false, "prints build version")
 	flag.StringVar(
@@ -53,17 +63,39 @@ func ArgParse() (err error) {
 		"dev",
 		"",
 		"nic to play data rate pattern on, default 'lo'")
+	flag.StringVar(
+		&(result.Backend),
+		"backend",
+		result.Backend,
+		"queue to shape: janz (custom qdisc, needs root), sim (userspace simulation, no dev needed), a fallback using standard qdiscs (tbf, htb, fq_codel, cake) or auto (janz if available, else the first supported fallback)")
 
 	pattern_path := flag.String(
 		"pattern",
 		"/etc/jens-cli/drp_3valleys.csv",
-		"csv file for data rate pattern (seperator enter, values in kbits)")
+		"csv file for data rate pattern (seperator enter, values in kbits), a generator like 'gen:sine?min=12000&max=60000&period=30s' or a synthesizer like 'synth:markov?source=drp.csv&seed=7'")
+
+	flag.BoolVar(
+		&timed,
+		"timed",
+		false,
+		"pattern is a csv of 'time_ms,rate_kbits'; each rate is played at its offset, freq is ignored")
+
+	flag.BoolVar(
+		&mahimahi,
+		"mahimahi",
+		false,
+		"pattern is a Mahimahi packet-delivery trace; it is converted to kbit/s at freq")
 
 	flag.IntVar(
 		&result.ChildDRP.Freq,
 		"freq",
 		10,
-		"number of samples per second to play [1 ... 100], default 10")
+		"number of samples per second to play [1 ... 1000], default 10")
+
+	resample := flag.String(
+		"resample",
+		"average",
+		"method to resample patterns declaring a native freq (#:freq=N) to freq: hold, linear or average")
 
 	flag.StringVar(
 		&result.Name,
@@ -75,6 +107,36 @@ func ArgParse() (err error) {
 		"loop",
 		false,
 		"defines if data rate pattern player should run in an endless loop")
+	loop_mode := flag.String(
+		"loopmode",
+		"pingpong",
+		"how to loop: pingpong (forth and back, doubling the end samples) or wrap (start over)")
+	playback := drp.PlaybackMode{}
+	flag.IntVar(
+		&playback.Repetitions,
+		"repeat",
+		0,
+		"number of passes through the pattern before stopping; implies looping, 0 = endless")
+	flag.BoolVar(
+		&playback.Reverse,
+		"reverse",
+		false,
+		"play the pattern backwards")
+	flag.IntVar(
+		&playback.StartSample,
+		"startsample",
+		0,
+		"first sample to play (in playing direction)")
+	flag.DurationVar(
+		&playback.StartTime,
+		"start",
+		0,
+		"time into the pattern to start at, e.g. 30s; overrides startsample")
+	flag.DurationVar(
+		&playback.Duration,
+		"duration",
+		0,
+		"stop playing after this duration, e.g. 5m; 0 = no cap")
 	flag.BoolVar(
 		&result.ParentBenchmark.CsvOuptut,
 		"csv",
@@ -92,20 +154,115 @@ func ArgParse() (err error) {
 		false,
 		"output measure records to configured postgresql db")
 
+	dl_pattern_path := flag.String(
+		"dlpattern",
+		"",
+		"pattern played on the downlink (ingress of dev) via an ifb device, same formats as pattern; default: uplink only")
+
+	flag.StringVar(
+		&result.IfbDev,
+		"ifb",
+		trafficcontrol.DEFAULT_IFB,
+		"ifb device the ingress of dev is redirected to for dlpattern")
+
+	flag.StringVar(
+		&result.ControlAddress,
+		"control",
+		"",
+		"serve the control api (status, pause, seek, rate, pattern, marking) on 'unix:PATH' or 'localhost:PORT'")
+
+	impair := flag.String(
+		"impair",
+		"",
+		"random loss and jitter in front of the queue: 'loss=bernoulli|ge,p=P[,r=R,bad=P,good=P][,delay=MS][,jitter=MS,dist=normal|pareto]'")
+
+	flag.StringVar(
+		&result.CatchUp,
+		"catchup",
+		string(trafficcontrol.CATCHUP_SKIP),
+		"what to do with rate changes that missed their deadline: skip (keep the pattern in time) or burst (apply them back to back)")
+
+	flag.StringVar(
+		&result.TimingFile,
+		"timing",
+		"",
+		"write deadline, apply time and lateness of every rate change to this csv file")
+
+	var ues ueFlags
+	flag.Var(
+		&ues,
+		"ue",
+		"additional UE: 'dev=NIC,pattern=DRP[,dlpattern=DRP][,ifb=IFB][,markfree=MS][,markfull=MS]'; repeatable, other settings are shared")
+
 	flag.BoolVar(
 		&result.ChildDRP.Nomeasure,
 		"nomeasure",
 		false,
 		"only play drp, no queue measures are recorded")
 
+	flag.StringVar(
+		&result.CaptureFile,
+		"capture",
+		"",
+		"write every raw measure record to this capture file (see -replay)")
+
+	replay := flag.String(
+		"replay",
+		"",
+		"replay a capture file into aggregation and persistence instead of playing a pattern")
+
+	flag.Float64Var(
+		&result.ReplaySpeed,
+		"speed",
+		1,
+		"replay speed; 1 = original timing, 10 = ten times as fast")
+
+	validate := flag.Bool(
+		"validate",
+		false,
+		"only check the pattern, reporting every problem with its line; exits 1 on errors")
+
 	flag.Parse()
 	if *version {
 		fmt.Printf("Version      : %s\n", assets.VERSION)
 		fmt.Printf("Compiletime  : %s\n", assets.BUILD_TIME)
 		os.Exit(0)
 	}
+	if timed && mahimahi {
+		logging.FlagParseExit("Flags: 'timed' and 'mahimahi' are mutually exclusive")
+	}
+	if *validate {
+		os.Exit(validatePattern(*pattern_path, timed, mahimahi, result.ChildDRP))
+	}
+	if *replay != "" {
+		if *dl_pattern_path != "" || len(ues) > 0 {
+			logging.FlagParseExit("Flag: 'replay' can't be combined with 'dlpattern' or 'ue'")
+		}
+		if err := setupReplay(*replay, result, pattern_path); err != nil {
+			return err
+		}
+	}
+	//A replay shapes nothing, its backend is the one of the capture
+	if *replay == "" {
+		backend := result.Backend
+		if result.Backend, err = trafficcontrol.ResolveBackend(backend); err != nil {
+			logging.FlagParseExit("Flag: 'backend': %s", err)
+		}
+		if backend == trafficcontrol.BACKEND_AUTO {
+			fmt.Fprintf(os.Stderr, "backend auto: using %s\n", result.Backend)
+		}
+	}
+	if result.Impairment, err = drp.ParseImpairment(*impair); err != nil {
+		logging.FlagParseExit("Flag: 'impair': %s", err)
+	}
+	if _, err := trafficcontrol.ParseCatchUpPolicy(result.CatchUp); err != nil {
+		logging.FlagParseExit("Flag: 'catchup': %s", err)
+	}
 	if result.Dev == "" {
-		logging.FlagParseExit("Flag: 'dev' was not set")
+		if result.Backend != trafficcontrol.BACKEND_SIM {
+			logging.FlagParseExit("Flag: 'dev' was not set")
+		}
+		result.Dev = trafficcontrol.BACKEND_SIM
 	}
 	if *postgresPtr {
 		err := persistence.SetPersistenceTo(&psql.DataBase{}, &config.PlayCfg().Psql)
@@ -118,9 +275,266 @@ func ArgParse() (err error) {
 			return err
 		}
 	}
-	err = result.ChildDRP.ParseDRP(drp.NewDataRatePatternFileProvider(*pattern_path))
-	result.ChildDRP.SetLooping(looping)
-	return err
+	if result.ChildDRP.Resample, err = drp.ParseResampleMethod(*resample); err != nil {
+		logging.FlagParseExit("Flag: 'resample': %s", err)
+	}
+	provider, err := newProvider(*pattern_path, timed, mahimahi, result.ChildDRP.Freq)
+	if err != nil {
+		return err
+	}
+	if err = result.ChildDRP.ParseDRP(provider); err != nil {
+		return err
+	}
+	if looping || playback.Repetitions > 0 {
+		if playback.Loop, err = drp.ParseLoopMode(*loop_mode); err != nil || playback.Loop == drp.LOOP_NONE {
+			logging.FlagParseExit("Flag: 'loopmode' must be pingpong or wrap")
+		}
+	}
+	if err = result.ChildDRP.SetPlaybackMode(playback); err != nil {
+		return err
+	}
+	if *dl_pattern_path != "" {
+		if result.ChildDRPDownlink, err = loadPatternLike(*dl_pattern_path, timed, mahimahi, result.ChildDRP); err != nil {
+			return fmt.Errorf("dlpattern: %w", err)
+		}
+		if err = result.ChildDRPDownlink.SetPlaybackMode(playback); err != nil {
+			return err
+		}
+	}
+	for _, spec := range ues {
+		if err := addUe(result, spec, timed, mahimahi, playback); err != nil {
+			return fmt.Errorf("ue '%s': %w", spec, err)
+		}
+	}
+	//Swapped patterns are played like the first one, from their start
+	swap_playback := playback
+	swap_playback.StartSample = 0
+	swap_playback.StartTime = 0
+	swapPatternLoader = func(identifier string) (*datatypes.DB_data_rate_pattern, error) {
+		//Checked before loading, a stream would open its source
+		if drp.IsStreamIdentifier(identifier) {
+			return nil, errortypes.NewUserInputError("streamed patterns can't be swapped to")
+		}
+		if timed || mahimahi {
+			return nil, errortypes.NewUserInputError("patterns played with timed or mahimahi can't be swapped")
+		}
+		pattern, err := loadPatternLike(identifier, false, false, result.ChildDRP)
+		if err != nil {
+			return nil, err
+		}
+		if err := pattern.SetPlaybackMode(swap_playback); err != nil {
+			pattern.Close()
+			return nil, err
+		}
+		return pattern, nil
+	}
+	return nil
+}
+
+// Values of the repeatable -ue flag
+type ueFlags []string
+
+func (u *ueFlags) String() string {
+	return strings.Join(*u, " ")
+}
+
+func (u *ueFlags) Set(value string) error {
+	*u = append(*u, value)
+	return nil
+}
+
+// Parses the key=value list of a -ue flag
+func parseUeSpec(spec string) (map[string]string, error) {
+	known := map[string]bool{"dev": true, "pattern": true, "dlpattern": true, "ifb": true, "markfree": true, "markfull": true}
+	res := make(map[string]string)
+	for _, kv := range strings.Split(spec, ",") {
+		key, value, found := strings.Cut(kv, "=")
+		if !found || value == "" {
+			return nil, errortypes.NewUserInputError("'%s' is not a key=value pair", kv)
+		}
+		if !known[key] {
+			return nil, errortypes.NewUserInputError("unknown key '%s'", key)
+		}
+		res[key] = value
+	}
+	if res["pattern"] == "" {
+		return nil, errortypes.NewUserInputError("pattern was not set")
+	}
+	return res, nil
+}
+
+// Adds the UE described by spec to session, its patterns
+// are loaded with the settings of the first UE
+func addUe(session *datatypes.DB_session, spec string, timed bool, mahimahi bool, playback drp.PlaybackMode) error {
+	values, err := parseUeSpec(spec)
+	if err != nil {
+		return err
+	}
+	pattern, err := loadPatternLike(values["pattern"], timed, mahimahi, session.ChildDRP)
+	if err != nil {
+		return err
+	}
+	if err := pattern.SetPlaybackMode(playback); err != nil {
+		return err
+	}
+	ue := session.AddUe(values["dev"], pattern)
+	if ue.Dev == "" {
+		if ue.Backend != trafficcontrol.BACKEND_SIM {
+			return errortypes.NewUserInputError("dev was not set")
+		}
+		ue.Dev = fmt.Sprintf("%s%d", trafficcontrol.BACKEND_SIM, ue.Ue)
+	}
+	for key, target := range map[string]*int32{"markfree": &ue.Markfree, "markfull": &ue.Markfull} {
+		if v, ok := values[key]; ok {
+			parsed, err := strconv.ParseInt(v, 10, 32)
+			if err != nil || parsed < 0 {
+				return errortypes.NewUserInputError("%s must be a positive number of ms", key)
+			}
+			*target = int32(parsed)
+		}
+	}
+	if values["dlpattern"] != "" {
+		if ue.ChildDRPDownlink, err = loadPatternLike(values["dlpattern"], timed, mahimahi, session.ChildDRP); err != nil {
+			return fmt.Errorf("dlpattern: %w", err)
+		}
+		if err := ue.ChildDRPDownlink.SetPlaybackMode(playback); err != nil {
+			return err
+		}
+		ue.IfbDev = fmt.Sprintf("ifb%d", ue.Ue)
+		if v, ok := values["ifb"]; ok {
+			ue.IfbDev = v
+		}
+	}
+	return checkUeDevs(session, ue)
+}
+
+// Returns an error if a dev of ue is shaped by another UE of session:
+// the root qdisc of a dev holds the queue of one UE only
+func checkUeDevs(session *datatypes.DB_session, ue *datatypes.DB_session) error {
+	devs := func(s *datatypes.DB_session) []string {
+		if s.IsBidirectional() {
+			return []string{s.Dev, s.IfbDev}
+		}
+		return []string{s.Dev}
+	}
+	for _, other := range session.Ues() {
+		for _, used := range devs(other) {
+			for _, dev := range devs(ue) {
+				if other != ue && dev == used {
+					return errortypes.NewUserInputError("dev %s is already shaped by ue%d", dev, other.Ue)
+				}
+			}
+		}
+	}
+	if ue.IsBidirectional() && ue.IfbDev == ue.Dev {
+		return errortypes.NewUserInputError("ifb must not be dev %s", ue.Dev)
+	}
+	return nil
+}
+
+// Loads pattern with the settings (freq, scale, ...) of template
+func loadPatternLike(pattern string, timed bool, mahimahi bool, template *datatypes.DB_data_rate_pattern) (*datatypes.DB_data_rate_pattern, error) {
+	res := datatypes.NewDB_data_rate_pattern()
+	res.Freq = template.Freq
+	res.Nomeasure = template.Nomeasure
+	res.WarmupTimeMs = template.WarmupTimeMs
+	res.Intial_minRateKbits = template.Intial_minRateKbits
+	res.Initial_scale = template.Initial_scale
+	res.Resample = template.Resample
+	provider, err := newProvider(pattern, timed, mahimahi, res.Freq)
+	if err != nil {
+		return nil, err
+	}
+	if err := res.ParseDRP(provider); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Configures session to replay the capture file path.
+// Session settings, dev and (if not set explicitly) pattern are taken from the capture.
+func setupReplay(path string, session *datatypes.DB_session, pattern_path *string) error {
+	if session.CaptureFile != "" {
+		logging.FlagParseExit("Flags: 'capture' and 'replay' are mutually exclusive")
+	}
+	if session.ReplaySpeed <= 0 {
+		logging.FlagParseExit("Flag: 'speed' must be greater 0")
+	}
+	header, err := measuresession.ReadCaptureHeader(path)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	session.ReplayFile = path
+	session.Backend = header.Backend
+	session.Markfree = header.Markfree
+	session.Markfull = header.Markfull
+	session.Queuesizepackets = header.Queuesizepackets
+	session.ExtralatencyMs = header.ExtralatencyMs
+	session.Ue = header.Ue
+	session.ChildDRP.WarmupTimeMs = 0
+	if session.Dev == "" {
+		session.Dev = header.Dev
+	}
+	pattern_set := false
+	flag.Visit(func(f *flag.Flag) { pattern_set = pattern_set || f.Name == "pattern" })
+	if !pattern_set && header.Pattern != "" {
+		*pattern_path = header.Pattern
+	}
+	return nil
+}
+
+// Returns the provider for the -pattern flag
+func newProvider(pattern string, timed bool, mahimahi bool, freq int) (drp.DataRatePatternProvider, error) {
+	if timed {
+		return drp.NewDataRatePatternTimedFileProvider(pattern), nil
+	} else if mahimahi {
+		return drp.NewDataRatePatternMahimahiProvider(pattern, freq), nil
+	}
+	return drp.NewDataRatePatternProvider(pattern)
+}
+
+// Lints (csv files only) and loads pattern, printing all problems.
+// Returns the exit code: 0 if the pattern can be played, 1 otherwise.
+func validatePattern(pattern string, timed bool, mahimahi bool, db_drp *datatypes.DB_data_rate_pattern) int {
+	failed := false
+	if drp.IsFileIdentifier(pattern) && !mahimahi {
+		params := drp.DefaultLintParams()
+		params.Timed = timed
+		params.MinRateKbits = db_drp.Intial_minRateKbits
+		diags, err := drp.Lint(pattern, params)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		for _, d := range diags {
+			fmt.Println(d)
+		}
+		failed = drp.HasLintDiagnostics(diags, drp.LINT_ERROR)
+	}
+	if drp.IsStreamIdentifier(pattern) {
+		//Providing would start listening
+		if _, err := drp.NewDataRatePatternStreamProvider(pattern); err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		fmt.Printf("%s: OK\n", pattern)
+		return 0
+	}
+	provider, err := newProvider(pattern, timed, mahimahi, db_drp.Freq)
+	if err == nil {
+		if err = db_drp.ParseDRP(provider); err == nil {
+			err = db_drp.Validate()
+		}
+	}
+	if err != nil {
+		fmt.Printf("%s: %s\n", pattern, err)
+		failed = true
+	}
+	if failed {
+		return 1
+	}
+	fmt.Printf("%s: OK (%s)\n", pattern, db_drp.GetHashStr())
+	return 0
 }
 
 func exithandler(player *drplay.DrpPlayer, exit chan uint8) {
@@ -143,6 +557,9 @@ func exithandler(player *drplay.DrpPlayer, exit chan uint8) {
 func main() {
 	logging.InitLogger(assets.NAME_DRPLAY)
 	INFO.Printf("===>Starting DrPlay @%s <===\n\n", time.Now().String())
+	if len(os.Args) > 1 && os.Args[1] == "doctor" {
+		os.Exit(runDoctor(os.Args[2:]))
+	}
 	var player_has_ended = make(chan uint8)
 	if err := ArgParse(); err != nil {
 		FATAL.Println("Error during Argparse")
@@ -160,6 +577,7 @@ func main() {
 		os.Exit(1)
 	}
 	player := drplay.NewDrpPlayer(session)
+	player.SetPatternLoader(swapPatternLoader)
 
 	//Todo should be done in caller, not callee
 	logging.LinkExitFunction(func() uint8 {
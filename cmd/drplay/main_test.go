@@ -32,6 +32,7 @@ import (
 	"github.com/telekom/aml-jens/internal/assets"
 	"github.com/telekom/aml-jens/internal/config"
 	"github.com/telekom/aml-jens/internal/persistence/datatypes"
+	"github.com/telekom/aml-jens/pkg/drp"
 )
 
 func preTest(t *testing.T, args []string) func() {
@@ -81,6 +82,13 @@ func TestArgParse(t *testing.T) {
 			t.Fatal(err)
 		}
 		validate(t, tests, config.PlayCfg().A_Session, post)
+		socket := filepath.Join(t.TempDir(), "rates.sock")
+		if _, err := swapPatternLoader("stream:unix:" + socket); err == nil {
+			t.Fatal("Swapping to a stream was not rejected")
+		}
+		if _, err := os.Stat(socket); !os.IsNotExist(err) {
+			t.Fatalf("Rejected swap opened the stream: %v", err)
+		}
 		post()
 	}
 
@@ -171,3 +179,61 @@ func contains(s []int, e int) bool {
 	}
 	return false
 }
+
+func TestValidatePattern(t *testing.T) {
+	for path, expected := range map[string]int{
+		filepath.Join("../../test/testdata/drp", "drp_3valleys.csv"):     0,
+		filepath.Join("../../test/testdata/drp", "broken_string.csv"):    1,
+		filepath.Join("../../test/testdata/drp", "lint", "problems.csv"): 1,
+		"gen:sine?min=12000&max=60000&period=30s":                        0,
+		"stream:stdin?underrun=drop":                                     1,
+	} {
+		db_drp := datatypes.NewDB_data_rate_pattern()
+		db_drp.Freq = 10
+		if got := validatePattern(path, false, false, db_drp); got != expected {
+			t.Fatalf("Expected exit code %d for %s, got %d", expected, path, got)
+		}
+	}
+}
+
+func TestAddUe_sharedDev(t *testing.T) {
+	pattern := "gen:sine?min=1000&max=5000"
+	newSession := func() *datatypes.DB_session {
+		session := &datatypes.DB_session{Dev: "veth0", IfbDev: "ifb0", ChildDRP: datatypes.NewDB_data_rate_pattern()}
+		session.ChildDRP.Freq = 10
+		session.ChildDRPDownlink = session.ChildDRP
+		return session
+	}
+	for _, spec := range []string{
+		"dev=veth0,pattern=" + pattern,
+		"dev=ifb0,pattern=" + pattern,
+		"dev=veth1,pattern=" + pattern + ",dlpattern=" + pattern + ",ifb=ifb0",
+		"dev=veth1,pattern=" + pattern + ",dlpattern=" + pattern + ",ifb=veth1",
+	} {
+		if err := addUe(newSession(), spec, false, false, drp.PlaybackMode{}); err == nil {
+			t.Fatalf("Expected error for '%s'", spec)
+		}
+	}
+	session := newSession()
+	if err := addUe(session, "dev=veth1,pattern="+pattern+",dlpattern="+pattern, false, false, drp.PlaybackMode{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := addUe(session, "dev=ifb1,pattern="+pattern, false, false, drp.PlaybackMode{}); err == nil {
+		t.Fatal("Expected error for the ifb of ue1")
+	}
+}
+
+func TestParseUeSpec(t *testing.T) {
+	values, err := parseUeSpec("dev=veth1,pattern=gen:sine?min=1000&max=5000,markfree=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values["dev"] != "veth1" || values["pattern"] != "gen:sine?min=1000&max=5000" || values["markfree"] != "2" {
+		t.Fatalf("Unexpected values %v", values)
+	}
+	for _, spec := range []string{"dev=veth1", "dev=veth1,pattern=", "pattern=a.csv,rate=5", "pattern=a.csv,veth1"} {
+		if _, err := parseUeSpec(spec); err == nil {
+			t.Fatalf("Expected error for '%s'", spec)
+		}
+	}
+}
@@ -36,6 +36,7 @@ import (
 	"github.com/telekom/aml-jens/internal/assets/paths"
 	"github.com/telekom/aml-jens/internal/config"
 	"github.com/telekom/aml-jens/internal/logging"
+	"github.com/telekom/aml-jens/internal/persistence/datatypes"
 )
 
 const (
@@ -47,6 +48,8 @@ const (
 	i_drop
 	i_prio
 	i_netw
+	i_direction
+	i_ue
 )
 const (
 	in_src = iota
@@ -275,11 +278,12 @@ func skipToMeasures(r *bufio.Reader, c chan *[]string) {
 	}
 }
 
+// Accepts the heading with or without the direction and ue columns (older drplay versions)
 func isMagicHeader(arr []string) bool {
-	if len(arr) != len(assets.CONST_HEADING) {
+	if len(arr) < i_direction || len(arr) > len(assets.CONST_HEADING) {
 		return false
 	}
-	for i, v := range assets.CONST_HEADING {
+	for i, v := range assets.CONST_HEADING[:len(arr)] {
 		if v != arr[i] {
 			return false
 		}
@@ -300,7 +304,18 @@ func (manager *FlowManager) ReadFromLine(line string) bool {
 		}
 		return i
 	}
-	if len(splitData) != len(assets.CONST_HEADING) {
+	direction := datatypes.DIRECTION_UPLINK
+	ue := 0
+	switch len(splitData) {
+	case len(assets.CONST_HEADING):
+		direction = splitData[i_direction]
+		ue = int(parseFloat(splitData[i_ue]))
+	case i_ue:
+		//Line without ue
+		direction = splitData[i_direction]
+	case i_direction:
+		//Line without direction
+	default:
 		INFO.Printf("Invalid Line format. Wrong length (%d):'%s'\n", len(splitData), line)
 		return false
 	}
@@ -313,6 +328,8 @@ func (manager *FlowManager) ReadFromLine(line string) bool {
 		net_data[in_src],
 		net_data[in_dst],
 		splitData[i_prio],
+		direction,
+		ue,
 	)
 	//manager.Mutex.Lock()
 	if !manager.Contains(f) {
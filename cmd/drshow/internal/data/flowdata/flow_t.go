@@ -32,6 +32,7 @@ import (
 
 	"github.com/telekom/aml-jens/internal/assets"
 	"github.com/telekom/aml-jens/internal/config"
+	"github.com/telekom/aml-jens/internal/persistence/datatypes"
 )
 
 type NetEndPoint struct {
@@ -70,6 +71,10 @@ type FlowT struct {
 	Dst    NetEndPoint
 	FlowId int32 //Relic of the past. used for id-ing. set by manager!
 	Prio   int
+	//uplink or downlink
+	Direction string
+	//UE the flow was shaped by
+	Ue int
 }
 
 func (s *FlowT) Color() uint8 {
@@ -84,13 +89,26 @@ func (s *FlowT) identifier() string {
 	return fmt.Sprintf("%s-%s", s.Src.Str(), s.Dst.Str())
 }
 
+// Returns identifier, prefixed by the direction for downlink flows
+// and by the UE for flows of additional UEs
+func (s *FlowT) Name() string {
+	name := s.identifier()
+	if s.Direction == datatypes.DIRECTION_DOWNLINK {
+		name = fmt.Sprintf("%s:%s", s.Direction, name)
+	}
+	if s.Ue > 0 {
+		name = fmt.Sprintf("ue%d:%s", s.Ue, name)
+	}
+	return name
+}
+
 func (self *FlowT) hasCombinedLoadGreater1() bool {
 	return self.D.HasLoadGreater1
 }
 
 func (self *FlowT) ExportToFile(path string) error {
 
-	file_name := fmt.Sprintf(assets.DRSHOW_EXPORT_PATH_NAME, self.identifier(), time.Now().Round(time.Second).Format("2006-01-02_15-04-05"))
+	file_name := fmt.Sprintf(assets.DRSHOW_EXPORT_PATH_NAME, self.Name(), time.Now().Round(time.Second).Format("2006-01-02_15-04-05"))
 	file_name, _ = filepath.Abs(filepath.Join(config.ShowCfg().ExportPathPrefix, file_name))
 	INFO.Printf("Trying to export [%s] to %s\n", self.identifier(), file_name)
 	var file *os.File
@@ -119,6 +137,8 @@ func (self *FlowT) ExportToFile(path string) error {
 		line[i_load] = fmt.Sprint(int64((*self.D.Load)[i]))
 		line[i_sojourntime] = fmt.Sprint(int64((*self.D.Sojourn)[i]))
 		line[i_prio] = fmt.Sprint(self.Prio)
+		line[i_direction] = self.Direction
+		line[i_ue] = fmt.Sprint(self.Ue)
 		if err = csvWriter.Write(line); err != nil {
 			return err
 		}
@@ -130,27 +150,31 @@ func (self *FlowT) ExportToFile(path string) error {
 
 func (self *FlowT) FmtString() string {
 	return fmt.Sprintf(
-		"FlowId:\n------------\nSrc:%s\nDst:%s\nSamples:%d",
+		"FlowId:\n------------\nSrc:%s\nDst:%s\nDirection:%s\nUE:%d\nSamples:%d",
 		self.Src.Str(),
 		self.Dst.Str(),
+		self.Direction,
+		self.Ue,
 		self.D.Length(),
 	)
 }
 
-func NewFlow(src string, dst string, prio string) *FlowT {
+func NewFlow(src string, dst string, prio string, direction string, ue int) *FlowT {
 	p, err := strconv.Atoi(prio)
 	if err != nil {
 		p = 9
 	}
 
 	return &FlowT{
-		Src:  *NewNetEndPointFromString(src),
-		Dst:  *NewNetEndPointFromString(dst),
-		D:    *NewFlowDataPoints(),
-		Prio: p}
+		Src:       *NewNetEndPointFromString(src),
+		Dst:       *NewNetEndPointFromString(dst),
+		D:         *NewFlowDataPoints(),
+		Prio:      p,
+		Direction: direction,
+		Ue:        ue}
 }
 
 func (self *FlowT) Equals(other *FlowT) bool {
 	return other != nil && self.Src.Equals(&other.Src) &&
-		self.Dst.Equals(&other.Dst)
+		self.Dst.Equals(&other.Dst) && self.Direction == other.Direction && self.Ue == other.Ue
 }
@@ -24,10 +24,13 @@ package drp
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/telekom/aml-jens/cmd/drshow/internal/data/channel"
 	"github.com/telekom/aml-jens/internal/logging"
 	"github.com/telekom/aml-jens/internal/util"
+	"github.com/telekom/aml-jens/pkg/drp"
 
 	"github.com/mum4k/termdash/cell"
 	"github.com/mum4k/termdash/terminal/terminalapi"
@@ -36,6 +39,39 @@ import (
 
 var DEBUG, INFO, WARN, FATAL = logging.GetLogger()
 
+// Like util.FormatLabelISOKilo, also for negative numbers
+func formatSignedKilo(nbr float64) string {
+	if nbr < 0 {
+		return "-" + util.FormatLabelISOKilo(-nbr)
+	}
+	return util.FormatLabelISOKilo(nbr)
+}
+
+// Formats the stats not already shown (min, max, avg).
+// Only the 5th, 50th and 95th percentile are shown.
+func formatStats(stats drp.DataRatePatternStats) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "StdDev:  %s\nCV:      %.2f\n", util.FormatLabelISOKilo(stats.StdDev), stats.CV)
+	for _, p := range stats.Percentiles {
+		if p.P == 5 || p.P == 50 || p.P == 95 {
+			fmt.Fprintf(&b, "P%-7s %s\n", strconv.FormatFloat(p.P, 'f', -1, 64)+":", util.FormatLabelISOKilo(p.Value))
+		}
+	}
+	for _, a := range stats.Autocorrelation {
+		fmt.Fprintf(&b, "%-8s %.2f\n", fmt.Sprintf("ACF(%d):", a.Lag), a.Value)
+	}
+	fmt.Fprintf(&b, "Valleys: %d below %s\n", stats.Valleys, util.FormatLabelISOKilo(stats.ValleyThreshold))
+	fmt.Fprintf(&b, "  len:   avg %.1f, max %d\n", stats.ValleyAvgLength, stats.ValleyMaxLength)
+	fmt.Fprintf(&b, "Change:  avg %s\n", util.FormatLabelISOKilo(stats.RateOfChange.MeanAbs))
+	fmt.Fprintf(&b, "  rise:  %s, drop: %s\n", util.FormatLabelISOKilo(stats.RateOfChange.MaxRise), util.FormatLabelISOKilo(stats.RateOfChange.MaxDrop))
+	for _, p := range stats.RateOfChange.Percentiles {
+		if p.P == 5 || p.P == 95 {
+			fmt.Fprintf(&b, "  P%-5s %s\n", strconv.FormatFloat(p.P, 'f', -1, 64)+":", formatSignedKilo(p.Value))
+		}
+	}
+	return b.String()
+}
+
 func NewDrpDetailsTextBox(ctx context.Context, t terminalapi.Terminal, chans *channel.DrpChannels) (*text.Text, error) {
 	wrapped, err := text.New(text.WrapAtRunes())
 	if err != nil {
@@ -49,7 +85,7 @@ func NewDrpDetailsTextBox(ctx context.Context, t terminalapi.Terminal, chans *ch
 			select {
 			case drp := <-chans.UpdateDrpDetails:
 				wrapped.Reset()
-				err := wrapped.Write(fmt.Sprintf("Pattern: %s\nSamples: %d\nMinimum: %s\nMaximum: %s\nAverage: %s\nPath:    %s", drp.Name, drp.SampleCount(), util.FormatLabelISOKilo(drp.Min), util.FormatLabelISOKilo(drp.Max), util.FormatLabelISOKilo(drp.Avg), drp.GetOrigin()))
+				err := wrapped.Write(fmt.Sprintf("Pattern: %s\nSamples: %d\nMinimum: %s\nMaximum: %s\nAverage: %s\n%sPath:    %s", drp.Name, drp.SampleCount(), util.FormatLabelISOKilo(drp.Min), util.FormatLabelISOKilo(drp.Max), util.FormatLabelISOKilo(drp.Avg), formatStats(drp.Stats()), drp.GetOrigin()))
 				if err != nil {
 					WARN.Println(err)
 				}
@@ -73,7 +73,7 @@ func (s *wids) Layout() ([]container.Option, error) {
 			},
 				grid.Widget(s.info),
 			),
-			grid.RowHeightFixedWithOpts(10, []container.Option{
+			grid.RowHeightFixedWithOpts(24, []container.Option{
 				container.Border(linestyle.Light),
 				container.BorderTitle("Pattern Information"),
 				container.BorderTitleAlignCenter(),
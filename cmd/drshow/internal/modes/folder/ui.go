@@ -92,7 +92,7 @@ func (s *wids) Layout(patterns *drp.DrpListT) ([]container.Option, error) {
 			},
 				grid.Widget(s.infoBox),
 			),
-			grid.RowHeightFixedWithOpts(8, []container.Option{
+			grid.RowHeightFixedWithOpts(16, []container.Option{
 				container.Border(linestyle.Light),
 				container.BorderTitle("Pattern Information"),
 				container.BorderTitleAlignCenter(),
@@ -24,14 +24,15 @@ package assets
 import "log"
 
 const (
-	NAME_DRPLAY   = "DrPlay"
-	NAME_DRSHOW   = "DrShow"
-	NAME_DRBENCH  = "DrBenchmark"
-	LOG_PRE_DEBUG = "[DEBUG] "
-	LOG_PRE_INFO  = "[INFO] "
-	LOG_PRE_WARN  = "[WARN] "
-	LOG_PRE_FATAL = "[FATAL] "
-	LOG_SETTING   = log.Ldate | log.Ltime | log.Lmicroseconds | log.Lshortfile | log.Lmsgprefix
+	NAME_DRPLAY    = "DrPlay"
+	NAME_DRSHOW    = "DrShow"
+	NAME_DRBENCH   = "DrBenchmark"
+	NAME_DRPATTERN = "DrPattern"
+	LOG_PRE_DEBUG  = "[DEBUG] "
+	LOG_PRE_INFO   = "[INFO] "
+	LOG_PRE_WARN   = "[WARN] "
+	LOG_PRE_FATAL  = "[FATAL] "
+	LOG_SETTING    = log.Ldate | log.Ltime | log.Lmicroseconds | log.Lshortfile | log.Lmsgprefix
 )
 
 const (
@@ -42,13 +43,14 @@ const (
 // Heading for stdout of drplay --> stdin for drshow.pipe
 //
 // [timestamp, soj, load, ...]
-var CONST_HEADING = []string{"timestampMs", "sojournTimeMs", "loadKbits", "capacityKbits", "ecnCePercent", "dropped", "prio", "netflow"}
+var CONST_HEADING = []string{"timestampMs", "sojournTimeMs", "loadKbits", "capacityKbits", "ecnCePercent", "dropped", "prio", "netflow", "direction", "ue"}
 
 var END_OF_DRPLAY = [...]string{"data", "rate", "player", "ended"}
 
 const (
 	NFT_TABLE_PREMARK = "premarkect1"
 	NFT_TABLE_SIGNAL  = "signalect0"
+	NFT_TABLE_LOSS    = "sampleloss"
 	NFT_CHAIN_FORWARD = "forward"
 	NFT_CHAIN_OUTPUT  = "output"
 )
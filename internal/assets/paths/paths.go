@@ -47,6 +47,20 @@ func RELEASE_CFG_PATH() string {
 	return "/etc/jens-cli/"
 }
 
+var library_path = "/etc/jens-cli/library/"
+
+// "/etc/jens-cli/library/"
+//
+//go:inline
+func LIBRARY_PATH() string {
+	return library_path
+}
+
+//go:inline
+func LIBRARY_PATH_UPDATE(p string) {
+	library_path = p
+}
+
 var testdata = ""
 
 // Only to be used in tests
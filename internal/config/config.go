@@ -67,6 +67,7 @@ func (c *config) readFromFile() error {
 		Qosmode:             uint8(viper.GetInt("tccommands.qosmode")),
 		L4sEnablePreMarking: viper.GetBool("tccommands.l4sEnabledPreMarking"),
 		SignalDrpStart:      viper.GetBool("tccommands.signalDrpStart"),
+		Backend:             viper.GetString("tccommands.backend"),
 		//DRP
 		ChildDRP: drp,
 		ParentBenchmark: &datatypes.DB_benchmark{
@@ -132,6 +133,7 @@ func (c *config) setToDefaults() {
 		Qosmode:             0,
 		L4sEnablePreMarking: false,
 		SignalDrpStart:      false,
+		Backend:             "janz",
 		//DRP
 		ChildDRP: drp,
 		ParentBenchmark: &datatypes.DB_benchmark{
@@ -176,6 +178,17 @@ func (c *config) setToDefaults() {
 	}
 }
 
+// Reads the config file in dir without applying it.
+// Returns the file found and an error if there is none
+// (viper.ConfigFileNotFoundError) or it can't be parsed.
+func CheckConfigFile(dir string) (string, error) {
+	v := viper.New()
+	v.SetConfigName(assets.CFG_FILE_NAME)
+	v.AddConfigPath(dir)
+	err := v.ReadInConfig()
+	return v.ConfigFileUsed(), err
+}
+
 func cfgIntDefault(key string, def int) int {
 	res := viper.GetInt(key)
 	if res == 0 {
@@ -0,0 +1,305 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Package netlink is a minimal client for rtnetlink and nftables netlink,
+// used to configure qdiscs, links and nft rules without shelling out to ip, tc and nft.
+package netlink
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// Time to wait for the kernel to answer a request
+const RECEIVE_TIMEOUT = 2 * time.Second
+
+const (
+	NLA_F_NESTED        = 0x8000
+	NLA_F_NET_BYTEORDER = 0x4000
+	nla_type_mask       = ^uint16(NLA_F_NESTED | NLA_F_NET_BYTEORDER)
+)
+
+// Byte order of netlink headers and of most rtnetlink attributes
+var native binary.ByteOrder = func() binary.ByteOrder {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}()
+
+// Error is returned if the kernel rejects a request or the socket fails
+type Error struct {
+	Op    string
+	Errno syscall.Errno
+}
+
+func (e *Error) Error() string { return fmt.Sprintf("netlink %s: %s", e.Op, e.Errno.Error()) }
+func (e *Error) Unwrap() error { return e.Errno }
+
+// VerifyError is returned if the state read back from the kernel
+// differs from the one that was configured
+type VerifyError struct {
+	Object string
+	Want   string
+	Got    string
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("netlink verify %s: want %s, got %s", e.Object, e.Want, e.Got)
+}
+
+// Returns true if err reports a missing qdisc, link, table etc.
+func IsNotExist(err error) bool {
+	return errors.Is(err, syscall.ENOENT) || errors.Is(err, syscall.ENODEV)
+}
+
+func newError(op string, err error) error {
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		return &Error{Op: op, Errno: errno}
+	}
+	return fmt.Errorf("netlink %s: %w", op, err)
+}
+
+// A netlink attribute, data excludes the header
+type attribute struct {
+	typ  uint16
+	data []byte
+}
+
+func attr(typ uint16, data []byte) attribute { return attribute{typ, data} }
+
+func stringAttr(typ uint16, s string) attribute { return attribute{typ, append([]byte(s), 0)} }
+
+func u32Attr(typ uint16, v uint32) attribute {
+	b := make([]byte, 4)
+	native.PutUint32(b, v)
+	return attribute{typ, b}
+}
+
+func be32Attr(typ uint16, v uint32) attribute {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return attribute{typ, b}
+}
+
+func nested(typ uint16, attrs ...attribute) attribute {
+	return attribute{typ | NLA_F_NESTED, encodeAttrs(attrs...)}
+}
+
+func align(n int) int { return (n + 3) &^ 3 }
+
+func encodeAttrs(attrs ...attribute) []byte {
+	var b []byte
+	for _, a := range attrs {
+		l := 4 + len(a.data)
+		buf := make([]byte, align(l))
+		native.PutUint16(buf[0:2], uint16(l))
+		native.PutUint16(buf[2:4], a.typ)
+		copy(buf[4:], a.data)
+		b = append(b, buf...)
+	}
+	return b
+}
+
+// Decodes a list of attributes, flags are stripped from their types
+func decodeAttrs(b []byte) ([]attribute, error) {
+	var attrs []attribute
+	for len(b) >= 4 {
+		l := int(native.Uint16(b[0:2]))
+		if l < 4 || l > len(b) {
+			return nil, fmt.Errorf("netlink: malformed attribute of length %d", l)
+		}
+		attrs = append(attrs, attribute{native.Uint16(b[2:4]) & nla_type_mask, b[4:l]})
+		if align(l) >= len(b) {
+			break
+		}
+		b = b[align(l):]
+	}
+	return attrs, nil
+}
+
+func attrString(data []byte) string {
+	for i, c := range data {
+		if c == 0 {
+			return string(data[:i])
+		}
+	}
+	return string(data)
+}
+
+// A request to the kernel, nlmsghdr is added on send
+type message struct {
+	typ   uint16
+	flags uint16
+	data  []byte
+}
+
+// Conn is a netlink socket of one protocol
+type Conn struct {
+	fd  int
+	seq uint32
+}
+
+// Opens a netlink socket of protocol, e.g. syscall.NETLINK_ROUTE
+func Dial(protocol int) (*Conn, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, protocol)
+	if err != nil {
+		return nil, newError("socket", err)
+	}
+	tv := syscall.NsecToTimeval(RECEIVE_TIMEOUT.Nanoseconds())
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv); err != nil {
+		syscall.Close(fd)
+		return nil, newError("setsockopt", err)
+	}
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		syscall.Close(fd)
+		return nil, newError("bind", err)
+	}
+	return &Conn{fd: fd, seq: uint32(time.Now().Unix())}, nil
+}
+
+func (c *Conn) Close() error {
+	return syscall.Close(c.fd)
+}
+
+// Encodes msgs into one buffer, returning the sequence number of each
+func (c *Conn) encode(msgs []message) ([]byte, []uint32) {
+	var b []byte
+	seqs := make([]uint32, len(msgs))
+	for i, m := range msgs {
+		c.seq++
+		seqs[i] = c.seq
+		hdr := make([]byte, syscall.NLMSG_HDRLEN)
+		native.PutUint32(hdr[0:4], uint32(syscall.NLMSG_HDRLEN+len(m.data)))
+		native.PutUint16(hdr[4:6], m.typ)
+		native.PutUint16(hdr[6:8], m.flags|syscall.NLM_F_REQUEST)
+		native.PutUint32(hdr[8:12], c.seq)
+		b = append(b, hdr...)
+		b = append(b, m.data...)
+		b = append(b, make([]byte, align(len(m.data))-len(m.data))...)
+	}
+	return b, seqs
+}
+
+func (c *Conn) send(op string, msgs []message) ([]uint32, error) {
+	b, seqs := c.encode(msgs)
+	if err := syscall.Sendto(c.fd, b, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return nil, newError(op, err)
+	}
+	return seqs, nil
+}
+
+func (c *Conn) receive(op string) ([]syscall.NetlinkMessage, error) {
+	b := make([]byte, 1<<16)
+	n, _, err := syscall.Recvfrom(c.fd, b, 0)
+	if err != nil {
+		return nil, newError(op, err)
+	}
+	msgs, err := syscall.ParseNetlinkMessage(b[:n])
+	if err != nil {
+		return nil, newError(op, err)
+	}
+	return msgs, nil
+}
+
+// Returns the error carried by an NLMSG_ERROR message, nil for an ack
+func ackError(op string, m syscall.NetlinkMessage) error {
+	if len(m.Data) < 4 {
+		return &Error{Op: op, Errno: syscall.EBADMSG}
+	}
+	if code := int32(native.Uint32(m.Data[0:4])); code != 0 {
+		return &Error{Op: op, Errno: syscall.Errno(-code)}
+	}
+	return nil
+}
+
+// Sends msgs in one write and waits for the ack of each message
+// flagged NLM_F_ACK. Returns the first error reported by the kernel.
+func (c *Conn) execute(op string, msgs ...message) error {
+	seqs, err := c.send(op, msgs)
+	if err != nil {
+		return err
+	}
+	pending := map[uint32]bool{}
+	for i, m := range msgs {
+		if m.flags&syscall.NLM_F_ACK != 0 {
+			pending[seqs[i]] = true
+		}
+	}
+	var first error
+	for len(pending) > 0 {
+		replies, err := c.receive(op)
+		if err != nil {
+			//After a fatal error the kernel does not ack the remaining messages
+			if first != nil {
+				return first
+			}
+			return err
+		}
+		for _, m := range replies {
+			if !pending[m.Header.Seq] || m.Header.Type != syscall.NLMSG_ERROR {
+				continue
+			}
+			delete(pending, m.Header.Seq)
+			if err := ackError(op, m); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+// Sends a dump request and returns the payload of every reply
+func (c *Conn) dump(op string, m message) ([][]byte, error) {
+	m.flags |= syscall.NLM_F_DUMP
+	seqs, err := c.send(op, []message{m})
+	if err != nil {
+		return nil, err
+	}
+	var payloads [][]byte
+	for {
+		replies, err := c.receive(op)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range replies {
+			if r.Header.Seq != seqs[0] {
+				continue
+			}
+			switch r.Header.Type {
+			case syscall.NLMSG_DONE:
+				return payloads, nil
+			case syscall.NLMSG_ERROR:
+				if err := ackError(op, r); err != nil {
+					return nil, err
+				}
+			default:
+				payloads = append(payloads, r.Data)
+			}
+		}
+	}
+}
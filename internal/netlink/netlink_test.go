@@ -0,0 +1,308 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package netlink
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestAttrs(t *testing.T) {
+	b := encodeAttrs(stringAttr(1, "ifb"), nested(2, be32Attr(3, 0x01020304)))
+	expected := []byte{
+		8, 0, 1, 0, 'i', 'f', 'b', 0,
+		12, 0, 2, 0x80, 8, 0, 3, 0, 1, 2, 3, 4,
+	}
+	if native.Uint16([]byte{1, 0}) != 1 {
+		t.Skip("expected bytes are little endian")
+	}
+	if !bytes.Equal(b, expected) {
+		t.Fatalf("Unexpected encoding %v", b)
+	}
+	attrs, err := decodeAttrs(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attrs) != 2 || attrs[1].typ != 2 || attrString(attrs[0].data) != "ifb" {
+		t.Fatalf("Unexpected decoding %+v", attrs)
+	}
+	if _, err := decodeAttrs([]byte{2, 0, 1, 0}); err == nil {
+		t.Fatal("Malformed attribute was decoded")
+	}
+}
+
+func TestQdiscEncoding(t *testing.T) {
+	q := Qdisc{Ifindex: 3, Handle: MakeHandle(0x8001, 0), Parent: TC_H_ROOT, Kind: "netem"}
+	got, err := decodeQdisc(q.encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != q {
+		t.Fatalf("Decoded %+v, expected %+v", got, q)
+	}
+	if s := q.String(); s != "netem 8001:0 parent root" {
+		t.Fatalf("Unexpected string %s", s)
+	}
+}
+
+// Returns the attributes of a by type, failing t if they can't be decoded
+func attrsByType(t *testing.T, b []byte) map[uint16][]byte {
+	attrs, err := decodeAttrs(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := make(map[uint16][]byte)
+	for _, a := range attrs {
+		res[a.typ] = a.data
+	}
+	return res
+}
+
+func TestNetemOptions(t *testing.T) {
+	opts := NetemOptions{
+		Limit:     1000,
+		Latency:   20 * time.Millisecond,
+		Jitter:    time.Millisecond,
+		DelayDist: []int16{-8192, 0, 8192},
+		GE:        &NetemGEModel{P: 0.5, R: 1, LossBad: 1},
+	}
+	a := opts.encode()
+	if a.typ != TCA_OPTIONS || len(a.data) < tc_netem_qopt_len {
+		t.Fatalf("Unexpected options attribute %d of length %d", a.typ, len(a.data))
+	}
+	qopt := a.data[:tc_netem_qopt_len]
+	if native.Uint32(qopt[0:4]) != 20000000>>psched_shift || native.Uint32(qopt[4:8]) != 1000 ||
+		native.Uint32(qopt[8:12]) != 0 || native.Uint32(qopt[20:24]) != 1000000>>psched_shift {
+		t.Fatalf("Unexpected tc_netem_qopt %v", qopt)
+	}
+	attrs := attrsByType(t, a.data[tc_netem_qopt_len:])
+	if native.Uint64(attrs[TCA_NETEM_LATENCY64]) != 20000000 || native.Uint64(attrs[TCA_NETEM_JITTER64]) != 1000000 {
+		t.Fatalf("Unexpected latency %v, jitter %v", attrs[TCA_NETEM_LATENCY64], attrs[TCA_NETEM_JITTER64])
+	}
+	if dist := attrs[TCA_NETEM_DELAY_DIST]; len(dist) != 6 || int16(native.Uint16(dist[0:2])) != -8192 {
+		t.Fatalf("Unexpected distribution %v", dist)
+	}
+	ge := attrsByType(t, attrs[TCA_NETEM_LOSS])[NETEM_LOSS_GE]
+	if len(ge) != 16 || native.Uint32(ge[0:4]) != math.MaxUint32/2+1 || native.Uint32(ge[4:8]) != math.MaxUint32 ||
+		native.Uint32(ge[8:12]) != 0 || native.Uint32(ge[12:16]) != 0 {
+		t.Fatalf("Unexpected gemodel %v", ge)
+	}
+	//Random loss is set in the qopt, without a loss model
+	a = NetemOptions{Loss: 1}.encode()
+	if native.Uint32(a.data[8:12]) != math.MaxUint32 {
+		t.Fatalf("Unexpected loss %v", a.data[8:12])
+	}
+	if _, ok := attrsByType(t, a.data[tc_netem_qopt_len:])[TCA_NETEM_LOSS]; ok {
+		t.Fatal("Random loss has a loss model")
+	}
+}
+
+func TestJanzOptions(t *testing.T) {
+	a := JanzOptions{Rate: 625000, Limit: 100, Markfree: 4 * time.Millisecond, Markfull: 14 * time.Millisecond}.encode()
+	if a.typ != TCA_OPTIONS|NLA_F_NESTED {
+		t.Fatalf("Unexpected options attribute %x", a.typ)
+	}
+	attrs := attrsByType(t, a.data)
+	if native.Uint64(attrs[TCA_JANZ_RATE64]) != 625000 || native.Uint32(attrs[TCA_JANZ_LIMIT]) != 100 ||
+		native.Uint32(attrs[TCA_JANZ_MARKFREE]) != 4000 || native.Uint32(attrs[TCA_JANZ_MARKFULL]) != 14000 {
+		t.Fatalf("Unexpected attributes %v", attrs)
+	}
+	//Options of 0 are sent, so a change to 0 is applied
+	for _, typ := range []uint16{TCA_JANZ_QOSMODE, TCA_JANZ_XLATENCY} {
+		if v, ok := attrs[typ]; !ok || native.Uint32(v) != 0 {
+			t.Fatalf("Attribute %d is %v, expected 0", typ, v)
+		}
+	}
+	if _, ok := attrsByType(t, JanzOptions{}.encode().data)[TCA_JANZ_LIMIT]; ok {
+		t.Fatal("Limit 0 was sent")
+	}
+}
+
+func TestTableMessages(t *testing.T) {
+	chains := []Chain{{"forward", NF_INET_FORWARD, 0}, {"output", NF_INET_LOCAL_OUT, 0}}
+	rules := []Rule{{"forward", append(MatchOifname("eth0"), Drop()...)}}
+	msgs := batch(tableMessages("t", chains, rules)...)
+	types := []uint16{
+		NFNL_MSG_BATCH_BEGIN,
+		NFNL_SUBSYS_NFTABLES<<8 | NFT_MSG_NEWTABLE,
+		NFNL_SUBSYS_NFTABLES<<8 | NFT_MSG_NEWCHAIN,
+		NFNL_SUBSYS_NFTABLES<<8 | NFT_MSG_NEWCHAIN,
+		NFNL_SUBSYS_NFTABLES<<8 | NFT_MSG_NEWRULE,
+		NFNL_MSG_BATCH_END,
+	}
+	if len(msgs) != len(types) {
+		t.Fatalf("Got %d messages, expected %d", len(msgs), len(types))
+	}
+	for i, m := range msgs {
+		if m.typ != types[i] {
+			t.Fatalf("Message %d has type %x, expected %x", i, m.typ, types[i])
+		}
+	}
+	if msgs[0].flags&syscall.NLM_F_ACK != 0 || msgs[4].flags&syscall.NLM_F_ACK == 0 {
+		t.Fatal("Only the messages inside the batch are acked")
+	}
+	if s := rules[0].String(); s != "forward: meta cmp immediate" {
+		t.Fatalf("Unexpected rule %s", s)
+	}
+}
+
+// Skips the test if the kernel does not allow to configure links, e.g. not root
+func skipUnlessPermitted(t *testing.T, err error) {
+	if errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.EOPNOTSUPP) || errors.Is(err, syscall.EPROTONOSUPPORT) {
+		t.Skipf("Not permitted: %v", err)
+	}
+}
+
+func TestKernelRedirect(t *testing.T) {
+	c, err := DialRoute()
+	if err != nil {
+		t.Skip(err)
+	}
+	defer c.Close()
+	err = c.AddLink("jens_nl0", "ifb")
+	skipUnlessPermitted(t, err)
+	if err != nil {
+		t.Skip(err)
+	}
+	dev, _ := LinkIndex("jens_nl0")
+	defer c.DeleteLink(dev)
+	if err := c.AddLink("jens_nl1", "ifb"); err != nil {
+		t.Fatal(err)
+	}
+	target, _ := LinkIndex("jens_nl1")
+	defer c.DeleteLink(target)
+	if err := c.SetLinkUp(target); err != nil {
+		t.Fatal(err)
+	}
+	ingress := Qdisc{Ifindex: dev, Handle: MakeHandle(0xffff, 0), Parent: TC_H_INGRESS, Kind: "ingress"}
+	if err := c.AddQdisc(ingress); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.VerifyQdisc(ingress); err != nil {
+		t.Fatal(err)
+	}
+	var verr *VerifyError
+	if err := c.VerifyQdisc(Qdisc{Ifindex: dev, Handle: ingress.Handle, Parent: TC_H_ROOT, Kind: "ingress"}); !errors.As(err, &verr) {
+		t.Fatalf("Expected a VerifyError, got %v", err)
+	}
+	if err := c.AddRedirectFilter(dev, ingress.Handle, target); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.VerifyFilter(dev, ingress.Handle, "u32"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteQdisc(Qdisc{Ifindex: dev, Parent: TC_H_INGRESS}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteQdisc(Qdisc{Ifindex: dev, Parent: TC_H_ROOT}); !IsNotExist(err) {
+		t.Fatalf("Expected a missing qdisc, got %v", err)
+	}
+	netem := Qdisc{Ifindex: dev, Handle: MakeHandle(0x8001, 0), Parent: TC_H_ROOT, Kind: "netem"}
+	if err := c.ChangeQdisc(netem, NetemOptions{Limit: 1000}); !IsNotExist(err) {
+		t.Fatalf("Expected a missing qdisc, got %v", err)
+	}
+}
+
+func TestKernelTable(t *testing.T) {
+	c, err := DialNftables()
+	if err != nil {
+		t.Skip(err)
+	}
+	defer c.Close()
+	const table = "jens_nl_test"
+	err = c.DeleteTable(table)
+	skipUnlessPermitted(t, err)
+	if err != nil && !IsNotExist(err) {
+		t.Skip(err)
+	}
+	chains := []Chain{{"forward", NF_INET_FORWARD, 0}, {"output", NF_INET_LOCAL_OUT, 0}}
+	var rules []Rule
+	for _, chain := range chains {
+		rules = append(rules,
+			Rule{chain.Name, append(append(MatchOifname("jens_nl0"), MatchIPv4()...), SetIPv4ECN(1)...)},
+			Rule{chain.Name, append(append(MatchOifname("jens_nl0"), MatchRandomBelow(1000000, 1000)...), Drop()...)})
+	}
+	if err := c.CreateTable(table, chains, rules); err != nil {
+		t.Fatal(err)
+	}
+	defer c.DeleteTable(table)
+	if err := c.VerifyRules(table, rules); err != nil {
+		t.Fatal(err)
+	}
+	//A failing message aborts the whole transaction
+	broken := append(rules, Rule{"missing", Drop()})
+	if err := c.CreateTable(table+"_broken", chains, broken); !IsNotExist(err) {
+		t.Fatalf("Expected a missing chain, got %v", err)
+	}
+	if got, err := c.Rules(table + "_broken"); err != nil || len(got) != 0 {
+		t.Fatalf("Aborted transaction left %v, %v", got, err)
+	}
+	if err := c.ReplaceTable(table, chains, broken); !IsNotExist(err) {
+		t.Fatalf("Expected a missing chain, got %v", err)
+	}
+	if err := c.VerifyRules(table, rules); err != nil {
+		t.Fatalf("Aborted replace changed the table: %v", err)
+	}
+	if err := c.ReplaceTable(table, chains, rules[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.VerifyRules(table, rules[:1]); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestQdiscStats(t *testing.T) {
+	u32 := func(v ...uint32) []byte {
+		b := make([]byte, 4*len(v))
+		for i, x := range v {
+			native.PutUint32(b[4*i:], x)
+		}
+		return b
+	}
+	basic := append(make([]byte, 8), u32(7, 0)...)
+	native.PutUint64(basic, 1000)
+	queue := u32(2, 3000, 4, 0, 5)
+	fqCodel := u32(tca_fq_codel_xstats_qdisc, 1514, 0, 6, 1)
+	cake := encodeAttrs(nested(tca_cake_stats_tin_stats,
+		nested(1, u32Attr(tca_cake_tin_stats_ecn_marked_packet, 2)),
+		nested(2, u32Attr(tca_cake_tin_stats_ecn_marked_packet, 3))))
+	for kind, app := range map[string][]byte{"fq_codel": fqCodel, "cake": cake, "tbf": fqCodel} {
+		stats, err := decodeQdiscStats(kind, encodeAttrs(attr(TCA_STATS_BASIC, basic), attr(TCA_STATS_QUEUE, queue), attr(TCA_STATS_APP, app)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := QdiscStats{Bytes: 1000, Packets: 7, Qlen: 2, Backlog: 3000, Drops: 4, Overlimits: 5}
+		switch kind {
+		case "fq_codel":
+			expected.EcnMarks = 6
+		case "cake":
+			expected.EcnMarks = 5
+		}
+		if stats != expected {
+			t.Fatalf("%s: decoded %+v, expected %+v", kind, stats, expected)
+		}
+	}
+}
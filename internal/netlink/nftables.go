@@ -0,0 +1,367 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package netlink
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"syscall"
+)
+
+const (
+	NETLINK_NETFILTER    = 12
+	NFNL_SUBSYS_NFTABLES = 10
+	NFNL_MSG_BATCH_BEGIN = syscall.NLMSG_MIN_TYPE
+	NFNL_MSG_BATCH_END   = syscall.NLMSG_MIN_TYPE + 1
+	NFPROTO_INET         = 1
+	NFPROTO_IPV4         = 2
+	nfgenmsg_len         = 4
+)
+
+const (
+	NFT_MSG_NEWTABLE = 0
+	NFT_MSG_DELTABLE = 2
+	NFT_MSG_NEWCHAIN = 3
+	NFT_MSG_NEWRULE  = 6
+	NFT_MSG_GETRULE  = 7
+)
+
+// Hooks of the inet family
+const (
+	NF_INET_FORWARD   uint32 = 2
+	NF_INET_LOCAL_OUT uint32 = 3
+)
+
+// Attribute types, see linux/netfilter/nf_tables.h
+const (
+	nfta_table_name       = 1
+	nfta_chain_table      = 1
+	nfta_chain_name       = 3
+	nfta_chain_hook       = 4
+	nfta_chain_type       = 7
+	nfta_hook_hooknum     = 1
+	nfta_hook_priority    = 2
+	nfta_rule_table       = 1
+	nfta_rule_chain       = 2
+	nfta_rule_expressions = 4
+	nfta_list_elem        = 1
+	nfta_expr_name        = 1
+	nfta_expr_data        = 2
+	nfta_data_value       = 1
+	nfta_data_verdict     = 2
+	nfta_verdict_code     = 1
+)
+
+const (
+	nft_reg_1          = 1
+	nft_meta_oifname   = 7
+	nft_meta_nfproto   = 15
+	nft_cmp_eq         = 0
+	nft_cmp_lt         = 2
+	nft_payload_nh     = 1
+	nft_payload_csum   = 1
+	nft_ng_random      = 1
+	nft_byteorder_hton = 1
+	nf_drop            = 0
+	ifnamsiz           = 16
+)
+
+// Expr is one nftables expression of a rule
+type Expr struct {
+	Name  string
+	attrs []attribute
+}
+
+func (e Expr) encode() attribute {
+	return nested(nfta_list_elem,
+		stringAttr(nfta_expr_name, e.Name),
+		nested(nfta_expr_data, e.attrs...))
+}
+
+func dataValue(typ uint16, v []byte) attribute {
+	return nested(typ, attr(nfta_data_value, v))
+}
+
+func cmp(op uint32, v []byte) Expr {
+	return Expr{"cmp", []attribute{
+		be32Attr(1, nft_reg_1),
+		be32Attr(2, op),
+		dataValue(3, v),
+	}}
+}
+
+func meta(key uint32) Expr {
+	return Expr{"meta", []attribute{be32Attr(1, nft_reg_1), be32Attr(2, key)}}
+}
+
+// Matches packets leaving dev
+func MatchOifname(dev string) []Expr {
+	name := make([]byte, ifnamsiz)
+	copy(name, dev)
+	return []Expr{meta(nft_meta_oifname), cmp(nft_cmp_eq, name)}
+}
+
+// Matches IPv4 packets
+func MatchIPv4() []Expr {
+	return []Expr{meta(nft_meta_nfproto), cmp(nft_cmp_eq, []byte{NFPROTO_IPV4})}
+}
+
+// Sets the ECN field of IPv4 packets to ecn,
+// updating the header checksum (nft: ip ecn set)
+func SetIPv4ECN(ecn uint8) []Expr {
+	return []Expr{
+		{"payload", []attribute{
+			be32Attr(1, nft_reg_1),
+			be32Attr(2, nft_payload_nh),
+			be32Attr(3, 1),
+			be32Attr(4, 1),
+		}},
+		{"bitwise", []attribute{
+			be32Attr(1, nft_reg_1),
+			be32Attr(2, nft_reg_1),
+			be32Attr(3, 1),
+			dataValue(4, []byte{0xfc}),
+			dataValue(5, []byte{ecn & 0x3}),
+		}},
+		{"payload", []attribute{
+			be32Attr(5, nft_reg_1),
+			be32Attr(2, nft_payload_nh),
+			be32Attr(3, 1),
+			be32Attr(4, 1),
+			be32Attr(6, nft_payload_csum),
+			be32Attr(7, 10),
+			be32Attr(8, 0),
+		}},
+	}
+}
+
+// Matches if a random number in [0,modulus) is below threshold
+// (nft: numgen random mod modulus < threshold)
+func MatchRandomBelow(modulus uint32, threshold uint32) []Expr {
+	v := make([]byte, 4)
+	binary.BigEndian.PutUint32(v, threshold)
+	return []Expr{
+		{"numgen", []attribute{
+			be32Attr(1, nft_reg_1),
+			be32Attr(2, modulus),
+			be32Attr(3, nft_ng_random),
+		}},
+		//numgen writes host byte order, cmp lt compares bytes
+		{"byteorder", []attribute{
+			be32Attr(1, nft_reg_1),
+			be32Attr(2, nft_reg_1),
+			be32Attr(3, nft_byteorder_hton),
+			be32Attr(4, 4),
+			be32Attr(5, 4),
+		}},
+		cmp(nft_cmp_lt, v),
+	}
+}
+
+// Drops the packet
+func Drop() []Expr {
+	return []Expr{{"immediate", []attribute{
+		be32Attr(1, 0),
+		nested(2, nested(nfta_data_verdict, be32Attr(nfta_verdict_code, nf_drop))),
+	}}}
+}
+
+// Chain is a base filter chain of an inet table
+type Chain struct {
+	Name     string
+	Hook     uint32
+	Priority int32
+}
+
+// Rule is a list of expressions appended to Chain
+type Rule struct {
+	Chain string
+	Exprs []Expr
+}
+
+// Returns the names of the rule's expressions, e.g. "meta cmp immediate"
+func (r Rule) String() string {
+	names := make([]string, len(r.Exprs))
+	for i, e := range r.Exprs {
+		names[i] = e.Name
+	}
+	return fmt.Sprintf("%s: %s", r.Chain, strings.Join(names, " "))
+}
+
+func nfgenmsg(family uint8, resID uint16) []byte {
+	b := make([]byte, nfgenmsg_len)
+	b[0] = family
+	binary.BigEndian.PutUint16(b[2:4], resID)
+	return b
+}
+
+func nftMessage(typ uint16, flags uint16, attrs ...attribute) message {
+	return message{
+		typ:   NFNL_SUBSYS_NFTABLES<<8 | typ,
+		flags: flags | syscall.NLM_F_ACK,
+		data:  append(nfgenmsg(NFPROTO_INET, 0), encodeAttrs(attrs...)...),
+	}
+}
+
+// Wraps msgs in a batch, the kernel applies all or none of them
+func batch(msgs ...message) []message {
+	begin := message{typ: NFNL_MSG_BATCH_BEGIN, data: nfgenmsg(syscall.AF_UNSPEC, NFNL_SUBSYS_NFTABLES)}
+	end := message{typ: NFNL_MSG_BATCH_END, data: nfgenmsg(syscall.AF_UNSPEC, NFNL_SUBSYS_NFTABLES)}
+	return append(append([]message{begin}, msgs...), end)
+}
+
+// Returns the messages creating table with chains and rules
+func tableMessages(table string, chains []Chain, rules []Rule) []message {
+	msgs := []message{nftMessage(NFT_MSG_NEWTABLE, syscall.NLM_F_CREATE, stringAttr(nfta_table_name, table))}
+	for _, c := range chains {
+		msgs = append(msgs, nftMessage(NFT_MSG_NEWCHAIN, syscall.NLM_F_CREATE,
+			stringAttr(nfta_chain_table, table),
+			stringAttr(nfta_chain_name, c.Name),
+			nested(nfta_chain_hook,
+				be32Attr(nfta_hook_hooknum, c.Hook),
+				be32Attr(nfta_hook_priority, uint32(c.Priority))),
+			stringAttr(nfta_chain_type, "filter"),
+		))
+	}
+	for _, r := range rules {
+		exprs := make([]attribute, len(r.Exprs))
+		for i, e := range r.Exprs {
+			exprs[i] = e.encode()
+		}
+		msgs = append(msgs, nftMessage(NFT_MSG_NEWRULE, syscall.NLM_F_CREATE|syscall.NLM_F_APPEND,
+			stringAttr(nfta_rule_table, table),
+			stringAttr(nfta_rule_chain, r.Chain),
+			nested(nfta_rule_expressions, exprs...),
+		))
+	}
+	return msgs
+}
+
+// Opens a nftables netlink socket
+func DialNftables() (*Conn, error) {
+	return Dial(NETLINK_NETFILTER)
+}
+
+// Creates the inet table with chains and rules in one transaction
+func (c *Conn) CreateTable(table string, chains []Chain, rules []Rule) error {
+	return c.execute("create table inet "+table, batch(tableMessages(table, chains, rules)...)...)
+}
+
+// Replaces the inet table, if any, by one with chains and rules in one
+// transaction: on error the old table is kept, and no packet passes
+// between the old table and the new one.
+func (c *Conn) ReplaceTable(table string, chains []Chain, rules []Rule) error {
+	//Creating an existing table without NLM_F_EXCL is a no-op,
+	//so the delete succeeds whether or not it existed
+	msgs := []message{
+		nftMessage(NFT_MSG_NEWTABLE, syscall.NLM_F_CREATE, stringAttr(nfta_table_name, table)),
+		nftMessage(NFT_MSG_DELTABLE, 0, stringAttr(nfta_table_name, table)),
+	}
+	return c.execute("replace table inet "+table, batch(append(msgs, tableMessages(table, chains, rules)...)...)...)
+}
+
+// Deletes the inet table with all its chains and rules.
+// Returns an error satisfying IsNotExist if there is none.
+func (c *Conn) DeleteTable(table string) error {
+	return c.execute("delete table inet "+table,
+		batch(nftMessage(NFT_MSG_DELTABLE, 0, stringAttr(nfta_table_name, table)))...)
+}
+
+// Returns the rules of the inet table, expressions carry their name only
+func (c *Conn) Rules(table string) ([]Rule, error) {
+	payloads, err := c.dump("get rules inet "+table, message{
+		typ:  NFNL_SUBSYS_NFTABLES<<8 | NFT_MSG_GETRULE,
+		data: append(nfgenmsg(NFPROTO_INET, 0), encodeAttrs(stringAttr(nfta_rule_table, table))...),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var rules []Rule
+	for _, p := range payloads {
+		if len(p) < nfgenmsg_len {
+			continue
+		}
+		attrs, err := decodeAttrs(p[nfgenmsg_len:])
+		if err != nil {
+			return nil, err
+		}
+		var rule Rule
+		var ruleTable string
+		for _, a := range attrs {
+			switch a.typ {
+			case nfta_rule_table:
+				ruleTable = attrString(a.data)
+			case nfta_rule_chain:
+				rule.Chain = attrString(a.data)
+			case nfta_rule_expressions:
+				if rule.Exprs, err = decodeExprNames(a.data); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if ruleTable == table {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+func decodeExprNames(b []byte) ([]Expr, error) {
+	elems, err := decodeAttrs(b)
+	if err != nil {
+		return nil, err
+	}
+	exprs := make([]Expr, 0, len(elems))
+	for _, elem := range elems {
+		attrs, err := decodeAttrs(elem.data)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range attrs {
+			if a.typ == nfta_expr_name {
+				exprs = append(exprs, Expr{Name: attrString(a.data)})
+			}
+		}
+	}
+	return exprs, nil
+}
+
+// Reads back the rules of the inet table and checks
+// they match want in chain and expression order
+func (c *Conn) VerifyRules(table string, want []Rule) error {
+	got, err := c.Rules(table)
+	if err != nil {
+		return err
+	}
+	format := func(rules []Rule) string {
+		s := make([]string, len(rules))
+		for i, r := range rules {
+			s[i] = r.String()
+		}
+		return "[" + strings.Join(s, "; ") + "]"
+	}
+	if format(got) != format(want) {
+		return &VerifyError{Object: "rules of table inet " + table, Want: format(want), Got: format(got)}
+	}
+	return nil
+}
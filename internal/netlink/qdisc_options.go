@@ -0,0 +1,165 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package netlink
+
+import (
+	"math"
+	"time"
+)
+
+// Options of a qdisc kind, sent as TCA_OPTIONS on add and change
+type QdiscOptions interface {
+	encode() attribute
+}
+
+// Attribute types of the netem options, see linux/pkt_sched.h
+const (
+	TCA_NETEM_DELAY_DIST = 2
+	TCA_NETEM_LOSS       = 5
+	TCA_NETEM_LATENCY64  = 10
+	TCA_NETEM_JITTER64   = 11
+	NETEM_LOSS_GE        = 2
+	//Entries of a delay distribution are in units of deviation/NETEM_DIST_SCALE
+	NETEM_DIST_SCALE  = 8192
+	tc_netem_qopt_len = 24
+	psched_shift      = 6
+)
+
+// Gilbert-Elliott loss model of netem, probabilities are [0,1]
+type NetemGEModel struct {
+	//Transition probabilities good -> bad and bad -> good
+	P float64
+	R float64
+	//Loss probability in the bad and good state
+	LossBad  float64
+	LossGood float64
+}
+
+// Options of a netem qdisc, as tc-netem(8) sets them
+type NetemOptions struct {
+	//Packets netem can hold while delaying them
+	Limit   uint32
+	Latency time.Duration
+	Jitter  time.Duration
+	//Distribution of the jitter, nil keeps the current one
+	DelayDist []int16
+	//Probability [0,1] of a random loss, ignored if GE is set
+	Loss float64
+	GE   *NetemGEModel
+}
+
+// Returns probability [0,1] scaled to [0, 2^32-1] the way tc does
+func probability32(p float64) uint32 {
+	return uint32(math.Round(math.Min(math.Max(p, 0), 1) * math.MaxUint32))
+}
+
+// Returns d in psched ticks, the unit of the legacy latency and jitter
+func pschedTicks(d time.Duration) uint32 {
+	return uint32(math.Min(float64(d.Nanoseconds()>>psched_shift), math.MaxUint32))
+}
+
+func s64Attr(typ uint16, v int64) attribute {
+	b := make([]byte, 8)
+	native.PutUint64(b, uint64(v))
+	return attribute{typ, b}
+}
+
+// Unlike other qdiscs, netem options are a struct tc_netem_qopt
+// followed by the attributes, not nested attributes
+func (o NetemOptions) encode() attribute {
+	qopt := make([]byte, tc_netem_qopt_len)
+	native.PutUint32(qopt[0:4], pschedTicks(o.Latency))
+	native.PutUint32(qopt[4:8], o.Limit)
+	attrs := []attribute{s64Attr(TCA_NETEM_LATENCY64, o.Latency.Nanoseconds()), s64Attr(TCA_NETEM_JITTER64, o.Jitter.Nanoseconds())}
+	if o.GE != nil {
+		ge := make([]byte, 16)
+		native.PutUint32(ge[0:4], probability32(o.GE.P))
+		native.PutUint32(ge[4:8], probability32(o.GE.R))
+		//h is the probability to deliver in the bad state
+		native.PutUint32(ge[8:12], math.MaxUint32-probability32(o.GE.LossBad))
+		native.PutUint32(ge[12:16], probability32(o.GE.LossGood))
+		attrs = append(attrs, nested(TCA_NETEM_LOSS, attr(NETEM_LOSS_GE, ge)))
+	} else {
+		native.PutUint32(qopt[8:12], probability32(o.Loss))
+	}
+	native.PutUint32(qopt[20:24], pschedTicks(o.Jitter))
+	if o.DelayDist != nil {
+		dist := make([]byte, 2*len(o.DelayDist))
+		for i, v := range o.DelayDist {
+			native.PutUint16(dist[2*i:], uint16(v))
+		}
+		attrs = append(attrs, attr(TCA_NETEM_DELAY_DIST, dist))
+	}
+	return attr(TCA_OPTIONS, append(qopt, encodeAttrs(attrs...)...))
+}
+
+// Attribute types of the janz options, in the order of the TCA_JANZ_*
+// enum of the sch_janz module; it ships no uapi header
+const (
+	TCA_JANZ_LIMIT     = 1
+	TCA_JANZ_RATE64    = 2
+	TCA_JANZ_HANDOVER  = 3
+	TCA_JANZ_QOSMODE   = 4
+	TCA_JANZ_MARKFREE  = 5
+	TCA_JANZ_MARKFULL  = 6
+	TCA_JANZ_SUBBUFS   = 7
+	TCA_JANZ_FRAGCACHE = 8
+	TCA_JANZ_XLATENCY  = 9
+)
+
+// Options of a janz qdisc, all but Limit are sent even if 0,
+// so a change to 0 is applied
+type JanzOptions struct {
+	//Bytes/s
+	Rate uint64
+	//Packets, 0 keeps the default of the module
+	Limit        uint32
+	ExtraLatency time.Duration
+	Markfree     time.Duration
+	Markfull     time.Duration
+	Qosmode      uint32
+}
+
+func u64Attr(typ uint16, v uint64) attribute {
+	b := make([]byte, 8)
+	native.PutUint64(b, v)
+	return attribute{typ, b}
+}
+
+// Returns d in µs, the unit of the janz times
+func microseconds32(d time.Duration) uint32 {
+	return uint32(math.Min(float64(d.Microseconds()), math.MaxUint32))
+}
+
+func (o JanzOptions) encode() attribute {
+	var attrs []attribute
+	if o.Limit > 0 {
+		attrs = append(attrs, u32Attr(TCA_JANZ_LIMIT, o.Limit))
+	}
+	return nested(TCA_OPTIONS, append(attrs,
+		u64Attr(TCA_JANZ_RATE64, o.Rate),
+		u32Attr(TCA_JANZ_QOSMODE, o.Qosmode),
+		u32Attr(TCA_JANZ_MARKFREE, microseconds32(o.Markfree)),
+		u32Attr(TCA_JANZ_MARKFULL, microseconds32(o.Markfull)),
+		u32Attr(TCA_JANZ_XLATENCY, microseconds32(o.ExtraLatency)),
+	)...)
+}
@@ -0,0 +1,438 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package netlink
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"syscall"
+)
+
+const (
+	TC_H_ROOT       uint32 = 0xffffffff
+	TC_H_INGRESS    uint32 = 0xfffffff1
+	TCA_KIND               = 1
+	TCA_OPTIONS            = 2
+	TCA_STATS2             = 7
+	TCA_STATS_BASIC        = 1
+	TCA_STATS_QUEUE        = 3
+	TCA_STATS_APP          = 4
+	IFLA_INFO_KIND         = 1
+	tcmsg_len              = 20
+)
+
+// Returns the tc handle major:minor
+func MakeHandle(major, minor uint16) uint32 {
+	return uint32(major)<<16 | uint32(minor)
+}
+
+// Formats a tc handle the way tc prints it
+func HandleString(h uint32) string {
+	switch h {
+	case TC_H_ROOT:
+		return "root"
+	case TC_H_INGRESS:
+		return "ingress"
+	}
+	return fmt.Sprintf("%x:%x", h>>16, h&0xffff)
+}
+
+// Counters of a qdisc, as shown by tc -s
+type QdiscStats struct {
+	Bytes      uint64
+	Packets    uint32
+	Qlen       uint32
+	Backlog    uint32
+	Drops      uint32
+	Overlimits uint32
+	//ECN marked packets, reported by fq_codel and cake only
+	EcnMarks uint32
+}
+
+// Qdisc as reported by RTM_GETQDISC, Stats are not sent on requests
+type Qdisc struct {
+	Ifindex int
+	Handle  uint32
+	Parent  uint32
+	Kind    string
+	Stats   QdiscStats
+}
+
+func (q Qdisc) String() string {
+	return fmt.Sprintf("%s %s parent %s", q.Kind, HandleString(q.Handle), HandleString(q.Parent))
+}
+
+func (q Qdisc) encode() []byte {
+	b := make([]byte, tcmsg_len)
+	b[0] = syscall.AF_UNSPEC
+	native.PutUint32(b[4:8], uint32(q.Ifindex))
+	native.PutUint32(b[8:12], q.Handle)
+	native.PutUint32(b[12:16], q.Parent)
+	if q.Kind != "" {
+		b = append(b, encodeAttrs(stringAttr(TCA_KIND, q.Kind))...)
+	}
+	return b
+}
+
+func decodeQdisc(b []byte) (Qdisc, error) {
+	if len(b) < tcmsg_len {
+		return Qdisc{}, fmt.Errorf("netlink: short tcmsg of length %d", len(b))
+	}
+	q := Qdisc{
+		Ifindex: int(int32(native.Uint32(b[4:8]))),
+		Handle:  native.Uint32(b[8:12]),
+		Parent:  native.Uint32(b[12:16]),
+	}
+	attrs, err := decodeAttrs(b[tcmsg_len:])
+	if err != nil {
+		return q, err
+	}
+	var stats []byte
+	for _, a := range attrs {
+		switch a.typ {
+		case TCA_KIND:
+			q.Kind = attrString(a.data)
+		case TCA_STATS2:
+			stats = a.data
+		}
+	}
+	if stats != nil {
+		q.Stats, err = decodeQdiscStats(q.Kind, stats)
+	}
+	return q, err
+}
+
+// Attribute types of the fq_codel and cake xstats
+const (
+	tca_fq_codel_xstats_qdisc            = 0
+	tca_cake_stats_tin_stats             = 10
+	tca_cake_tin_stats_ecn_marked_packet = 8
+)
+
+// Decodes the nested TCA_STATS2 of a qdisc of kind
+func decodeQdiscStats(kind string, b []byte) (QdiscStats, error) {
+	var stats QdiscStats
+	attrs, err := decodeAttrs(b)
+	if err != nil {
+		return stats, err
+	}
+	for _, a := range attrs {
+		switch {
+		case a.typ == TCA_STATS_BASIC && len(a.data) >= 12:
+			stats.Bytes = native.Uint64(a.data[0:8])
+			stats.Packets = native.Uint32(a.data[8:12])
+		case a.typ == TCA_STATS_QUEUE && len(a.data) >= 20:
+			stats.Qlen = native.Uint32(a.data[0:4])
+			stats.Backlog = native.Uint32(a.data[4:8])
+			stats.Drops = native.Uint32(a.data[8:12])
+			stats.Overlimits = native.Uint32(a.data[16:20])
+		case a.typ == TCA_STATS_APP:
+			if stats.EcnMarks, err = decodeEcnMarks(kind, a.data); err != nil {
+				return stats, err
+			}
+		}
+	}
+	return stats, nil
+}
+
+// Returns the ECN marks in the xstats of fq_codel and cake, 0 for other kinds
+func decodeEcnMarks(kind string, b []byte) (uint32, error) {
+	switch kind {
+	case "fq_codel":
+		//struct tc_fq_codel_xstats: type, maxpacket, drop_overlimit, ecn_mark
+		if len(b) >= 16 && native.Uint32(b[0:4]) == tca_fq_codel_xstats_qdisc {
+			return native.Uint32(b[12:16]), nil
+		}
+	case "cake":
+		attrs, err := decodeAttrs(b)
+		if err != nil {
+			return 0, err
+		}
+		var marks uint32
+		for _, a := range attrs {
+			if a.typ != tca_cake_stats_tin_stats {
+				continue
+			}
+			tins, err := decodeAttrs(a.data)
+			if err != nil {
+				return 0, err
+			}
+			for _, tin := range tins {
+				stats, err := decodeAttrs(tin.data)
+				if err != nil {
+					return 0, err
+				}
+				for _, s := range stats {
+					if s.typ == tca_cake_tin_stats_ecn_marked_packet && len(s.data) >= 4 {
+						marks += native.Uint32(s.data[0:4])
+					}
+				}
+			}
+		}
+		return marks, nil
+	}
+	return 0, nil
+}
+
+// Opens a rtnetlink socket
+func DialRoute() (*Conn, error) {
+	return Dial(syscall.NETLINK_ROUTE)
+}
+
+// Returns the index of the link name
+func LinkIndex(name string) (int, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return 0, &Error{Op: "link " + name, Errno: syscall.ENODEV}
+	}
+	return iface.Index, nil
+}
+
+// Returns the qdiscs of the link ifindex
+func (c *Conn) Qdiscs(ifindex int) ([]Qdisc, error) {
+	payloads, err := c.dump("get qdisc", message{typ: syscall.RTM_GETQDISC, data: Qdisc{Ifindex: ifindex}.encode()})
+	if err != nil {
+		return nil, err
+	}
+	var qdiscs []Qdisc
+	for _, p := range payloads {
+		q, err := decodeQdisc(p)
+		if err != nil {
+			return nil, err
+		}
+		if q.Ifindex == ifindex {
+			qdiscs = append(qdiscs, q)
+		}
+	}
+	return qdiscs, nil
+}
+
+// Returns the qdisc of ifindex with handle, including its stats.
+// Returns an error satisfying IsNotExist if there is none.
+func (c *Conn) Qdisc(ifindex int, handle uint32) (Qdisc, error) {
+	qdiscs, err := c.Qdiscs(ifindex)
+	if err != nil {
+		return Qdisc{}, err
+	}
+	for _, q := range qdiscs {
+		if q.Handle == handle {
+			return q, nil
+		}
+	}
+	return Qdisc{}, &Error{Op: "get qdisc " + HandleString(handle), Errno: syscall.ENOENT}
+}
+
+// Adds a qdisc without options, e.g. ingress
+func (c *Conn) AddQdisc(q Qdisc) error {
+	return c.AddQdiscWithOptions(q, nil)
+}
+
+// Adds a qdisc configured with options, nil for none
+func (c *Conn) AddQdiscWithOptions(q Qdisc, options QdiscOptions) error {
+	data := q.encode()
+	if options != nil {
+		data = append(data, encodeAttrs(options.encode())...)
+	}
+	return c.execute("add qdisc "+q.String(), message{
+		typ:   syscall.RTM_NEWQDISC,
+		flags: syscall.NLM_F_ACK | syscall.NLM_F_CREATE | syscall.NLM_F_EXCL,
+		data:  data,
+	})
+}
+
+// Changes the options of the existing qdisc q, like tc qdisc change.
+// Returns an error satisfying IsNotExist if there is none.
+func (c *Conn) ChangeQdisc(q Qdisc, options QdiscOptions) error {
+	return c.execute("change qdisc "+q.String(), message{
+		typ:   syscall.RTM_NEWQDISC,
+		flags: syscall.NLM_F_ACK,
+		data:  append(q.encode(), encodeAttrs(options.encode())...),
+	})
+}
+
+// Deletes the qdisc at q.Parent, q.Kind is ignored.
+// Returns an error satisfying IsNotExist if there is none.
+func (c *Conn) DeleteQdisc(q Qdisc) error {
+	q.Kind = ""
+	return c.execute("delete qdisc "+HandleString(q.Parent), message{
+		typ:   syscall.RTM_DELQDISC,
+		flags: syscall.NLM_F_ACK,
+		data:  q.encode(),
+	})
+}
+
+// Reads back the qdiscs of want.Ifindex and checks that
+// one with want's handle, parent and kind exists
+func (c *Conn) VerifyQdisc(want Qdisc) error {
+	qdiscs, err := c.Qdiscs(want.Ifindex)
+	if err != nil {
+		return err
+	}
+	for _, q := range qdiscs {
+		if q.Handle != want.Handle {
+			continue
+		}
+		if q.Kind != want.Kind || q.Parent != want.Parent {
+			return &VerifyError{Object: "qdisc " + HandleString(want.Handle), Want: want.String(), Got: q.String()}
+		}
+		return nil
+	}
+	return &VerifyError{Object: "qdisc " + HandleString(want.Handle), Want: want.String(), Got: "none"}
+}
+
+func ifinfomsg(index int, flags, change uint32) []byte {
+	b := make([]byte, syscall.SizeofIfInfomsg)
+	b[0] = syscall.AF_UNSPEC
+	native.PutUint32(b[4:8], uint32(index))
+	native.PutUint32(b[8:12], flags)
+	native.PutUint32(b[12:16], change)
+	return b
+}
+
+// Creates the link name of kind, e.g. ifb
+func (c *Conn) AddLink(name string, kind string) error {
+	data := append(ifinfomsg(0, 0, 0), encodeAttrs(
+		stringAttr(syscall.IFLA_IFNAME, name),
+		nested(syscall.IFLA_LINKINFO, stringAttr(IFLA_INFO_KIND, kind)),
+	)...)
+	return c.execute("add link "+name, message{
+		typ:   syscall.RTM_NEWLINK,
+		flags: syscall.NLM_F_ACK | syscall.NLM_F_CREATE | syscall.NLM_F_EXCL,
+		data:  data,
+	})
+}
+
+// Sets the link ifindex up
+func (c *Conn) SetLinkUp(ifindex int) error {
+	return c.execute(fmt.Sprintf("set link %d up", ifindex), message{
+		typ:   syscall.RTM_NEWLINK,
+		flags: syscall.NLM_F_ACK,
+		data:  ifinfomsg(ifindex, syscall.IFF_UP, syscall.IFF_UP),
+	})
+}
+
+// Deletes the link ifindex
+func (c *Conn) DeleteLink(ifindex int) error {
+	return c.execute(fmt.Sprintf("delete link %d", ifindex), message{
+		typ:   syscall.RTM_DELLINK,
+		flags: syscall.NLM_F_ACK,
+		data:  ifinfomsg(ifindex, 0, 0),
+	})
+}
+
+const (
+	ETH_P_ALL         = 0x0003
+	TCA_U32_SEL       = 5
+	TCA_U32_ACT       = 7
+	TCA_ACT_KIND      = 1
+	TCA_ACT_OPTIONS   = 2
+	TCA_MIRRED_PARMS  = 2
+	TCA_EGRESS_REDIR  = 1
+	TC_ACT_STOLEN     = 4
+	TC_U32_TERMINAL   = 1
+	tc_u32_sel_len    = 16
+	tc_u32_key_len    = 16
+	tc_mirred_len     = 28
+	tc_gen_action_off = 8
+)
+
+// Filter as reported by RTM_GETTFILTER
+type Filter struct {
+	Ifindex int
+	Handle  uint32
+	Parent  uint32
+	Kind    string
+}
+
+// Returns the protocol of all packets, as tcm_info expects it
+func protocolAll() uint32 {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, ETH_P_ALL)
+	return uint32(native.Uint16(b))
+}
+
+// Adds a u32 filter at parent of ifindex matching all packets and
+// redirecting them to the egress of target (tc: u32 match u32 0 0
+// action mirred egress redirect)
+func (c *Conn) AddRedirectFilter(ifindex int, parent uint32, target int) error {
+	sel := make([]byte, tc_u32_sel_len+tc_u32_key_len)
+	sel[0] = TC_U32_TERMINAL
+	sel[2] = 1
+	mirred := make([]byte, tc_mirred_len)
+	native.PutUint32(mirred[tc_gen_action_off:], TC_ACT_STOLEN)
+	native.PutUint32(mirred[20:24], TCA_EGRESS_REDIR)
+	native.PutUint32(mirred[24:28], uint32(target))
+
+	data := Qdisc{Ifindex: ifindex, Parent: parent, Kind: "u32"}.encode()
+	native.PutUint32(data[16:20], protocolAll())
+	data = append(data, encodeAttrs(nested(TCA_OPTIONS,
+		attr(TCA_U32_SEL, sel),
+		nested(TCA_U32_ACT, nested(1,
+			stringAttr(TCA_ACT_KIND, "mirred"),
+			nested(TCA_ACT_OPTIONS, attr(TCA_MIRRED_PARMS, mirred)),
+		)),
+	))...)
+	return c.execute("add redirect filter "+HandleString(parent), message{
+		typ:   syscall.RTM_NEWTFILTER,
+		flags: syscall.NLM_F_ACK | syscall.NLM_F_CREATE | syscall.NLM_F_EXCL,
+		data:  data,
+	})
+}
+
+// Returns the filters attached to parent of ifindex
+func (c *Conn) Filters(ifindex int, parent uint32) ([]Filter, error) {
+	payloads, err := c.dump("get filter", message{
+		typ:  syscall.RTM_GETTFILTER,
+		data: Qdisc{Ifindex: ifindex, Parent: parent}.encode(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var filters []Filter
+	for _, p := range payloads {
+		q, err := decodeQdisc(p)
+		if err != nil {
+			return nil, err
+		}
+		if q.Ifindex == ifindex && q.Parent == parent {
+			filters = append(filters, Filter{Ifindex: q.Ifindex, Handle: q.Handle, Parent: q.Parent, Kind: q.Kind})
+		}
+	}
+	return filters, nil
+}
+
+// Reads back the filters at parent of ifindex and checks one of kind exists
+func (c *Conn) VerifyFilter(ifindex int, parent uint32, kind string) error {
+	filters, err := c.Filters(ifindex, parent)
+	if err != nil {
+		return err
+	}
+	kinds := make([]string, 0, len(filters))
+	for _, f := range filters {
+		if f.Kind == kind {
+			return nil
+		}
+		kinds = append(kinds, f.Kind)
+	}
+	return &VerifyError{Object: "filter " + HandleString(parent), Want: kind, Got: fmt.Sprintf("%v", kinds)}
+}
@@ -24,12 +24,18 @@ package datatypes
 import (
 	"database/sql"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"time"
 
 	"github.com/telekom/aml-jens/internal/errortypes"
 	"github.com/telekom/aml-jens/pkg/drp"
 )
 
+// Highest freq a pattern can be played at;
+// the rate is changed at most once per ms.
+const MAX_FREQ = 1000
+
 type DB_data_rate_pattern struct {
 	//Set when loading file
 	//
@@ -43,6 +49,8 @@ type DB_data_rate_pattern struct {
 
 	Intial_minRateKbits float64
 	Initial_scale       float64
+	//Used if the native freq of the pattern differs from Freq
+	Resample drp.ResampleMethod
 }
 
 // Return the name of the loaded pattern; most likely filename
@@ -52,6 +60,11 @@ func (s *DB_data_rate_pattern) GetName() string {
 	return s.dr_pattern.Name
 }
 
+// Return where the loaded pattern came from (path or identifier)
+func (s *DB_data_rate_pattern) GetOrigin() string {
+	return s.dr_pattern.GetOrigin()
+}
+
 // Return the description of the loaded pattern; most likely empty
 //
 // The description is any comment in a dpr.csv that is not in the :key=value format
@@ -61,11 +74,25 @@ func (s *DB_data_rate_pattern) GetDescription() sql.NullString {
 	return sql.NullString{String: s.dr_pattern.Description, Valid: s.dr_pattern.Description != ""}
 }
 
-// Returns the playtime, extrapolated from frequency, samples and warmup
-//
-//go:inline
+// Returns the playtime, extrapolated from frequency, samples, playback mode and warmup.
+// Streamed patterns only account for warmup and a duration cap.
 func (s *DB_data_rate_pattern) GetEstimatedPlaytime() int {
-	return int(s.WarmupTimeMs/1000) + (s.dr_pattern.SampleCount() / s.Freq)
+	var pass time.Duration
+	if s.dr_pattern.IsStreamed() {
+		pass = s.dr_pattern.Iterator().GetPlaybackMode().Duration
+	} else if s.dr_pattern.IsTimed() {
+		pass = s.dr_pattern.GetTimedDuration()
+	} else {
+		pass = time.Duration(s.dr_pattern.SampleCount()) * time.Second / time.Duration(s.Freq)
+	}
+	mode := s.dr_pattern.Iterator().GetPlaybackMode()
+	if mode.Loop != drp.LOOP_NONE && mode.Repetitions > 1 {
+		pass *= time.Duration(mode.Repetitions)
+	}
+	if mode.Duration > 0 && (pass > mode.Duration || (mode.Loop != drp.LOOP_NONE && mode.Repetitions == 0)) {
+		pass = mode.Duration
+	}
+	return int(s.WarmupTimeMs/1000) + int(pass.Seconds())
 }
 
 //go:inline
@@ -112,13 +139,41 @@ func (s *DB_data_rate_pattern) GetTh_p999_latency() string {
 func (s *DB_data_rate_pattern) GetTh_link_usage() string {
 	return s.dr_pattern.GetMappingValue("th_link_usage", "{}")
 }
+
+// Returns all (known and custom) thresholds of the loaded pattern
+//
+// Wraps drp.DataRatePattern{}.GetThresholds()
+func (s *DB_data_rate_pattern) GetThresholds() map[string]drp.Threshold {
+	return s.dr_pattern.GetThresholds()
+}
+
+// Overrides thresholds of the loaded pattern. Needs to be called after ParseDRP.
+func (s *DB_data_rate_pattern) SetThresholds(thresholds map[string]drp.Threshold) error {
+	for k, v := range thresholds {
+		if err := s.dr_pattern.SetThreshold(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns drp.DataRatePattern{}.Stats() as json
+func (s *DB_data_rate_pattern) GetStatsJSON() (string, error) {
+	stats, err := json.Marshal(s.dr_pattern.Stats())
+	return string(stats), err
+}
+
 func (s *DB_data_rate_pattern) Insert(stmt SQLStmt) error {
 	DEBUG.Printf("Inserting DRP: %v, %v, %v, %v, %v\n", s.GetTh_mq_latency(),
 		s.GetTh_p95_latency(),
 		s.GetTh_p99_latency(),
 		s.GetTh_p999_latency(),
 		s.GetTh_link_usage())
-	err := stmt.QueryRow(`INSERT INTO data_rate_pattern
+	stats, err := s.GetStatsJSON()
+	if err != nil {
+		return err
+	}
+	err = stmt.QueryRow(`INSERT INTO data_rate_pattern
 	(
 		drp_sha256,
 		"name",
@@ -131,9 +186,10 @@ func (s *DB_data_rate_pattern) Insert(stmt SQLStmt) error {
 		th_p95_latency,
 		th_p99_latency,
 		th_p999_latency,
-		th_link_usage
+		th_link_usage,
+		stats
 	)
-	VALUES ( $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12 )
+	VALUES ( $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13 )
 	RETURNING drp_id;`,
 		s.GetHash(),
 		s.GetName(),
@@ -146,7 +202,8 @@ func (s *DB_data_rate_pattern) Insert(stmt SQLStmt) error {
 		s.GetTh_p95_latency(),
 		s.GetTh_p99_latency(),
 		s.GetTh_p999_latency(),
-		s.GetTh_link_usage()).Scan(&s.Id)
+		s.GetTh_link_usage(),
+		stats).Scan(&s.Id)
 	return err
 }
 func (s *DB_data_rate_pattern) Sync(stmt SQLStmt) error {
@@ -155,14 +212,14 @@ func (s *DB_data_rate_pattern) Sync(stmt SQLStmt) error {
 }
 
 func (s *DB_data_rate_pattern) Validate() (err error) {
-	if s.Freq < 1 || s.Freq > 100 {
-		return errortypes.NewUserInputError("frequency must be in intervall [1..100]")
+	if s.Freq < 1 || s.Freq > MAX_FREQ {
+		return errortypes.NewUserInputError("frequency must be in intervall [1..%d]", MAX_FREQ)
 	}
 
 	if s.dr_pattern.GetScale() < 0.1 {
 		return errortypes.NewUserInputError("scale factor must be greater than 0.1")
 	}
-	if s.dr_pattern.SampleCount() == 0 {
+	if s.dr_pattern.SampleCount() == 0 && !s.dr_pattern.IsStreamed() {
 		return errors.New("can't start drplay with a pattern of length 0")
 	}
 	return nil
@@ -194,6 +251,15 @@ func (s *DB_data_rate_pattern) SetLooping(endless bool) {
 	s.dr_pattern.Iterator().SetLooping(endless)
 }
 
+// Sets how the loaded pattern is played; Freq is taken from this DRP.
+// Needs to be called after ParseDRP.
+//
+// Wraps drp.DataRatePattern{}.Iterator().SetPlaybackMode()
+func (s *DB_data_rate_pattern) SetPlaybackMode(mode drp.PlaybackMode) error {
+	mode.Freq = s.Freq
+	return s.dr_pattern.Iterator().SetPlaybackMode(mode)
+}
+
 // Load a DataRatePattern from the given Provider.
 // Uses the self.Internal_{scale, minRateKbits} as constraints to the provider.
 func (drp *DB_data_rate_pattern) ParseDRP(provider drp.DataRatePatternProvider) error {
@@ -202,7 +268,30 @@ func (drp *DB_data_rate_pattern) ParseDRP(provider drp.DataRatePatternProvider)
 	}
 	var err error
 	drp.dr_pattern, err = provider.Provide(drp.Initial_scale, drp.Intial_minRateKbits)
-	return err
+	if err != nil {
+		return err
+	}
+	return drp.resampleToFreq()
+}
+
+// Resamples the loaded pattern to Freq if it declares a different native freq,
+// so that its playtime does not depend on Freq
+func (s *DB_data_rate_pattern) resampleToFreq() error {
+	native := s.dr_pattern.GetNativeFreq()
+	if native == 0 || s.Freq < 1 || native == s.Freq || s.dr_pattern.IsTimed() {
+		return nil
+	}
+	method, err := drp.ParseResampleMethod(string(s.Resample))
+	if err != nil {
+		return err
+	}
+	resampled, err := s.dr_pattern.Resample(s.Freq, method)
+	if err != nil {
+		return err
+	}
+	INFO.Printf("Resampled %s from %dHz to %dHz (%s): %d samples\n", s.GetName(), native, s.Freq, method, resampled.SampleCount())
+	s.dr_pattern = *resampled
+	return nil
 }
 
 // Wraps drp.DataRatePattern{}.GetStats()
@@ -219,6 +308,24 @@ func (s *DB_data_rate_pattern) SetToDone() {
 	s.dr_pattern.Iterator().SetDone()
 }
 
+// Makes a streamed pattern stop waiting for the next rate once exit is closed
+//
+// Wraps drp.DataRatePattern{}.GetStream().StopOn()
+func (s *DB_data_rate_pattern) StopStreamOn(exit <-chan uint8) {
+	if stream := s.dr_pattern.GetStream(); stream != nil {
+		stream.StopOn(exit)
+	}
+}
+
+// Closes the source of a streamed pattern, a no-op for other patterns
+//
+// Wraps drp.DataRatePattern{}.GetStream().Close()
+func (s *DB_data_rate_pattern) Close() {
+	if stream := s.dr_pattern.GetStream(); stream != nil {
+		stream.Close()
+	}
+}
+
 // Wraps drp.DataRatePattern{}.Iterator().SetToDone()
 //
 //go:inline
@@ -237,6 +344,51 @@ func (drp *DB_data_rate_pattern) Next() (value float64, err error) {
 	return drp.dr_pattern.Iterator().Next()
 }
 
+// Returns true if the loaded pattern carries its own sample offsets
+//
+// Wraps drp.DataRatePattern{}.IsTimed()
+//
+//go:inline
+func (drp *DB_data_rate_pattern) IsTimed() bool {
+	return drp.dr_pattern.IsTimed()
+}
+
+// Returns true if the loaded pattern is read while playing
+//
+// Wraps drp.DataRatePattern{}.IsStreamed()
+//
+//go:inline
+func (drp *DB_data_rate_pattern) IsStreamed() bool {
+	return drp.dr_pattern.IsStreamed()
+}
+
+// Offset returns the time (relative to the start of playback)
+// at which the value last returned by Next is due.
+//
+// Wraps drp.DataRatePattern{}.Iterator().Offset()
+//
+//go:inline
+func (drp *DB_data_rate_pattern) Offset() time.Duration {
+	return drp.dr_pattern.Iterator().Offset()
+}
+
+// Settings returns the per sample link settings belonging to
+// the value last returned by Next. ok is false for single-column patterns.
+//
+// Wraps drp.DataRatePattern{}.Iterator().Settings()
+//
+//go:inline
+func (s *DB_data_rate_pattern) Settings() (settings drp.SampleSettings, ok bool) {
+	return s.dr_pattern.Iterator().Settings()
+}
+
+// Returns true if the pattern sets the jitter per sample
+//
+// Wraps drp.DataRatePattern{}.HasSampleJitter()
+func (s *DB_data_rate_pattern) HasSampleJitter() bool {
+	return s.dr_pattern.HasSampleJitter()
+}
+
 // Next returns the next DataRate in a Pattern and its position.
 // Does not advance the Iterator
 //
@@ -247,6 +399,42 @@ func (drp *DB_data_rate_pattern) Peek() (value float64) {
 	return drp.dr_pattern.Iterator().Value()
 }
 
+// Returns the position (in playing direction) of the value last returned by Next
+//
+// Wraps drp.DataRatePattern{}.Iterator().Position()
+func (drp *DB_data_rate_pattern) Position() int {
+	return drp.dr_pattern.Iterator().Position()
+}
+
+// Returns the number of values returned by Next
+//
+// Wraps drp.DataRatePattern{}.Iterator().Played()
+func (drp *DB_data_rate_pattern) Played() int {
+	return drp.dr_pattern.Iterator().Played()
+}
+
+// Returns the number of samples of the loaded pattern, 0 if streamed
+func (drp *DB_data_rate_pattern) SampleCount() int {
+	if drp.dr_pattern.IsStreamed() || drp.dr_pattern.GetData() == nil {
+		return 0
+	}
+	return drp.dr_pattern.SampleCount()
+}
+
+// Continues playback at position with the next call to Next
+//
+// Wraps drp.DataRatePattern{}.Iterator().Seek()
+func (drp *DB_data_rate_pattern) Seek(position int) error {
+	return drp.dr_pattern.Iterator().Seek(position)
+}
+
+// Continues playback at the sample played d into the pattern
+//
+// Wraps drp.DataRatePattern{}.Iterator().SeekTime()
+func (drp *DB_data_rate_pattern) SeekTime(d time.Duration) error {
+	return drp.dr_pattern.Iterator().SeekTime(d)
+}
+
 // Create a new DataBaseObject with some initalized values
 func NewDB_data_rate_pattern() *DB_data_rate_pattern {
 	return &DB_data_rate_pattern{
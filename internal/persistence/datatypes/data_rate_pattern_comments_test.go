@@ -76,3 +76,22 @@ func TestKeyValueComment(t *testing.T) {
 		t.Fatal("DataRatePatternEvaluation did not get set correctly")
 	}
 }
+
+func TestThresholdComment(t *testing.T) {
+	data := datatypes.NewDB_data_rate_pattern()
+	err := data.ParseDRP(drp.NewDataRatePatternFileProvider(filepath.Join(paths.TESTDATA_DRP(), "thresholds", "custom.csv")))
+	if err != nil {
+		t.Fatalf("Loaded valid drp, got an error: %s", err)
+	}
+	if data.GetTh_mq_latency() != "{3,6}" || data.GetTh_link_usage() != "{90,80}" {
+		t.Fatalf("Thresholds were not normalized: %s %s", data.GetTh_mq_latency(), data.GetTh_link_usage())
+	}
+	err = data.SetThresholds(map[string]drp.Threshold{"th_mq_latency": {Warn: 8, Fail: 4}})
+	if err == nil {
+		t.Fatal("Expected error for threshold with warn above fail")
+	}
+	expected := drp.Threshold{Warn: 5000, Fail: 2000, Unit: "kbit/s", Direction: drp.THRESHOLD_BELOW}
+	if th := data.GetThresholds()["th_throughput"]; th != expected {
+		t.Fatalf("Custom threshold th_throughput: expected %+v, got %+v", expected, th)
+	}
+}
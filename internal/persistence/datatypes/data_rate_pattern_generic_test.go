@@ -218,3 +218,38 @@ func TestDrpValueLoop(t *testing.T) {
 		}
 	}
 }
+
+func TestDrpStatsJSON(t *testing.T) {
+	db_drp := datatypes.DB_data_rate_pattern{
+		Initial_scale:       1,
+		Intial_minRateKbits: 0,
+	}
+	if err := db_drp.ParseDRP(drp.NewDataRatePatternFileProvider(SAW_PATH)); err != nil {
+		t.Fatalf("Loaded valid drp, got an error: %s", err)
+	}
+	stats, err := db_drp.GetStatsJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []string{`"samples":10`, `"stddev":`, `"autocorrelation":[{"lag":1,`, `"valleys":1`, `"rate_of_change":{`} {
+		if !strings.Contains(stats, v) {
+			t.Fatalf("Stats '%s' do not contain '%s'", stats, v)
+		}
+	}
+}
+
+func TestDrpResampleToFreq(t *testing.T) {
+	for _, freq := range []int{5, 10, 100} {
+		db_drp := datatypes.DB_data_rate_pattern{
+			Initial_scale: 1,
+			Freq:          freq,
+			Resample:      drp.RESAMPLE_LINEAR,
+		}
+		if err := db_drp.ParseDRP(drp.NewDataRatePatternFileProvider(filepath.Join(paths.TESTDATA_DRP(), "native", "saw_100hz.csv"))); err != nil {
+			t.Fatalf("Loaded valid drp, got an error: %s", err)
+		}
+		if is := db_drp.GetEstimatedPlaytime(); is != 2 {
+			t.Fatalf("Playtime @%dHz should be 2s, is %ds", freq, is)
+		}
+	}
+}
@@ -37,11 +37,15 @@ type DB_measure_packet struct {
 	Capacitykbits       uint32
 	Net_flow_string     string
 	Net_flow_prio       uint8
+	//DIRECTION_UPLINK or DIRECTION_DOWNLINK
+	Direction string
+	//Non DB: UE of the session (see DB_session.Ue)
+	Ue int
 }
 
 //go:inline
 func (DB_measure_packet) GetSQLStatement() string {
-	return "INSERT INTO measure_packet (time, packetsojourntimems, loadkbits, capacitykbits, ecn, dropped, fk_flow_id) VALUES ($1, $2, $3, $4, $5, $6, $7);"
+	return "INSERT INTO measure_packet (time, packetsojourntimems, loadkbits, capacitykbits, ecn, dropped, fk_flow_id, direction) VALUES ($1, $2, $3, $4, $5, $6, $7, $8);"
 }
 
 //go:inline
@@ -54,16 +58,17 @@ func (s *DB_measure_packet) GetSQLArgs() []any {
 		s.Ecn,
 		s.Dropped,
 		s.Fk_flow_id,
+		s.Direction,
 	}
 }
 
 //go:inline
 func (s *DB_measure_packet) CsvRecord() []string {
-	return []string{fmt.Sprint(s.Time), fmt.Sprint(s.PacketSojournTimeMs), fmt.Sprint(s.LoadKbits), fmt.Sprint(s.Capacitykbits), fmt.Sprint(s.Ecn), fmt.Sprint(s.Dropped), fmt.Sprint(s.Net_flow_prio), s.Net_flow_string}
+	return []string{fmt.Sprint(s.Time), fmt.Sprint(s.PacketSojournTimeMs), fmt.Sprint(s.LoadKbits), fmt.Sprint(s.Capacitykbits), fmt.Sprint(s.Ecn), fmt.Sprint(s.Dropped), fmt.Sprint(s.Net_flow_prio), s.Net_flow_string, s.Direction, fmt.Sprint(s.Ue)}
 }
 
 //go:inline
 func (s *DB_measure_packet) PrintLine() error {
-	_, err := fmt.Println(s.Time, s.PacketSojournTimeMs, s.LoadKbits, s.Capacitykbits, s.Ecn, s.Dropped, s.Net_flow_prio, s.Net_flow_string)
+	_, err := fmt.Println(s.Time, s.PacketSojournTimeMs, s.LoadKbits, s.Capacitykbits, s.Ecn, s.Dropped, s.Net_flow_prio, s.Net_flow_string, s.Direction, s.Ue)
 	return err
 }
@@ -26,24 +26,32 @@ import (
 )
 
 type DB_measure_queue struct {
-	Time              uint64
-	Memoryusagebytes  uint32
-	PacketsInQueue    uint16
-	CapacityKbits     uint64
+	Time             uint64
+	Memoryusagebytes uint32
+	PacketsInQueue   uint16
+	CapacityKbits    uint64
+	//Packets dropped and ECN marked since the previous measure,
+	//reported by the fallback backends only
+	Dropped           uint32
+	EcnMarked         uint32
 	Fk_session_tag_id int
+	//DIRECTION_UPLINK or DIRECTION_DOWNLINK
+	Direction string
+	//Non DB: UE of the session (see DB_session.Ue)
+	Ue int
 }
 
 //go:inline
 func (s DB_measure_queue) GetSQLStatement() string {
-	return "INSERT INTO measure_queue (time, memoryusagebytes, packetsinqueue, fk_session_tag_id) VALUES ($1, $2, $3, $4);"
+	return "INSERT INTO measure_queue (time, memoryusagebytes, packetsinqueue, fk_session_tag_id, direction, dropped, ecnmarked) VALUES ($1, $2, $3, $4, $5, $6, $7);"
 }
 
 //go:inline
 func (s *DB_measure_queue) GetSQLArgs() []any {
-	return []any{s.Time, s.Memoryusagebytes, s.PacketsInQueue, s.Fk_session_tag_id}
+	return []any{s.Time, s.Memoryusagebytes, s.PacketsInQueue, s.Fk_session_tag_id, s.Direction, s.Dropped, s.EcnMarked}
 }
 
 //go:inline
 func (s *DB_measure_queue) CsvRecord() []string {
-	return []string{fmt.Sprint(s.Time), fmt.Sprint(s.Memoryusagebytes), fmt.Sprint(s.PacketsInQueue)}
+	return []string{fmt.Sprint(s.Time), fmt.Sprint(s.Memoryusagebytes), fmt.Sprint(s.PacketsInQueue), s.Direction, fmt.Sprint(s.Ue), fmt.Sprint(s.Dropped), fmt.Sprint(s.EcnMarked)}
 }
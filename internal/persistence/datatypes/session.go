@@ -27,6 +27,15 @@ import (
 	"net"
 
 	"github.com/telekom/aml-jens/internal/util"
+	"github.com/telekom/aml-jens/pkg/drp"
+)
+
+// Direction of the traffic a pattern is played on
+const (
+	//Egress of Dev
+	DIRECTION_UPLINK = "uplink"
+	//Ingress of Dev, redirected to an IFB device
+	DIRECTION_DOWNLINK = "downlink"
 )
 
 type DB_session struct {
@@ -42,11 +51,90 @@ type DB_session struct {
 	Qosmode             uint8
 	L4sEnablePreMarking bool
 	Nomeasure           bool
+	//Static random loss and jitter, persisted as its spec
+	Impairment drp.Impairment
+	//Qdisc backend: janz (default), sim or a fallback (tbf, htb, fq_codel, cake).
+	//Persisted as used; auto is resolved before
+	Backend string
 	//Non DB
 	SignalDrpStart bool
+	//Raw records are written to CaptureFile, if set
+	CaptureFile string
+	//Capture to replay instead of playing ChildDRP, ReplaySpeed times as fast
+	ReplayFile  string
+	ReplaySpeed float64
+	//IFB device the ingress of Dev is redirected to, if ChildDRPDownlink is set
+	IfbDev string
+	//Address of the control api ('unix:PATH' or 'localhost:PORT'), empty to disable
+	ControlAddress string
+	//What the change loop does with missed deadlines: skip (default) or burst
+	CatchUp string
+	//The timing of every rate change is written to TimingFile as csv, if set
+	TimingFile string
 	// DB_Relations
 	ParentBenchmark *DB_benchmark
 	ChildDRP        *DB_data_rate_pattern
+	//Pattern played on the downlink (ingress), nil for uplink only
+	ChildDRPDownlink *DB_data_rate_pattern
+	//Index of the UE this session shapes, 0 for the first (parent) one
+	Ue int
+	//Session of the first UE, nil if this is the first UE
+	ParentSession *DB_session
+	//Sessions of the additional UEs played alongside this one
+	ChildUEs []*DB_session
+}
+
+// Creates the session of an additional UE, shaping dev with pattern.
+//
+// Queue settings, backend and outputs are taken from s,
+// markings can be changed on the returned session.
+func (s *DB_session) AddUe(dev string, pattern *DB_data_rate_pattern) *DB_session {
+	ue := *s
+	ue.Session_id = 0
+	ue.Ue = len(s.ChildUEs) + 1
+	ue.Name = fmt.Sprintf("%s/ue%d", s.Name, ue.Ue)
+	ue.Dev = dev
+	ue.ChildDRP = pattern
+	ue.ChildDRPDownlink = nil
+	ue.IfbDev = ""
+	ue.ParentSession = s
+	ue.ChildUEs = nil
+	if s.CaptureFile != "" {
+		ue.CaptureFile = fmt.Sprintf("%s.ue%d", s.CaptureFile, ue.Ue)
+	}
+	s.ChildUEs = append(s.ChildUEs, &ue)
+	return &ue
+}
+
+// Returns this session followed by the sessions of all additional UEs
+func (s *DB_session) Ues() []*DB_session {
+	return append([]*DB_session{s}, s.ChildUEs...)
+}
+
+func (s *DB_session) getParentSessionId() sql.NullInt64 {
+	if s.ParentSession == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: int64(s.ParentSession.Session_id), Valid: true}
+}
+
+func (s *DB_session) getImpairment() sql.NullString {
+	if !s.Impairment.Enabled() {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: s.Impairment.String(), Valid: true}
+}
+
+// Returns true if a downlink pattern is played as well
+func (s *DB_session) IsBidirectional() bool {
+	return s.ChildDRPDownlink != nil
+}
+
+func (s *DB_session) getDownlinkDrpId() sql.NullInt64 {
+	if !s.IsBidirectional() {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: int64(s.ChildDRPDownlink.Id), Valid: true}
 }
 
 // Executes a sqlstmt to Insert this session into DB
@@ -55,6 +143,11 @@ func (s *DB_session) Insert(stmt SQLStmt) error {
 	if err != nil {
 		return err
 	}
+	if s.IsBidirectional() {
+		if err := s.ChildDRPDownlink.Insert(stmt); err != nil {
+			return err
+		}
+	}
 
 	err = stmt.QueryRow(`INSERT INTO session_tag (
 	benchmark_id,
@@ -66,8 +159,13 @@ func (s *DB_session) Insert(stmt SQLStmt) error {
 	markfull,
 	extralatency,
 	qosmode,
-	l4sEnablePreMarking
-	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING session_id`,
+	l4sEnablePreMarking,
+	drp_id_downlink,
+	ue,
+	parent_session_id,
+	impairment,
+	backend
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15) RETURNING session_id`,
 		s.getBenchmarkId(),
 		s.Name,
 		s.Time,
@@ -77,8 +175,21 @@ func (s *DB_session) Insert(stmt SQLStmt) error {
 		s.Markfull,
 		s.ExtralatencyMs,
 		s.Qosmode,
-		s.L4sEnablePreMarking).Scan(&s.Session_id)
-	return err
+		s.L4sEnablePreMarking,
+		s.getDownlinkDrpId(),
+		s.Ue,
+		s.getParentSessionId(),
+		s.getImpairment(),
+		s.Backend).Scan(&s.Session_id)
+	if err != nil {
+		return err
+	}
+	for _, ue := range s.ChildUEs {
+		if err := ue.Insert(stmt); err != nil {
+			return fmt.Errorf("ue%d: %w", ue.Ue, err)
+		}
+	}
+	return nil
 }
 
 // == Insert()
@@ -117,8 +228,24 @@ func (s *DB_session) ValidateUniqueName(stmt SQLStmt) error {
 }
 
 func (s *DB_session) Validate() (err error) {
-	if _, err := net.InterfaceByName(s.Dev); err != nil {
-		return fmt.Errorf("'%s' is not a recognized interface -> %v", s.Dev, err)
+	//A simulated queue is not bound to an interface
+	if s.Backend != "sim" {
+		if _, err := net.InterfaceByName(s.Dev); err != nil {
+			return fmt.Errorf("'%s' is not a recognized interface -> %v", s.Dev, err)
+		}
+	}
+	if err := s.Impairment.Validate(); err != nil {
+		return err
+	}
+	if s.IsBidirectional() {
+		if err := s.ChildDRPDownlink.Validate(); err != nil {
+			return fmt.Errorf("downlink: %w", err)
+		}
+	}
+	for _, ue := range s.ChildUEs {
+		if err := ue.Validate(); err != nil {
+			return fmt.Errorf("ue%d: %w", ue.Ue, err)
+		}
 	}
 	return s.ChildDRP.Validate()
 }
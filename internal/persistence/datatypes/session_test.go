@@ -0,0 +1,57 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package datatypes_test
+
+import (
+	"testing"
+
+	"github.com/telekom/aml-jens/internal/persistence/datatypes"
+)
+
+func TestAddUe(t *testing.T) {
+	session := &datatypes.DB_session{
+		Name:        "tag",
+		Dev:         "eth0",
+		Markfree:    4,
+		Markfull:    14,
+		CaptureFile: "run.jcap",
+		ChildDRP:    datatypes.NewDB_data_rate_pattern(),
+	}
+	pattern := datatypes.NewDB_data_rate_pattern()
+	ue := session.AddUe("veth1", pattern)
+	ue.Markfree = 2
+	if ue.Ue != 1 || ue.Name != "tag/ue1" || ue.Dev != "veth1" || ue.ChildDRP != pattern || ue.ParentSession != session {
+		t.Fatalf("UE session is not set up correctly: %+v", ue)
+	}
+	if ue.CaptureFile != "run.jcap.ue1" || ue.Markfull != 14 {
+		t.Fatalf("UE session did not inherit settings: %+v", ue)
+	}
+	if session.Markfree != 4 || session.Dev != "eth0" {
+		t.Fatal("Changing the UE changed the parent session")
+	}
+	if ues := session.Ues(); len(ues) != 2 || ues[0] != session || ues[1] != ue {
+		t.Fatalf("Unexpected UEs %v", ues)
+	}
+	if session.AddUe("veth2", pattern).Ue != 2 {
+		t.Fatal("UEs are not numbered consecutively")
+	}
+}
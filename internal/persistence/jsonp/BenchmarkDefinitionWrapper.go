@@ -28,6 +28,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/telekom/aml-jens/internal/config"
 	"github.com/telekom/aml-jens/internal/logging"
@@ -112,8 +113,9 @@ func ReadTcValuesWithFallbacks(fb *datatypes.DB_session, tc ...*DrPlayTrafficCon
 	return mark_free, mark_full, extralatency, l4spre, signalstart, queue_size
 
 }
-func ReadDrpValuesWithFallbacks(fb *datatypes.DB_data_rate_pattern, drp ...*DrPlayDataRateConfig) (scale float64, freq int, minrate float64, warmup int32) {
+func ReadDrpValuesWithFallbacks(fb *datatypes.DB_data_rate_pattern, drp ...*DrPlayDataRateConfig) (scale float64, freq int, minrate float64, warmup int32, resample string) {
 	freq = fb.Freq
+	resample = string(fb.Resample)
 	scale = fb.Initial_scale
 	minrate = fb.Intial_minRateKbits
 	warmup = fb.WarmupTimeMs
@@ -121,6 +123,7 @@ func ReadDrpValuesWithFallbacks(fb *datatypes.DB_data_rate_pattern, drp ...*DrPl
 	scale_set := false
 	minrate_set := false
 	warmup_set := false
+	resample_set := false
 	for _, v := range drp {
 		if v == nil {
 			continue
@@ -142,9 +145,66 @@ func ReadDrpValuesWithFallbacks(fb *datatypes.DB_data_rate_pattern, drp ...*DrPl
 			warmup = int32(*v.WarmupBeforeDrpMs)
 			warmup_set = true
 		}
+		if !resample_set && v.Resample != nil {
+			resample = *v.Resample
+			resample_set = true
+		}
+
+	}
+	return scale, freq, minrate, warmup, resample
+}
+
+// Reads the impairment of the first config setting one, fb's otherwise
+func ReadImpairmentWithFallbacks(fb *datatypes.DB_session, tc ...*DrPlayTrafficControlConfig) (drp.Impairment, error) {
+	for _, v := range tc {
+		if v != nil && v.Impairment != nil {
+			return drp.ParseImpairment(*v.Impairment)
+		}
+	}
+	return fb.Impairment, nil
+}
 
+// Reads the playback mode, the first set value of each field is used.
+//
+// Benchmarks need to end: endless loops (no Repetitions) need a DurationMs.
+func ReadPlaybackModeWithFallbacks(cfgs ...*DrPlayDataRateConfig) (mode drp.PlaybackMode, err error) {
+	loop_mode := ""
+	for i := len(cfgs) - 1; i >= 0; i-- {
+		v := cfgs[i]
+		if v == nil {
+			continue
+		}
+		if v.LoopMode != nil {
+			loop_mode = *v.LoopMode
+		}
+		if v.Repetitions != nil {
+			mode.Repetitions = *v.Repetitions
+		}
+		if v.Reverse != nil {
+			mode.Reverse = *v.Reverse
+		}
+		if v.StartSample != nil {
+			mode.StartSample = *v.StartSample
+		}
+		if v.StartTimeMs != nil {
+			mode.StartTime = time.Duration(*v.StartTimeMs * float64(time.Millisecond))
+		}
+		if v.DurationMs != nil {
+			mode.Duration = time.Duration(*v.DurationMs * float64(time.Millisecond))
+		}
+	}
+	if loop_mode == "" && mode.Repetitions > 0 {
+		loop_mode = "pingpong"
+	}
+	if loop_mode != "" {
+		if mode.Loop, err = drp.ParseLoopMode(loop_mode); err != nil {
+			return mode, err
+		}
+	}
+	if mode.Loop != drp.LOOP_NONE && mode.Repetitions == 0 && mode.Duration == 0 {
+		return mode, fmt.Errorf("looping endlessly needs a DurationMs")
 	}
-	return scale, freq, minrate, warmup
+	return mode, nil
 }
 
 func LoadDB_benchmarkFromJson(path string) (*datatypes.DB_benchmark, error) {
@@ -170,18 +230,39 @@ func LoadDB_benchmarkFromJson(path string) (*datatypes.DB_benchmark, error) {
 	}
 
 	for i, v := range defintion.Patterns {
-		s, f, m, w := ReadDrpValuesWithFallbacks(play_cfg.A_Session.ChildDRP, v.Setting.DRP, defintion.DrplaySetting.DRP)
+		s, f, m, w, r := ReadDrpValuesWithFallbacks(play_cfg.A_Session.ChildDRP, v.Setting.DRP, defintion.DrplaySetting.DRP)
 		db_drp := datatypes.NewDB_data_rate_pattern()
 		db_drp.SetLooping(false)
 		db_drp.Freq = f
 		db_drp.Initial_scale = s
 		db_drp.Intial_minRateKbits = m
 		db_drp.WarmupTimeMs = w
+		if db_drp.Resample, err = drp.ParseResampleMethod(r); err != nil {
+			return nil, err
+		}
 
-		if err = db_drp.ParseDRP(drp.NewDataRatePatternFileProvider(v.Path)); err != nil {
+		provider, err := drp.NewDataRatePatternProvider(v.identifier())
+		if err != nil {
+			return nil, err
+		}
+		if err = db_drp.ParseDRP(provider); err != nil {
+			return nil, err
+		}
+		if err = db_drp.SetThresholds(v.Thresholds); err != nil {
+			return nil, fmt.Errorf("Pattern %d: %w", i, err)
+		}
+		mode, err := ReadPlaybackModeWithFallbacks(v.Setting.DRP, defintion.DrplaySetting.DRP)
+		if err != nil {
+			return nil, fmt.Errorf("Pattern %d: %w", i, err)
+		}
+		if err = db_drp.SetPlaybackMode(mode); err != nil {
 			return nil, err
 		}
 		fe, fu, el, l4, ss, qs := ReadTcValuesWithFallbacks(play_cfg.A_Session, v.Setting.TC, defintion.DrplaySetting.TC)
+		impairment, err := ReadImpairmentWithFallbacks(play_cfg.A_Session, v.Setting.TC, defintion.DrplaySetting.TC)
+		if err != nil {
+			return nil, fmt.Errorf("Pattern %d: %w", i, err)
+		}
 		benchmark.Sessions[i] = &datatypes.DB_session{
 			Markfree:            fe,
 			Markfull:            fu,
@@ -192,6 +273,7 @@ func LoadDB_benchmarkFromJson(path string) (*datatypes.DB_benchmark, error) {
 			ChildDRP:            db_drp,
 			Name:                fmt.Sprintf("%s:%s (%d/%d)", benchmark.Name, benchmark.Tag, i+1, len(benchmark.Sessions)),
 			Queuesizepackets:    qs,
+			Impairment:          impairment,
 		}
 		benchmark.Sessions[i].SetParentBenchmark(benchmark)
 	}
@@ -24,9 +24,11 @@ package jsonp_test
 import (
 	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/telekom/aml-jens/internal/persistence/jsonp"
 	"github.com/telekom/aml-jens/internal/util/utiltest"
+	"github.com/telekom/aml-jens/pkg/drp"
 )
 
 func TestNewBenchmarkDrPlaySetting(t *testing.T) {
@@ -56,3 +58,41 @@ func TestBenchmarkDrPlaySettingJsonMarshall(t *testing.T) {
 	utiltest.InJsonOutput(t, txt, "Frequency")
 	utiltest.InJsonOutput(t, txt, "WarmupBeforeDrpMs")
 }
+
+func TestReadPlaybackModeWithFallbacks(t *testing.T) {
+	var pattern, fallback jsonp.DrPlayDataRateConfig
+	if err := json.Unmarshal([]byte(`{"LoopMode":"wrap","Repetitions":3}`), &pattern); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(`{"LoopMode":"pingpong","Reverse":true,"StartTimeMs":1500,"DurationMs":60000}`), &fallback); err != nil {
+		t.Fatal(err)
+	}
+	if err := pattern.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	mode, err := jsonp.ReadPlaybackModeWithFallbacks(&pattern, nil, &fallback)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode.Loop != drp.LOOP_WRAP || mode.Repetitions != 3 || !mode.Reverse ||
+		mode.StartTime != 1500*time.Millisecond || mode.Duration != time.Minute {
+		t.Fatalf("Unexpected playback mode: %+v", mode)
+	}
+	if _, err := jsonp.ReadPlaybackModeWithFallbacks(&jsonp.DrPlayDataRateConfig{LoopMode: fallback.LoopMode}); err == nil {
+		t.Fatal("Endless loop without duration did not fail")
+	}
+	broken := "circle"
+	if err := (&jsonp.DrPlayDataRateConfig{LoopMode: &broken}).Validate(); err == nil {
+		t.Fatal("Invalid LoopMode did not fail")
+	}
+}
+
+func TestDrPlayDataRateConfigFrequency(t *testing.T) {
+	for freq, valid := range map[int]bool{1: true, 100: true, 1000: true, 1001: false, -1: false} {
+		f := freq
+		err := (&jsonp.DrPlayDataRateConfig{Frequency: &f}).Validate()
+		if (err == nil) != valid {
+			t.Fatalf("Frequency %d: valid %t, got %v", freq, valid, err)
+		}
+	}
+}
@@ -37,7 +37,9 @@ type BenchmarkPattern struct {
 	hash    []byte
 	HashStr string `json:"Hash"`
 	Setting DrplaySetting
-	pattern *datatypes.DB_data_rate_pattern
+	// Overrides the thresholds (th_*) defined by the pattern
+	Thresholds map[string]drp.Threshold `json:",omitempty"`
+	pattern    *datatypes.DB_data_rate_pattern
 }
 
 func NewBenchmarkPattern(path string, setting DrplaySetting) BenchmarkPattern {
@@ -54,15 +56,32 @@ func NewBenchmarkPattern(path string, setting DrplaySetting) BenchmarkPattern {
 func (bp *BenchmarkPattern) GetDrp() *datatypes.DB_data_rate_pattern {
 	return bp.pattern
 }
+
+// Returns Path or, if it is not set, a library identifier
+// resolving the pattern by its hash
+func (bp *BenchmarkPattern) identifier() string {
+	if bp.Path == "" && bp.HashStr != "" {
+		return drp.LIBRARY_PREFIX + bp.HashStr
+	}
+	return bp.Path
+}
+
 func (bp *BenchmarkPattern) loadPattern() error {
-	if bp.Path == "" {
-		return errors.New("can't load a pattern without a path")
+	if bp.identifier() == "" {
+		return errors.New("can't load a pattern without a path or hash")
+	}
+	if drp.IsStreamIdentifier(bp.identifier()) {
+		return errors.New("streamed patterns can't be benchmarked")
 	}
 	bp.pattern = &datatypes.DB_data_rate_pattern{
 		Intial_minRateKbits: 0.9652,
 		Initial_scale:       0.9999965,
 	}
-	return bp.pattern.ParseDRP(drp.NewDataRatePatternFileProvider(bp.Path))
+	provider, err := drp.NewDataRatePatternProvider(bp.identifier())
+	if err != nil {
+		return err
+	}
+	return bp.pattern.ParseDRP(provider)
 }
 
 func (bp *BenchmarkPattern) GetHashOfLoadedPattern() []byte {
@@ -97,7 +116,7 @@ func (bp *BenchmarkPattern) Validate() error {
 		return err
 	}
 	E := func(s string) error { return fmt.Errorf("BenchmarkPattern: %s", s) }
-	if _, err := os.Stat(bp.Path); errors.Is(err, os.ErrNotExist) {
+	if _, err := os.Stat(bp.identifier()); drp.IsFileIdentifier(bp.identifier()) && errors.Is(err, os.ErrNotExist) {
 		return E(fmt.Sprintf("File %s does not exit", bp.Path))
 	}
 	//TODO: add argument for minratekbits
@@ -112,5 +131,8 @@ func (bp *BenchmarkPattern) Validate() error {
 				bp.Path, bp.pattern.GetHashStr(), bp.HashStr))
 		}
 	}
+	if err := bp.pattern.SetThresholds(bp.Thresholds); err != nil {
+		return E(err.Error())
+	}
 	return bp.Setting.Validate()
 }
@@ -22,11 +22,13 @@
 package jsonp_test
 
 import (
+	"encoding/json"
 	"path/filepath"
 	"testing"
 
 	"github.com/telekom/aml-jens/internal/assets/paths"
 	"github.com/telekom/aml-jens/internal/persistence/jsonp"
+	"github.com/telekom/aml-jens/pkg/drp"
 )
 
 func TestNewBenchmarkPattern(t *testing.T) {
@@ -47,3 +49,75 @@ func TestNewBenchmarkPattern(t *testing.T) {
 	}
 
 }
+
+func TestNewBenchmarkPatternGenerated(t *testing.T) {
+	const ID = "gen:sine?min=12000&max=60000&period=30s"
+	data := jsonp.NewBenchmarkPattern(ID, jsonp.NewDrplaySetting(10, 1.0, 500, 999))
+	if err := data.Validate(); err != nil {
+		t.Fatalf("Validation failed: %s", err)
+	}
+	if data.HashStr == "" {
+		t.Fatal("Hash of generated pattern was not set")
+	}
+}
+
+func TestNewBenchmarkPatternSynthesized(t *testing.T) {
+	ID := "synth:bootstrap?seed=3&source=" + filepath.Join(paths.TESTDATA_DRP(), "drp_3valleys.csv")
+	data := jsonp.NewBenchmarkPattern(ID, jsonp.NewDrplaySetting(10, 1.0, 500, 999))
+	if err := data.Validate(); err != nil {
+		t.Fatalf("Validation failed: %s", err)
+	}
+	if data.HashStr == "" {
+		t.Fatal("Hash of synthesized pattern was not set")
+	}
+}
+
+func TestBenchmarkPatternFromLibrary(t *testing.T) {
+	defer paths.LIBRARY_PATH_UPDATE(paths.LIBRARY_PATH())
+	paths.LIBRARY_PATH_UPDATE(t.TempDir())
+	lib, err := drp.OpenDefaultPatternLibrary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pattern, err := drp.NewDataRatePatternFileProvider(filepath.Join(paths.TESTDATA_DRP(), "drp_3valleys.csv")).Provide(1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := lib.Add(&pattern, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := jsonp.BenchmarkPattern{HashStr: entry.Hash, Setting: jsonp.NewDrplaySetting(10, 1.0, 500, 999)}
+	if err := data.Validate(); err != nil {
+		t.Fatalf("Validation failed: %s", err)
+	}
+	if data.GetDrp().GetName() != "drp_3valleys" {
+		t.Fatalf("Pattern was not resolved from library: %s", data.GetDrp().GetName())
+	}
+	data = jsonp.BenchmarkPattern{HashStr: "00" + entry.Hash[2:], Setting: jsonp.NewDrplaySetting(10, 1.0, 500, 999)}
+	if err := data.Validate(); err == nil {
+		t.Fatal("Expected error for unknown hash")
+	}
+}
+
+func TestBenchmarkPatternThresholds(t *testing.T) {
+	var data jsonp.BenchmarkPattern
+	err := json.Unmarshal([]byte(`{"Path":"`+filepath.Join(paths.TESTDATA_DRP(), "drp_3valleys.csv")+`",
+		"Thresholds":{"th_mq_latency":{"Warn":2,"Fail":4},"th_jitter":{"Warn":1,"Fail":3,"Unit":"ms"}}}`), &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := data.Validate(); err != nil {
+		t.Fatalf("Validation failed: %s", err)
+	}
+	if data.GetDrp().GetTh_mq_latency() != "{2,4}" {
+		t.Fatalf("Threshold override was not applied: %s", data.GetDrp().GetTh_mq_latency())
+	}
+	if th := data.GetDrp().GetThresholds()["th_jitter"]; th != (drp.Threshold{Warn: 1, Fail: 3, Unit: "ms", Direction: drp.THRESHOLD_ABOVE}) {
+		t.Fatalf("Custom threshold was not applied: %+v", th)
+	}
+	data.Thresholds["th_link_usage"] = drp.Threshold{Warn: 80, Fail: 90}
+	if err := data.Validate(); err == nil {
+		t.Fatal("Expected error for link usage threshold with fail above warn")
+	}
+}
@@ -23,6 +23,9 @@ package jsonp
 
 import (
 	"fmt"
+
+	"github.com/telekom/aml-jens/internal/persistence/datatypes"
+	"github.com/telekom/aml-jens/pkg/drp"
 )
 
 type DrPlayDataRateConfig struct {
@@ -30,13 +33,25 @@ type DrPlayDataRateConfig struct {
 	Frequency         *int     `json:",omitempty"`
 	Scale             *float64 `json:",omitempty"`
 	MinRateKbits      *float64 `json:",omitempty"`
+	//Resample method for patterns declaring a native freq: hold, linear or average
+	Resample *string `json:",omitempty"`
+	//Playback mode, see drp.PlaybackMode
+	//
+	//LoopMode: none, pingpong or wrap
+	LoopMode    *string  `json:",omitempty"`
+	Repetitions *int     `json:",omitempty"`
+	Reverse     *bool    `json:",omitempty"`
+	StartSample *int     `json:",omitempty"`
+	StartTimeMs *float64 `json:",omitempty"`
+	DurationMs  *float64 `json:",omitempty"`
 }
 
 func (s *DrPlayDataRateConfig) Equals(other DrPlayDataRateConfig) bool {
 	return *s.WarmupBeforeDrpMs == *other.WarmupBeforeDrpMs &&
 		*s.Frequency == *other.Frequency &&
 		*s.Scale == *other.Scale &&
-		*s.MinRateKbits == *other.MinRateKbits
+		*s.MinRateKbits == *other.MinRateKbits &&
+		(s.Resample == other.Resample || (s.Resample != nil && other.Resample != nil && *s.Resample == *other.Resample))
 }
 
 func (s *DrPlayDataRateConfig) String() string {
@@ -61,8 +76,8 @@ func NewDrPlayDataRateConfig(WarmupBeforeDrpMs float64, Frequency int, Scale flo
 // Validate membervariables
 func (bdrp *DrPlayDataRateConfig) Validate() error {
 	E := func(s string) error { return fmt.Errorf("BenchmarkDrplaySetting: %s", s) }
-	if bdrp.Frequency != nil && (*bdrp.Frequency > 100 || *bdrp.Frequency < 0) {
-		return E("Invalid Frequency range [0-100]")
+	if bdrp.Frequency != nil && (*bdrp.Frequency > datatypes.MAX_FREQ || *bdrp.Frequency < 0) {
+		return E(fmt.Sprintf("Invalid Frequency range [0-%d]", datatypes.MAX_FREQ))
 	}
 	if bdrp.Scale != nil && *bdrp.Scale < 0.1 {
 		return E("Scale must be >= 0.1")
@@ -73,5 +88,21 @@ func (bdrp *DrPlayDataRateConfig) Validate() error {
 	if bdrp.WarmupBeforeDrpMs != nil && *bdrp.WarmupBeforeDrpMs < 0 {
 		return E("WarmupBeforeDrpMs can't be less than 0")
 	}
+	if bdrp.LoopMode != nil {
+		if _, err := drp.ParseLoopMode(*bdrp.LoopMode); err != nil {
+			return E(err.Error())
+		}
+	}
+	if (bdrp.Repetitions != nil && *bdrp.Repetitions < 0) ||
+		(bdrp.StartSample != nil && *bdrp.StartSample < 0) ||
+		(bdrp.StartTimeMs != nil && *bdrp.StartTimeMs < 0) ||
+		(bdrp.DurationMs != nil && *bdrp.DurationMs < 0) {
+		return E("Repetitions, StartSample, StartTimeMs and DurationMs can't be less than 0")
+	}
+	if bdrp.Resample != nil {
+		if _, err := drp.ParseResampleMethod(*bdrp.Resample); err != nil {
+			return E(err.Error())
+		}
+	}
 	return nil
 }
@@ -21,7 +21,11 @@
 
 package jsonp
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/telekom/aml-jens/pkg/drp"
+)
 
 type DrPlayTrafficControlConfig struct {
 	Markfree            *int32  `json:"Markfree,omitempty"`
@@ -30,6 +34,8 @@ type DrPlayTrafficControlConfig struct {
 	L4sEnablePreMarking *bool   `json:"L4sEnablePreMarking,omitempty"`
 	SignalDrpStart      *bool   `json:"SignalDrpStart,omitempty"`
 	Queuesizepackets    *uint64 `json:"Queuesizepackets,omitempty"`
+	//Random loss and jitter, see drp.ParseImpairment
+	Impairment *string `json:"Impairment,omitempty"`
 }
 
 func (s *DrPlayTrafficControlConfig) Equals(other DrPlayTrafficControlConfig) bool {
@@ -95,5 +101,10 @@ func (tcSet *DrPlayTrafficControlConfig) Validate() error {
 	if tcSet.Extralatency != nil && *tcSet.Extralatency < 0 && *tcSet.Extralatency > 100 {
 		return E(fmt.Sprintf("Extralatency should be inbetween 0 and 100; is %d", *tcSet.Extralatency))
 	}
+	if tcSet.Impairment != nil {
+		if _, err := drp.ParseImpairment(*tcSet.Impairment); err != nil {
+			return E(err.Error())
+		}
+	}
 	return nil
 }
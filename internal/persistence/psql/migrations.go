@@ -0,0 +1,59 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package psql
+
+import "fmt"
+
+// Column added to a table of the jens-db schema after its release.
+// Migrations are idempotent and applied by Init, in order.
+type migration struct {
+	table      string
+	column     string
+	definition string
+}
+
+var MIGRATIONS = []migration{
+	{"data_rate_pattern", "stats", "JSONB"},
+	{"session_tag", "drp_id_downlink", "INTEGER"},
+	{"measure_packet", "direction", "TEXT NOT NULL DEFAULT 'uplink'"},
+	{"measure_queue", "direction", "TEXT NOT NULL DEFAULT 'uplink'"},
+	{"session_tag", "ue", "INTEGER NOT NULL DEFAULT 0"},
+	{"session_tag", "parent_session_id", "INTEGER"},
+	{"session_tag", "impairment", "TEXT"},
+	{"session_tag", "backend", "TEXT NOT NULL DEFAULT 'janz'"},
+	{"measure_queue", "dropped", "BIGINT NOT NULL DEFAULT 0"},
+	{"measure_queue", "ecnmarked", "BIGINT NOT NULL DEFAULT 0"},
+}
+
+func (m migration) statement() string {
+	return fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s;", m.table, m.column, m.definition)
+}
+
+// Adds the columns of MIGRATIONS missing in the db
+func (s *DataBase) migrate() error {
+	for _, m := range MIGRATIONS {
+		if _, err := s.db.Exec(m.statement()); err != nil {
+			return fmt.Errorf("could not add column %s.%s: %w", m.table, m.column, err)
+		}
+	}
+	return nil
+}
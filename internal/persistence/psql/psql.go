@@ -79,7 +79,7 @@ func (s *DataBase) Init(login *datatypes.Login) error {
 			return err
 		}
 		s.db = db
-		if err != nil {
+		if err = s.migrate(); err != nil {
 			return err
 		}
 		if err = s.prep_bulk_stmts(); err != nil {
@@ -125,8 +125,11 @@ func (s *DataBase) GetSessionStats(session_id int) (int, int, int, error) {
 }
 
 // var flow_id_cache map[string]
+//
+// Flows are cached per session, as every UE has its own session
 func (s *DataBase) persist_flow(flow *datatypes.DB_network_flow) error {
-	flowInCache, keyExists := s.knownFlowsByMeasure_ID[flow.MeasureIdStr()]
+	key := fmt.Sprintf("%d %s", flow.Session_id, flow.MeasureIdStr())
+	flowInCache, keyExists := s.knownFlowsByMeasure_ID[key]
 	if keyExists {
 		if flow.Prio != flowInCache.Prio {
 			flow.Update(s.db, flowInCache.Flow_id, flow.Prio)
@@ -136,7 +139,7 @@ func (s *DataBase) persist_flow(flow *datatypes.DB_network_flow) error {
 		return nil
 	} else {
 		err := flow.Sync(s.db)
-		s.knownFlowsByMeasure_ID[flow.MeasureIdStr()] = flow
+		s.knownFlowsByMeasure_ID[key] = flow
 		return err
 	}
 }
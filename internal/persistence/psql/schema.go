@@ -0,0 +1,119 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package psql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/telekom/aml-jens/internal/persistence/datatypes"
+)
+
+// Columns written by the datatypes, per table (lower case, as folded by postgres)
+var SCHEMA = map[string][]string{
+	"benchmark":         {"benchmark_id", "name", "tag"},
+	"data_rate_pattern": {"drp_id", "drp_sha256", "name", "description", "loop", "freq", "scale", "minratekbits", "th_mq_latency", "th_p95_latency", "th_p99_latency", "th_p999_latency", "th_link_usage", "stats"},
+	"session_tag":       {"session_id", "benchmark_id", "name", "time", "drp_id", "dev", "markfree", "markfull", "extralatency", "qosmode", "l4senablepremarking", "drp_id_downlink", "ue", "parent_session_id", "impairment", "backend"},
+	"network_flow":      {"flow_id", "session_id", "source_ip", "source_port", "destination_ip", "destination_port", "prio"},
+	"measure_packet":    {"time", "packetsojourntimems", "loadkbits", "capacitykbits", "ecn", "dropped", "fk_flow_id", "direction"},
+	"measure_queue":     {"time", "memoryusagebytes", "packetsinqueue", "fk_session_tag_id", "direction", "dropped", "ecnmarked"},
+}
+
+// Returned by CheckSchema if tables or columns are missing
+var ErrSchemaIncomplete = errors.New("schema incomplete")
+
+// Time to wait for the db to answer the checks
+const CHECK_TIMEOUT = 5 * time.Second
+
+// Connects to the db of login and returns an error
+// if it is not reachable or a table or column of SCHEMA is missing (ErrSchemaIncomplete).
+// Columns of MIGRATIONS may be missing, Init adds them.
+func CheckSchema(login *datatypes.Login) error {
+	db, err := sql.Open("postgres", login.InfoStr())
+	if err != nil {
+		return fmt.Errorf("could not establish connection to DB: %w", err)
+	}
+	defer db.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), CHECK_TIMEOUT)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		return fmt.Errorf("%s:%d is not reachable: %w", login.Host, login.Port, err)
+	}
+	tables := make([]string, 0, len(SCHEMA))
+	for table := range SCHEMA {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	var missing []string
+	for _, table := range tables {
+		columns, err := tableColumns(ctx, db, table)
+		if err != nil {
+			return err
+		}
+		if len(columns) == 0 {
+			missing = append(missing, "table "+table)
+			continue
+		}
+		for _, column := range SCHEMA[table] {
+			if !columns[column] && !isMigrated(table, column) {
+				missing = append(missing, table+"."+column)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w, missing %s", ErrSchemaIncomplete, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func isMigrated(table string, column string) bool {
+	for _, m := range MIGRATIONS {
+		if m.table == table && m.column == column {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the columns of table in the current schema, none if there is no table
+func tableColumns(ctx context.Context, db *sql.DB, table string) (map[string]bool, error) {
+	rows, err := db.QueryContext(ctx, `SELECT column_name FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = $1`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := make(map[string]bool)
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			return nil, err
+		}
+		res[column] = true
+	}
+	return res, rows.Err()
+}
@@ -0,0 +1,196 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package drp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/telekom/aml-jens/internal/errortypes"
+)
+
+// Loss model of an Impairment
+type LossModel string
+
+const (
+	//Every packet is lost with probability P
+	LOSS_BERNOULLI LossModel = "bernoulli"
+	//Bursty loss: good and bad state with transition probabilities P (good->bad)
+	//and R (bad->good), packets are lost with LossGood/LossBad in the respective state
+	LOSS_GILBERT_ELLIOTT LossModel = "ge"
+)
+
+var LOSS_MODELS = []LossModel{LOSS_BERNOULLI, LOSS_GILBERT_ELLIOTT}
+
+// Distribution of the jitter of an Impairment
+type JitterDistribution string
+
+const (
+	JITTER_NORMAL JitterDistribution = "normal"
+	//Heavy tailed, delays are skewed towards late packets
+	JITTER_PARETO JitterDistribution = "pareto"
+)
+
+var JITTER_DISTRIBUTIONS = []JitterDistribution{JITTER_NORMAL, JITTER_PARETO}
+
+// Random loss and delay jitter applied to packets in addition to the rate limit.
+//
+// Probabilities are in [0,1], the zero value impairs nothing.
+type Impairment struct {
+	//"" for no loss
+	Loss LossModel
+	//Bernoulli: loss probability, Gilbert-Elliott: probability of good -> bad
+	P float64
+	//Gilbert-Elliott: probability of bad -> good
+	R float64
+	//Gilbert-Elliott: loss probability in the bad and good state
+	LossBad  float64
+	LossGood float64
+	DelayMs  float64
+	//Deviation of the delay
+	JitterMs     float64
+	Distribution JitterDistribution
+}
+
+// Returns true if i impairs any packet
+func (i Impairment) Enabled() bool {
+	return i.Loss != "" || i.DelayMs > 0 || i.JitterMs > 0
+}
+
+// Parses an impairment spec of comma separated key=value pairs:
+//
+// loss=bernoulli|ge, p, r, bad, good (probabilities), delay, jitter (ms), dist=normal|pareto
+//
+// e.g. 'loss=ge,p=0.01,r=0.3,jitter=5,dist=pareto'.
+// For ge r defaults to 1-p, bad to 1 and good to 0. "" results in no impairment.
+func ParseImpairment(spec string) (Impairment, error) {
+	res := Impairment{LossBad: 1, R: -1, Distribution: JITTER_NORMAL}
+	if spec == "" {
+		return Impairment{}, nil
+	}
+	targets := map[string]*float64{"p": &res.P, "r": &res.R, "bad": &res.LossBad, "good": &res.LossGood, "delay": &res.DelayMs, "jitter": &res.JitterMs}
+	for _, pair := range strings.Split(spec, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return res, errortypes.NewUserInputError("Impairment: expected key=value, got '%s'", pair)
+		}
+		key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		switch key {
+		case "loss":
+			res.Loss = LossModel(value)
+		case "dist":
+			res.Distribution = JitterDistribution(value)
+		default:
+			target, ok := targets[key]
+			if !ok {
+				return res, errortypes.NewUserInputError("Impairment: unknown key '%s'", key)
+			}
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return res, errortypes.NewUserInputError("Impairment: '%s' of %s is not a valid float64", value, key)
+			}
+			*target = f
+		}
+	}
+	if res.R < 0 {
+		res.R = 1 - res.P
+	}
+	if res.Loss != LOSS_GILBERT_ELLIOTT {
+		res.R, res.LossBad, res.LossGood = 0, 0, 0
+	}
+	return res, res.Validate()
+}
+
+func (i Impairment) Validate() error {
+	switch i.Loss {
+	case "", LOSS_BERNOULLI, LOSS_GILBERT_ELLIOTT:
+	default:
+		return errortypes.NewUserInputError("Impairment: unknown loss model '%s', expected one of %v", i.Loss, LOSS_MODELS)
+	}
+	switch i.Distribution {
+	case "", JITTER_NORMAL, JITTER_PARETO:
+	default:
+		return errortypes.NewUserInputError("Impairment: unknown distribution '%s', expected one of %v", i.Distribution, JITTER_DISTRIBUTIONS)
+	}
+	for _, v := range []float64{i.P, i.R, i.LossBad, i.LossGood} {
+		if v < 0 || v > 1 {
+			return errortypes.NewUserInputError("Impairment: probabilities must be in [0,1], got %g", v)
+		}
+	}
+	if i.DelayMs < 0 || i.DelayMs >= 10000 || i.JitterMs < 0 || i.JitterMs >= 10000 {
+		return errortypes.NewUserInputError("Impairment: delay and jitter must be in [0,10000)ms")
+	}
+	return nil
+}
+
+// Returns the spec of i, see ParseImpairment; "" if i impairs nothing
+func (i Impairment) String() string {
+	if !i.Enabled() {
+		return ""
+	}
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	pairs := make([]string, 0, 8)
+	if i.Loss != "" {
+		pairs = append(pairs, "loss="+string(i.Loss), "p="+f(i.P))
+	}
+	if i.Loss == LOSS_GILBERT_ELLIOTT {
+		pairs = append(pairs, "r="+f(i.R), "bad="+f(i.LossBad), "good="+f(i.LossGood))
+	}
+	if i.DelayMs > 0 {
+		pairs = append(pairs, "delay="+f(i.DelayMs))
+	}
+	if i.JitterMs > 0 {
+		pairs = append(pairs, "jitter="+f(i.JitterMs), fmt.Sprintf("dist=%s", i.distribution()))
+	}
+	return strings.Join(pairs, ",")
+}
+
+// Returns the distribution of the jitter, JITTER_NORMAL if not set
+func (i Impairment) distribution() JitterDistribution {
+	if i.Distribution == "" {
+		return JITTER_NORMAL
+	}
+	return i.Distribution
+}
+
+// Returns i controlled by the settings of a pattern sample.
+//
+// The loss of the sample is the loss probability (Bernoulli, if i has no
+// loss model) or the loss in the bad state (Gilbert-Elliott).
+// Its jitter replaces JitterMs, if set.
+func (i Impairment) WithSample(s SampleSettings) Impairment {
+	switch i.Loss {
+	case LOSS_GILBERT_ELLIOTT:
+		i.LossBad = s.Loss
+	case LOSS_BERNOULLI:
+		i.P = s.Loss
+	default:
+		if s.Loss > 0 {
+			i.Loss, i.P = LOSS_BERNOULLI, s.Loss
+		}
+	}
+	if s.HasJitter() {
+		i.JitterMs = s.JitterMs
+	}
+	return i
+}
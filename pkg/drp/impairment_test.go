@@ -0,0 +1,59 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package drp
+
+import "testing"
+
+func TestParseImpairment(t *testing.T) {
+	imp, err := ParseImpairment("loss=ge,p=0.01,jitter=5,dist=pareto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imp.Loss != LOSS_GILBERT_ELLIOTT || imp.R != 0.99 || imp.LossBad != 1 || imp.LossGood != 0 || imp.Distribution != JITTER_PARETO {
+		t.Fatalf("Unexpected defaults: %+v", imp)
+	}
+	again, err := ParseImpairment(imp.String())
+	if err != nil || again != imp {
+		t.Fatalf("'%s' did not round trip: %+v, %v", imp.String(), again, err)
+	}
+	if imp, err := ParseImpairment(""); err != nil || imp.Enabled() || imp.String() != "" {
+		t.Fatalf("Empty spec impairs: %+v, %v", imp, err)
+	}
+	for _, spec := range []string{"loss=random", "p=2", "delay", "dist=uniform", "jitter=-1", "burst=1"} {
+		if _, err := ParseImpairment(spec); err == nil {
+			t.Fatalf("'%s' was accepted", spec)
+		}
+	}
+}
+
+func TestImpairmentWithSample(t *testing.T) {
+	sample := SampleSettings{Loss: 0.2, MarkfreeMs: -1, MarkfullMs: -1, JitterMs: 4}
+	imp := Impairment{}.WithSample(sample)
+	if imp.Loss != LOSS_BERNOULLI || imp.P != 0.2 || imp.JitterMs != 4 {
+		t.Fatalf("Sample was not applied: %+v", imp)
+	}
+	ge := Impairment{Loss: LOSS_GILBERT_ELLIOTT, P: 0.01, R: 0.5, LossBad: 1, JitterMs: 2}
+	sample.JitterMs = -1
+	if imp := ge.WithSample(sample); imp.LossBad != 0.2 || imp.P != 0.01 || imp.JitterMs != 2 {
+		t.Fatalf("Sample was not applied to the bad state: %+v", imp)
+	}
+}
@@ -0,0 +1,210 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package drp
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/telekom/aml-jens/internal/errortypes"
+	"github.com/telekom/aml-jens/internal/util"
+)
+
+// Modulation order and code rate (x1024) of a CQI or MCS index
+// as listed in 3GPP TS 38.214. Qm = 0 marks an index without transmission.
+type ModulationCoding struct {
+	Qm           int     `json:"qm"`
+	CodeRate1024 float64 `json:"code_rate_x1024"`
+}
+
+// Spectral efficiency in bit per RE
+func (m ModulationCoding) Efficiency() float64 {
+	return float64(m.Qm) * m.CodeRate1024 / 1024
+}
+
+// TS 38.214 Table 5.2.2.1-2 (CQI 0 ... 15, 64QAM)
+var CQI_TABLE_64QAM = []ModulationCoding{
+	{0, 0}, {2, 78}, {2, 120}, {2, 193}, {2, 308}, {2, 449}, {2, 602},
+	{4, 378}, {4, 490}, {4, 616},
+	{6, 466}, {6, 567}, {6, 666}, {6, 772}, {6, 873}, {6, 948},
+}
+
+// TS 38.214 Table 5.1.3.1-1 (MCS 0 ... 28, 64QAM)
+var MCS_TABLE_64QAM = []ModulationCoding{
+	{2, 120}, {2, 157}, {2, 193}, {2, 251}, {2, 308}, {2, 379}, {2, 449}, {2, 526}, {2, 602}, {2, 679},
+	{4, 340}, {4, 378}, {4, 434}, {4, 490}, {4, 553}, {4, 616}, {4, 658},
+	{6, 438}, {6, 466}, {6, 517}, {6, 567}, {6, 616}, {6, 666}, {6, 719}, {6, 772}, {6, 822}, {6, 873}, {6, 910}, {6, 948},
+}
+
+// TS 38.214 Table 5.1.3.2-1
+var tbs_table = []int{
+	24, 32, 40, 48, 56, 64, 72, 80, 88, 96, 104, 112, 120, 128, 136, 144, 152, 160, 168, 176, 184, 192,
+	208, 224, 240, 256, 272, 288, 304, 320, 336, 352, 368, 384, 408, 432, 456, 480, 504, 528, 552, 576,
+	608, 640, 672, 704, 736, 768, 808, 848, 888, 928, 984, 1032, 1064, 1128, 1160, 1192, 1224, 1256,
+	1288, 1320, 1352, 1416, 1480, 1544, 1608, 1672, 1736, 1800, 1864, 1928, 2024, 2088, 2152, 2216,
+	2280, 2408, 2472, 2536, 2600, 2664, 2728, 2792, 2856, 2976, 3104, 3240, 3368, 3496, 3624, 3752, 3824,
+}
+
+// Parameters used to derive throughput from radio KPIs.
+// Missing keys of a json config keep their default value.
+type KPIConversion struct {
+	CqiTable []ModulationCoding `json:"cqi_table"`
+	McsTable []ModulationCoding `json:"mcs_table"`
+	//Subcarrier spacing in kHz (15, 30, 60, 120, 240)
+	ScsKhz int `json:"scs_khz"`
+	//MIMO layers, if the log does not carry them
+	Layers int `json:"layers"`
+	//Symbols per slot allocated for the shared channel
+	SymbolsPerSlot int `json:"symbols_per_slot"`
+	DmrsRePerPrb   int `json:"dmrs_re_per_prb"`
+	//xOverhead of TS 38.214
+	OverheadRePerPrb int `json:"overhead_re_per_prb"`
+	//Fraction of slots not available (e.g. TDD uplink, control), [0,1)
+	Overhead float64 `json:"overhead"`
+	//Fraction of the bandwidth usable for PRBs, if the log does not carry PRBs
+	BandwidthOccupancy float64 `json:"bandwidth_occupancy"`
+}
+
+func DefaultKPIConversion() KPIConversion {
+	return KPIConversion{
+		CqiTable:           CQI_TABLE_64QAM,
+		McsTable:           MCS_TABLE_64QAM,
+		ScsKhz:             30,
+		Layers:             1,
+		SymbolsPerSlot:     12,
+		DmrsRePerPrb:       12,
+		OverheadRePerPrb:   0,
+		Overhead:           0,
+		BandwidthOccupancy: 0.98,
+	}
+}
+
+// Loads a KPIConversion from a json file, based on DefaultKPIConversion
+func LoadKPIConversion(path string) (KPIConversion, error) {
+	res := DefaultKPIConversion()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return res, errortypes.NewUserInputError("Could not read '%s': %s", path, err)
+	}
+	if err := json.Unmarshal(data, &res); err != nil {
+		return res, errortypes.NewUserInputError("Could not parse '%s': %s", path, err)
+	}
+	return res, res.Validate()
+}
+
+func validateTable(name string, table []ModulationCoding) error {
+	if len(table) == 0 {
+		return errortypes.NewUserInputError("%s is empty", name)
+	}
+	for i, v := range table {
+		if v.Qm == 0 {
+			continue
+		}
+		if v.Qm != 1 && v.Qm != 2 && v.Qm != 4 && v.Qm != 6 && v.Qm != 8 && v.Qm != 10 {
+			return errortypes.NewUserInputError("%s[%d]: invalid modulation order %d", name, i, v.Qm)
+		}
+		if v.CodeRate1024 <= 0 || v.CodeRate1024 >= 1024 {
+			return errortypes.NewUserInputError("%s[%d]: code rate x1024 needs to be in (0,1024), is %f", name, i, v.CodeRate1024)
+		}
+	}
+	return nil
+}
+
+func (c *KPIConversion) Validate() error {
+	if err := validateTable("cqi_table", c.CqiTable); err != nil {
+		return err
+	}
+	if err := validateTable("mcs_table", c.McsTable); err != nil {
+		return err
+	}
+	if c.ScsKhz%15 != 0 || c.ScsKhz < 15 || c.ScsKhz > 240 || (c.ScsKhz/15)&(c.ScsKhz/15-1) != 0 {
+		return errortypes.NewUserInputError("scs_khz needs to be one of 15, 30, 60, 120, 240; is %d", c.ScsKhz)
+	}
+	if c.Layers < 1 || c.Layers > 8 {
+		return errortypes.NewUserInputError("layers needs to be in [1,8], is %d", c.Layers)
+	}
+	if c.SymbolsPerSlot < 1 || c.SymbolsPerSlot > 14 {
+		return errortypes.NewUserInputError("symbols_per_slot needs to be in [1,14], is %d", c.SymbolsPerSlot)
+	}
+	if c.rePerPrb() <= 0 {
+		return errortypes.NewUserInputError("dmrs_re_per_prb and overhead_re_per_prb leave no REs for data")
+	}
+	if c.Overhead < 0 || c.Overhead >= 1 {
+		return errortypes.NewUserInputError("overhead needs to be in [0,1), is %f", c.Overhead)
+	}
+	if c.BandwidthOccupancy <= 0 || c.BandwidthOccupancy > 1 {
+		return errortypes.NewUserInputError("bandwidth_occupancy needs to be in (0,1], is %f", c.BandwidthOccupancy)
+	}
+	return nil
+}
+
+func (c *KPIConversion) String() string {
+	return fmt.Sprintf("scs=%dkHz layers=%d symbols=%d dmrs_re=%d overhead_re=%d overhead=%s occupancy=%s",
+		c.ScsKhz, c.Layers, c.SymbolsPerSlot, c.DmrsRePerPrb, c.OverheadRePerPrb,
+		formatFloat(c.Overhead), formatFloat(c.BandwidthOccupancy))
+}
+
+// N'_RE of TS 38.214 5.1.3.2
+func (c *KPIConversion) rePerPrb() int {
+	return 12*c.SymbolsPerSlot - c.DmrsRePerPrb - c.OverheadRePerPrb
+}
+
+func (c *KPIConversion) slotsPerSecond() float64 {
+	return 1000 * float64(c.ScsKhz) / 15
+}
+
+// Number of PRBs fitting into bandwidth
+func (c *KPIConversion) Prbs(bandwidthMhz float64) int {
+	return int(bandwidthMhz * 1000 * c.BandwidthOccupancy / float64(12*c.ScsKhz))
+}
+
+// Transport block size in bit according to TS 38.214 5.1.3.2
+func (c *KPIConversion) TBS(mc ModulationCoding, prbs int, layers int) int {
+	n_re := util.MinInt(156, c.rePerPrb()) * prbs
+	r := mc.CodeRate1024 / 1024
+	n_info := float64(n_re) * r * float64(mc.Qm) * float64(layers)
+	if n_info <= 0 {
+		return 0
+	}
+	if n_info <= 3824 {
+		n := math.Max(3, math.Floor(math.Log2(n_info))-6)
+		n_info_q := math.Max(24, math.Exp2(n)*math.Floor(n_info/math.Exp2(n)))
+		return tbs_table[sort.SearchInts(tbs_table, int(math.Ceil(n_info_q)))]
+	}
+	n := math.Floor(math.Log2(n_info-24)) - 5
+	n_info_q := math.Max(3840, math.Exp2(n)*math.Round((n_info-24)/math.Exp2(n)))
+	c_blocks := 1.0
+	if r <= 0.25 {
+		c_blocks = math.Ceil((n_info_q + 24) / 3816)
+	} else if n_info_q > 8424 {
+		c_blocks = math.Ceil((n_info_q + 24) / 8424)
+	}
+	return int(8*c_blocks*math.Ceil((n_info_q+24)/(8*c_blocks))) - 24
+}
+
+// Throughput in kbit/s of one TBS per (available) slot
+func (c *KPIConversion) ThroughputKbits(mc ModulationCoding, prbs int, layers int) float64 {
+	return float64(c.TBS(mc, prbs, layers)) * c.slotsPerSecond() * (1 - c.Overhead) / 1000
+}
@@ -26,7 +26,11 @@ import (
 	"crypto/md5"
 	"encoding/binary"
 	"encoding/hex"
+	"math"
 	"strings"
+	"time"
+
+	"github.com/telekom/aml-jens/internal/errortypes"
 )
 
 type DataRatePattern struct {
@@ -38,6 +42,14 @@ type DataRatePattern struct {
 	Avg    float64
 	Length int
 	Sha256 []byte
+	//Offset of each sample in ms, nil if samples are equidistant
+	timestamps *[]float64
+	//Per sample link settings, nil if the pattern only carries rates
+	settings *[]SampleSettings
+	//Samples per second the pattern was recorded at, 0 if unknown
+	nativeFreq int
+	//Source of rates read while playing, nil for patterns loaded at once
+	stream *RateStream
 	//Description/Comment of DRP
 	Description string
 	//Contains key-value parameters
@@ -76,11 +88,52 @@ func NewDataRatePattern(params struct {
 			"th_p95_latency":  "{10,20}",
 			"th_p99_latency":  "{10,20}",
 			"th_p999_latency": "{10,20}",
-			"th_link_usage":   "{60,80}",
+			"th_link_usage":   "{80,60}",
 		},
 	}
 }
 
+// Creates a DataRatePattern from raw (unscaled) values.
+// Scale and MinRateKbits of params are applied, stats and hash calculated.
+//
+// Used by providers that do not read a csv.
+func newDataRatePatternFromData(raw []float64, params struct {
+	MinRateKbits float64
+	Scale        float64
+	Origin       string
+}) (*DataRatePattern, error) {
+	if params.Scale == 0 {
+		params.Scale = 1
+	}
+	if len(raw) == 0 {
+		return nil, errortypes.NewUserInputError("DRP seems to be invalid. No samples.")
+	}
+	drp := NewDataRatePattern(params)
+	drp.Name = params.Origin
+	drp.Min = math.MaxFloat64
+	drp.Max = -1
+	drp.Length = len(raw)
+	data := make([]float64, drp.Length)
+	drp.data = &data
+	var hash_buf bytes.Buffer
+	for i, v := range raw {
+		data[i] = math.Max(v*params.Scale, params.MinRateKbits)
+		if err := binary.Write(&hash_buf, binary.LittleEndian, v); err != nil {
+			return nil, err
+		}
+		drp.Max = math.Max(drp.Max, data[i])
+		drp.Min = math.Min(drp.Min, data[i])
+		drp.Avg += data[i]
+	}
+	drp.Avg /= float64(drp.Length)
+	hash := md5.New()
+	if _, err := hash.Write(hash_buf.Bytes()); err != nil {
+		return nil, err
+	}
+	drp.Sha256 = hash.Sum(nil)
+	return drp, nil
+}
+
 // Return KeyValue parameter specified by pattern or fallback
 func (s *DataRatePattern) GetMappingValue(name string, fallback string) string {
 	v, found := s.mapping[name]
@@ -90,6 +143,17 @@ func (s *DataRatePattern) GetMappingValue(name string, fallback string) string {
 	return v
 }
 
+// Returns true if the rates are read while playing.
+// Streamed patterns hold no samples.
+func (s *DataRatePattern) IsStreamed() bool {
+	return s.stream != nil
+}
+
+// Returns the source of a streamed pattern, nil otherwise
+func (s *DataRatePattern) GetStream() *RateStream {
+	return s.stream
+}
+
 // Returns the amount of samples in the pattern
 //
 //go:inline
@@ -122,11 +186,24 @@ func (s *DataRatePattern) GetOrigin() string {
 }
 
 // Sets the internal pattern to d
+//
+// NOTE: If the length of d differs, timestamps and
+// per sample settings are dropped.
 func (s *DataRatePattern) SetData(d []float64) {
 	cpy := make([]float64, len(d))
 	copy(cpy, d)
 	s.data = &cpy
-	s.iter.updateAndReset(s.data)
+	if s.timestamps != nil && len(*s.timestamps) != len(cpy) {
+		s.timestamps = nil
+	}
+	if s.settings != nil && len(*s.settings) != len(cpy) {
+		s.settings = nil
+	}
+	if s.iter != nil {
+		s.iter.updateAndReset(s.data)
+		s.iter.updateTimestamps(s.timestamps)
+		s.iter.updateSettings(s.settings)
+	}
 }
 
 // Returns the set data
@@ -136,6 +213,65 @@ func (s *DataRatePattern) GetData() *[]float64 {
 	return s.data
 }
 
+// Returns true if every sample carries its own offset
+// instead of being played at a fixed frequency
+//
+//go:inline
+func (s *DataRatePattern) IsTimed() bool {
+	return s.timestamps != nil
+}
+
+// Returns the offset of each sample in ms.
+// nil if the pattern is not timed.
+func (s *DataRatePattern) GetTimestamps() *[]float64 {
+	return s.timestamps
+}
+
+// Returns the time between the first and the last sample
+// of a timed pattern. Untimed patterns return 0.
+func (s *DataRatePattern) GetTimedDuration() time.Duration {
+	if s.timestamps == nil || len(*s.timestamps) == 0 {
+		return 0
+	}
+	t := *s.timestamps
+	return time.Duration((t[len(t)-1] - t[0]) * float64(time.Millisecond))
+}
+
+// Returns the samples per second the pattern was recorded at (#:freq=N),
+// 0 if unknown
+//
+//go:inline
+func (s *DataRatePattern) GetNativeFreq() int {
+	return s.nativeFreq
+}
+
+// Returns true if the pattern carries per sample link settings
+// (latency, loss, marking) next to its rates
+//
+//go:inline
+func (s *DataRatePattern) HasSampleSettings() bool {
+	return s.settings != nil
+}
+
+// Returns true if any sample sets the jitter of the impairment stage
+func (s *DataRatePattern) HasSampleJitter() bool {
+	if s.settings == nil {
+		return false
+	}
+	for _, set := range *s.settings {
+		if set.HasJitter() {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the per sample link settings.
+// nil if the pattern only carries rates.
+func (s *DataRatePattern) GetSampleSettings() *[]SampleSettings {
+	return s.settings
+}
+
 // Returns Sha256 hash as a byte array
 //
 //go:inline
@@ -165,6 +301,11 @@ func (s *DataRatePattern) Iterator() *DataRatePatternIterator {
 		s.iter = NewDataRatePatternIterator()
 		if s.data != nil && len(*s.data) != 0 {
 			s.iter.updateAndReset(s.data)
+			s.iter.updateTimestamps(s.timestamps)
+			s.iter.updateSettings(s.settings)
+		}
+		if s.stream != nil {
+			s.iter.updateStream(s.stream)
 		}
 	}
 	return s.iter
@@ -0,0 +1,132 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package drp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/telekom/aml-jens/internal/errortypes"
+)
+
+// Returns the duration of each sample in ms.
+// Untimed patterns are played at freq, timed patterns keep their spacing
+// (the last sample lasts as long as its predecessor).
+func (s *DataRatePattern) sampleDurationsMs(freq int) ([]float64, error) {
+	n := s.SampleCount()
+	res := make([]float64, n)
+	if s.timestamps == nil || n < 2 {
+		if freq < 1 {
+			return nil, errortypes.NewUserInputError("freq must be at least 1, is %d", freq)
+		}
+		for i := range res {
+			res[i] = 1000 / float64(freq)
+		}
+		return res, nil
+	}
+	t := *s.timestamps
+	for i := 0; i < n-1; i++ {
+		res[i] = t[i+1] - t[i]
+	}
+	res[n-1] = s.lastSpacing()
+	return res, nil
+}
+
+// Writes the pattern as Mahimahi packet-delivery trace.
+//
+// Every ms the current rate (bit/ms) is credited, each MAHIMAHI_PACKET_BITS
+// of credit result in one delivery opportunity. Untimed patterns are
+// played at freq.
+func (s *DataRatePattern) WriteMahimahi(w io.Writer, freq int) error {
+	durations, err := s.sampleDurationsMs(freq)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	credit := 0.0
+	opportunities := 0
+	end := 0.0
+	ms := 0
+	for i, v := range *s.data {
+		end += durations[i]
+		for ; float64(ms)+0.5 < end; ms++ {
+			credit += v
+			for ; credit >= MAHIMAHI_PACKET_BITS; credit -= MAHIMAHI_PACKET_BITS {
+				fmt.Fprintf(bw, "%d\n", ms+1)
+				opportunities++
+			}
+		}
+	}
+	if opportunities == 0 {
+		return errortypes.NewUserInputError("Mahimahi: '%s' does not carry a single packet", s.Name)
+	}
+	return bw.Flush()
+}
+
+// Writes the pattern as ns-3 friendly list of rate changes:
+// 'time_s rate' with rates parseable by ns3::DataRate, e.g. '0.1 12000kbps'.
+// Untimed patterns are played at freq.
+func (s *DataRatePattern) WriteNs3(w io.Writer, freq int) error {
+	durations, err := s.sampleDurationsMs(freq)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	if s.Description != "" {
+		for _, line := range strings.Split(strings.TrimSuffix(s.Description, "\n"), "\n") {
+			fmt.Fprintf(bw, "# %s\n", line)
+		}
+	}
+	fmt.Fprintln(bw, "# time_s rate")
+	offset := 0.0
+	for i, v := range *s.data {
+		fmt.Fprintf(bw, "%s %skbps\n", formatFloat(math.Round(offset)/1000), formatFloat(v))
+		offset += durations[i]
+	}
+	return bw.Flush()
+}
+
+func saveTo(path string, write func(io.Writer) error) error {
+	fp, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(fp); err != nil {
+		fp.Close()
+		return err
+	}
+	return fp.Close()
+}
+
+// Writes the pattern as Mahimahi trace to path. See WriteMahimahi
+func (s *DataRatePattern) SaveMahimahi(path string, freq int) error {
+	return saveTo(path, func(w io.Writer) error { return s.WriteMahimahi(w, freq) })
+}
+
+// Writes the pattern as ns-3 rate list to path. See WriteNs3
+func (s *DataRatePattern) SaveNs3(path string, freq int) error {
+	return saveTo(path, func(w io.Writer) error { return s.WriteNs3(w, freq) })
+}
@@ -0,0 +1,98 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package drp
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/telekom/aml-jens/internal/assets/paths"
+)
+
+var PathMahimahiShort = filepath.Join(paths.TESTDATA_DRP(), "mahimahi", "short.down")
+
+func TestMahimahiProvider(t *testing.T) {
+	data, err := NewDataRatePatternMahimahiProvider(PathMahimahiShort, 100).Provide(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareDrps([]float64{12000, 1200}, *data.data, t)
+	data, err = NewDataRatePatternMahimahiProvider(PathMahimahiShort, 50).Provide(2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareDrps([]float64{13200}, *data.data, t)
+}
+
+func TestMahimahiProviderNOK(t *testing.T) {
+	for _, p := range []*DataRatePatternMahimahiProvider{
+		NewDataRatePatternMahimahiProvider(filepath.Join(paths.TESTDATA_DRP(), "mahimahi", "broken_order.down"), 10),
+		NewDataRatePatternMahimahiProvider(PathTimedSaw, 10),
+		NewDataRatePatternMahimahiProvider(PathMahimahiShort, 0),
+	} {
+		if _, err := p.Provide(0, 0); err == nil {
+			t.Fatalf("%s @%dHz did not fail", p.Path, p.Freq)
+		}
+	}
+}
+
+func TestMahimahiRoundtrip(t *testing.T) {
+	saw := loadSaw(t)
+	out := filepath.Join(t.TempDir(), "saw.down")
+	if err := saw.SaveMahimahi(out, 10); err != nil {
+		t.Fatal(err)
+	}
+	data, err := NewDataRatePatternMahimahiProvider(out, 10).Provide(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.SampleCount() != saw.SampleCount() {
+		t.Fatalf("Expected %d samples, got %d", saw.SampleCount(), data.SampleCount())
+	}
+	for i, v := range *data.data {
+		//rates are quantized to whole packets per window
+		if diff := v - (*saw.data)[i]; diff > MAHIMAHI_PACKET_BITS/100 || diff < -MAHIMAHI_PACKET_BITS/100 {
+			t.Fatalf("Sample %d: %f != %f", i, v, (*saw.data)[i])
+		}
+	}
+}
+
+func TestWriteNs3(t *testing.T) {
+	data, err := NewDataRatePatternTimedFileProvider(PathTimedSaw).Provide(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := data.WriteNs3(&buf, 0); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if lines[len(lines)-1] != "1 50000kbps" || lines[len(lines)-2] != "0.4 40000kbps" {
+		t.Fatalf("Unexpected ns-3 output:\n%s", buf.String())
+	}
+	buf.Reset()
+	if err := loadSaw(t).WriteNs3(&buf, 0); err == nil {
+		t.Fatal("Untimed pattern without freq did not fail")
+	}
+}
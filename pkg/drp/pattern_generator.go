@@ -0,0 +1,327 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package drp
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/telekom/aml-jens/internal/errortypes"
+)
+
+// Prefix of identifiers describing a generated pattern
+//
+// e.g.: gen:sine?min=12000&max=60000&period=30s
+const GENERATOR_PREFIX = "gen:"
+
+// Function calculating the (unscaled) rate of sample i
+type generatorFunc func(g *DataRatePatternGeneratorProvider, i int, rnd *rand.Rand, last float64) float64
+
+var generators = map[string]generatorFunc{
+	"sine": func(g *DataRatePatternGeneratorProvider, i int, _ *rand.Rand, _ float64) float64 {
+		return g.Baseline + g.Amplitude*math.Sin(2*math.Pi*g.phase(i))
+	},
+	"square": func(g *DataRatePatternGeneratorProvider, i int, _ *rand.Rand, _ float64) float64 {
+		if g.phase(i) < g.Duty {
+			return g.Baseline + g.Amplitude
+		}
+		return g.Baseline - g.Amplitude
+	},
+	"sawtooth": func(g *DataRatePatternGeneratorProvider, i int, _ *rand.Rand, _ float64) float64 {
+		return g.Baseline - g.Amplitude + 2*g.Amplitude*g.phase(i)
+	},
+	"step": func(g *DataRatePatternGeneratorProvider, i int, _ *rand.Rand, _ float64) float64 {
+		if g.Steps < 2 {
+			return g.Baseline
+		}
+		level := math.Floor(g.phase(i) * float64(g.Steps))
+		return g.Baseline - g.Amplitude + 2*g.Amplitude*level/float64(g.Steps-1)
+	},
+	"randomwalk": func(g *DataRatePatternGeneratorProvider, i int, rnd *rand.Rand, last float64) float64 {
+		if i == 0 {
+			return g.Baseline
+		}
+		next := last + rnd.NormFloat64()*g.StepSize
+		return math.Max(g.Baseline-g.Amplitude, math.Min(g.Baseline+g.Amplitude, next))
+	},
+	"outage": func(g *DataRatePatternGeneratorProvider, i int, _ *rand.Rand, _ float64) float64 {
+		if g.phase(i)*g.Period.Seconds() >= g.Period.Seconds()-g.Outage.Seconds() {
+			return g.Baseline - g.Amplitude
+		}
+		return g.Baseline + g.Amplitude
+	},
+}
+
+// Provides a synthetic DataRatePattern described by an identifier
+// like 'gen:sine?min=12000&max=60000&period=30s'.
+//
+// Supported kinds: sine, square, sawtooth, step, randomwalk, outage
+//
+// Supported parameters:
+//   - min, max | baseline, amplitude (kbit/s)
+//   - period, duration (e.g. 30s)
+//   - freq: samples per second (default 10)
+//   - seed: seed of randomwalk
+//   - duty: share of a period spent at max (square)
+//   - steps: number of levels (step)
+//   - stepsize: standard deviation of a step in kbit/s (randomwalk)
+//   - outage: length of the outage at the end of each period (outage)
+type DataRatePatternGeneratorProvider struct {
+	Identifier string
+	Kind       string
+	Baseline   float64
+	Amplitude  float64
+	Period     time.Duration
+	Duration   time.Duration
+	Freq       int
+	Seed       int64
+	Duty       float64
+	Steps      int
+	StepSize   float64
+	Outage     time.Duration
+}
+
+// Returns true if identifier describes a generated pattern
+func IsGeneratorIdentifier(identifier string) bool {
+	return strings.HasPrefix(identifier, GENERATOR_PREFIX)
+}
+
+// Parses identifier into a DataRatePatternGeneratorProvider
+func NewDataRatePatternGeneratorProvider(identifier string) (*DataRatePatternGeneratorProvider, error) {
+	E := func(msg string, args ...any) error {
+		return errortypes.NewUserInputError("Generator '%s': %s", identifier, fmt.Sprintf(msg, args...))
+	}
+	if !IsGeneratorIdentifier(identifier) {
+		return nil, E("does not start with '%s'", GENERATOR_PREFIX)
+	}
+	u, err := url.Parse(identifier)
+	if err != nil {
+		return nil, E("%s", err)
+	}
+	g := &DataRatePatternGeneratorProvider{
+		Identifier: identifier,
+		Kind:       strings.ReplaceAll(u.Opaque, "-", ""),
+		Period:     10 * time.Second,
+		Freq:       10,
+		Seed:       1,
+		Duty:       0.5,
+		Steps:      5,
+		Outage:     time.Second,
+	}
+	if _, found := generators[g.Kind]; !found {
+		return nil, E("unknown kind '%s'", u.Opaque)
+	}
+	query, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return nil, E("%s", err)
+	}
+	values := make(map[string]float64)
+	for key, v := range query {
+		if len(v) != 1 {
+			return nil, E("parameter '%s' set %d times", key, len(v))
+		}
+		switch key {
+		case "period", "duration", "outage":
+			d, err := time.ParseDuration(v[0])
+			if err != nil {
+				return nil, E("'%s' is not a valid duration: %s", key, err)
+			}
+			*map[string]*time.Duration{"period": &g.Period, "duration": &g.Duration, "outage": &g.Outage}[key] = d
+		case "min", "max", "baseline", "amplitude", "freq", "seed", "duty", "steps", "stepsize":
+			f, err := strconv.ParseFloat(v[0], 64)
+			if err != nil {
+				return nil, E("'%s' is not a valid number", key)
+			}
+			values[key] = f
+		default:
+			return nil, E("unknown parameter '%s'", key)
+		}
+	}
+	if err := g.setLevels(values); err != nil {
+		return nil, E("%s", err)
+	}
+	if v, found := values["freq"]; found {
+		g.Freq = int(v)
+	}
+	if v, found := values["seed"]; found {
+		g.Seed = int64(v)
+	}
+	if v, found := values["duty"]; found {
+		g.Duty = v
+	}
+	if v, found := values["steps"]; found {
+		g.Steps = int(v)
+	}
+	g.StepSize = g.Amplitude / 10
+	if v, found := values["stepsize"]; found {
+		g.StepSize = v
+	}
+	if g.Duration == 0 {
+		g.Duration = g.Period
+	}
+	if err := g.validate(); err != nil {
+		return nil, E("%s", err)
+	}
+	return g, nil
+}
+
+// Sets Baseline and Amplitude either from min/max or baseline/amplitude
+func (g *DataRatePatternGeneratorProvider) setLevels(values map[string]float64) error {
+	min, has_min := values["min"]
+	max, has_max := values["max"]
+	baseline, has_baseline := values["baseline"]
+	amplitude, has_amplitude := values["amplitude"]
+	switch {
+	case (has_min || has_max) && (has_baseline || has_amplitude):
+		return fmt.Errorf("use either min/max or baseline/amplitude")
+	case has_min && has_max:
+		if min > max {
+			return fmt.Errorf("min (%f) is greater than max (%f)", min, max)
+		}
+		g.Baseline = (min + max) / 2
+		g.Amplitude = (max - min) / 2
+	case has_baseline:
+		g.Baseline = baseline
+		g.Amplitude = amplitude
+	default:
+		return fmt.Errorf("min and max or baseline need to be set")
+	}
+	return nil
+}
+
+func (g *DataRatePatternGeneratorProvider) validate() error {
+	if g.Baseline-g.Amplitude < 0 {
+		return fmt.Errorf("rates would become negative")
+	}
+	if g.Amplitude < 0 {
+		return fmt.Errorf("amplitude can't be negative")
+	}
+	if g.Freq < 1 {
+		return fmt.Errorf("freq must be at least 1")
+	}
+	if g.Period <= 0 || g.Duration <= 0 {
+		return fmt.Errorf("period and duration must be greater than 0")
+	}
+	if g.Duty < 0 || g.Duty > 1 {
+		return fmt.Errorf("duty must be in [0,1]")
+	}
+	if g.Outage < 0 || g.Outage > g.Period {
+		return fmt.Errorf("outage must be in [0,period]")
+	}
+	if g.SampleCount() < 1 {
+		return fmt.Errorf("duration is shorter than one sample")
+	}
+	return nil
+}
+
+// Returns the amount of samples that will be generated
+func (g *DataRatePatternGeneratorProvider) SampleCount() int {
+	return int(g.Duration.Seconds() * float64(g.Freq))
+}
+
+// Returns the position of sample i within its period [0,1)
+func (g *DataRatePatternGeneratorProvider) phase(i int) float64 {
+	t := float64(i) / float64(g.Freq)
+	p := g.Period.Seconds()
+	return math.Mod(t, p) / p
+}
+
+// Generates the raw (unscaled) samples
+func (g *DataRatePatternGeneratorProvider) generate() []float64 {
+	f := generators[g.Kind]
+	rnd := rand.New(rand.NewSource(g.Seed))
+	res := make([]float64, g.SampleCount())
+	last := g.Baseline
+	for i := range res {
+		res[i] = f(g, i, rnd, last)
+		last = res[i]
+	}
+	return res
+}
+
+func (g *DataRatePatternGeneratorProvider) Provide(scale float64, minrate float64) (DataRatePattern, error) {
+	drp, err := newDataRatePatternFromData(g.generate(), struct {
+		MinRateKbits float64
+		Scale        float64
+		Origin       string
+	}{
+		Scale:        scale,
+		MinRateKbits: minrate,
+		Origin:       g.Identifier,
+	})
+	if err != nil {
+		return DataRatePattern{}, err
+	}
+	drp.nativeFreq = g.Freq
+	drp.Description = fmt.Sprintf("Generated %s pattern: %d samples @%dHz", g.Kind, drp.Length, g.Freq)
+	return *drp, nil
+}
+
+// Returns true if identifier refers to a file, i.e. is
+// neither a generator, synthesizer, library nor stream identifier
+func IsFileIdentifier(identifier string) bool {
+	return !IsGeneratorIdentifier(identifier) && !IsSynthIdentifier(identifier) &&
+		!IsLibraryIdentifier(identifier) && !IsStreamIdentifier(identifier)
+}
+
+// Returns a provider for identifier:
+//   - generated patterns for identifiers starting with GENERATOR_PREFIX
+//   - synthesized patterns for identifiers starting with SYNTH_PREFIX
+//   - library patterns for identifiers starting with LIBRARY_PREFIX
+//   - streamed patterns for identifiers starting with STREAM_PREFIX
+//   - DataRatePatternFileProvider for anything else
+func NewDataRatePatternProvider(identifier string) (DataRatePatternProvider, error) {
+	if IsGeneratorIdentifier(identifier) {
+		g, err := NewDataRatePatternGeneratorProvider(identifier)
+		if err != nil {
+			return nil, err
+		}
+		return g, nil
+	}
+	if IsSynthIdentifier(identifier) {
+		s, err := NewDataRatePatternSynthProvider(identifier)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+	if IsLibraryIdentifier(identifier) {
+		l, err := NewDataRatePatternLibraryProvider(identifier)
+		if err != nil {
+			return nil, err
+		}
+		return l, nil
+	}
+	if IsStreamIdentifier(identifier) {
+		s, err := NewDataRatePatternStreamProvider(identifier)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+	return NewDataRatePatternFileProvider(identifier), nil
+}
@@ -0,0 +1,122 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package drp
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func provideGenerated(t *testing.T, identifier string) DataRatePattern {
+	t.Helper()
+	provider, err := NewDataRatePatternProvider(identifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := provider.Provide(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestGenerator_sine(t *testing.T) {
+	data := provideGenerated(t, "gen:sine?min=12000&max=60000&period=30s")
+	if data.Length != 300 {
+		t.Fatalf("Expected 300 samples, got %d", data.Length)
+	}
+	if data.Max != 60000 || data.Min != 12000 {
+		t.Fatalf("Got unexpected range [%f,%f]", data.Min, data.Max)
+	}
+	if math.Abs(data.Avg-36000) > 1 {
+		t.Fatalf("Got unexpected average %f", data.Avg)
+	}
+	if data.Name != "gen:sine?min=12000&max=60000&period=30s" {
+		t.Fatalf("Name was not set to identifier: %s", data.Name)
+	}
+}
+
+func TestGenerator_kinds(t *testing.T) {
+	expected := map[string][]float64{
+		"gen:square?min=10&max=20&period=1s&freq=4":                         {20, 20, 10, 10, 20, 20, 10, 10},
+		"gen:sawtooth?min=0&max=40&period=1s&freq=4":                        {0, 10, 20, 30, 0, 10, 20, 30},
+		"gen:step?min=10&max=30&period=1s&freq=4&steps=2":                   {10, 10, 30, 30, 10, 10, 30, 30},
+		"gen:outage?baseline=50&amplitude=50&period=1s&freq=4&outage=500ms": {100, 100, 0, 0, 100, 100, 0, 0},
+	}
+	for id, e := range expected {
+		g, err := NewDataRatePatternGeneratorProvider(id + "&duration=2s")
+		if err != nil {
+			t.Fatal(err)
+		}
+		compareDrps(e, g.generate(), t)
+	}
+}
+
+func TestGenerator_randomwalk_seed(t *testing.T) {
+	a := provideGenerated(t, "gen:random-walk?min=1000&max=2000&seed=42&duration=1m")
+	b := provideGenerated(t, "gen:random-walk?min=1000&max=2000&seed=42&duration=1m")
+	c := provideGenerated(t, "gen:random-walk?min=1000&max=2000&seed=43&duration=1m")
+	if a.GetHashStr() != b.GetHashStr() {
+		t.Fatal("Same seed produced different patterns")
+	}
+	if a.GetHashStr() == c.GetHashStr() {
+		t.Fatal("Different seeds produced the same pattern")
+	}
+	if a.Min < 1000 || a.Max > 2000 {
+		t.Fatalf("Random walk left its range [%f,%f]", a.Min, a.Max)
+	}
+}
+
+func TestGenerator_NOK(t *testing.T) {
+	for _, id := range []string{
+		"gen:unknown?min=1&max=2",
+		"gen:sine",
+		"gen:sine?min=2&max=1",
+		"gen:sine?min=1&max=2&baseline=3",
+		"gen:sine?baseline=1&amplitude=2",
+		"gen:sine?min=1&max=2&period=abc",
+		"gen:sine?min=1&max=2&foo=1",
+		"gen:sine?min=1&max=2&duration=1ms",
+	} {
+		if _, err := NewDataRatePatternGeneratorProvider(id); err == nil {
+			t.Fatalf("Expected error for '%s'", id)
+		}
+	}
+}
+
+func TestGenerator_Provider(t *testing.T) {
+	p, err := NewDataRatePatternProvider(PathSaw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.(*DataRatePatternFileProvider); !ok {
+		t.Fatal("Path did not resolve to a DataRatePatternFileProvider")
+	}
+	g, err := NewDataRatePatternGeneratorProvider("gen:sine?min=1&max=2&period=1m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Duration != time.Minute {
+		t.Fatal("Duration does not default to period")
+	}
+}
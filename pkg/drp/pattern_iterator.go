@@ -22,31 +22,271 @@
 package drp
 
 import (
+	"math"
+	"sort"
+	"time"
+
 	"github.com/telekom/aml-jens/internal/errortypes"
 	"github.com/telekom/aml-jens/internal/util"
 )
 
+type LoopMode uint8
+
+const (
+	//Play once
+	LOOP_NONE LoopMode = iota
+	//Play forth and back, doubling the samples at both ends
+	LOOP_PINGPONG
+	//Start over at the first sample after the last one
+	LOOP_WRAP
+)
+
+var loopModeNames = map[string]LoopMode{"none": LOOP_NONE, "pingpong": LOOP_PINGPONG, "wrap": LOOP_WRAP}
+
+func ParseLoopMode(mode string) (LoopMode, error) {
+	if v, ok := loopModeNames[mode]; ok {
+		return v, nil
+	}
+	return LOOP_NONE, errortypes.NewUserInputError("Unknown loop mode '%s', expected none, pingpong or wrap", mode)
+}
+
+func (m LoopMode) String() string {
+	for k, v := range loopModeNames {
+		if v == m {
+			return k
+		}
+	}
+	return "unknown"
+}
+
+// Defines how a DataRatePatternIterator plays a pattern
+type PlaybackMode struct {
+	Loop LoopMode
+	//Number of passes through the pattern before stopping, 0 = endless.
+	//Ignored for LOOP_NONE
+	Repetitions int
+	//Play the pattern backwards
+	Reverse bool
+	//First sample to play (in playing direction)
+	StartSample int
+	//Time into the pattern to start at; overrides StartSample if > 0
+	StartTime time.Duration
+	//Stop after playing for Duration, 0 = no cap
+	Duration time.Duration
+	//Samples per second of untimed patterns; needed for StartTime and Duration
+	Freq int
+}
+
+func (m *PlaybackMode) Validate(timed bool) error {
+	if m.Repetitions < 0 || m.StartSample < 0 || m.StartTime < 0 || m.Duration < 0 {
+		return errortypes.NewUserInputError("Repetitions, start and duration can't be negative")
+	}
+	if !timed && (m.StartTime > 0 || m.Duration > 0) && m.Freq < 1 {
+		return errortypes.NewUserInputError("StartTime and Duration of untimed patterns need a freq")
+	}
+	return nil
+}
+
 type DataRatePatternIterator struct {
-	looping  bool
-	operator int
-	data     *[]float64
+	mode PlaybackMode
+	data *[]float64
+	//position in playing direction, -1 before the first call to Next
 	position int
-	value    float64
+	//+1 or -1; changes at the ends of a ping-pong loop
+	direction int
+	//completed passes through the pattern
+	passes int
+	//number of values returned by Next
+	played int
+	done   bool
+	value  float64
+	//index of value in data, -1 before the first call to Next
+	index int
+	//Offset of each sample in ms, nil for untimed patterns
+	timestamps *[]float64
+	//Offset in ms at which value is due
+	offset float64
+	//Offset in ms of the first played value
+	first_offset float64
+	//Per sample link settings, nil if not set
+	settings *[]SampleSettings
+	//Source of streamed patterns, nil otherwise
+	stream *RateStream
+	//Time of the first call to Next of a streamed pattern
+	stream_start time.Time
+	//Position Next continues at, -1 if not seeking
+	seek int
 }
 
 func NewDataRatePatternIterator() *DataRatePatternIterator {
 	return &DataRatePatternIterator{
-		looping:  false,
-		operator: +1,
-		position: -1,
+		direction: +1,
+		position:  -1,
+		index:     -1,
+		seek:      -1,
 	}
 }
 
 // updates internal data pointer as well as position and value
 func (s *DataRatePatternIterator) updateAndReset(drp *[]float64) {
 	s.data = drp
+	s.reset()
+}
+
+// Resets to the state before the first call to Next
+func (s *DataRatePatternIterator) reset() {
 	s.position = -1
-	s.value = (*drp)[0]
+	s.direction = +1
+	s.passes = 0
+	s.played = 0
+	s.done = false
+	s.index = -1
+	s.offset = 0
+	s.seek = -1
+	if s.data != nil && len(*s.data) > 0 {
+		s.value = (*s.data)[s.toIndex(s.startPosition())]
+	}
+}
+
+// updates internal timestamp pointer. nil turns timing off
+func (s *DataRatePatternIterator) updateTimestamps(timestamps *[]float64) {
+	s.timestamps = timestamps
+	s.reset()
+}
+
+// updates internal settings pointer. nil turns settings off
+func (s *DataRatePatternIterator) updateSettings(settings *[]SampleSettings) {
+	s.settings = settings
+}
+
+// Reads values from stream instead of data
+func (s *DataRatePatternIterator) updateStream(stream *RateStream) {
+	s.stream = stream
+	s.value = stream.initial()
+}
+
+// Sets the PlaybackMode and resets the iterator
+func (s *DataRatePatternIterator) SetPlaybackMode(mode PlaybackMode) error {
+	if err := mode.Validate(s.IsTimed()); err != nil {
+		return err
+	}
+	s.mode = mode
+	s.reset()
+	return nil
+}
+
+func (s *DataRatePatternIterator) GetPlaybackMode() PlaybackMode {
+	return s.mode
+}
+
+// Maps a position in playing direction to an index of data
+func (s *DataRatePatternIterator) toIndex(position int) int {
+	if s.mode.Reverse {
+		return len(*s.data) - 1 - position
+	}
+	return position
+}
+
+// Offset (ms) of the sample at position, relative to the first sample in playing direction
+func (s *DataRatePatternIterator) relativeTime(position int) float64 {
+	t := *s.timestamps
+	return math.Abs(t[s.toIndex(position)] - t[s.toIndex(0)])
+}
+
+func (s *DataRatePatternIterator) startPosition() int {
+	if s.mode.StartTime <= 0 {
+		return util.MinInt(s.mode.StartSample, len(*s.data)-1)
+	}
+	return s.positionAt(s.mode.StartTime)
+}
+
+// Returns the position of the sample played d into the pattern
+func (s *DataRatePatternIterator) positionAt(d time.Duration) int {
+	n := len(*s.data)
+	ms := float64(d) / float64(time.Millisecond)
+	if s.timestamps == nil {
+		return util.MinInt(int(math.Round(ms*float64(s.mode.Freq)/1000)), n-1)
+	}
+	return util.MinInt(sort.Search(n, func(i int) bool { return s.relativeTime(i) >= ms }), n-1)
+}
+
+// Returns the position (in playing direction) of the last value
+// returned by Next, -1 before the first call
+func (s *DataRatePatternIterator) Position() int {
+	return s.position
+}
+
+// Returns the number of values returned by Next
+func (s *DataRatePatternIterator) Played() int {
+	return s.played
+}
+
+// Continues playback at position (in playing direction) with the next call to Next.
+// Timed patterns keep their offset, as if position followed the current sample.
+func (s *DataRatePatternIterator) Seek(position int) error {
+	if s.stream != nil {
+		return errortypes.NewUserInputError("Streamed patterns can't seek")
+	}
+	if position < 0 || position >= len(*s.data) {
+		return errortypes.NewUserInputError("Position %d is out of range [0, %d]", position, len(*s.data)-1)
+	}
+	if s.done {
+		return errortypes.NewUserInputError("Pattern has finished")
+	}
+	s.seek = position
+	return nil
+}
+
+// Continues playback at the sample played d into the pattern, see Seek.
+// Untimed patterns need the freq of the PlaybackMode.
+func (s *DataRatePatternIterator) SeekTime(d time.Duration) error {
+	if s.stream != nil {
+		return errortypes.NewUserInputError("Streamed patterns can't seek")
+	}
+	if d < 0 || (s.timestamps == nil && s.mode.Freq < 1) {
+		return errortypes.NewUserInputError("Can't seek to %s", d)
+	}
+	return s.Seek(s.positionAt(d))
+}
+
+// Spacing (ms) between the sample at index and its neighbour;
+// this is how long doubled samples and the last sample of a pass are held.
+func (s *DataRatePatternIterator) spacing(index int) float64 {
+	t := *s.timestamps
+	switch {
+	case len(t) < 2:
+		return 0
+	case index == 0:
+		return t[1] - t[0]
+	default:
+		return t[index] - t[index-1]
+	}
+}
+
+// Advances the offset from the sample at prev to the current sample.
+//
+// A doubled sample (at the turning point of a loop) is held
+// as long as the spacing next to it. When wrapping around the
+// last sample is held as long as the spacing before it.
+func (s *DataRatePatternIterator) advanceOffset(prev int, wrapped bool) {
+	if s.timestamps == nil {
+		return
+	}
+	t := *s.timestamps
+	switch {
+	case prev == -1:
+		//A pattern played from its start keeps its initial offset
+		if s.index == 0 && !s.mode.Reverse {
+			s.offset = t[0]
+		}
+		s.first_offset = s.offset
+	case wrapped:
+		s.offset += s.spacing(prev)
+	case prev != s.index:
+		s.offset += math.Abs(t[s.index] - t[prev])
+	default:
+		s.offset += s.spacing(s.index)
+	}
 }
 
 // Retunrs last value
@@ -54,50 +294,132 @@ func (s *DataRatePatternIterator) Value() float64 {
 	return s.value
 }
 
+// Returns true if the underlying pattern is timed.
+// Use Offset to retrieve the time a value is due.
+func (s *DataRatePatternIterator) IsTimed() bool {
+	return s.timestamps != nil
+}
+
+// Returns the offset (relative to the start of playback) at which
+// the last value returned by Next is due.
+//
+// Only meaningful for timed patterns; always 0 otherwise.
+func (s *DataRatePatternIterator) Offset() time.Duration {
+	return time.Duration(s.offset * float64(time.Millisecond))
+}
+
+// Returns the link settings belonging to the last value
+// returned by Next. ok is false if the pattern has no
+// per sample settings.
+func (s *DataRatePatternIterator) Settings() (settings SampleSettings, ok bool) {
+	if s.settings == nil {
+		return settings, false
+	}
+	return (*s.settings)[util.MaxInt(s.index, 0)], true
+}
+
+// Returns true if another pass may be started
+func (s *DataRatePatternIterator) nextPass() bool {
+	s.passes++
+	if s.mode.Loop == LOOP_NONE {
+		return false
+	}
+	return s.mode.Repetitions == 0 || s.passes < s.mode.Repetitions
+}
+
+func (s *DataRatePatternIterator) stop() (float64, error) {
+	s.done = true
+	if s.stream != nil {
+		s.stream.Close()
+	}
+	return 0, &errortypes.IterableStopError{}
+}
+
+// Waits for the next value of a streamed pattern.
+// See RateStream.next
+func (s *DataRatePatternIterator) nextStreamed() (float64, error) {
+	if s.played == 0 {
+		s.stream_start = time.Now()
+	} else if s.mode.Duration > 0 && time.Since(s.stream_start) >= s.mode.Duration {
+		return s.stop()
+	}
+	v, err := s.stream.next(s.value)
+	if err != nil {
+		return s.stop()
+	}
+	s.played++
+	s.value = v
+	return v, nil
+}
+
 // Get next Value
 func (s *DataRatePatternIterator) Next() (float64, error) {
-	switch max_i := len(*s.data); {
-	case s.position == -1:
-		s.position += s.operator * 2
-	case s.position >= max_i || s.position <= 0:
-		at_max := s.position >= max_i
-		//We are at the end of a cycle
-		if !s.looping {
-			return 0, &errortypes.IterableStopError{}
+	if s.done {
+		return s.stop()
+	}
+	if s.stream != nil {
+		return s.nextStreamed()
+	}
+	n := len(*s.data)
+	prev := s.index
+	wrapped := false
+	if s.seek != -1 {
+		s.position = s.seek
+		s.seek = -1
+		//Offsets continue as after a wrap
+		wrapped = prev != -1
+	} else if s.position == -1 {
+		s.position = s.startPosition()
+	} else if next := s.position + s.direction; next >= 0 && next < n {
+		s.position = next
+	} else {
+		//We are at the end of a pass
+		if !s.nextPass() {
+			return s.stop()
 		}
-		//reverse driection
-		s.operator *= -1
-		if at_max {
-			//double last value and continue at last -1
-			s.position += s.operator * 2
-		} else /* at_min*/ {
-			//start back up at 0- doubling it
-			s.position = -1
-			s.value = (*s.data)[0]
+		if s.mode.Loop == LOOP_WRAP {
+			s.position = 0
+			wrapped = true
+		} else {
+			//reverse direction, doubling the last value
+			s.direction *= -1
 		}
-
-	default:
-		s.position += s.operator
-		index := util.MinInt(max_i-1, util.AbsInt(s.position-s.operator))
-		s.value = (*s.data)[index]
 	}
+	s.index = s.toIndex(s.position)
+	s.advanceOffset(prev, wrapped)
+	if s.mode.Duration > 0 {
+		if s.timestamps != nil && s.Offset()-time.Duration(s.first_offset*float64(time.Millisecond)) >= s.mode.Duration {
+			return s.stop()
+		}
+		if s.timestamps == nil && time.Duration(s.played)*time.Second >= s.mode.Duration*time.Duration(s.mode.Freq) {
+			return s.stop()
+		}
+	}
+	s.played++
+	s.value = (*s.data)[s.index]
 	return s.value, nil
 }
 
-// Turns on / off looping-mode
+// Turns on (ping-pong) / off looping-mode
 func (s *DataRatePatternIterator) SetLooping(endless bool) {
-	s.looping = endless
+	if !endless {
+		s.mode.Loop = LOOP_NONE
+	} else if s.mode.Loop == LOOP_NONE {
+		s.mode.Loop = LOOP_PINGPONG
+	}
 }
 
 // returns if looping is on
 func (s *DataRatePatternIterator) IsLooping() bool {
-	return s.looping
+	return s.mode.Loop != LOOP_NONE
 }
 
 // Sets the Iterator to a Doen state.
 // Subsequent calls to Next will raise an IterableStopError
 func (s *DataRatePatternIterator) SetDone() {
 	s.SetLooping(false)
-	s.operator = +1
-	s.position = len(*s.data)
+	s.done = true
+	if s.stream != nil {
+		s.stream.Close()
+	}
 }
@@ -24,6 +24,7 @@ package drp
 import (
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/telekom/aml-jens/internal/assets/paths"
 )
@@ -135,6 +136,142 @@ func TestIterator_saw_loop(t *testing.T) {
 	}
 }
 
+// Plays iter until it stops or max values were returned
+func playAll(iter *DataRatePatternIterator, max int) []float64 {
+	res := []float64{}
+	for v, err := iter.Next(); err == nil && len(res) < max; v, err = iter.Next() {
+		res = append(res, v)
+	}
+	return res
+}
+
+func TestIterator_modes(t *testing.T) {
+	data := []float64{1, 2, 3, 4}
+	cases := []struct {
+		name     string
+		mode     PlaybackMode
+		expected []float64
+	}{
+		{"once", PlaybackMode{}, []float64{1, 2, 3, 4}},
+		{"wrap", PlaybackMode{Loop: LOOP_WRAP}, []float64{1, 2, 3, 4, 1, 2, 3, 4, 1, 2, 3, 4}},
+		{"wrap_count", PlaybackMode{Loop: LOOP_WRAP, Repetitions: 2}, []float64{1, 2, 3, 4, 1, 2, 3, 4}},
+		{"pingpong_count", PlaybackMode{Loop: LOOP_PINGPONG, Repetitions: 3}, []float64{1, 2, 3, 4, 4, 3, 2, 1, 1, 2, 3, 4}},
+		{"count_without_loop", PlaybackMode{Repetitions: 3}, []float64{1, 2, 3, 4}},
+		{"reverse", PlaybackMode{Reverse: true}, []float64{4, 3, 2, 1}},
+		{"reverse_wrap", PlaybackMode{Reverse: true, Loop: LOOP_WRAP, Repetitions: 2}, []float64{4, 3, 2, 1, 4, 3, 2, 1}},
+		{"start", PlaybackMode{StartSample: 2, Loop: LOOP_WRAP, Repetitions: 2}, []float64{3, 4, 1, 2, 3, 4}},
+		{"start_reverse", PlaybackMode{StartSample: 1, Reverse: true}, []float64{3, 2, 1}},
+		{"start_time", PlaybackMode{StartTime: 500 * time.Millisecond, Freq: 2}, []float64{2, 3, 4}},
+		{"start_beyond_end", PlaybackMode{StartSample: 10}, []float64{4}},
+		{"duration", PlaybackMode{Loop: LOOP_WRAP, Duration: 3 * time.Second, Freq: 2}, []float64{1, 2, 3, 4, 1, 2}},
+	}
+	for _, c := range cases {
+		p := DataRatePattern{data: &data}
+		iter := p.Iterator()
+		if err := iter.SetPlaybackMode(c.mode); err != nil {
+			t.Fatalf("%s: %s", c.name, err)
+		}
+		if iter.Value() != c.expected[0] {
+			t.Fatalf("%s: Value before first call to Next() is %f", c.name, iter.Value())
+		}
+		res := playAll(iter, 12)
+		if len(res) != len(c.expected) {
+			t.Fatalf("%s: expected %v, got %v", c.name, c.expected, res)
+		}
+		compareDrps(c.expected, res, t)
+	}
+	p := DataRatePattern{data: &data}
+	if err := p.Iterator().SetPlaybackMode(PlaybackMode{Duration: time.Second}); err == nil {
+		t.Fatal("Duration of untimed pattern without freq did not fail")
+	}
+}
+
+func TestIterator_modes_timed(t *testing.T) {
+	//saw_timed: 0,100,150,400,1000 ms
+	data, err := NewDataRatePatternTimedFileProvider(PathTimedSaw).Provide(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name    string
+		mode    PlaybackMode
+		offsets []time.Duration
+	}{
+		{"wrap", PlaybackMode{Loop: LOOP_WRAP, Repetitions: 2}, []time.Duration{0, 100, 150, 400, 1000, 1600, 1700, 1750, 2000, 2600}},
+		{"reverse", PlaybackMode{Reverse: true}, []time.Duration{0, 600, 850, 900, 1000}},
+		{"start_time", PlaybackMode{StartTime: 120 * time.Millisecond}, []time.Duration{0, 250, 850}},
+		{"duration", PlaybackMode{Loop: LOOP_WRAP, Duration: 1700 * time.Millisecond}, []time.Duration{0, 100, 150, 400, 1000, 1600}},
+	}
+	for _, c := range cases {
+		iter := data.Iterator()
+		if err := iter.SetPlaybackMode(c.mode); err != nil {
+			t.Fatal(err)
+		}
+		pos := 0
+		for _, err := iter.Next(); err == nil; _, err = iter.Next() {
+			if pos >= len(c.offsets) {
+				t.Fatalf("%s: played more than %d samples", c.name, len(c.offsets))
+			}
+			if iter.Offset() != c.offsets[pos]*time.Millisecond {
+				t.Fatalf("%s: offset @%d is %s, expected %s", c.name, pos, iter.Offset(), c.offsets[pos]*time.Millisecond)
+			}
+			pos++
+		}
+		if pos != len(c.offsets) {
+			t.Fatalf("%s: played %d samples, expected %d", c.name, pos, len(c.offsets))
+		}
+	}
+}
+
+func TestIteratorSeek(t *testing.T) {
+	data := []float64{1, 2, 3, 4, 5}
+	p := DataRatePattern{data: &data}
+	iter := p.Iterator()
+	if err := iter.SetPlaybackMode(PlaybackMode{Freq: 2}); err != nil {
+		t.Fatal(err)
+	}
+	iter.Next()
+	if err := iter.Seek(3); err != nil {
+		t.Fatal(err)
+	}
+	compareDrps([]float64{4, 5}, playAll(iter, 10), t)
+	if err := iter.Seek(0); err == nil {
+		t.Fatal("Seeking in a finished pattern did not fail")
+	}
+	iter.SetPlaybackMode(PlaybackMode{Freq: 2})
+	if err := iter.SeekTime(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	compareDrps([]float64{3, 4, 5}, playAll(iter, 10), t)
+	if iter.Position() != 4 || iter.Played() != 3 {
+		t.Fatalf("Position %d, played %d after seeking", iter.Position(), iter.Played())
+	}
+	for _, position := range []int{-1, 5} {
+		if err := iter.Seek(position); err == nil {
+			t.Fatalf("Seeking to %d did not fail", position)
+		}
+	}
+}
+
+func TestIteratorSeek_timed(t *testing.T) {
+	//saw_timed: 0,100,150,400,1000 ms
+	data, err := NewDataRatePatternTimedFileProvider(PathTimedSaw).Provide(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iter := data.Iterator()
+	iter.Next()
+	iter.Next()
+	if err := iter.SeekTime(400 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	iter.Next()
+	//Sample at 400ms follows the one at 100ms after the spacing of the latter
+	if iter.Position() != 3 || iter.Offset() != 200*time.Millisecond {
+		t.Fatalf("Position %d, offset %s after seeking", iter.Position(), iter.Offset())
+	}
+}
+
 var result float64
 
 func BenchmarkDRPIter(b *testing.B) {
@@ -0,0 +1,311 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package drp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/telekom/aml-jens/internal/assets/paths"
+	"github.com/telekom/aml-jens/internal/errortypes"
+)
+
+// Prefix of identifiers referring to a pattern of the library
+// at paths.LIBRARY_PATH() by name or (prefix of its) hash
+//
+// e.g.: lib:munich_autobahn, lib:3f2a9c
+const LIBRARY_PREFIX = "lib:"
+
+// Name of the index file within a library
+const LIBRARY_INDEX = "index.json"
+
+// Minimum length of a hash prefix to resolve a pattern by
+const LIBRARY_MIN_HASH_PREFIX = 6
+
+// Metadata of a pattern stored in a PatternLibrary
+type PatternLibraryEntry struct {
+	// Content hash (see DataRatePattern.GetHashStr)
+	Hash        string `json:"hash"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// th_* mappings of the comment header
+	Mappings map[string]string    `json:"mappings,omitempty"`
+	Tags     []string             `json:"tags,omitempty"`
+	Timed    bool                 `json:"timed,omitempty"`
+	Freq     int                  `json:"freq,omitempty"`
+	Stats    DataRatePatternStats `json:"stats"`
+}
+
+// Returns true if the entry carries all tags
+func (e *PatternLibraryEntry) HasTags(tags ...string) bool {
+	for _, tag := range normalizeTags(tags) {
+		idx := sort.SearchStrings(e.Tags, tag)
+		if idx == len(e.Tags) || e.Tags[idx] != tag {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns true if every whitespace separated term of query is
+// contained (case insensitive) in the name, description, tags or
+// mapping keys of the entry
+func (e *PatternLibraryEntry) Matches(query string) bool {
+	haystack := strings.ToLower(strings.Join([]string{e.Name, e.Description, strings.Join(e.Tags, " ")}, " "))
+	for k := range e.Mappings {
+		haystack += " " + strings.ToLower(k)
+	}
+	for _, term := range strings.Fields(strings.ToLower(query)) {
+		if !strings.Contains(haystack, term) {
+			return false
+		}
+	}
+	return true
+}
+
+// Stores patterns as csv files named by their content hash
+// and keeps an index of their metadata:
+//
+//	<root>/index.json
+//	<root>/patterns/<hash>.csv
+type PatternLibrary struct {
+	Root    string
+	entries []PatternLibraryEntry
+}
+
+// Opens the library at root. A missing index is treated as empty library.
+func OpenPatternLibrary(root string) (*PatternLibrary, error) {
+	lib := &PatternLibrary{Root: root, entries: make([]PatternLibraryEntry, 0)}
+	data, err := os.ReadFile(filepath.Join(root, LIBRARY_INDEX))
+	if errors.Is(err, os.ErrNotExist) {
+		return lib, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &lib.entries); err != nil {
+		return nil, errortypes.NewUserInputError("Library index '%s' is invalid: %s", filepath.Join(root, LIBRARY_INDEX), err)
+	}
+	return lib, nil
+}
+
+// Opens the library at paths.LIBRARY_PATH()
+func OpenDefaultPatternLibrary() (*PatternLibrary, error) {
+	return OpenPatternLibrary(paths.LIBRARY_PATH())
+}
+
+// Returns all entries sorted by name
+func (l *PatternLibrary) Entries() []PatternLibraryEntry {
+	res := make([]PatternLibraryEntry, len(l.entries))
+	copy(res, l.entries)
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
+// Returns all entries (sorted by name) matching query and carrying all tags.
+// See PatternLibraryEntry.Matches
+func (l *PatternLibrary) Search(query string, tags ...string) []PatternLibraryEntry {
+	res := make([]PatternLibraryEntry, 0)
+	for _, e := range l.Entries() {
+		if e.Matches(query) && e.HasTags(tags...) {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+// Returns the entry named ref or the entry whose hash starts
+// with ref (at least LIBRARY_MIN_HASH_PREFIX characters).
+func (l *PatternLibrary) Resolve(ref string) (PatternLibraryEntry, error) {
+	ref = strings.TrimPrefix(ref, LIBRARY_PREFIX)
+	for _, e := range l.entries {
+		if e.Name == ref || e.Hash == ref {
+			return e, nil
+		}
+	}
+	var found []PatternLibraryEntry
+	if len(ref) >= LIBRARY_MIN_HASH_PREFIX {
+		for _, e := range l.entries {
+			if strings.HasPrefix(e.Hash, strings.ToLower(ref)) {
+				found = append(found, e)
+			}
+		}
+	}
+	switch len(found) {
+	case 0:
+		return PatternLibraryEntry{}, errortypes.NewUserInputError("No pattern '%s' in library '%s'", ref, l.Root)
+	case 1:
+		return found[0], nil
+	default:
+		return PatternLibraryEntry{}, errortypes.NewUserInputError("Hash prefix '%s' is ambiguous (%d patterns)", ref, len(found))
+	}
+}
+
+// Returns the path of the csv storing the pattern of entry
+func (l *PatternLibrary) PatternPath(entry PatternLibraryEntry) string {
+	return filepath.Join(l.Root, "patterns", entry.Hash+".csv")
+}
+
+// Returns a provider loading the pattern of entry.
+// Provided patterns are named like the entry.
+func (l *PatternLibrary) Provider(entry PatternLibraryEntry) DataRatePatternProvider {
+	return &DataRatePatternLibraryProvider{Path: l.PatternPath(entry), Entry: entry}
+}
+
+// Adds pattern (loaded at scale 1, minrate 0) to the library and returns its entry.
+// The name defaults to the file name of the pattern's origin. Tags are
+// merged with the ones set by '#:tags=a,b' in its comment header.
+//
+// Adding a pattern that is already stored only merges the tags.
+func (l *PatternLibrary) Add(pattern *DataRatePattern, name string, tags []string) (PatternLibraryEntry, error) {
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(pattern.GetOrigin()), filepath.Ext(pattern.GetOrigin()))
+	}
+	if name == "" || strings.ContainsAny(name, " \t\n/") {
+		return PatternLibraryEntry{}, errortypes.NewUserInputError("Invalid pattern name '%s'", name)
+	}
+	tags = normalizeTags(append(tags, strings.Split(strings.Trim(pattern.GetMappingValue("tags", ""), "{}"), ",")...))
+	stored := pattern.clone()
+	if len(tags) > 0 {
+		stored.mapping["tags"] = fmt.Sprintf("{%s}", strings.Join(tags, ","))
+	}
+	if err := os.MkdirAll(filepath.Join(l.Root, "patterns"), 0755); err != nil {
+		return PatternLibraryEntry{}, err
+	}
+	// Hash the written file to match patterns loaded from the library
+	tmp := filepath.Join(l.Root, "patterns", ".adding.csv")
+	defer os.Remove(tmp)
+	if err := stored.SaveCSV(tmp); err != nil {
+		return PatternLibraryEntry{}, err
+	}
+	var provider DataRatePatternProvider = NewDataRatePatternFileProvider(tmp)
+	if stored.IsTimed() {
+		provider = NewDataRatePatternTimedFileProvider(tmp)
+	}
+	loaded, err := provider.Provide(1, 0)
+	if err != nil {
+		return PatternLibraryEntry{}, err
+	}
+	entry := PatternLibraryEntry{
+		Hash:        loaded.GetHashStr(),
+		Name:        name,
+		Description: strings.TrimSpace(loaded.Description),
+		Mappings:    make(map[string]string),
+		Tags:        tags,
+		Timed:       loaded.IsTimed(),
+		Freq:        loaded.GetNativeFreq(),
+		Stats:       loaded.Stats(),
+	}
+	for k, v := range loaded.mapping {
+		if strings.HasPrefix(k, "th_") {
+			entry.Mappings[k] = v
+		}
+	}
+	for i, e := range l.entries {
+		if e.Hash == entry.Hash {
+			l.entries[i].Tags = normalizeTags(append(e.Tags, tags...))
+			return l.entries[i], l.save()
+		}
+	}
+	for _, e := range l.entries {
+		if e.Name == entry.Name {
+			return PatternLibraryEntry{}, errortypes.NewUserInputError("Name '%s' is already used by %s", name, e.Hash)
+		}
+	}
+	if err := os.Rename(tmp, l.PatternPath(entry)); err != nil {
+		return PatternLibraryEntry{}, err
+	}
+	l.entries = append(l.entries, entry)
+	return entry, l.save()
+}
+
+// Writes the index
+func (l *PatternLibrary) save() error {
+	data, err := json.MarshalIndent(l.Entries(), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(l.Root, LIBRARY_INDEX+".tmp")
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(l.Root, LIBRARY_INDEX))
+}
+
+// Lowercases, sorts and deduplicates tags, dropping empty ones
+func normalizeTags(tags []string) []string {
+	res := make([]string, 0, len(tags))
+	for _, t := range tags {
+		if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+			res = append(res, t)
+		}
+	}
+	sort.Strings(res)
+	unique := res[:0]
+	for i, t := range res {
+		if i == 0 || t != res[i-1] {
+			unique = append(unique, t)
+		}
+	}
+	return unique
+}
+
+// Returns true if identifier refers to a library pattern
+func IsLibraryIdentifier(identifier string) bool {
+	return strings.HasPrefix(identifier, LIBRARY_PREFIX)
+}
+
+// Provides a pattern stored in a PatternLibrary
+type DataRatePatternLibraryProvider struct {
+	Path  string
+	Entry PatternLibraryEntry
+}
+
+// Resolves identifier (lib:<name|hash>) in the library at paths.LIBRARY_PATH()
+func NewDataRatePatternLibraryProvider(identifier string) (*DataRatePatternLibraryProvider, error) {
+	lib, err := OpenDefaultPatternLibrary()
+	if err != nil {
+		return nil, err
+	}
+	entry, err := lib.Resolve(identifier)
+	if err != nil {
+		return nil, err
+	}
+	return lib.Provider(entry).(*DataRatePatternLibraryProvider), nil
+}
+
+func (p *DataRatePatternLibraryProvider) Provide(scale float64, minrate float64) (DataRatePattern, error) {
+	var provider DataRatePatternProvider = NewDataRatePatternFileProvider(p.Path)
+	if p.Entry.Timed {
+		provider = NewDataRatePatternTimedFileProvider(p.Path)
+	}
+	res, err := provider.Provide(scale, minrate)
+	if err != nil {
+		return res, err
+	}
+	res.Name = p.Entry.Name
+	return res, nil
+}
@@ -0,0 +1,160 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package drp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/telekom/aml-jens/internal/assets/paths"
+)
+
+func addToLibrary(t *testing.T, lib *PatternLibrary, identifier string, name string, tags ...string) PatternLibraryEntry {
+	t.Helper()
+	provider, err := NewDataRatePatternProvider(identifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return addProvidedToLibrary(t, lib, provider, name, tags...)
+}
+
+func addProvidedToLibrary(t *testing.T, lib *PatternLibrary, provider DataRatePatternProvider, name string, tags ...string) PatternLibraryEntry {
+	t.Helper()
+	pattern, err := provider.Provide(1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := lib.Add(&pattern, name, tags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entry
+}
+
+func TestLibrary_add(t *testing.T) {
+	lib, err := OpenPatternLibrary(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := addToLibrary(t, lib, PathNative100Hz, "", "Saw", "lab")
+	saw := loadSaw(t)
+	if entry.Name != "saw_100hz" {
+		t.Fatalf("Name was not derived from file: %s", entry.Name)
+	}
+	if entry.Description != "Saw recorded at 100 samples/s" || entry.Freq != 100 {
+		t.Fatalf("Header was not indexed: %+v", entry)
+	}
+	if entry.Mappings["th_mq_latency"] != "{3,6}" {
+		t.Fatalf("Mappings were not indexed: %v", entry.Mappings)
+	}
+	if len(entry.Tags) != 2 || entry.Tags[0] != "lab" || entry.Tags[1] != "saw" {
+		t.Fatalf("Tags were not normalized: %v", entry.Tags)
+	}
+	if entry.Stats.Samples != 200 {
+		t.Fatalf("Stats were not indexed: %+v", entry.Stats)
+	}
+	// Same content is stored once, the hash matches the original file
+	original := provideGenerated(t, PathNative100Hz)
+	if entry.Hash != original.GetHashStr() {
+		t.Fatalf("Hash %s differs from original %s", entry.Hash, original.GetHashStr())
+	}
+	again := addToLibrary(t, lib, PathNative100Hz, "other", "ramp")
+	if again.Name != "saw_100hz" || !again.HasTags("lab", "ramp", "saw") {
+		t.Fatalf("Re-adding did not merge tags: %+v", again)
+	}
+	if _, err := lib.Add(saw, "saw_100hz", nil); err == nil {
+		t.Fatal("Expected error for duplicate name")
+	}
+	// Index is persisted
+	reopened, err := OpenPatternLibrary(lib.Root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reopened.Entries()) != 1 || !reopened.Entries()[0].HasTags("ramp") {
+		t.Fatalf("Index was not persisted: %+v", reopened.Entries())
+	}
+}
+
+func TestLibrary_searchAndResolve(t *testing.T) {
+	lib, err := OpenPatternLibrary(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	saw := addToLibrary(t, lib, PathNative100Hz, "", "lab")
+	sine := addToLibrary(t, lib, "gen:sine?min=12000&max=60000&period=30s", "sine", "lab", "synthetic")
+	timed := addProvidedToLibrary(t, lib, NewDataRatePatternTimedFileProvider(PathTimedSaw), "timed_saw")
+
+	if res := lib.Search(""); len(res) != 3 || res[0].Name != "saw_100hz" || res[2].Name != "timed_saw" {
+		t.Fatalf("Expected all entries sorted by name, got %+v", res)
+	}
+	if res := lib.Search("", "lab"); len(res) != 2 {
+		t.Fatalf("Expected 2 entries tagged lab, got %d", len(res))
+	}
+	if res := lib.Search("RECORDED th_mq"); len(res) != 1 || res[0].Hash != saw.Hash {
+		t.Fatalf("Search did not match description and mappings: %+v", res)
+	}
+	if res := lib.Search("saw", "synthetic"); len(res) != 0 {
+		t.Fatalf("Expected no match, got %+v", res)
+	}
+	for _, ref := range []string{"sine", sine.Hash, sine.Hash[:LIBRARY_MIN_HASH_PREFIX], LIBRARY_PREFIX + "sine"} {
+		if e, err := lib.Resolve(ref); err != nil || e.Hash != sine.Hash {
+			t.Fatalf("Could not resolve '%s': %v", ref, err)
+		}
+	}
+	if _, err := lib.Resolve(sine.Hash[:LIBRARY_MIN_HASH_PREFIX-1]); err == nil {
+		t.Fatal("Expected error for short hash prefix")
+	}
+	if _, err := lib.Resolve("unknown"); err == nil {
+		t.Fatal("Expected error for unknown pattern")
+	}
+	data, err := lib.Provider(timed).Provide(1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !data.IsTimed() || data.Name != "timed_saw" || data.GetHashStr() != timed.Hash {
+		t.Fatalf("Timed pattern was not restored: %s %s", data.Name, data.GetHashStr())
+	}
+	if _, err := os.Stat(filepath.Join(lib.Root, LIBRARY_INDEX)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLibrary_identifier(t *testing.T) {
+	defer paths.LIBRARY_PATH_UPDATE(paths.LIBRARY_PATH())
+	paths.LIBRARY_PATH_UPDATE(t.TempDir())
+	lib, err := OpenDefaultPatternLibrary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := addToLibrary(t, lib, PathSaw, "")
+	data := provideGenerated(t, "lib:saw")
+	if data.Name != "saw" || data.GetHashStr() != entry.Hash {
+		t.Fatalf("Got unexpected pattern %s (%s)", data.Name, data.GetHashStr())
+	}
+	if _, err := NewDataRatePatternProvider("lib:missing"); err == nil {
+		t.Fatal("Expected error for missing library pattern")
+	}
+	if IsFileIdentifier("lib:saw") || !IsFileIdentifier(PathSaw) {
+		t.Fatal("IsFileIdentifier misclassified identifiers")
+	}
+}
@@ -0,0 +1,242 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package drp
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/telekom/aml-jens/internal/util"
+)
+
+// Keys besides thresholds (th_*) a comment header may set ('#:key=value')
+var KNOWN_PATTERN_KEYS = map[string]bool{
+	"freq": true,
+	"tags": true,
+}
+
+type LintSeverity uint8
+
+const (
+	//The pattern loads, but might not be what was intended
+	LINT_WARNING LintSeverity = iota
+	//The pattern will not load (or loads differently than written)
+	LINT_ERROR
+)
+
+func (s LintSeverity) String() string {
+	if s == LINT_ERROR {
+		return "error"
+	}
+	return "warning"
+}
+
+// A problem found in a line of a pattern
+type LintDiagnostic struct {
+	Path string
+	//1-based; 0 if the problem concerns the whole file
+	Line     int
+	Severity LintSeverity
+	Message  string
+}
+
+// Formats the diagnostic like 'path:line: severity: message'
+func (d LintDiagnostic) String() string {
+	return fmt.Sprintf("%s:%d: %s: %s", d.Path, d.Line, d.Severity, d.Message)
+}
+
+// Settings of Lint
+type LintParams struct {
+	//The pattern is a csv of 'time_ms,rate_kbits'
+	Timed bool
+	//Rates below are reported, 0 disables the check
+	MinRateKbits float64
+	//Consecutive rates differing by more than this factor are reported, 0 disables the check
+	JumpFactor float64
+}
+
+func DefaultLintParams() LintParams {
+	return LintParams{JumpFactor: 10}
+}
+
+// Returns true if any diagnostic is at least of severity
+func HasLintDiagnostics(diags []LintDiagnostic, severity LintSeverity) bool {
+	for _, d := range diags {
+		if d.Severity >= severity {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks the csv pattern at path and reports every problem found.
+// err is only set if the file can't be read.
+func Lint(path string, params LintParams) (diags []LintDiagnostic, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	l := linter{path: path, params: params}
+	for i, line := range strings.Split(string(data), "\n") {
+		l.line = i + 1
+		l.check(strings.TrimSuffix(line, "\r"))
+	}
+	if l.rows == 0 {
+		l.line = 0
+		l.report(LINT_ERROR, "no data rows")
+	}
+	return l.diags, nil
+}
+
+type linter struct {
+	path   string
+	params LintParams
+	diags  []LintDiagnostic
+	line   int
+	//number of data rows seen
+	rows int
+	//number of cols of the first data row
+	cols int
+	keys map[string]int
+	//rate and time of the previous valid row, NaN if invalid
+	last_rate float64
+	last_time float64
+}
+
+func (l *linter) report(severity LintSeverity, msg string, args ...any) {
+	l.diags = append(l.diags, LintDiagnostic{Path: l.path, Line: l.line, Severity: severity, Message: fmt.Sprintf(msg, args...)})
+}
+
+func (l *linter) check(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	if strings.HasPrefix(line, "#") {
+		l.checkComment(line)
+		return
+	}
+	l.checkRow(line)
+}
+
+func (l *linter) checkComment(line string) {
+	no_white_space := util.RemoveWhiteSpace(line)
+	if len(no_white_space) < 2 || no_white_space[1] != ':' {
+		return
+	}
+	if l.rows > 0 {
+		l.report(LINT_WARNING, "'%s' is ignored after the first data row", strings.TrimSpace(line))
+		return
+	}
+	key, value, found := strings.Cut(no_white_space[2:], "=")
+	if !found || key == "" {
+		l.report(LINT_ERROR, "malformed assignment '%s', expected '#:key=value'", strings.TrimSpace(line))
+		return
+	}
+	if l.keys == nil {
+		l.keys = make(map[string]int)
+	}
+	if first, ok := l.keys[key]; ok {
+		l.report(LINT_WARNING, "'%s' was already set in line %d", key, first)
+	}
+	l.keys[key] = l.line
+	switch {
+	case IsThresholdKey(key):
+		if _, err := ParseThreshold(key, value); err != nil {
+			l.report(LINT_ERROR, "%s", err)
+		}
+	case key == "freq":
+		if freq, err := strconv.Atoi(value); err != nil || freq < 1 {
+			l.report(LINT_ERROR, "freq must be an integer >= 1, is '%s'", value)
+		}
+	case !KNOWN_PATTERN_KEYS[key]:
+		l.report(LINT_WARNING, "unknown key '%s'", key)
+	}
+}
+
+func (l *linter) checkRow(line string) {
+	cols := strings.Split(line, ",")
+	l.rows++
+	if l.rows == 1 {
+		l.cols = len(cols)
+		l.last_rate, l.last_time = math.NaN(), math.NaN()
+	} else if len(cols) != l.cols {
+		l.report(LINT_ERROR, "expected %d cols like the first row, got %d", l.cols, len(cols))
+		return
+	}
+	if l.params.Timed {
+		if len(cols) < 2 {
+			l.report(LINT_ERROR, "expected time_ms,rate_kbits[,latency,loss[,markfree,markfull[,jitter]]], got %d cols", len(cols))
+			return
+		}
+		l.checkTime(cols[0])
+		cols = cols[1:]
+	}
+	switch len(cols) {
+	case 1, SAMPLE_SETTINGS_COLS + 1, SAMPLE_SETTINGS_COLS_MARK + 1, SAMPLE_SETTINGS_COLS_JITTER + 1:
+	default:
+		l.report(LINT_ERROR, "expected rate[,latency,loss[,markfree,markfull[,jitter]]], got %d cols", len(cols))
+		return
+	}
+	l.checkRate(cols[0])
+	if len(cols) > 1 {
+		if _, err := parseSampleSettings(cols[1:]); err != nil {
+			l.report(LINT_ERROR, "%s", err)
+		}
+	}
+}
+
+func (l *linter) checkTime(col string) {
+	t, err := strconv.ParseFloat(col, 64)
+	switch {
+	case err != nil:
+		l.report(LINT_ERROR, "'%s' is not a valid time", col)
+		t = math.NaN()
+	case t < 0:
+		l.report(LINT_ERROR, "time can't be negative (%s)", col)
+	case t <= l.last_time:
+		l.report(LINT_ERROR, "time %s is not after previous row (%s)", col, formatFloat(l.last_time))
+	}
+	l.last_time = t
+}
+
+func (l *linter) checkRate(col string) {
+	v, err := strconv.ParseFloat(col, 64)
+	switch {
+	case err != nil:
+		l.report(LINT_ERROR, "'%s' is not a valid rate", col)
+		v = math.NaN()
+	case v < 0:
+		l.report(LINT_ERROR, "rate can't be negative (%s)", col)
+	case v < l.params.MinRateKbits:
+		l.report(LINT_WARNING, "rate %s is below the minrate %s and will be raised", col, formatFloat(l.params.MinRateKbits))
+	}
+	if l.params.JumpFactor > 0 && !math.IsNaN(v) && !math.IsNaN(l.last_rate) && v >= 0 && l.last_rate >= 0 {
+		high, low := math.Max(v, l.last_rate), math.Min(v, l.last_rate)
+		if high > l.params.JumpFactor*math.Max(low, 1) {
+			l.report(LINT_WARNING, "suspicious jump from %s to %s", formatFloat(l.last_rate), col)
+		}
+	}
+	l.last_rate = v
+}
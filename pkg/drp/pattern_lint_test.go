@@ -0,0 +1,122 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package drp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/telekom/aml-jens/internal/assets/paths"
+)
+
+func TestLint(t *testing.T) {
+	params := DefaultLintParams()
+	params.MinRateKbits = 500
+	diags, err := Lint(filepath.Join(paths.TESTDATA_DRP(), "lint", "problems.csv"), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct {
+		line     int
+		severity LintSeverity
+	}{
+		{3, LINT_ERROR},    //malformed threshold
+		{4, LINT_ERROR},    //wrong unit
+		{5, LINT_WARNING},  //unknown key
+		{6, LINT_ERROR},    //invalid freq
+		{7, LINT_WARNING},  //duplicate key
+		{8, LINT_ERROR},    //malformed assignment
+		{11, LINT_ERROR},   //negative rate
+		{12, LINT_ERROR},   //non-numeric rate
+		{13, LINT_WARNING}, //below minrate
+		{14, LINT_WARNING}, //jump
+		{15, LINT_ERROR},   //cols
+		{18, LINT_WARNING}, //mapping after data
+	}
+	if len(diags) != len(expected) {
+		t.Fatalf("Expected %d diagnostics, got %d: %v", len(expected), len(diags), diags)
+	}
+	for i, e := range expected {
+		if diags[i].Line != e.line || diags[i].Severity != e.severity {
+			t.Fatalf("Expected %s in line %d, got %s", e.severity, e.line, diags[i])
+		}
+	}
+	if !HasLintDiagnostics(diags, LINT_ERROR) {
+		t.Fatal("HasLintDiagnostics did not find errors")
+	}
+}
+
+func TestLint_valid(t *testing.T) {
+	for _, path := range []string{PathSaw, PathNative100Hz, filepath.Join(paths.TESTDATA_DRP(), "drp_3valleys_kv_comment.csv")} {
+		diags, err := Lint(path, DefaultLintParams())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(diags) != 0 {
+			t.Fatalf("Expected no diagnostics for %s, got %v", path, diags)
+		}
+	}
+}
+
+func TestLint_timed(t *testing.T) {
+	params := DefaultLintParams()
+	params.Timed = true
+	diags, err := Lint(PathTimedSaw, params)
+	if err != nil || len(diags) != 0 {
+		t.Fatalf("Expected no diagnostics, got %v (%v)", diags, err)
+	}
+	diags, err = Lint(filepath.Join(paths.TESTDATA_DRP(), "timed", "broken_time_order.csv"), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diags) != 1 || diags[0].Line != 3 || diags[0].Severity != LINT_ERROR {
+		t.Fatalf("Expected time order error in line 3, got %v", diags)
+	}
+}
+
+func TestLint_empty(t *testing.T) {
+	diags, err := Lint(filepath.Join(paths.TESTDATA_DRP(), "broken_empty.csv"), DefaultLintParams())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diags) != 1 || diags[0].Line != 0 || diags[0].String() == "" {
+		t.Fatalf("Expected one file level error, got %v", diags)
+	}
+	if _, err := Lint("/does/not/exist.csv", DefaultLintParams()); err == nil {
+		t.Fatal("Expected error for missing file")
+	}
+}
+
+func TestLint_thresholdOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "swapped.csv")
+	if err := os.WriteFile(path, []byte("#:th_link_usage=50,90\n10000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	diags, err := Lint(path, DefaultLintParams())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diags) != 1 || diags[0].Line != 1 || diags[0].Severity != LINT_ERROR {
+		t.Fatalf("Expected an error for warn below fail in line 1, got %v", diags)
+	}
+}
@@ -79,9 +79,12 @@ func convertDRPdata(strdata *[][]string, p struct {
 		case l == 0:
 			return drp,
 				errortypes.NewUserInputError("DRP seems to be invalid. Empty row.")
-		case l > 1:
+		case l > SAMPLE_SETTINGS_COLS_JITTER+1:
 			return drp,
 				errortypes.NewUserInputError("DRP seems to be invalid. Too many cols.")
+		case l != 1 && l != SAMPLE_SETTINGS_COLS+1 && l != SAMPLE_SETTINGS_COLS_MARK+1 && l != SAMPLE_SETTINGS_COLS_JITTER+1:
+			return drp,
+				errortypes.NewUserInputError("Row %d: expected rate[,latency,loss[,markfree,markfull[,jitter]]], got %d cols", i, l)
 		}
 		float, err := strconv.ParseFloat(str[0], 64)
 		if err != nil {
@@ -93,6 +96,21 @@ func convertDRPdata(strdata *[][]string, p struct {
 		if err != nil {
 			return drp, err
 		}
+		if len(str) > 1 {
+			settings, err := parseSampleSettings(str[1:])
+			if err != nil {
+				return drp,
+					errortypes.NewUserInputError("Row %d: %s", i, err)
+			}
+			if drp.settings == nil {
+				cols := make([]SampleSettings, drp.Length)
+				drp.settings = &cols
+			}
+			(*drp.settings)[i] = settings
+			if err = settings.writeHash(&hash_buf); err != nil {
+				return drp, err
+			}
+		}
 		if ret[i] > drp.Max {
 			drp.Max = ret[i]
 		}
@@ -146,18 +164,32 @@ func readDRPCommentPath(path string, drp *DataRatePattern) (err error) {
 		}
 
 		sep := strings.Split(no_white_space[2:], "=")
+		if len(sep) < 2 {
+			return errortypes.NewUserInputError("Not a valid assignment: '%s'", no_white_space)
+		}
 		var_name := sep[0]
 		var_value := sep[1]
-		if strings.HasPrefix(var_name, "th_") {
-			//Format: '{a,b}' | a,b ∈ [0-9]+ //[2]float64
+		if var_name == "freq" {
+			freq, err := strconv.Atoi(var_value)
+			if err != nil || freq < 1 {
+				return errortypes.NewUserInputError("Invalid native frequency: '%s'", var_value)
+			}
+			drp.nativeFreq = freq
+			continue
+		}
+		if IsThresholdKey(var_name) {
+			//Format: 'a,b[:unit[:above|below]]'
 			if len(sep) != 2 {
 				return fmt.Errorf("error Parsing EvalSetting: '%s'; Not a valid assignment", no_white_space)
 			}
-			/*if var_value[0] != '{' || var_value[len(var_value)-1] != '}' {
-				//TODO: format validation
-			}*/
-		}
-		if !two_values.MatchString(var_value) {
+			th, err := ParseThreshold(var_name, var_value)
+			if err != nil {
+				return err
+			}
+			//Store normalized, so evaluation can rely on warn/fail order
+			drp.mapping[var_name] = th.mappingValue(var_name)
+			continue
+		} else if var_name != "tags" && !two_values.MatchString(var_value) {
 			INFO.Printf("Ignoring: %s=%s ", var_name, var_value)
 		}
 		drp.mapping[var_name] = fmt.Sprintf("{%s}", var_value)
@@ -0,0 +1,160 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package drp
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/telekom/aml-jens/internal/errortypes"
+)
+
+// Provides DataRatePatterns from radio KPI logs.
+//
+// The log is a csv with a header row, each further row is one sample.
+// Recognized columns (any order, others are ignored):
+//   - mcs or cqi: index into the McsTable / CqiTable (mcs is preferred)
+//   - prb or bandwidth_mhz: allocated PRBs or channel bandwidth
+//   - layers: optional MIMO layers
+type DataRatePatternKPIProvider struct {
+	Path       string
+	Conversion KPIConversion
+}
+
+func NewDataRatePatternKPIProvider(path string, conversion KPIConversion) *DataRatePatternKPIProvider {
+	return &DataRatePatternKPIProvider{Path: path, Conversion: conversion}
+}
+
+// Returns the index of each known column, -1 if missing
+func parseKPIHeader(header []string) map[string]int {
+	res := map[string]int{"mcs": -1, "cqi": -1, "prb": -1, "bandwidth_mhz": -1, "layers": -1}
+	for i, v := range header {
+		v = strings.ToLower(strings.TrimSpace(v))
+		if _, ok := res[v]; ok {
+			res[v] = i
+		}
+	}
+	return res
+}
+
+func parseKPIValue(row []string, col int, line int, name string) (float64, error) {
+	if col >= len(row) {
+		return 0, errortypes.NewUserInputError("Row %d: missing %s", line, name)
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(row[col]), 64)
+	if err != nil || v < 0 {
+		return 0, errortypes.NewUserInputError("Row %d: %s '%s' is invalid", line, name, row[col])
+	}
+	return v, nil
+}
+
+func convertKPIdata(strdata [][]string, conv *KPIConversion) (res []float64, source string, err error) {
+	if len(strdata) < 2 {
+		return nil, "", errortypes.NewUserInputError("KPI log needs a header and at least one row")
+	}
+	cols := parseKPIHeader(strdata[0])
+	source = "mcs"
+	table := conv.McsTable
+	if cols["mcs"] == -1 {
+		source = "cqi"
+		table = conv.CqiTable
+	}
+	if cols[source] == -1 {
+		return nil, "", errortypes.NewUserInputError("KPI log needs a mcs or cqi column")
+	}
+	if cols["prb"] == -1 && cols["bandwidth_mhz"] == -1 {
+		return nil, "", errortypes.NewUserInputError("KPI log needs a prb or bandwidth_mhz column")
+	}
+	res = make([]float64, len(strdata)-1)
+	for i, row := range strdata[1:] {
+		line := i + 1
+		idx, err := parseKPIValue(row, cols[source], line, source)
+		if err != nil {
+			return nil, "", err
+		}
+		if int(idx) >= len(table) || idx != float64(int(idx)) {
+			return nil, "", errortypes.NewUserInputError("Row %d: %s %s is not in the table", line, source, row[cols[source]])
+		}
+		var prbs int
+		if cols["prb"] != -1 {
+			v, err := parseKPIValue(row, cols["prb"], line, "prb")
+			if err != nil {
+				return nil, "", err
+			}
+			prbs = int(v)
+		} else {
+			v, err := parseKPIValue(row, cols["bandwidth_mhz"], line, "bandwidth_mhz")
+			if err != nil {
+				return nil, "", err
+			}
+			prbs = conv.Prbs(v)
+		}
+		layers := conv.Layers
+		if cols["layers"] != -1 {
+			v, err := parseKPIValue(row, cols["layers"], line, "layers")
+			if err != nil {
+				return nil, "", err
+			}
+			layers = int(v)
+		}
+		res[i] = conv.ThroughputKbits(table[int(idx)], prbs, layers)
+	}
+	return res, source, nil
+}
+
+func (self *DataRatePatternKPIProvider) Provide(scale float64, minrate float64) (DataRatePattern, error) {
+	if err := self.Conversion.Validate(); err != nil {
+		return DataRatePattern{}, err
+	}
+	strdata, err := readCSV(self.Path)
+	if err != nil {
+		return DataRatePattern{}, err
+	}
+	raw, source, err := convertKPIdata(*strdata, &self.Conversion)
+	if err != nil {
+		return DataRatePattern{}, err
+	}
+	drp, err := newDataRatePatternFromData(raw, struct {
+		MinRateKbits float64
+		Scale        float64
+		Origin       string
+	}{
+		Scale:        scale,
+		MinRateKbits: minrate,
+		Origin:       self.Path,
+	})
+	if err != nil {
+		return DataRatePattern{}, err
+	}
+	if err := readDRPCommentPath(self.Path, drp); err != nil {
+		return DataRatePattern{}, err
+	}
+	drp.Name = filepath.Base(self.Path)
+	description := fmt.Sprintf("Derived from radio KPIs (%s): %s", source, self.Conversion.String())
+	if drp.Description != "" {
+		description += "\n" + drp.Description
+	}
+	drp.Description = description
+	return *drp, nil
+}
@@ -0,0 +1,104 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package drp
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/telekom/aml-jens/internal/assets/paths"
+)
+
+var PathKPI = filepath.Join(paths.TESTDATA_DRP(), "kpi")
+
+func TestTBS(t *testing.T) {
+	conv := DefaultKPIConversion()
+	for _, v := range []struct {
+		mcs      int
+		prbs     int
+		layers   int
+		expected int
+	}{
+		{0, 1, 1, 24},
+		{28, 273, 1, 200808},
+		{9, 10, 1, 1800},
+		{0, 0, 1, 0},
+	} {
+		if tbs := conv.TBS(MCS_TABLE_64QAM[v.mcs], v.prbs, v.layers); tbs != v.expected {
+			t.Fatalf("MCS %d, %d PRBs: expected TBS %d, got %d", v.mcs, v.prbs, v.expected, tbs)
+		}
+	}
+}
+
+func TestKPIProvider(t *testing.T) {
+	data, err := NewDataRatePatternKPIProvider(filepath.Join(PathKPI, "field_log.csv"), DefaultKPIConversion()).Provide(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//mcs is preferred over cqi, 2000 slots/s @30kHz
+	compareDrps([]float64{401616, 48, 401616, 34848}, *data.data, t)
+	if !strings.HasPrefix(data.Description, "Derived from radio KPIs (mcs): scs=30kHz layers=1") ||
+		!strings.Contains(data.Description, "Drive test") {
+		t.Fatalf("Unexpected description: %s", data.Description)
+	}
+	if data.GetMappingValue("th_mq_latency", "") != "{3,6}" {
+		t.Fatal("Mapping was not read")
+	}
+}
+
+func TestKPIProviderConversion(t *testing.T) {
+	conv, err := LoadKPIConversion(filepath.Join(PathKPI, "conversion_tdd.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conv.Layers != 4 || conv.SymbolsPerSlot != 12 || len(conv.CqiTable) != 16 {
+		t.Fatalf("Defaults were not kept: %+v", conv)
+	}
+	data, err := NewDataRatePatternKPIProvider(filepath.Join(PathKPI, "cqi_bandwidth.csv"), conv).Provide(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := *data.data
+	if d[0] <= 0 || d[1] <= d[0] || d[2] != 0 {
+		t.Fatalf("Unexpected throughput: %v", d)
+	}
+	if !strings.Contains(data.Description, "(cqi)") || !strings.Contains(data.Description, "overhead=0.25") {
+		t.Fatalf("Unexpected description: %s", data.Description)
+	}
+}
+
+func TestKPIProviderNOK(t *testing.T) {
+	conv := DefaultKPIConversion()
+	for _, p := range []string{
+		filepath.Join(PathKPI, "broken_mcs.csv"),
+		PathSaw,
+	} {
+		if _, err := NewDataRatePatternKPIProvider(p, conv).Provide(0, 0); err == nil {
+			t.Fatalf("%s did not fail", p)
+		}
+	}
+	conv.ScsKhz = 45
+	if err := conv.Validate(); err == nil {
+		t.Fatal("Invalid scs did not fail")
+	}
+}
@@ -0,0 +1,127 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package drp
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/telekom/aml-jens/internal/errortypes"
+	"github.com/telekom/aml-jens/internal/util"
+)
+
+// Size of a single Mahimahi delivery opportunity (one MTU)
+const MAHIMAHI_PACKET_BITS = 1500 * 8
+
+// Provides DataRatePatterns from Mahimahi packet-delivery traces.
+//
+// Each line of a trace is the timestamp (ms) of a delivery opportunity
+// for one MTU sized packet; the last timestamp is the period of the trace.
+// Opportunities are counted in windows of 1000/Freq ms and converted to kbit/s.
+type DataRatePatternMahimahiProvider struct {
+	Path string
+	Freq int
+}
+
+func NewDataRatePatternMahimahiProvider(path string, freq int) *DataRatePatternMahimahiProvider {
+	return &DataRatePatternMahimahiProvider{Path: path, Freq: freq}
+}
+
+func readMahimahiTrace(path string) ([]uint64, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return nil, errortypes.NewUserInputError("Could not read '%s': %s", path, err)
+	}
+	defer fp.Close()
+	res := make([]uint64, 0, 1024)
+	scanner := bufio.NewScanner(fp)
+	line := 0
+	for scanner.Scan() {
+		line++
+		v := strings.TrimSpace(scanner.Text())
+		if v == "" {
+			continue
+		}
+		ts, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return nil, errortypes.NewUserInputError("Line %d: '%s' is not a timestamp in ms", line, v)
+		}
+		if len(res) > 0 && ts < res[len(res)-1] {
+			return nil, errortypes.NewUserInputError("Line %d: timestamps need to be non-decreasing", line)
+		}
+		res = append(res, ts)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(res) == 0 || res[len(res)-1] == 0 {
+		return nil, errortypes.NewUserInputError("Mahimahi trace '%s' is empty", path)
+	}
+	return res, nil
+}
+
+// Converts delivery opportunities to kbit/s samples of windowMs each
+func convertMahimahi(trace []uint64, windowMs float64) []float64 {
+	period := float64(trace[len(trace)-1])
+	res := make([]float64, int(math.Ceil(period/windowMs)))
+	for _, ts := range trace {
+		//opportunity at ts is delivered during (ts-1, ts]
+		bin := util.MinInt(int(math.Max(float64(ts)-1, 0)/windowMs), len(res)-1)
+		res[bin]++
+	}
+	for i := range res {
+		//bits per ms == kbit/s
+		res[i] *= MAHIMAHI_PACKET_BITS / windowMs
+	}
+	return res
+}
+
+func (self *DataRatePatternMahimahiProvider) Provide(scale float64, minrate float64) (DataRatePattern, error) {
+	if self.Freq < 1 {
+		return DataRatePattern{}, errortypes.NewUserInputError("Mahimahi: freq must be at least 1, is %d", self.Freq)
+	}
+	trace, err := readMahimahiTrace(self.Path)
+	if err != nil {
+		return DataRatePattern{}, err
+	}
+	drp, err := newDataRatePatternFromData(convertMahimahi(trace, 1000/float64(self.Freq)), struct {
+		MinRateKbits float64
+		Scale        float64
+		Origin       string
+	}{
+		Scale:        scale,
+		MinRateKbits: minrate,
+		Origin:       self.Path,
+	})
+	if err != nil {
+		return DataRatePattern{}, err
+	}
+	drp.Name = filepath.Base(self.Path)
+	drp.nativeFreq = self.Freq
+	drp.Description = fmt.Sprintf("Converted from Mahimahi trace %s: %d opportunities @%dHz", drp.Name, len(trace), self.Freq)
+	return *drp, nil
+}
@@ -0,0 +1,162 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package drp
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"math"
+	"path/filepath"
+	"strconv"
+
+	"github.com/telekom/aml-jens/internal/errortypes"
+)
+
+// Provides DataRatePatterns from a csv with two columns:
+// time_ms,rate_kbits
+//
+// Like untimed patterns, per sample settings may follow:
+// time_ms,rate_kbits[,latency_ms,loss[,markfree_ms,markfull_ms[,jitter_ms]]]
+//
+// Each rate is applied at its recorded offset instead of
+// a fixed frequency.
+type DataRatePatternTimedFileProvider struct {
+	Path string
+}
+
+func NewDataRatePatternTimedFileProvider(path string) *DataRatePatternTimedFileProvider {
+	return &DataRatePatternTimedFileProvider{Path: path}
+}
+
+func convertTimedDRPdata(strdata *[][]string, p struct {
+	MinRateKbits float64
+	Scale        float64
+	Origin       string
+}) (drp DataRatePattern, err error) {
+	if p.Scale == 0 {
+		p.Scale = 1
+	}
+	if len(*strdata) == 0 {
+		return drp,
+			errortypes.NewUserInputError("DRP seems to be invalid. No rows loaded.")
+	}
+	drp.loadParameters = p
+	drp.Min = math.MaxFloat64
+	drp.Max = -1
+	drp.Avg = 0
+	drp.Length = len(*strdata)
+	var hash_buf bytes.Buffer
+	ret := make([]float64, drp.Length)
+	times := make([]float64, drp.Length)
+	drp.data = &ret
+	drp.timestamps = &times
+	hash := md5.New()
+	for i, str := range *strdata {
+		if len(str) < 2 {
+			return drp,
+				errortypes.NewUserInputError("Row %d: expected at least 2 cols (time_ms,rate_kbits), got %d", i, len(str))
+		}
+		t, err := strconv.ParseFloat(str[0], 64)
+		if err != nil {
+			return drp,
+				errortypes.NewUserInputError("Row %d: '%s' in drp is not a valid time", i, str[0])
+		}
+		if t < 0 {
+			return drp,
+				errortypes.NewUserInputError("Row %d: time can't be negative (%f)", i, t)
+		}
+		if i > 0 && t <= times[i-1] {
+			return drp,
+				errortypes.NewUserInputError("Row %d: time %f is not after previous row (%f)", i, t, times[i-1])
+		}
+		float, err := strconv.ParseFloat(str[1], 64)
+		if err != nil {
+			return drp,
+				errortypes.NewUserInputError("Row %d: '%s' in drp is not a valid float64", i, str[1])
+		}
+		times[i] = t
+		ret[i] = math.Max(float*p.Scale, p.MinRateKbits)
+		if err = binary.Write(&hash_buf, binary.LittleEndian, t); err != nil {
+			return drp, err
+		}
+		if err = binary.Write(&hash_buf, binary.LittleEndian, float); err != nil {
+			return drp, err
+		}
+		if len(str) > 2 {
+			settings, err := parseSampleSettings(str[2:])
+			if err != nil {
+				return drp,
+					errortypes.NewUserInputError("Row %d: %s", i, err)
+			}
+			if drp.settings == nil {
+				cols := make([]SampleSettings, drp.Length)
+				drp.settings = &cols
+			}
+			(*drp.settings)[i] = settings
+			if err = settings.writeHash(&hash_buf); err != nil {
+				return drp, err
+			}
+		}
+		if ret[i] > drp.Max {
+			drp.Max = ret[i]
+		}
+		if ret[i] < drp.Min {
+			drp.Min = ret[i]
+		}
+		drp.Avg += ret[i]
+	}
+	drp.Avg = drp.Avg / float64(drp.Length)
+	if _, err = hash.Write(hash_buf.Bytes()); err != nil {
+		return drp, err
+	}
+	drp.Sha256 = hash.Sum(nil)
+	return drp, nil
+}
+
+func (self *DataRatePatternTimedFileProvider) Provide(scale float64, minrate float64) (DataRatePattern, error) {
+	var ret = DataRatePattern{}
+	if self.Path == "" {
+		return ret,
+			errors.New("DataRatePatternTimedFileProvider was not initialized with a path")
+	}
+	strdata, err := readCSV(self.Path)
+	if err != nil {
+		return ret, err
+	}
+	ret, err = convertTimedDRPdata(strdata, struct {
+		MinRateKbits float64
+		Scale        float64
+		Origin       string
+	}{
+		Scale:        scale,
+		MinRateKbits: minrate,
+		Origin:       self.Path,
+	})
+	if err != nil {
+		return ret, err
+	}
+	err = readDRPCommentPath(self.Path, &ret)
+	ret.Name = filepath.Base(self.Path)
+	return ret, err
+}
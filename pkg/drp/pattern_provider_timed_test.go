@@ -0,0 +1,103 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package drp
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/telekom/aml-jens/internal/assets/paths"
+)
+
+var PathTimedSaw = filepath.Join(paths.TESTDATA_DRP(), "timed", "saw_timed.csv")
+
+func TestDataRatePatternTimedFileProvider_OK_saw(t *testing.T) {
+	data, err := NewDataRatePatternTimedFileProvider(PathTimedSaw).Provide(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !data.IsTimed() {
+		t.Fatal("Pattern loaded by TimedFileProvider is not timed")
+	}
+	compareDrps([]float64{10000, 20000, 30000, 40000, 50000}, *data.data, t)
+	compareDrps([]float64{0, 100, 150, 400, 1000}, *data.GetTimestamps(), t)
+	if data.Avg != 30000 {
+		t.Fatalf("Incorrect stat: Avg is %f should be 30000", data.Avg)
+	}
+	if data.GetTimedDuration() != time.Second {
+		t.Fatalf("Incorrect duration: %s", data.GetTimedDuration())
+	}
+	if data.GetMappingValue("th_mq_latency", "") != "{3,6}" {
+		t.Fatal("Comment was not read")
+	}
+}
+
+func TestDataRatePatternTimedFileProvider_NOK(t *testing.T) {
+	for _, v := range []string{
+		filepath.Join(paths.TESTDATA_DRP(), "timed", "broken_time_order.csv"),
+		filepath.Join(paths.TESTDATA_DRP(), "saw.csv"),
+		filepath.Join(paths.TESTDATA_DRP(), "broken_empty.csv"),
+	} {
+		if _, err := NewDataRatePatternTimedFileProvider(v).Provide(0, 0); err == nil {
+			t.Fatalf("Expected an error loading %s", v)
+		}
+	}
+}
+
+func TestIteratorTimed_saw_loop(t *testing.T) {
+	data, err := NewDataRatePatternTimedFileProvider(PathTimedSaw).Provide(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iter := data.Iterator()
+	iter.SetLooping(true)
+	if !iter.IsTimed() {
+		t.Fatal("Iterator of timed pattern is not timed")
+	}
+	expected := []struct {
+		v float64
+		o time.Duration
+	}{
+		{10000, 0},
+		{20000, 100 * time.Millisecond},
+		{30000, 150 * time.Millisecond},
+		{40000, 400 * time.Millisecond},
+		{50000, 1000 * time.Millisecond},
+		{50000, 1600 * time.Millisecond},
+		{40000, 2200 * time.Millisecond},
+		{30000, 2450 * time.Millisecond},
+		{20000, 2500 * time.Millisecond},
+		{10000, 2600 * time.Millisecond},
+		{10000, 2700 * time.Millisecond},
+		{20000, 2800 * time.Millisecond},
+	}
+	for i, e := range expected {
+		v, err := iter.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != e.v || iter.Offset() != e.o {
+			t.Fatalf("@%d: got %f at %s, expected %f at %s", i, v, iter.Offset(), e.v, e.o)
+		}
+	}
+}
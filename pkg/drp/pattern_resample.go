@@ -0,0 +1,107 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package drp
+
+import (
+	"math"
+
+	"github.com/telekom/aml-jens/internal/errortypes"
+)
+
+type ResampleMethod string
+
+const (
+	//Repeat/ skip samples
+	RESAMPLE_HOLD ResampleMethod = "hold"
+	//Interpolate linearly between neighbouring samples
+	RESAMPLE_LINEAR ResampleMethod = "linear"
+	//Average all samples within the new sample's interval (weighted by overlap)
+	RESAMPLE_AVERAGE ResampleMethod = "average"
+)
+
+var RESAMPLE_METHODS = []ResampleMethod{RESAMPLE_HOLD, RESAMPLE_LINEAR, RESAMPLE_AVERAGE}
+
+// Returns the ResampleMethod named method; "" results in RESAMPLE_AVERAGE
+func ParseResampleMethod(method string) (ResampleMethod, error) {
+	if method == "" {
+		return RESAMPLE_AVERAGE, nil
+	}
+	for _, v := range RESAMPLE_METHODS {
+		if string(v) == method {
+			return v, nil
+		}
+	}
+	return "", errortypes.NewUserInputError("Unknown resample method '%s', expected one of %v", method, RESAMPLE_METHODS)
+}
+
+// Resamples the pattern from its native freq to freq, keeping its duration.
+//
+// Per sample settings are held. Timed patterns and patterns
+// without native freq can not be resampled.
+func (s *DataRatePattern) Resample(freq int, method ResampleMethod) (*DataRatePattern, error) {
+	if s.IsTimed() {
+		return nil, errortypes.NewUserInputError("Resample: timed patterns are played at their offsets")
+	}
+	if s.nativeFreq < 1 {
+		return nil, errortypes.NewUserInputError("Resample: '%s' does not declare its native freq", s.Name)
+	}
+	if freq < 1 {
+		return nil, errortypes.NewUserInputError("Resample: freq must be at least 1, is %d", freq)
+	}
+	data := *s.data
+	n := len(data)
+	//source samples per resampled sample
+	ratio := float64(s.nativeFreq) / float64(freq)
+	m := int(math.Max(1, math.Round(float64(n)/ratio)))
+	indices := make([]int, m)
+	for j := range indices {
+		indices[j] = int(math.Min(float64(n-1), math.Floor(float64(j)*ratio)))
+	}
+	res := s.pick(indices)
+	res.nativeFreq = freq
+	for j := range *res.data {
+		switch method {
+		case RESAMPLE_HOLD:
+		case RESAMPLE_LINEAR:
+			x := float64(j) * ratio
+			i := indices[j]
+			if i+1 < n {
+				frac := x - float64(i)
+				(*res.data)[j] = data[i] + (data[i+1]-data[i])*frac
+			}
+		case RESAMPLE_AVERAGE:
+			from, to := float64(j)*ratio, math.Min(float64(j+1)*ratio, float64(n))
+			if to <= from {
+				continue
+			}
+			sum := 0.0
+			for i := int(math.Floor(from)); float64(i) < to; i++ {
+				overlap := math.Min(float64(i+1), to) - math.Max(float64(i), from)
+				sum += data[i] * overlap
+			}
+			(*res.data)[j] = sum / (to - from)
+		default:
+			return nil, errortypes.NewUserInputError("Unknown resample method '%s'", method)
+		}
+	}
+	return res.rebuild()
+}
@@ -0,0 +1,113 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package drp
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+
+	"github.com/telekom/aml-jens/internal/assets/paths"
+)
+
+var PathNative100Hz = filepath.Join(paths.TESTDATA_DRP(), "native", "saw_100hz.csv")
+
+func TestNativeFreq(t *testing.T) {
+	data, err := NewDataRatePatternFileProvider(PathNative100Hz).Provide(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.GetNativeFreq() != 100 {
+		t.Fatalf("Native freq was not read: %d", data.GetNativeFreq())
+	}
+	if _, found := data.mapping["freq"]; found {
+		t.Fatal("freq should not be part of the mapping")
+	}
+	if loadSaw(t).GetNativeFreq() != 0 {
+		t.Fatal("Pattern without #:freq has a native freq")
+	}
+	if _, err := NewDataRatePatternFileProvider(filepath.Join(paths.TESTDATA_DRP(), "native", "broken_freq.csv")).Provide(0, 0); err == nil {
+		t.Fatal("Invalid native freq did not fail")
+	}
+}
+
+func TestResample(t *testing.T) {
+	data := []float64{10, 20, 30, 40}
+	p := DataRatePattern{data: &data, nativeFreq: 4}
+	cases := []struct {
+		freq     int
+		method   ResampleMethod
+		expected []float64
+	}{
+		{2, RESAMPLE_HOLD, []float64{10, 30}},
+		{2, RESAMPLE_AVERAGE, []float64{15, 35}},
+		{8, RESAMPLE_HOLD, []float64{10, 10, 20, 20, 30, 30, 40, 40}},
+		{8, RESAMPLE_LINEAR, []float64{10, 15, 20, 25, 30, 35, 40, 40}},
+		{8, RESAMPLE_AVERAGE, []float64{10, 10, 20, 20, 30, 30, 40, 40}},
+		{4, RESAMPLE_LINEAR, []float64{10, 20, 30, 40}},
+	}
+	for _, c := range cases {
+		res, err := p.Resample(c.freq, c.method)
+		if err != nil {
+			t.Fatal(err)
+		}
+		compareDrps(c.expected, *res.data, t)
+		if res.GetNativeFreq() != c.freq {
+			t.Fatalf("Native freq was not updated: %d", res.GetNativeFreq())
+		}
+	}
+	//overlapping intervals are weighted
+	res, err := p.Resample(3, RESAMPLE_AVERAGE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range []float64{12.5, 25, 37.5} {
+		if math.Abs((*res.data)[i]-v) > 1e-9 {
+			t.Fatalf("Sample %d: %f != %f", i, (*res.data)[i], v)
+		}
+	}
+	if _, err := loadSaw(t).Resample(10, RESAMPLE_HOLD); err == nil {
+		t.Fatal("Pattern without native freq was resampled")
+	}
+	if _, err := ParseResampleMethod("cubic"); err == nil {
+		t.Fatal("Unknown method did not fail")
+	}
+}
+
+func TestResampleKeepsDuration(t *testing.T) {
+	data, err := NewDataRatePatternFileProvider(PathNative100Hz).Provide(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, freq := range []int{1, 10, 30, 100} {
+		res, err := data.Resample(freq, RESAMPLE_AVERAGE)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.SampleCount() != 2*freq {
+			t.Fatalf("2s @%dHz should be %d samples, got %d", freq, 2*freq, res.SampleCount())
+		}
+		if res.GetMappingValue("th_mq_latency", "") != "{3,6}" {
+			t.Fatal("Mapping was not kept")
+		}
+	}
+}
@@ -0,0 +1,118 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package drp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+)
+
+const (
+	// Number of additional cols: latency,loss
+	SAMPLE_SETTINGS_COLS = 2
+	// Number of additional cols: latency,loss,markfree,markfull
+	SAMPLE_SETTINGS_COLS_MARK = 4
+	// Number of additional cols: latency,loss,markfree,markfull,jitter
+	SAMPLE_SETTINGS_COLS_JITTER = 5
+)
+
+// Link settings of a single sample, read from the
+// additional columns of a multi-column DRP:
+//
+// rate_kbits,latency_ms,loss[,markfree_ms,markfull_ms[,jitter_ms]]
+//
+// Marking can be left unset by -1 when only jitter is given.
+type SampleSettings struct {
+	ExtralatencyMs float64
+	//Probability [0,1] of a packet being dropped
+	Loss float64
+	//-1 if not set by the pattern
+	MarkfreeMs float64
+	//-1 if not set by the pattern
+	MarkfullMs float64
+	//Delay jitter of the impairment stage, -1 if not set by the pattern
+	JitterMs float64
+}
+
+// Returns true if the sample sets markfree and markfull
+//
+//go:inline
+func (s SampleSettings) HasMarking() bool {
+	return s.MarkfreeMs >= 0 && s.MarkfullMs >= 0
+}
+
+// Returns true if the sample sets the jitter
+//
+//go:inline
+func (s SampleSettings) HasJitter() bool {
+	return s.JitterMs >= 0
+}
+
+func (s SampleSettings) validate() error {
+	if s.ExtralatencyMs < 0 || s.ExtralatencyMs >= 10000 {
+		return fmt.Errorf("latency must be in [0,10000)ms, is %f", s.ExtralatencyMs)
+	}
+	if s.Loss < 0 || s.Loss > 1 {
+		return fmt.Errorf("loss must be a probability in [0,1], is %f", s.Loss)
+	}
+	if s.JitterMs >= 10000 {
+		return fmt.Errorf("jitter must be in [0,10000)ms, is %f", s.JitterMs)
+	}
+	if s.HasMarking() && s.MarkfreeMs > s.MarkfullMs {
+		return fmt.Errorf("markfree (%f) must not be greater than markfull (%f)", s.MarkfreeMs, s.MarkfullMs)
+	}
+	return nil
+}
+
+func (s SampleSettings) writeHash(buf *bytes.Buffer) error {
+	values := []float64{s.ExtralatencyMs, s.Loss, s.MarkfreeMs, s.MarkfullMs}
+	//Patterns without jitter keep their hash
+	if s.HasJitter() {
+		values = append(values, s.JitterMs)
+	}
+	for _, v := range values {
+		if err := binary.Write(buf, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Parses the additional columns of a multi-column DRP row
+func parseSampleSettings(cols []string) (SampleSettings, error) {
+	res := SampleSettings{MarkfreeMs: -1, MarkfullMs: -1, JitterMs: -1}
+	if len(cols) != SAMPLE_SETTINGS_COLS && len(cols) != SAMPLE_SETTINGS_COLS_MARK && len(cols) != SAMPLE_SETTINGS_COLS_JITTER {
+		return res, fmt.Errorf("expected %d, %d or %d additional cols, got %d",
+			SAMPLE_SETTINGS_COLS, SAMPLE_SETTINGS_COLS_MARK, SAMPLE_SETTINGS_COLS_JITTER, len(cols))
+	}
+	targets := []*float64{&res.ExtralatencyMs, &res.Loss, &res.MarkfreeMs, &res.MarkfullMs, &res.JitterMs}
+	for i, v := range cols {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return res, fmt.Errorf("'%s' is not a valid float64", v)
+		}
+		*targets[i] = f
+	}
+	return res, res.validate()
+}
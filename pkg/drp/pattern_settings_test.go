@@ -0,0 +1,105 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package drp
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/telekom/aml-jens/internal/assets/paths"
+)
+
+func TestDataRatePatternFileProvider_OK_settings(t *testing.T) {
+	data, err := NewDataRatePatternFileProvider(filepath.Join(paths.TESTDATA_DRP(), "multicol", "saw_settings.csv")).Provide(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !data.HasSampleSettings() {
+		t.Fatal("Settings were not loaded")
+	}
+	compareDrps([]float64{10000, 20000, 30000}, *data.data, t)
+	expected := []SampleSettings{
+		{ExtralatencyMs: 0, Loss: 0, MarkfreeMs: 4, MarkfullMs: 14, JitterMs: -1},
+		{ExtralatencyMs: 5, Loss: 0.01, MarkfreeMs: 4, MarkfullMs: 14, JitterMs: -1},
+		{ExtralatencyMs: 10, Loss: 0.1, MarkfreeMs: 2, MarkfullMs: 10, JitterMs: -1},
+	}
+	iter := data.Iterator()
+	for i, e := range expected {
+		if _, err := iter.Next(); err != nil {
+			t.Fatal(err)
+		}
+		got, ok := iter.Settings()
+		if !ok {
+			t.Fatal("Iterator did not return settings")
+		}
+		if got != e {
+			t.Fatalf("@%d: got %+v, expected %+v", i, got, e)
+		}
+	}
+}
+
+func TestDataRatePatternFileProvider_OK_latency_loss(t *testing.T) {
+	data, err := NewDataRatePatternFileProvider(filepath.Join(paths.TESTDATA_DRP(), "multicol", "saw_latency_loss.csv")).Provide(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := (*data.GetSampleSettings())[1]
+	if s.ExtralatencyMs != 5 || s.Loss != 0.5 || s.HasMarking() {
+		t.Fatalf("Got unexpected settings: %+v", s)
+	}
+}
+
+func TestDataRatePatternFileProvider_NOK_settings(t *testing.T) {
+	for _, v := range []string{"broken_loss.csv", "broken_marking.csv", "broken_cols.csv"} {
+		path := filepath.Join(paths.TESTDATA_DRP(), "multicol", v)
+		if _, err := NewDataRatePatternFileProvider(path).Provide(0, 0); err == nil {
+			t.Fatalf("Expected an error loading %s", v)
+		}
+	}
+}
+
+func TestDataRatePatternFileProvider_NoSettings(t *testing.T) {
+	data, err := NewDataRatePatternFileProvider(PathSaw).Provide(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.HasSampleSettings() {
+		t.Fatal("Single-column pattern has settings")
+	}
+	if _, ok := data.Iterator().Settings(); ok {
+		t.Fatal("Iterator of single-column pattern returned settings")
+	}
+}
+
+func TestDataRatePatternFileProvider_OK_jitter(t *testing.T) {
+	data, err := NewDataRatePatternFileProvider(filepath.Join(paths.TESTDATA_DRP(), "multicol", "saw_jitter.csv")).Provide(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings := *data.GetSampleSettings()
+	if s := settings[1]; !s.HasJitter() || s.JitterMs != 3 || s.HasMarking() {
+		t.Fatalf("Got unexpected settings: %+v", s)
+	}
+	if s := settings[2]; s.JitterMs != 8.5 || !s.HasMarking() {
+		t.Fatalf("Got unexpected settings: %+v", s)
+	}
+}
@@ -0,0 +1,186 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package drp
+
+import (
+	"math"
+	"sort"
+
+	"github.com/telekom/aml-jens/internal/util"
+)
+
+// Parameters of DataRatePattern.ComputeStats
+type StatsParams struct {
+	//Percentiles to calculate, in [0,100]
+	Percentiles []float64
+	//Lags (in samples) to calculate the autocorrelation at
+	Lags []int
+	//Rates below ValleyThreshold (kbit/s) are part of a valley.
+	//If <= 0, half of the average rate is used.
+	ValleyThreshold float64
+}
+
+func DefaultStatsParams() StatsParams {
+	return StatsParams{
+		Percentiles: []float64{1, 5, 25, 50, 75, 95, 99},
+		Lags:        []int{1, 10, 100},
+	}
+}
+
+type Percentile struct {
+	P     float64 `json:"p"`
+	Value float64 `json:"value"`
+}
+
+type Autocorrelation struct {
+	Lag   int     `json:"lag"`
+	Value float64 `json:"value"`
+}
+
+// Distribution of the change between consecutive samples (kbit/s per sample)
+type RateOfChange struct {
+	MeanAbs     float64      `json:"mean_abs"`
+	MaxRise     float64      `json:"max_rise"`
+	MaxDrop     float64      `json:"max_drop"`
+	Percentiles []Percentile `json:"percentiles"`
+}
+
+// Statistics of a DataRatePattern, rates in kbit/s
+type DataRatePatternStats struct {
+	Samples     int          `json:"samples"`
+	Min         float64      `json:"min"`
+	Max         float64      `json:"max"`
+	Avg         float64      `json:"avg"`
+	StdDev      float64      `json:"stddev"`
+	CV          float64      `json:"cv"`
+	Percentiles []Percentile `json:"percentiles"`
+	//Autocorrelation at lags shorter than the pattern; 0 for constant patterns
+	Autocorrelation []Autocorrelation `json:"autocorrelation"`
+	ValleyThreshold float64           `json:"valley_threshold"`
+	Valleys         int               `json:"valleys"`
+	//Lengths in samples
+	ValleyMaxLength int          `json:"valley_max_length"`
+	ValleyAvgLength float64      `json:"valley_avg_length"`
+	RateOfChange    RateOfChange `json:"rate_of_change"`
+}
+
+// Returns the p-th percentile of sorted, interpolating linearly between ranks
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := math.Max(0, math.Min(1, p/100)) * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
+
+func percentiles(values []float64, ps []float64) []Percentile {
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+	res := make([]Percentile, len(ps))
+	for i, p := range ps {
+		res[i] = Percentile{P: p, Value: percentile(sorted, p)}
+	}
+	return res
+}
+
+// Calculates statistics of the loaded (scaled) pattern
+func (s *DataRatePattern) ComputeStats(params StatsParams) DataRatePatternStats {
+	data := *s.data
+	n := len(data)
+	res := DataRatePatternStats{Samples: n}
+	if n == 0 {
+		return res
+	}
+	res.Min, res.Max = math.MaxFloat64, -math.MaxFloat64
+	for _, v := range data {
+		res.Min = math.Min(res.Min, v)
+		res.Max = math.Max(res.Max, v)
+		res.Avg += v
+	}
+	res.Avg /= float64(n)
+	variance := 0.0
+	for _, v := range data {
+		variance += (v - res.Avg) * (v - res.Avg)
+	}
+	res.StdDev = math.Sqrt(variance / float64(n))
+	if res.Avg != 0 {
+		res.CV = res.StdDev / res.Avg
+	}
+	res.Percentiles = percentiles(data, params.Percentiles)
+
+	res.Autocorrelation = make([]Autocorrelation, 0, len(params.Lags))
+	for _, lag := range params.Lags {
+		if lag < 1 || lag >= n {
+			continue
+		}
+		ac := Autocorrelation{Lag: lag}
+		if variance != 0 {
+			for i := 0; i+lag < n; i++ {
+				ac.Value += (data[i] - res.Avg) * (data[i+lag] - res.Avg)
+			}
+			ac.Value /= variance
+		}
+		res.Autocorrelation = append(res.Autocorrelation, ac)
+	}
+
+	res.ValleyThreshold = params.ValleyThreshold
+	if res.ValleyThreshold <= 0 {
+		res.ValleyThreshold = res.Avg / 2
+	}
+	valley_samples, length := 0, 0
+	for i, v := range data {
+		if v < res.ValleyThreshold {
+			length++
+		}
+		if length > 0 && (v >= res.ValleyThreshold || i == n-1) {
+			res.Valleys++
+			valley_samples += length
+			res.ValleyMaxLength = util.MaxInt(res.ValleyMaxLength, length)
+			length = 0
+		}
+	}
+	if res.Valleys > 0 {
+		res.ValleyAvgLength = float64(valley_samples) / float64(res.Valleys)
+	}
+
+	changes := make([]float64, 0, n)
+	for i := 1; i < n; i++ {
+		d := data[i] - data[i-1]
+		changes = append(changes, d)
+		res.RateOfChange.MeanAbs += math.Abs(d)
+		res.RateOfChange.MaxRise = math.Max(res.RateOfChange.MaxRise, d)
+		res.RateOfChange.MaxDrop = math.Max(res.RateOfChange.MaxDrop, -d)
+	}
+	if len(changes) > 0 {
+		res.RateOfChange.MeanAbs /= float64(len(changes))
+	}
+	res.RateOfChange.Percentiles = percentiles(changes, params.Percentiles)
+	return res
+}
+
+// Calculates statistics using DefaultStatsParams
+func (s *DataRatePattern) Stats() DataRatePatternStats {
+	return s.ComputeStats(DefaultStatsParams())
+}
@@ -0,0 +1,69 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package drp
+
+import (
+	"math"
+	"testing"
+)
+
+func TestComputeStats(t *testing.T) {
+	data := []float64{10, 10, 2, 2, 10, 10, 1, 10}
+	p := DataRatePattern{data: &data}
+	st := p.ComputeStats(StatsParams{Percentiles: []float64{0, 50, 100}, Lags: []int{1, 8}})
+	if st.Samples != 8 || st.Min != 1 || st.Max != 10 || st.Avg != 55.0/8 {
+		t.Fatalf("Unexpected basic stats: %+v", st)
+	}
+	if math.Abs(st.StdDev-4.0447) > 1e-3 || math.Abs(st.CV-st.StdDev/st.Avg) > 1e-9 {
+		t.Fatalf("Unexpected stddev: %f, cv: %f", st.StdDev, st.CV)
+	}
+	if st.Percentiles[0].Value != 1 || st.Percentiles[1].Value != 10 || st.Percentiles[2].Value != 10 {
+		t.Fatalf("Unexpected percentiles: %+v", st.Percentiles)
+	}
+	if len(st.Autocorrelation) != 1 || st.Autocorrelation[0].Lag != 1 {
+		t.Fatalf("Lag >= samples was not skipped: %+v", st.Autocorrelation)
+	}
+	if st.ValleyThreshold != st.Avg/2 || st.Valleys != 2 || st.ValleyMaxLength != 2 || st.ValleyAvgLength != 1.5 {
+		t.Fatalf("Unexpected valleys: %+v", st)
+	}
+	if st.RateOfChange.MaxRise != 9 || st.RateOfChange.MaxDrop != 9 || st.RateOfChange.MeanAbs != 34.0/7 {
+		t.Fatalf("Unexpected rate of change: %+v", st.RateOfChange)
+	}
+}
+
+func TestComputeStatsSaw(t *testing.T) {
+	st := loadSaw(t).Stats()
+	if st.Valleys != 1 || st.ValleyMaxLength != 2 {
+		t.Fatalf("Unexpected valleys: %+v", st)
+	}
+	if st.Percentiles[3].P != 50 || st.Percentiles[3].Value != 55000 {
+		t.Fatalf("Unexpected median: %+v", st.Percentiles[3])
+	}
+	if st.Autocorrelation[0].Value <= 0.5 {
+		t.Fatalf("Saw should be strongly autocorrelated at lag 1: %+v", st.Autocorrelation)
+	}
+	for _, p := range st.RateOfChange.Percentiles {
+		if p.Value != 10000 {
+			t.Fatalf("Saw changes by 10000 per sample: %+v", p)
+		}
+	}
+}
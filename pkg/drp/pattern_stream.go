@@ -0,0 +1,357 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package drp
+
+import (
+	"bufio"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/telekom/aml-jens/internal/errortypes"
+)
+
+// Prefix of identifiers describing a live stream of rates
+//
+// e.g.: stream:stdin, stream:fifo:/tmp/rates?underrun=min, stream:unix:/run/jens.sock?timeout=500ms
+const STREAM_PREFIX = "stream:"
+
+// Defines what a streamed pattern plays if no rate arrived in time
+type UnderrunMode uint8
+
+const (
+	//Repeat the last rate
+	UNDERRUN_HOLD UnderrunMode = iota
+	//Drop to the min rate of the pattern
+	UNDERRUN_MIN
+	//Stop playing
+	UNDERRUN_STOP
+)
+
+var underrunModeNames = map[string]UnderrunMode{"hold": UNDERRUN_HOLD, "min": UNDERRUN_MIN, "stop": UNDERRUN_STOP}
+
+func ParseUnderrunMode(mode string) (UnderrunMode, error) {
+	if v, ok := underrunModeNames[mode]; ok {
+		return v, nil
+	}
+	return UNDERRUN_HOLD, errortypes.NewUserInputError("Unknown underrun mode '%s', expected hold, min or stop", mode)
+}
+
+func (m UnderrunMode) String() string {
+	for k, v := range underrunModeNames {
+		if v == m {
+			return k
+		}
+	}
+	return "unknown"
+}
+
+// Provides a DataRatePattern whose rates are read while playing.
+// Rates (kbit/s) are read line by line, empty lines and lines
+// starting with '#' are skipped.
+//
+// Supported sources:
+//   - stdin
+//   - fifo:PATH: a named pipe (or file); the stream ends at its EOF
+//   - unix:PATH: a unix socket drplay listens on; clients may
+//     connect one after another
+//
+// Supported parameters:
+//   - underrun: hold (default), min or stop; applies if no rate
+//     arrived within timeout
+//   - timeout: time to wait for the next rate (default 1s)
+//   - initial: rate played before the first one arrived (default 1000)
+type DataRatePatternStreamProvider struct {
+	Identifier string
+	Source     string
+	Path       string
+	Underrun   UnderrunMode
+	Timeout    time.Duration
+	Initial    float64
+}
+
+// Returns true if identifier describes a streamed pattern
+func IsStreamIdentifier(identifier string) bool {
+	return strings.HasPrefix(identifier, STREAM_PREFIX)
+}
+
+// Parses identifier into a DataRatePatternStreamProvider
+func NewDataRatePatternStreamProvider(identifier string) (*DataRatePatternStreamProvider, error) {
+	E := func(msg string, args ...any) error {
+		return errortypes.NewUserInputError("Stream '%s': %s", identifier, fmt.Sprintf(msg, args...))
+	}
+	if !IsStreamIdentifier(identifier) {
+		return nil, E("does not start with '%s'", STREAM_PREFIX)
+	}
+	s := &DataRatePatternStreamProvider{
+		Identifier: identifier,
+		Underrun:   UNDERRUN_HOLD,
+		Timeout:    time.Second,
+		Initial:    1000,
+	}
+	source, raw_query, _ := strings.Cut(strings.TrimPrefix(identifier, STREAM_PREFIX), "?")
+	s.Source, s.Path, _ = strings.Cut(source, ":")
+	switch {
+	case s.Source == "stdin" && s.Path == "":
+	case (s.Source == "fifo" || s.Source == "unix") && s.Path != "":
+	default:
+		return nil, E("expected stdin, fifo:PATH or unix:PATH")
+	}
+	query, err := url.ParseQuery(raw_query)
+	if err != nil {
+		return nil, E("%s", err)
+	}
+	for key, v := range query {
+		if len(v) != 1 {
+			return nil, E("parameter '%s' set %d times", key, len(v))
+		}
+		switch key {
+		case "underrun":
+			if s.Underrun, err = ParseUnderrunMode(v[0]); err != nil {
+				return nil, E("%s", err)
+			}
+		case "timeout":
+			if s.Timeout, err = time.ParseDuration(v[0]); err != nil || s.Timeout <= 0 {
+				return nil, E("'timeout' must be a positive duration")
+			}
+		case "initial":
+			if s.Initial, err = strconv.ParseFloat(v[0], 64); err != nil || s.Initial < 0 {
+				return nil, E("'initial' must be a non-negative number")
+			}
+		default:
+			return nil, E("unknown parameter '%s'", key)
+		}
+	}
+	return s, nil
+}
+
+func (s *DataRatePatternStreamProvider) Provide(scale float64, minrate float64) (DataRatePattern, error) {
+	if scale == 0 {
+		scale = 1
+	}
+	params := struct {
+		MinRateKbits float64
+		Scale        float64
+		Origin       string
+	}{
+		Scale:        scale,
+		MinRateKbits: minrate,
+		Origin:       s.Identifier,
+	}
+	stream := newRateStream(s, params)
+	if err := stream.open(); err != nil {
+		return DataRatePattern{}, errortypes.NewUserInputError("Stream '%s': %s", s.Identifier, err)
+	}
+	drp := NewDataRatePattern(params)
+	drp.Name = s.Identifier
+	drp.Description = fmt.Sprintf("Streamed from %s (underrun: %s after %s)", strings.TrimPrefix(strings.Split(s.Identifier, "?")[0], STREAM_PREFIX), s.Underrun, s.Timeout)
+	empty := make([]float64, 0)
+	drp.data = &empty
+	drp.stream = stream
+	//The content is unknown: hash the identifier instead
+	hash := md5.Sum([]byte(s.Identifier))
+	drp.Sha256 = hash[:]
+	return *drp, nil
+}
+
+// Rates received by a DataRatePatternStreamProvider
+type RateStream struct {
+	provider *DataRatePatternStreamProvider
+	scale    float64
+	minrate  float64
+	values   chan float64
+	mutex    sync.Mutex
+	closers  []io.Closer
+	closed   bool
+	//Ends the wait for the next rate once closed, see StopOn
+	exit <-chan uint8
+	//Number of times no rate arrived in time
+	underruns int
+}
+
+func newRateStream(provider *DataRatePatternStreamProvider, params struct {
+	MinRateKbits float64
+	Scale        float64
+	Origin       string
+}) *RateStream {
+	return &RateStream{
+		provider: provider,
+		scale:    params.Scale,
+		minrate:  params.MinRateKbits,
+		values:   make(chan float64, 1024),
+	}
+}
+
+// Starts reading from the source in the background
+func (s *RateStream) open() error {
+	switch s.provider.Source {
+	case "stdin":
+		go s.read(os.Stdin, true)
+	case "fifo":
+		if _, err := os.Stat(s.provider.Path); err != nil {
+			return err
+		}
+		//Opening a fifo blocks until a writer opened it
+		go func() {
+			fp, err := os.Open(s.provider.Path)
+			if err != nil {
+				WARN.Printf("Could not open %s: %s\n", s.provider.Path, err)
+				close(s.values)
+				return
+			}
+			if !s.track(fp) {
+				return
+			}
+			s.read(fp, true)
+		}()
+	case "unix":
+		if fi, err := os.Stat(s.provider.Path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			//Left over by a previous run
+			os.Remove(s.provider.Path)
+		}
+		listener, err := net.Listen("unix", s.provider.Path)
+		if err != nil {
+			return err
+		}
+		s.track(listener)
+		go func() {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					close(s.values)
+					return
+				}
+				if !s.track(conn) {
+					return
+				}
+				INFO.Printf("Stream client connected to %s\n", s.provider.Path)
+				s.read(conn, false)
+			}
+		}()
+	}
+	return nil
+}
+
+// Registers c to be closed by Close. Returns false (closing c)
+// if the stream is already closed.
+func (s *RateStream) track(c io.Closer) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		c.Close()
+		return false
+	}
+	s.closers = append(s.closers, c)
+	return true
+}
+
+// Parses rates from r until EOF, closing the stream afterwards if last is set
+func (s *RateStream) read(r io.Reader, last bool) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		v, err := strconv.ParseFloat(line, 64)
+		if err != nil || v < 0 {
+			WARN.Printf("Stream %s: ignoring invalid rate '%s'\n", s.provider.Identifier, line)
+			continue
+		}
+		s.values <- math.Max(v*s.scale, s.minrate)
+	}
+	if err := scanner.Err(); err != nil && !errors.Is(err, net.ErrClosed) && !errors.Is(err, os.ErrClosed) {
+		WARN.Printf("Stream %s: %s\n", s.provider.Identifier, err)
+	}
+	if last {
+		close(s.values)
+	}
+}
+
+// Returns the rate played before the first one arrived
+func (s *RateStream) initial() float64 {
+	return math.Max(s.provider.Initial*s.scale, s.minrate)
+}
+
+// Makes waiting for the next rate return an IterableStopError
+// as soon as exit is closed. Has to be called before playing.
+func (s *RateStream) StopOn(exit <-chan uint8) {
+	s.exit = exit
+}
+
+// Waits up to Timeout for the next rate. On underrun last is
+// returned (hold), the min rate (min) or an IterableStopError (stop).
+// An IterableStopError is also returned once the source ended
+// or the exit channel (see StopOn) is closed.
+func (s *RateStream) next(last float64) (float64, error) {
+	timer := time.NewTimer(s.provider.Timeout)
+	defer timer.Stop()
+	select {
+	case v, ok := <-s.values:
+		if !ok {
+			return 0, &errortypes.IterableStopError{}
+		}
+		return v, nil
+	case <-s.exit:
+		return 0, &errortypes.IterableStopError{}
+	case <-timer.C:
+	}
+	s.underruns++
+	switch s.provider.Underrun {
+	case UNDERRUN_STOP:
+		return 0, &errortypes.IterableStopError{}
+	case UNDERRUN_MIN:
+		return s.minrate, nil
+	default:
+		return last, nil
+	}
+}
+
+// Returns the number of times no rate arrived in time
+func (s *RateStream) Underruns() int {
+	return s.underruns
+}
+
+// Stops reading and releases the source
+func (s *RateStream) Close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	for _, c := range s.closers {
+		c.Close()
+	}
+	if s.provider.Source == "unix" {
+		os.Remove(s.provider.Path)
+	}
+}
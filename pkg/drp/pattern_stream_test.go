@@ -0,0 +1,174 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package drp
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/telekom/aml-jens/internal/errortypes"
+)
+
+func provideStream(t *testing.T, identifier string, scale float64, minrate float64) *DataRatePattern {
+	t.Helper()
+	provider, err := NewDataRatePatternProvider(identifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := provider.Provide(scale, minrate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !data.IsStreamed() {
+		t.Fatal("Pattern is not streamed")
+	}
+	return &data
+}
+
+func expectNext(t *testing.T, iter *DataRatePatternIterator, expected float64) {
+	t.Helper()
+	v, err := iter.Next()
+	if err != nil {
+		t.Fatalf("Expected %f, got %s", expected, err)
+	}
+	if v != expected {
+		t.Fatalf("Expected %f, got %f", expected, v)
+	}
+}
+
+func expectStop(t *testing.T, iter *DataRatePatternIterator) {
+	t.Helper()
+	if _, err := iter.Next(); err == nil {
+		t.Fatal("Expected stream to stop")
+	} else if _, ok := err.(*errortypes.IterableStopError); !ok {
+		t.Fatalf("Expected IterableStopError, got %s", err)
+	}
+}
+
+func TestStream_fifo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates")
+	if err := os.WriteFile(path, []byte("1000\n# comment\n\nabc\n2000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	data := provideStream(t, "stream:fifo:"+path+"?underrun=stop&timeout=1s", 2, 2500)
+	if data.SampleCount() != 0 || data.Stats().Samples != 0 {
+		t.Fatal("Streamed pattern should hold no samples")
+	}
+	iter := data.Iterator()
+	if iter.Value() != 2500 {
+		t.Fatalf("Initial value should be scaled and limited by minrate, got %f", iter.Value())
+	}
+	expectNext(t, iter, 2500)
+	expectNext(t, iter, 4000)
+	//EOF ends the stream
+	expectStop(t, iter)
+}
+
+func TestStream_unixUnderrun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.sock")
+	for _, tc := range []struct {
+		underrun string
+		expected float64
+	}{{"hold", 5000}, {"min", 100}} {
+		data := provideStream(t, "stream:unix:"+path+"?timeout=20ms&underrun="+tc.underrun, 1, 100)
+		iter := data.Iterator()
+		for _, rate := range []string{"5000\n", "7000\n"} {
+			conn, err := net.Dial("unix", path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := conn.Write([]byte(rate)); err != nil {
+				t.Fatal(err)
+			}
+			if rate == "5000\n" {
+				expectNext(t, iter, 5000)
+				expectNext(t, iter, tc.expected)
+				if data.GetStream().Underruns() != 1 {
+					t.Fatalf("%s: expected 1 underrun, got %d", tc.underrun, data.GetStream().Underruns())
+				}
+			} else {
+				expectNext(t, iter, 7000)
+			}
+			conn.Close()
+		}
+		iter.SetDone()
+		if _, err := os.Stat(path); err == nil {
+			t.Fatalf("%s: socket was not removed", tc.underrun)
+		}
+	}
+}
+
+func TestStream_stop(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.sock")
+	data := provideStream(t, "stream:unix:"+path+"?timeout=10ms&underrun=stop", 1, 0)
+	start := time.Now()
+	expectStop(t, data.Iterator())
+	if time.Since(start) > time.Second {
+		t.Fatal("Underrun did not stop in time")
+	}
+}
+
+func TestStream_stopOnExit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.sock")
+	data := provideStream(t, "stream:unix:"+path+"?timeout=1m", 1, 0)
+	exit := make(chan uint8)
+	data.GetStream().StopOn(exit)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(exit)
+	}()
+	start := time.Now()
+	expectStop(t, data.Iterator())
+	if time.Since(start) > time.Second {
+		t.Fatal("Closing exit did not end the wait for the next rate")
+	}
+	if data.GetStream().Underruns() != 0 {
+		t.Fatal("Exit was counted as underrun")
+	}
+}
+
+func TestStreamNOK(t *testing.T) {
+	for _, identifier := range []string{
+		"stream:",
+		"stream:stdin:foo",
+		"stream:fifo",
+		"stream:tcp:localhost",
+		"stream:stdin?underrun=drop",
+		"stream:stdin?timeout=0s",
+		"stream:stdin?initial=-1",
+		"stream:stdin?foo=1",
+	} {
+		if _, err := NewDataRatePatternProvider(identifier); err == nil {
+			t.Fatalf("Expected error for '%s'", identifier)
+		}
+	}
+	provider, err := NewDataRatePatternProvider("stream:fifo:/does/not/exist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.Provide(1, 0); err == nil {
+		t.Fatal("Expected error for missing fifo")
+	}
+}
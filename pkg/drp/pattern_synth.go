@@ -0,0 +1,297 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package drp
+
+import (
+	"fmt"
+	"math/rand"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/telekom/aml-jens/internal/errortypes"
+)
+
+// Prefix of identifiers describing a pattern synthesized from a seed pattern
+//
+// e.g.: synth:markov?source=/etc/jens-cli/drp_3valleys.csv&samples=6000&seed=7
+const SYNTH_PREFIX = "synth:"
+
+// Function synthesizing n (unscaled) samples resembling data
+type synthFunc func(s *DataRatePatternSynthProvider, data []float64, n int, rnd *rand.Rand) []float64
+
+var synthesizers = map[string]synthFunc{
+	"markov": func(s *DataRatePatternSynthProvider, data []float64, n int, rnd *rand.Rand) []float64 {
+		return learnMarkovChain(data, s.Levels).generate(n, rnd)
+	},
+	"bootstrap": func(s *DataRatePatternSynthProvider, data []float64, n int, rnd *rand.Rand) []float64 {
+		return blockBootstrap(data, s.Block, n, rnd)
+	},
+}
+
+// Provides a DataRatePattern that is statistically similar to a
+// seed pattern, described by an identifier like
+// 'synth:markov?source=drp_3valleys.csv&samples=6000&seed=7'.
+//
+// Supported methods:
+//   - markov: first order markov chain over quantized rate levels.
+//     Transitions are learned from the seed, values are drawn from
+//     the seed samples of the reached level.
+//   - bootstrap: circular block bootstrap, concatenating randomly
+//     chosen blocks of consecutive seed samples.
+//
+// Supported parameters:
+//   - source: seed pattern (csv file or url-encoded gen: identifier)
+//   - samples: length of the result (default: length of source)
+//   - seed: seed of the random number generator (default 1)
+//   - levels: number of quantization levels (markov, default 16)
+//   - block: block length in samples (bootstrap, default 20)
+//
+// Mappings and the native frequency of the source are kept,
+// timestamps and markings of timed patterns are dropped.
+type DataRatePatternSynthProvider struct {
+	Identifier string
+	Method     string
+	Source     string
+	Samples    int
+	Seed       int64
+	Levels     int
+	Block      int
+}
+
+// Returns true if identifier describes a synthesized pattern
+func IsSynthIdentifier(identifier string) bool {
+	return strings.HasPrefix(identifier, SYNTH_PREFIX)
+}
+
+// Parses identifier into a DataRatePatternSynthProvider
+func NewDataRatePatternSynthProvider(identifier string) (*DataRatePatternSynthProvider, error) {
+	E := func(msg string, args ...any) error {
+		return errortypes.NewUserInputError("Synthesizer '%s': %s", identifier, fmt.Sprintf(msg, args...))
+	}
+	if !IsSynthIdentifier(identifier) {
+		return nil, E("does not start with '%s'", SYNTH_PREFIX)
+	}
+	u, err := url.Parse(identifier)
+	if err != nil {
+		return nil, E("%s", err)
+	}
+	s := &DataRatePatternSynthProvider{
+		Identifier: identifier,
+		Method:     u.Opaque,
+		Seed:       1,
+		Levels:     16,
+		Block:      20,
+	}
+	if _, found := synthesizers[s.Method]; !found {
+		return nil, E("unknown method '%s'", u.Opaque)
+	}
+	query, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return nil, E("%s", err)
+	}
+	for key, v := range query {
+		if len(v) != 1 {
+			return nil, E("parameter '%s' set %d times", key, len(v))
+		}
+		switch key {
+		case "source":
+			s.Source = v[0]
+		case "samples", "seed", "levels", "block":
+			i, err := strconv.ParseInt(v[0], 10, 64)
+			if err != nil {
+				return nil, E("'%s' is not a valid integer", key)
+			}
+			switch key {
+			case "samples":
+				s.Samples = int(i)
+			case "seed":
+				s.Seed = i
+			case "levels":
+				s.Levels = int(i)
+			case "block":
+				s.Block = int(i)
+			}
+		default:
+			return nil, E("unknown parameter '%s'", key)
+		}
+	}
+	if err := s.validate(); err != nil {
+		return nil, E("%s", err)
+	}
+	return s, nil
+}
+
+func (s *DataRatePatternSynthProvider) validate() error {
+	if s.Source == "" {
+		return fmt.Errorf("source needs to be set")
+	}
+	if IsSynthIdentifier(s.Source) {
+		return fmt.Errorf("source can't be synthesized itself")
+	}
+	if IsStreamIdentifier(s.Source) {
+		return fmt.Errorf("source can't be streamed")
+	}
+	if s.Samples < 0 {
+		return fmt.Errorf("samples can't be negative")
+	}
+	if s.Levels < 1 {
+		return fmt.Errorf("levels must be at least 1")
+	}
+	if s.Block < 1 {
+		return fmt.Errorf("block must be at least 1")
+	}
+	return nil
+}
+
+func (s *DataRatePatternSynthProvider) Provide(scale float64, minrate float64) (DataRatePattern, error) {
+	provider, err := NewDataRatePatternProvider(s.Source)
+	if err != nil {
+		return DataRatePattern{}, err
+	}
+	source, err := provider.Provide(1, 0)
+	if err != nil {
+		return DataRatePattern{}, err
+	}
+	data := *source.data
+	if len(data) == 0 {
+		return DataRatePattern{}, errortypes.NewUserInputError("Synthesizer '%s': source is empty", s.Identifier)
+	}
+	n := s.Samples
+	if n == 0 {
+		n = len(data)
+	}
+	rnd := rand.New(rand.NewSource(s.Seed))
+	drp, err := newDataRatePatternFromData(synthesizers[s.Method](s, data, n, rnd), struct {
+		MinRateKbits float64
+		Scale        float64
+		Origin       string
+	}{
+		Scale:        scale,
+		MinRateKbits: minrate,
+		Origin:       s.Identifier,
+	})
+	if err != nil {
+		return DataRatePattern{}, err
+	}
+	drp.nativeFreq = source.nativeFreq
+	for k, v := range source.mapping {
+		drp.mapping[k] = v
+	}
+	drp.Description = fmt.Sprintf("Synthesized (%s, seed %d) from %s: %d samples", s.Method, s.Seed, source.Name, drp.Length)
+	return *drp, nil
+}
+
+// First order markov chain over quantized rate levels
+type markovChain struct {
+	// seed samples per level
+	members [][]float64
+	// transitions[from][to] = count
+	transitions [][]int
+	// level of every seed sample
+	states []int
+}
+
+// Quantizes data into (at most) levels equally populated levels
+// and counts the transitions between consecutive samples
+func learnMarkovChain(data []float64, levels int) *markovChain {
+	sorted := make([]float64, len(data))
+	copy(sorted, data)
+	sort.Float64s(sorted)
+	// upper bounds (exclusive) of all but the last level
+	bounds := make([]float64, 0, levels-1)
+	for i := 1; i < levels; i++ {
+		b := sorted[i*len(sorted)/levels]
+		if len(bounds) == 0 || b > bounds[len(bounds)-1] {
+			bounds = append(bounds, b)
+		}
+	}
+	m := &markovChain{
+		members:     make([][]float64, len(bounds)+1),
+		transitions: make([][]int, len(bounds)+1),
+		states:      make([]int, len(data)),
+	}
+	for i := range m.transitions {
+		m.transitions[i] = make([]int, len(bounds)+1)
+	}
+	for i, v := range data {
+		state := sort.Search(len(bounds), func(j int) bool { return bounds[j] > v })
+		m.states[i] = state
+		m.members[state] = append(m.members[state], v)
+		if i > 0 {
+			m.transitions[m.states[i-1]][state]++
+		}
+	}
+	return m
+}
+
+// Walks the chain for n steps, starting at a state drawn from the
+// seed's level distribution. States without outgoing transitions
+// (only possible for the last seed sample) restart the same way.
+func (m *markovChain) generate(n int, rnd *rand.Rand) []float64 {
+	res := make([]float64, n)
+	state := -1
+	for i := range res {
+		if state >= 0 {
+			state = m.next(state, rnd)
+		}
+		if state < 0 {
+			state = m.states[rnd.Intn(len(m.states))]
+		}
+		members := m.members[state]
+		res[i] = members[rnd.Intn(len(members))]
+	}
+	return res
+}
+
+// Returns the randomly chosen successor of state or -1
+func (m *markovChain) next(state int, rnd *rand.Rand) int {
+	total := 0
+	for _, c := range m.transitions[state] {
+		total += c
+	}
+	if total == 0 {
+		return -1
+	}
+	r := rnd.Intn(total)
+	for to, c := range m.transitions[state] {
+		if r < c {
+			return to
+		}
+		r -= c
+	}
+	return -1
+}
+
+// Concatenates randomly chosen blocks of consecutive samples of data,
+// wrapping around at its end, until n samples are reached.
+func blockBootstrap(data []float64, block int, n int, rnd *rand.Rand) []float64 {
+	res := make([]float64, 0, n)
+	for len(res) < n {
+		start := rnd.Intn(len(data))
+		for i := 0; i < block && len(res) < n; i++ {
+			res = append(res, data[(start+i)%len(data)])
+		}
+	}
+	return res
+}
@@ -0,0 +1,141 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package drp
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"testing"
+
+	"github.com/telekom/aml-jens/internal/util"
+)
+
+// Value following v in saw_100hz.csv
+func nextSawValue(v float64) float64 {
+	return math.Mod(v-10000+1000, 20000) + 10000
+}
+
+func synthIdentifier(method string, params string) string {
+	return fmt.Sprintf("synth:%s?source=%s&%s", method, url.QueryEscape(PathNative100Hz), params)
+}
+
+func TestSynth_deterministic(t *testing.T) {
+	for _, method := range []string{"markov", "bootstrap"} {
+		a := provideGenerated(t, synthIdentifier(method, "seed=1&samples=500"))
+		b := provideGenerated(t, synthIdentifier(method, "seed=1&samples=500"))
+		c := provideGenerated(t, synthIdentifier(method, "seed=2&samples=500"))
+		if !util.ByteCompare(a.GetHash(), b.GetHash()) {
+			t.Fatalf("%s: same seed produced different patterns", method)
+		}
+		if util.ByteCompare(a.GetHash(), c.GetHash()) {
+			t.Fatalf("%s: different seeds produced the same pattern", method)
+		}
+	}
+}
+
+func TestSynth_similar(t *testing.T) {
+	for _, method := range []string{"markov", "bootstrap"} {
+		data := provideGenerated(t, synthIdentifier(method, "samples=2000"))
+		if data.Length != 2000 {
+			t.Fatalf("%s: expected 2000 samples, got %d", method, data.Length)
+		}
+		if data.Min < 10000 || data.Max > 29000 {
+			t.Fatalf("%s: got values outside of the source range [%f,%f]", method, data.Min, data.Max)
+		}
+		if math.Abs(data.Avg-19500) > 1500 {
+			t.Fatalf("%s: average %f deviates from source", method, data.Avg)
+		}
+		if ac := data.Stats().Autocorrelation[0]; ac.Lag != 1 || ac.Value < 0.5 {
+			t.Fatalf("%s: lag 1 autocorrelation was lost: %+v", method, ac)
+		}
+		if data.GetNativeFreq() != 100 {
+			t.Fatalf("%s: native freq was not kept: %d", method, data.GetNativeFreq())
+		}
+		if v := data.GetMappingValue("th_mq_latency", ""); v != "{3,6}" {
+			t.Fatalf("%s: mapping was not kept: %s", method, v)
+		}
+	}
+}
+
+func TestSynth_defaultLength(t *testing.T) {
+	data := provideGenerated(t, synthIdentifier("markov", "seed=3"))
+	if data.Length != 200 {
+		t.Fatalf("Expected length of source (200), got %d", data.Length)
+	}
+}
+
+func TestSynth_markovTransitions(t *testing.T) {
+	// One level per distinct value: the saw only ever steps up or wraps
+	data := provideGenerated(t, synthIdentifier("markov", "levels=20&samples=1000&seed=5"))
+	values := *data.GetData()
+	for i := 1; i < len(values); i++ {
+		if values[i] != nextSawValue(values[i-1]) {
+			t.Fatalf("Unseen transition %f -> %f at %d", values[i-1], values[i], i)
+		}
+	}
+}
+
+func TestSynth_bootstrapBlocks(t *testing.T) {
+	data := provideGenerated(t, synthIdentifier("bootstrap", "block=7&samples=1000&seed=5"))
+	values := *data.GetData()
+	for i := 1; i < len(values); i++ {
+		if i%7 != 0 && values[i] != nextSawValue(values[i-1]) {
+			t.Fatalf("Block was not kept intact at %d: %f -> %f", i, values[i-1], values[i])
+		}
+	}
+}
+
+func TestSynth_generatedSource(t *testing.T) {
+	source := "gen:sine?min=12000&max=60000&period=30s"
+	data := provideGenerated(t, "synth:bootstrap?samples=50&source="+url.QueryEscape(source))
+	if data.Length != 50 {
+		t.Fatalf("Expected 50 samples, got %d", data.Length)
+	}
+	if data.Min < 12000 || data.Max > 60000 {
+		t.Fatalf("Got values outside of the source range [%f,%f]", data.Min, data.Max)
+	}
+}
+
+func TestSynthNOK(t *testing.T) {
+	for _, identifier := range []string{
+		"synth:arima?source=" + PathSaw,
+		"synth:markov",
+		"synth:markov?source=" + PathSaw + "&levels=0",
+		"synth:bootstrap?source=" + PathSaw + "&block=0",
+		"synth:bootstrap?source=" + PathSaw + "&samples=-1",
+		"synth:bootstrap?source=" + PathSaw + "&seed=x",
+		"synth:bootstrap?source=" + PathSaw + "&foo=1",
+		"synth:bootstrap?source=synth%3Amarkov",
+	} {
+		if _, err := NewDataRatePatternProvider(identifier); err == nil {
+			t.Fatalf("Expected error for '%s'", identifier)
+		}
+	}
+	provider, err := NewDataRatePatternProvider("synth:markov?source=/does/not/exist.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.Provide(1, 0); err == nil {
+		t.Fatal("Expected error for missing source")
+	}
+}
@@ -0,0 +1,223 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package drp
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/telekom/aml-jens/internal/errortypes"
+)
+
+// Prefix of mapping keys holding a Threshold
+const THRESHOLD_PREFIX = "th_"
+
+// Defines which side of a Threshold is worse
+type ThresholdDirection string
+
+const (
+	//Values above Warn/Fail are worse (e.g. latencies)
+	THRESHOLD_ABOVE ThresholdDirection = "above"
+	//Values below Warn/Fail are worse (e.g. link usage)
+	THRESHOLD_BELOW ThresholdDirection = "below"
+)
+
+// Result of Threshold.Evaluate
+type ThresholdResult uint8
+
+const (
+	THRESHOLD_PASS ThresholdResult = iota
+	THRESHOLD_WARN
+	THRESHOLD_FAIL
+)
+
+func (r ThresholdResult) String() string {
+	return [...]string{"pass", "warn", "fail"}[r]
+}
+
+// Warn/fail range a measured value is evaluated against.
+//
+// In a comment header thresholds are written as
+// '#:th_<name>=warn,fail[:unit[:above|below]]'; fail has
+// to be the worse value in the direction of the threshold.
+type Threshold struct {
+	Warn      float64
+	Fail      float64
+	Unit      string             `json:",omitempty"`
+	Direction ThresholdDirection `json:",omitempty"`
+}
+
+// Unit and direction of the thresholds evaluated by default.
+// Other th_* keys are custom thresholds.
+var KNOWN_THRESHOLDS = map[string]Threshold{
+	"th_mq_latency":   {Unit: "ms", Direction: THRESHOLD_ABOVE},
+	"th_p95_latency":  {Unit: "ms", Direction: THRESHOLD_ABOVE},
+	"th_p99_latency":  {Unit: "ms", Direction: THRESHOLD_ABOVE},
+	"th_p999_latency": {Unit: "ms", Direction: THRESHOLD_ABOVE},
+	"th_link_usage":   {Unit: "%", Direction: THRESHOLD_BELOW},
+}
+
+// Returns true if key names a threshold
+func IsThresholdKey(key string) bool {
+	return strings.HasPrefix(key, THRESHOLD_PREFIX) && len(key) > len(THRESHOLD_PREFIX)
+}
+
+// Parses value ('warn,fail[:unit[:above|below]]', optionally enclosed in
+// braces) of the threshold key. Values in the wrong order are an error.
+func ParseThreshold(key string, value string) (Threshold, error) {
+	E := func(msg string, args ...any) (Threshold, error) {
+		return Threshold{}, errortypes.NewUserInputError("Threshold %s='%s': %s", key, value, fmt.Sprintf(msg, args...))
+	}
+	parts := strings.Split(strings.TrimSuffix(strings.TrimPrefix(value, "{"), "}"), ":")
+	if len(parts) > 3 {
+		return E("expected 'a,b[:unit[:above|below]]'")
+	}
+	values := strings.Split(parts[0], ",")
+	if len(values) != 2 {
+		return E("expected two values 'a,b'")
+	}
+	var ab [2]float64
+	for i, v := range values {
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return E("'%s' is not a number", v)
+		}
+		ab[i] = f
+	}
+	res := Threshold{}
+	if len(parts) > 1 {
+		res.Unit = parts[1]
+	}
+	if len(parts) > 2 {
+		res.Direction = ThresholdDirection(parts[2])
+	}
+	res.Warn, res.Fail = ab[0], ab[1]
+	if err := res.normalize(key); err != nil {
+		return E("%s", err)
+	}
+	return res, nil
+}
+
+// Sets default unit and direction of key and validates the threshold
+func (t *Threshold) normalize(key string) error {
+	if !IsThresholdKey(key) {
+		return fmt.Errorf("key needs to start with '%s'", THRESHOLD_PREFIX)
+	}
+	known, is_known := KNOWN_THRESHOLDS[key]
+	if t.Unit == "" {
+		t.Unit = known.Unit
+	}
+	if t.Direction == "" {
+		t.Direction = THRESHOLD_ABOVE
+		if is_known {
+			t.Direction = known.Direction
+		}
+	}
+	if is_known && (t.Unit != known.Unit || t.Direction != known.Direction) {
+		return fmt.Errorf("%s is measured in '%s' (%s)", key, known.Unit, known.Direction)
+	}
+	switch t.Direction {
+	case THRESHOLD_ABOVE:
+		if t.Warn > t.Fail {
+			return fmt.Errorf("warn (%s) must not be above fail (%s)", formatFloat(t.Warn), formatFloat(t.Fail))
+		}
+	case THRESHOLD_BELOW:
+		if t.Warn < t.Fail {
+			return fmt.Errorf("warn (%s) must not be below fail (%s)", formatFloat(t.Warn), formatFloat(t.Fail))
+		}
+	default:
+		return fmt.Errorf("direction must be above or below, is '%s'", t.Direction)
+	}
+	return nil
+}
+
+// Returns the threshold in the format of a comment header mapping ('{warn,fail[:unit:direction]}').
+// Unit and direction are left out for known thresholds.
+func (t Threshold) mappingValue(key string) string {
+	if _, is_known := KNOWN_THRESHOLDS[key]; is_known {
+		return fmt.Sprintf("{%s,%s}", formatFloat(t.Warn), formatFloat(t.Fail))
+	}
+	return fmt.Sprintf("{%s,%s:%s:%s}", formatFloat(t.Warn), formatFloat(t.Fail), t.Unit, t.Direction)
+}
+
+// Evaluates a measured value
+func (t Threshold) Evaluate(v float64) ThresholdResult {
+	worse := func(a float64, b float64) bool {
+		if t.Direction == THRESHOLD_BELOW {
+			return a < b
+		}
+		return a > b
+	}
+	switch {
+	case worse(v, t.Fail):
+		return THRESHOLD_FAIL
+	case worse(v, t.Warn):
+		return THRESHOLD_WARN
+	default:
+		return THRESHOLD_PASS
+	}
+}
+
+func (t Threshold) String() string {
+	op := ">"
+	if t.Direction == THRESHOLD_BELOW {
+		op = "<"
+	}
+	return fmt.Sprintf("warn %s%s%s, fail %s%s%s", op, formatFloat(t.Warn), t.Unit, op, formatFloat(t.Fail), t.Unit)
+}
+
+// Returns all thresholds set by the pattern (known and custom ones)
+func (s *DataRatePattern) GetThresholds() map[string]Threshold {
+	res := make(map[string]Threshold)
+	for k, v := range s.mapping {
+		if !IsThresholdKey(k) {
+			continue
+		}
+		th, err := ParseThreshold(k, v)
+		if err != nil {
+			WARN.Printf("Ignoring %s\n", err)
+			continue
+		}
+		res[k] = th
+	}
+	return res
+}
+
+// Returns the threshold key and true, or false if it is not set
+func (s *DataRatePattern) GetThreshold(key string) (Threshold, bool) {
+	th, ok := s.GetThresholds()[key]
+	return th, ok
+}
+
+// Sets (overrides) the threshold key
+func (s *DataRatePattern) SetThreshold(key string, th Threshold) error {
+	if err := th.normalize(key); err != nil {
+		return errortypes.NewUserInputError("Threshold %s: %s", key, err)
+	}
+	if s.mapping == nil {
+		s.mapping = make(map[string]string)
+	}
+	s.mapping[key] = th.mappingValue(key)
+	return nil
+}
@@ -0,0 +1,141 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package drp
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/telekom/aml-jens/internal/assets/paths"
+)
+
+func TestParseThreshold(t *testing.T) {
+	tests := []struct {
+		key      string
+		value    string
+		expected Threshold
+	}{
+		{"th_mq_latency", "{3,6}", Threshold{3, 6, "ms", THRESHOLD_ABOVE}},
+		{"th_p95_latency", " 11 ,21", Threshold{11, 21, "ms", THRESHOLD_ABOVE}},
+		{"th_link_usage", "90,80", Threshold{90, 80, "%", THRESHOLD_BELOW}},
+		{"th_link_usage", "{90,80:%:below}", Threshold{90, 80, "%", THRESHOLD_BELOW}},
+		{"th_jitter", "2,5:ms", Threshold{2, 5, "ms", THRESHOLD_ABOVE}},
+		{"th_throughput", "5000,2000:kbit/s:below", Threshold{5000, 2000, "kbit/s", THRESHOLD_BELOW}},
+	}
+	for _, test := range tests {
+		th, err := ParseThreshold(test.key, test.value)
+		if err != nil {
+			t.Fatalf("%s=%s: %s", test.key, test.value, err)
+		}
+		if th != test.expected {
+			t.Fatalf("%s=%s: expected %+v, got %+v", test.key, test.value, test.expected, th)
+		}
+	}
+}
+
+func TestParseThresholdNOK(t *testing.T) {
+	tests := []struct {
+		key   string
+		value string
+	}{
+		{"th_mq_latency", "3"},
+		{"th_mq_latency", "3,6,9"},
+		{"th_mq_latency", "a,6"},
+		{"th_mq_latency", "3,NaN"},
+		{"th_mq_latency", "3,6:s"},
+		{"th_link_usage", "90,80:%:above"},
+		{"th_jitter", "2,5:ms:sideways"},
+		{"th_jitter", "2,5:ms:above:x"},
+		{"th_", "2,5"},
+		//Fail has to be the worse value
+		{"th_p95_latency", "21,11"},
+		{"th_link_usage", "80,90"},
+		{"th_throughput", "2000,5000:kbit/s:below"},
+	}
+	for _, test := range tests {
+		if th, err := ParseThreshold(test.key, test.value); err == nil {
+			t.Fatalf("%s=%s: expected an error, got %+v", test.key, test.value, th)
+		}
+	}
+}
+
+func TestThresholdEvaluate(t *testing.T) {
+	latency := Threshold{Warn: 3, Fail: 6, Direction: THRESHOLD_ABOVE}
+	usage := Threshold{Warn: 90, Fail: 80, Direction: THRESHOLD_BELOW}
+	tests := []struct {
+		th       Threshold
+		value    float64
+		expected ThresholdResult
+	}{
+		{latency, 1, THRESHOLD_PASS},
+		{latency, 3, THRESHOLD_PASS},
+		{latency, 4, THRESHOLD_WARN},
+		{latency, 7, THRESHOLD_FAIL},
+		{usage, 95, THRESHOLD_PASS},
+		{usage, 85, THRESHOLD_WARN},
+		{usage, 79, THRESHOLD_FAIL},
+	}
+	for _, test := range tests {
+		if res := test.th.Evaluate(test.value); res != test.expected {
+			t.Fatalf("%s with %f: expected %s, got %s", test.th, test.value, test.expected, res)
+		}
+	}
+}
+
+func TestPatternThresholds(t *testing.T) {
+	pattern, err := NewDataRatePatternFileProvider(filepath.Join(paths.TESTDATA_DRP(), "thresholds", "custom.csv")).Provide(1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ths := pattern.GetThresholds()
+	if len(ths) != 3 {
+		t.Fatalf("Expected 2 known and 1 custom threshold, got %+v", ths)
+	}
+	if th, _ := pattern.GetThreshold("th_mq_latency"); th != (Threshold{3, 6, "ms", THRESHOLD_ABOVE}) {
+		t.Fatalf("th_mq_latency not set correctly: %+v", th)
+	}
+	if th, _ := pattern.GetThreshold("th_throughput"); th != (Threshold{5000, 2000, "kbit/s", THRESHOLD_BELOW}) {
+		t.Fatalf("th_throughput not set correctly: %+v", th)
+	}
+	if err := pattern.SetThreshold("th_mq_latency", Threshold{Warn: 2, Fail: 4}); err != nil {
+		t.Fatal(err)
+	}
+	if v := pattern.GetMappingValue("th_mq_latency", ""); v != "{2,4}" {
+		t.Fatalf("Override not written to mapping: %s", v)
+	}
+	if err := pattern.SetThreshold("th_link_usage", Threshold{Warn: 80, Fail: 90}); err == nil {
+		t.Fatal("Expected an error for a link usage threshold with fail above warn")
+	}
+	if err := pattern.SetThreshold("th_throughput", Threshold{Warn: 1, Fail: 2, Unit: "ms"}); err != nil {
+		t.Fatal(err)
+	}
+	if th, _ := pattern.GetThreshold("th_throughput"); th != (Threshold{1, 2, "ms", THRESHOLD_ABOVE}) {
+		t.Fatalf("th_throughput override not set correctly: %+v", th)
+	}
+}
+
+func TestPatternThresholdsMalformed(t *testing.T) {
+	_, err := NewDataRatePatternFileProvider(filepath.Join(paths.TESTDATA_DRP(), "thresholds", "malformed.csv")).Provide(1, 0)
+	if err == nil {
+		t.Fatal("Expected an error for a malformed threshold")
+	}
+}
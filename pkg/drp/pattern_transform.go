@@ -0,0 +1,376 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package drp
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/telekom/aml-jens/internal/errortypes"
+)
+
+// Transformations return a new DataRatePattern and leave the
+// original untouched. Description and mappings are preserved,
+// stats and hash are recalculated.
+//
+// The hash of a transformed pattern equals the hash of the
+// pattern loaded from its saved csv (scale 1, minrate 0).
+
+// Creates a deep copy without iterator
+func (s *DataRatePattern) clone() *DataRatePattern {
+	res := *s
+	res.iter = nil
+	data := make([]float64, len(*s.data))
+	copy(data, *s.data)
+	res.data = &data
+	if s.timestamps != nil {
+		t := make([]float64, len(*s.timestamps))
+		copy(t, *s.timestamps)
+		res.timestamps = &t
+	}
+	if s.settings != nil {
+		set := make([]SampleSettings, len(*s.settings))
+		copy(set, *s.settings)
+		res.settings = &set
+	}
+	res.mapping = make(map[string]string, len(s.mapping))
+	for k, v := range s.mapping {
+		res.mapping[k] = v
+	}
+	res.Sha256 = nil
+	return &res
+}
+
+// Creates a copy, keeping only the samples at indices
+// (indices may repeat or be out of order).
+// Timestamps are taken over as is.
+func (s *DataRatePattern) pick(indices []int) *DataRatePattern {
+	res := s.clone()
+	data := make([]float64, len(indices))
+	for i, v := range indices {
+		data[i] = (*s.data)[v]
+	}
+	res.data = &data
+	if s.timestamps != nil {
+		t := make([]float64, len(indices))
+		for i, v := range indices {
+			t[i] = (*s.timestamps)[v]
+		}
+		res.timestamps = &t
+	}
+	if s.settings != nil {
+		set := make([]SampleSettings, len(indices))
+		for i, v := range indices {
+			set[i] = (*s.settings)[v]
+		}
+		res.settings = &set
+	}
+	return res
+}
+
+// Recalculates Length, Min, Max, Avg and hash from data
+func (s *DataRatePattern) rebuild() (*DataRatePattern, error) {
+	if s.data == nil || len(*s.data) == 0 {
+		return nil, errortypes.NewUserInputError("Transformation would result in an empty pattern")
+	}
+	s.Length = len(*s.data)
+	s.Min = math.MaxFloat64
+	s.Max = -1
+	s.Avg = 0
+	var hash_buf bytes.Buffer
+	for i, v := range *s.data {
+		if s.timestamps != nil {
+			if err := binary.Write(&hash_buf, binary.LittleEndian, (*s.timestamps)[i]); err != nil {
+				return nil, err
+			}
+		}
+		if err := binary.Write(&hash_buf, binary.LittleEndian, v); err != nil {
+			return nil, err
+		}
+		if s.settings != nil {
+			if err := (*s.settings)[i].writeHash(&hash_buf); err != nil {
+				return nil, err
+			}
+		}
+		s.Min = math.Min(s.Min, v)
+		s.Max = math.Max(s.Max, v)
+		s.Avg += v
+	}
+	s.Avg /= float64(s.Length)
+	hash := md5.New()
+	if _, err := hash.Write(hash_buf.Bytes()); err != nil {
+		return nil, err
+	}
+	s.Sha256 = hash.Sum(nil)
+	return s, nil
+}
+
+// Shifts all timestamps so that the first sample is at 0
+func (s *DataRatePattern) rebaseTimestamps() {
+	if s.timestamps == nil || len(*s.timestamps) == 0 {
+		return
+	}
+	t0 := (*s.timestamps)[0]
+	for i := range *s.timestamps {
+		(*s.timestamps)[i] -= t0
+	}
+}
+
+// Returns the spacing between the last two samples of a timed pattern
+func (s *DataRatePattern) lastSpacing() float64 {
+	t := *s.timestamps
+	if len(t) < 2 {
+		return 0
+	}
+	return t[len(t)-1] - t[len(t)-2]
+}
+
+// Returns samples [from, to)
+func (s *DataRatePattern) Crop(from int, to int) (*DataRatePattern, error) {
+	if from < 0 || to > s.SampleCount() || from >= to {
+		return nil, errortypes.NewUserInputError("Crop: [%d,%d) is not within [0,%d)", from, to, s.SampleCount())
+	}
+	indices := make([]int, 0, to-from)
+	for i := from; i < to; i++ {
+		indices = append(indices, i)
+	}
+	res := s.pick(indices)
+	res.rebaseTimestamps()
+	return res.rebuild()
+}
+
+// Appends others to this pattern.
+//
+// All patterns need to be of the same kind (timed, per sample settings, native freq).
+// Timed patterns are appended after the last spacing of their predecessor.
+// Description and mappings are taken from this pattern.
+func (s *DataRatePattern) Concat(others ...*DataRatePattern) (*DataRatePattern, error) {
+	res := s.clone()
+	res.rebaseTimestamps()
+	for _, o := range others {
+		if o.IsTimed() != s.IsTimed() || o.HasSampleSettings() != s.HasSampleSettings() || o.nativeFreq != s.nativeFreq {
+			return nil, errortypes.NewUserInputError("Concat: '%s' and '%s' are not of the same kind", s.Name, o.Name)
+		}
+		if res.timestamps != nil {
+			gap := res.lastSpacing()
+			if gap == 0 {
+				gap = o.lastSpacing()
+			}
+			last := (*res.timestamps)[len(*res.timestamps)-1]
+			first := (*o.timestamps)[0]
+			for _, t := range *o.timestamps {
+				*res.timestamps = append(*res.timestamps, last+gap+t-first)
+			}
+		}
+		*res.data = append(*res.data, *o.data...)
+		if res.settings != nil {
+			*res.settings = append(*res.settings, *o.settings...)
+		}
+	}
+	return res.rebuild()
+}
+
+// Repeats the pattern n times
+func (s *DataRatePattern) Repeat(n int) (*DataRatePattern, error) {
+	if n < 1 {
+		return nil, errortypes.NewUserInputError("Repeat: n must be at least 1, is %d", n)
+	}
+	others := make([]*DataRatePattern, n-1)
+	for i := range others {
+		others[i] = s
+	}
+	return s.Concat(others...)
+}
+
+// Plays the pattern backwards.
+// Timed patterns keep their spacing (mirrored).
+func (s *DataRatePattern) Reverse() (*DataRatePattern, error) {
+	n := s.SampleCount()
+	indices := make([]int, n)
+	for i := range indices {
+		indices[i] = n - 1 - i
+	}
+	res := s.pick(indices)
+	if res.timestamps != nil {
+		last := (*s.timestamps)[n-1]
+		for i := range *res.timestamps {
+			(*res.timestamps)[i] = last - (*res.timestamps)[i]
+		}
+	}
+	return res.rebuild()
+}
+
+// Stretches the pattern in time by factor (2 = twice as long).
+//
+// Timed patterns get their timestamps multiplied,
+// untimed patterns are resampled by holding values.
+func (s *DataRatePattern) Stretch(factor float64) (*DataRatePattern, error) {
+	if factor <= 0 {
+		return nil, errortypes.NewUserInputError("Stretch: factor must be greater than 0, is %f", factor)
+	}
+	if s.timestamps != nil {
+		res := s.clone()
+		for i := range *res.timestamps {
+			(*res.timestamps)[i] *= factor
+		}
+		return res.rebuild()
+	}
+	n := int(math.Round(float64(s.SampleCount()) * factor))
+	indices := make([]int, n)
+	for i := range indices {
+		indices[i] = int(math.Min(float64(s.SampleCount()-1), math.Floor(float64(i)/factor)))
+	}
+	return s.pick(indices).rebuild()
+}
+
+// Replaces every rate by the average of a centered window of size window
+func (s *DataRatePattern) Smooth(window int) (*DataRatePattern, error) {
+	if window < 1 {
+		return nil, errortypes.NewUserInputError("Smooth: window must be at least 1, is %d", window)
+	}
+	res := s.clone()
+	n := s.SampleCount()
+	for i := range *res.data {
+		from := i - window/2
+		to := from + window
+		sum := 0.0
+		count := 0
+		for j := from; j < to; j++ {
+			if j < 0 || j >= n {
+				continue
+			}
+			sum += (*s.data)[j]
+			count++
+		}
+		(*res.data)[i] = sum / float64(count)
+	}
+	return res.rebuild()
+}
+
+// Limits every rate to [min,max]
+func (s *DataRatePattern) Clamp(min float64, max float64) (*DataRatePattern, error) {
+	if min > max {
+		return nil, errortypes.NewUserInputError("Clamp: min (%f) is greater than max (%f)", min, max)
+	}
+	res := s.clone()
+	for i, v := range *res.data {
+		(*res.data)[i] = math.Max(min, math.Min(max, v))
+	}
+	return res.rebuild()
+}
+
+// Maps the rates linearly from [Min,Max] to [min,max]
+func (s *DataRatePattern) Rescale(min float64, max float64) (*DataRatePattern, error) {
+	if min > max || min < 0 {
+		return nil, errortypes.NewUserInputError("Rescale: [%f,%f] is not a valid range", min, max)
+	}
+	res := s.clone()
+	span := s.Max - s.Min
+	for i, v := range *res.data {
+		if span == 0 {
+			(*res.data)[i] = min
+			continue
+		}
+		(*res.data)[i] = min + (v-s.Min)/span*(max-min)
+	}
+	return res.rebuild()
+}
+
+// Multiplies every rate by factor. Contrary to Scale a copy is returned.
+func (s *DataRatePattern) Scaled(factor float64) (*DataRatePattern, error) {
+	if factor <= 0 {
+		return nil, errortypes.NewUserInputError("Scaled: factor must be greater than 0, is %f", factor)
+	}
+	res := s.clone()
+	for i := range *res.data {
+		(*res.data)[i] *= factor
+	}
+	return res.rebuild()
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// Writes the pattern as csv, including description and mappings
+// as comment header. Values are written as currently loaded (scaled).
+func (s *DataRatePattern) WriteCSV(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	if s.Description != "" {
+		for _, line := range strings.Split(strings.TrimSuffix(s.Description, "\n"), "\n") {
+			fmt.Fprintf(bw, "# %s\n", line)
+		}
+	}
+	keys := make([]string, 0, len(s.mapping))
+	for k := range s.mapping {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	if s.nativeFreq > 0 {
+		fmt.Fprintf(bw, "#:freq=%d\n", s.nativeFreq)
+	}
+	for _, k := range keys {
+		fmt.Fprintf(bw, "#:%s=%s\n", k, strings.Trim(s.mapping[k], "{}"))
+	}
+	//csv needs a fixed amount of cols: write marking (and jitter) for all if any sets it
+	marking, jitter := false, false
+	if s.settings != nil {
+		for _, set := range *s.settings {
+			marking = marking || set.HasMarking()
+			jitter = jitter || set.HasJitter()
+		}
+	}
+	for i, v := range *s.data {
+		cols := make([]string, 0, 6)
+		if s.timestamps != nil {
+			cols = append(cols, formatFloat((*s.timestamps)[i]))
+		}
+		cols = append(cols, formatFloat(v))
+		if s.settings != nil {
+			set := (*s.settings)[i]
+			cols = append(cols, formatFloat(set.ExtralatencyMs), formatFloat(set.Loss))
+			if marking || jitter {
+				cols = append(cols, formatFloat(set.MarkfreeMs), formatFloat(set.MarkfullMs))
+			}
+			if jitter {
+				cols = append(cols, formatFloat(set.JitterMs))
+			}
+		}
+		if _, err := bw.WriteString(strings.Join(cols, ",") + "\n"); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// Writes the pattern as csv to path. See WriteCSV
+func (s *DataRatePattern) SaveCSV(path string) error {
+	return saveTo(path, s.WriteCSV)
+}
@@ -0,0 +1,182 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package drp
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func loadSaw(t *testing.T) *DataRatePattern {
+	t.Helper()
+	data, err := NewDataRatePatternFileProvider(PathSaw).Provide(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &data
+}
+
+func TestTransform_saw(t *testing.T) {
+	saw := loadSaw(t)
+	cases := []struct {
+		name     string
+		f        func() (*DataRatePattern, error)
+		expected []float64
+	}{
+		{"crop", func() (*DataRatePattern, error) { return saw.Crop(2, 5) }, []float64{30000, 40000, 50000}},
+		{"reverse", saw.Reverse, []float64{100000, 90000, 80000, 70000, 60000, 50000, 40000, 30000, 20000, 10000}},
+		{"clamp", func() (*DataRatePattern, error) { return saw.Clamp(30000, 80000) },
+			[]float64{30000, 30000, 30000, 40000, 50000, 60000, 70000, 80000, 80000, 80000}},
+		{"rescale", func() (*DataRatePattern, error) { return saw.Rescale(0, 9) }, []float64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}},
+		{"smooth", func() (*DataRatePattern, error) { return saw.Smooth(3) },
+			[]float64{15000, 20000, 30000, 40000, 50000, 60000, 70000, 80000, 90000, 95000}},
+		{"stretch", func() (*DataRatePattern, error) {
+			c, err := saw.Crop(0, 3)
+			if err != nil {
+				return nil, err
+			}
+			return c.Stretch(2)
+		}, []float64{10000, 10000, 20000, 20000, 30000, 30000}},
+		{"repeat", func() (*DataRatePattern, error) {
+			c, err := saw.Crop(0, 2)
+			if err != nil {
+				return nil, err
+			}
+			return c.Repeat(3)
+		}, []float64{10000, 20000, 10000, 20000, 10000, 20000}},
+	}
+	for _, c := range cases {
+		res, err := c.f()
+		if err != nil {
+			t.Fatalf("%s: %s", c.name, err)
+		}
+		compareDrps(c.expected, *res.data, t)
+		if res.Length != len(c.expected) {
+			t.Fatalf("%s: Length was not updated", c.name)
+		}
+	}
+	compareDrps(ExpectationSaw, *saw.data, t)
+}
+
+func TestTransform_stats(t *testing.T) {
+	saw := loadSaw(t)
+	res, err := saw.Crop(0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Min != 10000 || res.Max != 20000 || res.Avg != 15000 {
+		t.Fatalf("Stats were not recalculated: %f %f %f", res.Min, res.Max, res.Avg)
+	}
+	if res.GetHashStr() == saw.GetHashStr() {
+		t.Fatal("Hash was not recalculated")
+	}
+}
+
+func TestTransform_NOK(t *testing.T) {
+	saw := loadSaw(t)
+	timed, err := NewDataRatePatternTimedFileProvider(PathTimedSaw).Provide(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := saw.Crop(5, 5); err == nil {
+		t.Fatal("Empty crop did not fail")
+	}
+	if _, err := saw.Crop(0, 11); err == nil {
+		t.Fatal("Crop out of bounds did not fail")
+	}
+	if _, err := saw.Concat(&timed); err == nil {
+		t.Fatal("Concat of timed and untimed pattern did not fail")
+	}
+	if _, err := saw.Clamp(2, 1); err == nil {
+		t.Fatal("Invalid clamp did not fail")
+	}
+}
+
+func TestTransform_timed(t *testing.T) {
+	data, err := NewDataRatePatternTimedFileProvider(PathTimedSaw).Provide(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rev, err := data.Reverse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareDrps([]float64{0, 600, 850, 900, 1000}, *rev.timestamps, t)
+	twice, err := data.Concat(&data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareDrps([]float64{0, 100, 150, 400, 1000, 1600, 1700, 1750, 2000, 2600}, *twice.timestamps, t)
+	crop, err := data.Crop(1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareDrps([]float64{0, 50}, *crop.timestamps, t)
+}
+
+func TestTransform_SaveCSV_roundtrip(t *testing.T) {
+	for _, v := range []struct {
+		path  string
+		timed bool
+	}{
+		{filepath.Join(PathSaw), false},
+		{PathTimedSaw, true},
+		{filepath.Join(filepath.Dir(PathSaw), "multicol", "saw_settings.csv"), false},
+		{filepath.Join(filepath.Dir(PathSaw), "drp_3valleys_kv_comment.csv"), false},
+	} {
+		var provider DataRatePatternProvider = NewDataRatePatternFileProvider(v.path)
+		if v.timed {
+			provider = NewDataRatePatternTimedFileProvider(v.path)
+		}
+		data, err := provider.Provide(0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := data.Reverse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := filepath.Join(t.TempDir(), "out.csv")
+		if err := res.SaveCSV(out); err != nil {
+			t.Fatal(err)
+		}
+		provider = NewDataRatePatternFileProvider(out)
+		if v.timed {
+			provider = NewDataRatePatternTimedFileProvider(out)
+		}
+		loaded, err := provider.Provide(0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if loaded.GetHashStr() != res.GetHashStr() {
+			t.Fatalf("%s: Hash of saved pattern differs: %s != %s", v.path, loaded.GetHashStr(), res.GetHashStr())
+		}
+		if loaded.Description != data.Description {
+			t.Fatalf("%s: Description was not preserved: '%s' != '%s'", v.path, loaded.Description, data.Description)
+		}
+		for k, m := range data.mapping {
+			if loaded.mapping[k] != m {
+				t.Fatalf("%s: mapping %s was not preserved: %s != %s", v.path, k, loaded.mapping[k], m)
+			}
+		}
+	}
+}
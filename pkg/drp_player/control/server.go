@@ -0,0 +1,306 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Runtime control of a running drplay.
+//
+// A small HTTP api, served on a unix socket or a loopback address:
+//
+//	GET  /status                              state of every change loop
+//	POST /pause, /resume                      hold / continue the pattern
+//	POST /seek?index=N or /seek?time=30s      continue the pattern at a sample
+//	POST /rate?kbits=N[&duration=10s]         force a rate, kbits=0 clears it
+//	POST /pattern?id=IDENTIFIER               continue with another pattern
+//	POST /marking?markfree=MS&markfull=MS     change the marking of the queue, overriding
+//	                                          the pattern's marking until clear=1 is posted
+//
+// Actions apply to ue=0 and direction=uplink unless set as query parameters.
+// Every response is json: the status of the affected loops or {"Error": ...}.
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/telekom/aml-jens/internal/errortypes"
+	"github.com/telekom/aml-jens/internal/logging"
+	"github.com/telekom/aml-jens/internal/persistence/datatypes"
+	"github.com/telekom/aml-jens/pkg/drp_player/trafficcontrol"
+)
+
+var DEBUG, INFO, WARN, FATAL = logging.GetLogger()
+
+// A change loop controllable through the api
+type Target struct {
+	Ue        int
+	Direction string
+	Tc        *trafficcontrol.TrafficControl
+}
+
+// Loads a pattern to swap to, with the settings (freq, scale, ...) of the running ones
+type PatternLoader func(identifier string) (*datatypes.DB_data_rate_pattern, error)
+
+// Status of a Target
+type TargetStatus struct {
+	Ue        int
+	Direction string
+	trafficcontrol.LoopStatus
+}
+
+type errorResponse struct {
+	Error string
+}
+
+type Server struct {
+	targets  []Target
+	load     PatternLoader
+	listener net.Listener
+	server   *http.Server
+	//Socket file to remove on Close, empty for tcp
+	socket string
+}
+
+// Listens on address: 'unix:PATH' or 'HOST:PORT', where HOST has to be a loopback address.
+// Serve has to be called afterwards.
+func Listen(address string, targets []Target, load PatternLoader) (*Server, error) {
+	s := &Server{targets: targets, load: load}
+	var err error
+	if strings.HasPrefix(address, "unix:") {
+		path := strings.TrimPrefix(address, "unix:")
+		if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			//Left over by a previous run
+			os.Remove(path)
+		}
+		s.socket = path
+		s.listener, err = net.Listen("unix", path)
+	} else {
+		if err := checkLoopback(address); err != nil {
+			return nil, err
+		}
+		s.listener, err = net.Listen("tcp", address)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("control: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", s.handleStatus)
+	for path, action := range map[string]func(Target, *http.Request) error{
+		"/pause":   s.pause,
+		"/resume":  s.resume,
+		"/seek":    s.seek,
+		"/rate":    s.rate,
+		"/pattern": s.swap,
+		"/marking": s.marking,
+	} {
+		mux.HandleFunc(path, s.handleAction(action))
+	}
+	s.server = &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	return s, nil
+}
+
+func checkLoopback(address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return errortypes.NewUserInputError("Control address '%s' is neither unix:PATH nor HOST:PORT", address)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return errortypes.NewUserInputError("Control address '%s' is not a loopback address", address)
+	}
+	return nil
+}
+
+// Returns the address the server listens on
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Serves requests until Close is called.
+//
+// Blocking
+func (s *Server) Serve() {
+	INFO.Printf("control api listening on %s", s.Addr())
+	if err := s.server.Serve(s.listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		WARN.Printf("control: %v", err)
+	}
+}
+
+func (s *Server) Close() error {
+	err := s.server.Close()
+	if s.socket != "" {
+		os.Remove(s.socket)
+	}
+	return err
+}
+
+func (s *Server) status(targets []Target) []TargetStatus {
+	res := make([]TargetStatus, 0, len(targets))
+	for _, t := range targets {
+		res = append(res, TargetStatus{Ue: t.Ue, Direction: t.Direction, LoopStatus: t.Tc.Status()})
+	}
+	return res
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		respond(w, http.StatusMethodNotAllowed, errorResponse{"use GET"})
+		return
+	}
+	respond(w, http.StatusOK, s.status(s.targets))
+}
+
+func (s *Server) handleAction(action func(Target, *http.Request) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			respond(w, http.StatusMethodNotAllowed, errorResponse{"use POST"})
+			return
+		}
+		target, err := s.target(req)
+		if err == nil {
+			err = action(target, req)
+		}
+		if err != nil {
+			code := http.StatusInternalServerError
+			var input_err *errortypes.UserInputError
+			if errors.As(err, &input_err) {
+				code = http.StatusBadRequest
+			}
+			respond(w, code, errorResponse{err.Error()})
+			return
+		}
+		INFO.Printf("control: %s %s", req.URL.Path, req.URL.RawQuery)
+		respond(w, http.StatusOK, s.status([]Target{target}))
+	}
+}
+
+// Returns the target selected by the ue and direction query parameters
+func (s *Server) target(req *http.Request) (Target, error) {
+	query := req.URL.Query()
+	ue := 0
+	if v := query.Get("ue"); v != "" {
+		var err error
+		if ue, err = strconv.Atoi(v); err != nil {
+			return Target{}, errortypes.NewUserInputError("ue has to be a number")
+		}
+	}
+	direction := query.Get("direction")
+	if direction == "" {
+		direction = datatypes.DIRECTION_UPLINK
+	}
+	for _, t := range s.targets {
+		if t.Ue == ue && t.Direction == direction {
+			return t, nil
+		}
+	}
+	return Target{}, errortypes.NewUserInputError("No pattern is played on the %s of ue%d", direction, ue)
+}
+
+func respond(w http.ResponseWriter, code int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		DEBUG.Printf("control: could not respond: %v", err)
+	}
+}
+
+func (s *Server) pause(t Target, _ *http.Request) error {
+	return t.Tc.Pause()
+}
+
+func (s *Server) resume(t Target, _ *http.Request) error {
+	t.Tc.Resume()
+	return nil
+}
+
+func (s *Server) seek(t Target, req *http.Request) error {
+	query := req.URL.Query()
+	if v := query.Get("time"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return errortypes.NewUserInputError("time: %s", err)
+		}
+		return t.Tc.SeekTime(d)
+	}
+	index, err := strconv.Atoi(query.Get("index"))
+	if err != nil {
+		return errortypes.NewUserInputError("Expected index=N or time=DURATION")
+	}
+	return t.Tc.Seek(index)
+}
+
+func (s *Server) rate(t Target, req *http.Request) error {
+	query := req.URL.Query()
+	kbits, err := strconv.ParseFloat(query.Get("kbits"), 64)
+	if err != nil {
+		return errortypes.NewUserInputError("Expected kbits=N")
+	}
+	var d time.Duration
+	if v := query.Get("duration"); v != "" {
+		if d, err = time.ParseDuration(v); err != nil {
+			return errortypes.NewUserInputError("duration: %s", err)
+		}
+	}
+	return t.Tc.ForceRate(kbits, d)
+}
+
+func (s *Server) swap(t Target, req *http.Request) error {
+	id := req.URL.Query().Get("id")
+	if id == "" {
+		return errortypes.NewUserInputError("Expected id=PATTERN")
+	}
+	if s.load == nil {
+		return errortypes.NewUserInputError("Patterns can't be swapped")
+	}
+	drp, err := s.load(id)
+	if err != nil {
+		return errortypes.NewUserInputError("%s: %s", id, err)
+	}
+	return t.Tc.SwapPattern(drp)
+}
+
+func (s *Server) marking(t Target, req *http.Request) error {
+	query := req.URL.Query()
+	if query.Get("clear") == "1" {
+		return t.Tc.ClearMarking()
+	}
+	status := t.Tc.Status()
+	markfree, markfull := status.Markfree, status.Markfull
+	var err error
+	if v := query.Get("markfree"); v != "" {
+		if markfree, err = strconv.Atoi(v); err != nil {
+			return errortypes.NewUserInputError("markfree has to be a number of ms")
+		}
+	}
+	if v := query.Get("markfull"); v != "" {
+		if markfull, err = strconv.Atoi(v); err != nil {
+			return errortypes.NewUserInputError("markfull has to be a number of ms")
+		}
+	}
+	return t.Tc.ChangeMarking(markfree, markfull)
+}
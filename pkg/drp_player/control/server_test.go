@@ -0,0 +1,88 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package control
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/telekom/aml-jens/internal/persistence/datatypes"
+	"github.com/telekom/aml-jens/pkg/drp_player/trafficcontrol"
+)
+
+func TestCheckLoopback(t *testing.T) {
+	for address, ok := range map[string]bool{
+		"localhost:8080":   true,
+		"127.0.0.1:8080":   true,
+		"[::1]:8080":       true,
+		"0.0.0.0:8080":     false,
+		"192.168.1.1:8080": false,
+		":8080":            false,
+		"localhost":        false,
+	} {
+		if err := checkLoopback(address); (err == nil) != ok {
+			t.Fatalf("checkLoopback(%s) returned %v", address, err)
+		}
+	}
+}
+
+func TestServer(t *testing.T) {
+	tc := trafficcontrol.NewTrafficControl("sim", trafficcontrol.NewSimulator(trafficcontrol.DefaultSimulatorParams()))
+	socket := filepath.Join(t.TempDir(), "control.sock")
+	s, err := Listen("unix:"+socket, []Target{{Ue: 0, Direction: datatypes.DIRECTION_UPLINK, Tc: tc}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve()
+	defer s.Close()
+	client := http.Client{Transport: &http.Transport{
+		Dial: func(_, _ string) (net.Conn, error) { return net.Dial("unix", socket) },
+	}}
+	res, err := client.Get("http://control/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := []TargetStatus{}
+	if err := json.NewDecoder(res.Body).Decode(&status); err != nil || len(status) != 1 || status[0].Direction != datatypes.DIRECTION_UPLINK {
+		t.Fatalf("Unexpected status %+v, %v", status, err)
+	}
+	res.Body.Close()
+	for url, code := range map[string]int{
+		"http://control/pause":               http.StatusBadRequest,
+		"http://control/resume?ue=1":         http.StatusBadRequest,
+		"http://control/seek?index=x":        http.StatusBadRequest,
+		"http://control/pattern?id=gen:sine": http.StatusBadRequest,
+		"http://control/resume":              http.StatusOK,
+	} {
+		res, err := client.Post(url, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != code {
+			t.Fatalf("POST %s returned %d, expected %d", url, res.StatusCode, code)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package measuresession
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/telekom/aml-jens/internal/errortypes"
+	"github.com/telekom/aml-jens/internal/persistence/datatypes"
+)
+
+// First bytes of every capture file
+const CAPTURE_MAGIC = "JENSCAP1"
+
+// Header of a capture file, followed by the raw 64 byte records
+//
+// File layout: CAPTURE_MAGIC, uint32 (LE) length of the json encoded
+// header, header, records
+type CaptureHeader struct {
+	Session          string
+	Dev              string
+	Backend          string
+	Direction        string
+	Ue               int
+	Pattern          string
+	PatternHash      string
+	Markfree         int32
+	Markfull         int32
+	Queuesizepackets int32
+	ExtralatencyMs   int32
+	//Offset of the (monotonic) record timestamps to unix time
+	TimeDiffMs uint64
+	//Unix time the capture was started at
+	StartMs uint64
+}
+
+func newCaptureHeader(session *datatypes.DB_session, direction string, time_diff uint64) CaptureHeader {
+	pattern := session.ChildDRP
+	if direction == datatypes.DIRECTION_DOWNLINK {
+		pattern = session.ChildDRPDownlink
+	}
+	return CaptureHeader{
+		Session:          session.Name,
+		Dev:              session.Dev,
+		Backend:          session.Backend,
+		Direction:        direction,
+		Ue:               session.Ue,
+		Pattern:          pattern.GetOrigin(),
+		PatternHash:      pattern.GetHashStr(),
+		Markfree:         session.Markfree,
+		Markfull:         session.Markfull,
+		Queuesizepackets: session.Queuesizepackets,
+		ExtralatencyMs:   session.ExtralatencyMs,
+		TimeDiffMs:       time_diff,
+		StartMs:          uint64(time.Now().UnixMilli()),
+	}
+}
+
+// Returns the capture file of direction, the downlink
+// is captured next to the uplink
+func capturePath(path string, direction string) string {
+	if direction == datatypes.DIRECTION_DOWNLINK {
+		return path + "." + datatypes.DIRECTION_DOWNLINK
+	}
+	return path
+}
+
+// Writes raw records to a capture file
+type CaptureWriter struct {
+	file    *os.File
+	writer  *bufio.Writer
+	records uint64
+}
+
+// Creates the capture file path and writes header
+func NewCaptureWriter(path string, header CaptureHeader) (*CaptureWriter, error) {
+	data, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("capture: %w", err)
+	}
+	w := &CaptureWriter{file: file, writer: bufio.NewWriter(file)}
+	length := make([]byte, 4)
+	binary.LittleEndian.PutUint32(length, uint32(len(data)))
+	for _, b := range [][]byte{[]byte(CAPTURE_MAGIC), length, data} {
+		if _, err := w.writer.Write(b); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("capture: %w", err)
+		}
+	}
+	return w, nil
+}
+
+// Appends record to the capture
+func (w *CaptureWriter) Write(record RecordArray) error {
+	if len(record) != RECORD_SIZE {
+		return fmt.Errorf("capture: record has %d bytes", len(record))
+	}
+	_, err := w.writer.Write(record)
+	w.records++
+	return err
+}
+
+// Flushes and closes the capture file
+func (w *CaptureWriter) Close() error {
+	INFO.Printf("Captured %d records to %s", w.records, w.file.Name())
+	if err := w.writer.Flush(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+// Reads CaptureHeader from r
+func readCaptureHeader(r io.Reader) (CaptureHeader, error) {
+	header := CaptureHeader{}
+	prefix := make([]byte, len(CAPTURE_MAGIC)+4)
+	if _, err := io.ReadFull(r, prefix); err != nil || string(prefix[:len(CAPTURE_MAGIC)]) != CAPTURE_MAGIC {
+		return header, errortypes.NewUserInputError("Not a capture file")
+	}
+	data := make([]byte, binary.LittleEndian.Uint32(prefix[len(CAPTURE_MAGIC):]))
+	if _, err := io.ReadFull(r, data); err != nil {
+		return header, errortypes.NewUserInputError("Capture header is truncated")
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return header, errortypes.NewUserInputError("Capture header is invalid: %s", err)
+	}
+	return header, nil
+}
+
+// Reads the header of the capture file path
+func ReadCaptureHeader(path string) (CaptureHeader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return CaptureHeader{}, err
+	}
+	defer file.Close()
+	return readCaptureHeader(bufio.NewReader(file))
+}
+
+// Replays the records of a capture file.
+//
+// Implements trafficcontrol.RecordReader, so it can be used in place
+// of a live backend. Returns io.EOF after the last record.
+type CaptureReader struct {
+	file   *os.File
+	reader *bufio.Reader
+	header CaptureHeader
+	//Replay speed: 1 original timing, 2 twice as fast, ...
+	speed    float64
+	started  time.Time
+	first_ts uint64
+	pending  []byte
+}
+
+// Opens the capture file path, replaying its records speed times as fast as recorded
+func OpenCapture(path string, speed float64) (*CaptureReader, error) {
+	if speed <= 0 {
+		return nil, errortypes.NewUserInputError("Replay speed must be greater 0")
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &CaptureReader{file: file, reader: bufio.NewReader(file), speed: speed}
+	if r.header, err = readCaptureHeader(r.reader); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *CaptureReader) Header() CaptureHeader {
+	return r.header
+}
+
+// Reads the next record into buf as soon as it is due
+func (r *CaptureReader) ReadRecord(buf []byte, timeout time.Duration) (int, error) {
+	if r.pending == nil {
+		record := make([]byte, RECORD_SIZE)
+		if _, err := io.ReadFull(r.reader, record); err != nil {
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				WARN.Println("Capture ends with an incomplete record")
+				err = io.EOF
+			}
+			return 0, err
+		}
+		r.pending = record
+	}
+	ts := binary.LittleEndian.Uint64(r.pending[0:8])
+	if r.started.IsZero() {
+		r.started = time.Now()
+		r.first_ts = ts
+	}
+	if ts > r.first_ts {
+		due := r.started.Add(time.Duration(float64(ts-r.first_ts) / r.speed))
+		if wait := time.Until(due); wait > timeout {
+			time.Sleep(timeout)
+			return 0, nil
+		} else if wait > 0 {
+			time.Sleep(wait)
+		}
+	}
+	n := copy(buf, r.pending)
+	r.pending = nil
+	return n, nil
+}
+
+// No-op, captures do not contain records of the warmup
+func (r *CaptureReader) Discard() error {
+	return nil
+}
+
+func (r *CaptureReader) Close() error {
+	return r.file.Close()
+}
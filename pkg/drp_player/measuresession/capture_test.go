@@ -0,0 +1,140 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package measuresession
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/telekom/aml-jens/internal/persistence/datatypes"
+)
+
+func newTestRecord(ts time.Duration, type_id RecoordArrayType) RecordArray {
+	record := make(RecordArray, RECORD_SIZE)
+	binary.LittleEndian.PutUint64(record[0:8], uint64(ts.Nanoseconds()))
+	record[8] = byte(type_id)
+	return record
+}
+
+func writeTestCapture(t *testing.T, records []RecordArray) string {
+	path := filepath.Join(t.TempDir(), "test.jcap")
+	w, err := NewCaptureWriter(path, CaptureHeader{Session: "test", Dev: "sim", Pattern: "gen:sine", TimeDiffMs: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range records {
+		if err := w.Write(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCapture(t *testing.T) {
+	records := []RecordArray{
+		newTestRecord(time.Second, RECORD_TYPE_Q),
+		newTestRecord(time.Second+time.Millisecond, RECORD_TYPE_P),
+		newTestRecord(time.Second+2*time.Millisecond, RECORD_TYPE_P),
+	}
+	path := writeTestCapture(t, records)
+	header, err := ReadCaptureHeader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Session != "test" || header.Pattern != "gen:sine" || header.TimeDiffMs != 42 {
+		t.Fatalf("Header was not read correctly: %+v", header)
+	}
+	replay, err := OpenCapture(path, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replay.Close()
+	buf := make(RecordArray, RECORD_SIZE)
+	for i, record := range records {
+		n, err := replay.ReadRecord(buf, time.Second)
+		if err != nil || n != RECORD_SIZE {
+			t.Fatalf("Record %d: read %d bytes, %v", i, n, err)
+		}
+		if string(buf) != string(record) {
+			t.Fatalf("Record %d differs: %v != %v", i, buf, record)
+		}
+	}
+	if _, err := replay.ReadRecord(buf, time.Second); err != io.EOF {
+		t.Fatalf("Expected EOF after the last record, got %v", err)
+	}
+}
+
+func TestCaptureReplayTiming(t *testing.T) {
+	path := writeTestCapture(t, []RecordArray{
+		newTestRecord(0, RECORD_TYPE_Q),
+		newTestRecord(200*time.Millisecond, RECORD_TYPE_Q),
+	})
+	replay, err := OpenCapture(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replay.Close()
+	buf := make(RecordArray, RECORD_SIZE)
+	start := time.Now()
+	if n, _ := replay.ReadRecord(buf, time.Second); n != RECORD_SIZE {
+		t.Fatal("First record is due immediately")
+	}
+	if n, _ := replay.ReadRecord(buf, 10*time.Millisecond); n != 0 {
+		t.Fatal("Second record was returned before it was due")
+	}
+	if n, _ := replay.ReadRecord(buf, time.Second); n != RECORD_SIZE {
+		t.Fatal("Second record was not returned")
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed > 500*time.Millisecond {
+		t.Fatalf("Expected the second record after 100ms at 2x speed, got it after %s", elapsed)
+	}
+}
+
+func TestCaptureNOK(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "not.jcap")
+	if err := os.WriteFile(path, []byte("timestampMs,value\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadCaptureHeader(path); err == nil {
+		t.Fatal("Expected error for a file that is not a capture")
+	}
+	valid := writeTestCapture(t, nil)
+	if _, err := OpenCapture(valid, 0); err == nil {
+		t.Fatal("Expected error for replay speed 0")
+	}
+}
+
+func TestCapturePath(t *testing.T) {
+	if p := capturePath("a.jcap", datatypes.DIRECTION_UPLINK); p != "a.jcap" {
+		t.Fatalf("Uplink captured to %s", p)
+	}
+	if p := capturePath("a.jcap", datatypes.DIRECTION_DOWNLINK); p != "a.jcap.downlink" {
+		t.Fatalf("Downlink captured to %s", p)
+	}
+}
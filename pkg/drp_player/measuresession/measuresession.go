@@ -21,25 +21,12 @@
 
 package measuresession
 
-/*
- #include "stdio.h"
- #include "stdlib.h"
- #include "poll.h"
- #include <time.h>
- static unsigned long long get_nsecs(void)
- {
-	 struct timespec ts;
-	 clock_gettime(CLOCK_MONOTONIC, &ts);
-	 return (unsigned long long)ts.tv_sec * 1000000000UL + ts.tv_nsec;
- }
-*/
-import "C"
 import (
 	"encoding/binary"
 	"fmt"
 	"io"
-	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/telekom/aml-jens/internal/logging"
@@ -63,16 +50,16 @@ type AggregateMeasure struct {
 	sumEcnNCE        uint32
 	sumDropped       uint32
 	net_flow         *datatypes.DB_network_flow
+	source           *recordSource
 	t_start          uint64
 	t_end            uint64
 }
 
-var currentCapacityKbits uint64
-
-func (s *AggregateMeasure) toDB_measure_packet(time uint64) DB_measure_packet {
+func (s *AggregateMeasure) toDB_measure_packet(time uint64, sample_duration_ms int) DB_measure_packet {
 	var sampleCapacityKbits uint32
-	sample_duration := util.MaxInt(SAMPLE_DURATION_MS, int(s.t_end-s.t_start))
-	loadKbits := ((s.sumloadBytes * 8) / 1000) * (1000 / uint32(sample_duration))
+	sample_duration := util.MaxInt(sample_duration_ms, int(s.t_end-s.t_start))
+	//bit per ms = kbit/s
+	loadKbits := (s.sumloadBytes * 8) / uint32(sample_duration)
 	if s.sumCapacityKbits == -1 {
 		sampleCapacityKbits = loadKbits
 	} else {
@@ -88,10 +75,12 @@ func (s *AggregateMeasure) toDB_measure_packet(time uint64) DB_measure_packet {
 		Capacitykbits:       sampleCapacityKbits,
 		Net_flow_string:     s.net_flow.MeasureIdStr(),
 		Net_flow_prio:       s.net_flow.Prio,
+		Direction:           s.source.direction,
+		Ue:                  s.source.session.Ue,
 	}
 }
 
-func NewAggregateMeasure(flow *datatypes.DB_network_flow) *AggregateMeasure {
+func NewAggregateMeasure(flow *datatypes.DB_network_flow, source *recordSource) *AggregateMeasure {
 	return &AggregateMeasure{
 		sumloadBytes:     0,
 		sumDropped:       0,
@@ -99,6 +88,7 @@ func NewAggregateMeasure(flow *datatypes.DB_network_flow) *AggregateMeasure {
 		sumSojournTimeMs: 0,
 		sampleCount:      0,
 		net_flow:         flow,
+		source:           source,
 		t_start:          0,
 		t_end:            0,
 	}
@@ -149,24 +139,79 @@ type DbQueueMeasure struct {
 	memUsageBytes          uint32
 }
 
-const MM_FILE = "/sys/kernel/debug/sch_janz/0001:0"
-
 const SAMPLE_DURATION_MS = 10
 
+// Returns the interval measures of a pattern played at freq are aggregated over.
+//
+// Above 1000/SAMPLE_DURATION_MS Hz it is shortened to one sample (at least 1 ms),
+// so that every rate change shows in the measures.
+func SampleDurationMs(freq int) int {
+	if freq <= 1000/SAMPLE_DURATION_MS {
+		return SAMPLE_DURATION_MS
+	}
+	return util.MaxInt(1, 1000/freq)
+}
+
+// Records of one direction of a UE, read by their own poll
+type recordSource struct {
+	//Session of the UE
+	session   *datatypes.DB_session
+	direction string
+	tc        *trafficcontrol.TrafficControl
+	//Capacity of the latest queue record, accessed atomically
+	capacityKbits uint64
+}
+
 type MeasureSession struct {
 	session             *datatypes.DB_session
-	tc                  *trafficcontrol.TrafficControl
+	sources             []*recordSource
 	chan_to_aggregation chan PacketMeasure
 	chan_to_persistence chan interface{}
 	time_diff           uint64
 	wg                  *sync.WaitGroup
 	should_end          bool
 	persistor           *MeasureSessionPersistor
+	//Source of records instead of tc, if a capture is replayed
+	replay *CaptureReader
+	//Factor the records arrive faster than real time
+	speed float64
+	//Interval packet measures are aggregated over, see SampleDurationMs
+	sample_duration_ms int
 }
 
+// Creates a MeasureSession for the uplink records of tc.
+// Further UEs and directions are added using AddSource.
 func NewMeasureSession(session *datatypes.DB_session, tc *trafficcontrol.TrafficControl) MeasureSession {
-	monotonicMs := uint64(C.get_nsecs()) / 1e6
+	monotonicMs := trafficcontrol.MonotonicNs() / 1e6
 	systemMs := uint64(time.Now().UnixMilli())
+	return newMeasureSession(session, tc, datatypes.DIRECTION_UPLINK, systemMs-monotonicMs)
+}
+
+// Measures the records of tc as direction of the UE session, in addition
+// to all other sources. All sources share one clock offset and persistor.
+// Has to be called before Start
+func (m *MeasureSession) AddSource(session *datatypes.DB_session, direction string, tc *trafficcontrol.TrafficControl) {
+	m.sources = append(m.sources, &recordSource{
+		session:   session,
+		direction: direction,
+		tc:        tc,
+	})
+}
+
+// Creates a MeasureSession aggregating and persisting the records of a capture.
+// Timestamps are converted with the clock offset of the captured session.
+func NewReplayMeasureSession(session *datatypes.DB_session, replay *CaptureReader) MeasureSession {
+	direction := replay.Header().Direction
+	if direction == "" {
+		direction = datatypes.DIRECTION_UPLINK
+	}
+	m := newMeasureSession(session, nil, direction, replay.Header().TimeDiffMs)
+	m.replay = replay
+	m.speed = replay.speed
+	return m
+}
+
+func newMeasureSession(session *datatypes.DB_session, tc *trafficcontrol.TrafficControl, direction string, time_diff uint64) MeasureSession {
 	var wg sync.WaitGroup
 	p, err := NewMeasureSessionPersistor(session)
 	if err != nil {
@@ -174,19 +219,21 @@ func NewMeasureSession(session *datatypes.DB_session, tc *trafficcontrol.Traffic
 	}
 	return MeasureSession{
 		session:             session,
-		tc:                  tc,
+		sources:             []*recordSource{{session: session, direction: direction, tc: tc}},
 		chan_to_aggregation: make(chan PacketMeasure, 10000),
 		chan_to_persistence: make(chan interface{}, 10000),
-		time_diff:           systemMs - monotonicMs,
+		time_diff:           time_diff,
 		wg:                  &wg,
 		should_end:          false,
 		persistor:           p,
+		speed:               1,
+		sample_duration_ms:  SampleDurationMs(session.ChildDRP.Freq),
 	}
 
 }
 func (m MeasureSession) Start(r util.RoutineReport) {
 	// open memory file stream
-	INFO.Println("start measure session")
+	INFO.Printf("start measure session, aggregating over %dms", m.sample_duration_ms)
 
 	// compute offset of monotonic and system clock
 
@@ -212,53 +259,67 @@ func (m MeasureSession) Start(r util.RoutineReport) {
 		DEBUG.Println("Closing persistor")
 		m.wg.Done()
 	})
-	m.wg.Add(1)
-	go m.poll(r)
+	//Aggregation is closed once every source has been closed
+	var polls sync.WaitGroup
+	for _, source := range m.sources {
+		m.wg.Add(1)
+		polls.Add(1)
+		go func(source *recordSource) {
+			defer polls.Done()
+			m.poll(r, source)
+		}(source)
+	}
+	go func() {
+		polls.Wait()
+		close(m.chan_to_aggregation)
+	}()
 
 	m.wg.Add(1)
 	go m.aggregateMeasures(r)
 
 	m.wg.Wait()
 	DEBUG.Println("Closed measure_session")
+	if m.replay != nil {
+		select {
+		case r.Application_has_finished <- "Capture has been replayed":
+		case <-r.On_extern_exit_c:
+		}
+	}
 	r.Wg.Done()
 }
 
-// Represents the polling loop.
+// Represents the polling loop of source.
 // Will close if membervariable m.shouldEnd becomes true
-// Will foreward this signal by closing chan_to_aggregation
-func (m *MeasureSession) poll(r util.RoutineReport) {
-	//Buffer in which the contets of MM_FILE will be written
+func (m *MeasureSession) poll(r util.RoutineReport, source *recordSource) {
+	//Buffer in which the records of the backend will be written
 	recordArray := make(RecordArray, RECORD_SIZE)
-	var file, err = os.Open(MM_FILE)
+	records, capture, err := m.openRecords(source)
 	if err != nil {
-		r.ReportFatal(fmt.Errorf("measuresession.poll: %w", err))
-	}
-	/* Clear recordArray due to records in WarmupTime*/
-	if m.session.ChildDRP.WarmupTimeMs > 0 {
-		dummy := make([]byte, 0xffffffff)
-		file.Read(dummy)
+		r.ReportFatal(fmt.Errorf("measuresession.poll(ue%d %s): %w", source.session.Ue, source.direction, err))
+		m.wg.Done()
+		return
 	}
 	defer func() {
-		DEBUG.Println("Closed: Poll")
-		if file != nil {
-			file.Close()
+		DEBUG.Printf("Closed: Poll (ue%d %s)", source.session.Ue, source.direction)
+		records.Close()
+		if capture != nil {
+			if err := capture.Close(); err != nil {
+				WARN.Printf("Could not close capture: %v", err)
+			}
 		}
 		m.wg.Done()
-		//Forward closing to aggregation
-		close(m.chan_to_aggregation)
 	}()
-	var fdint C.int = C.int(uint(file.Fd()))
-	pfd := C.struct_pollfd{fdint, C.POLLIN, 0}
 	for !m.should_end {
-		// poll fd
-		rc := C.poll(&pfd, 1, 1000)
-		if rc <= 0 {
-			//INFO.Println("rc <= 0")
+		// read one record of either packet or queue type
+		bytesRead, err := records.ReadRecord(recordArray, time.Second)
+		if bytesRead == 0 && err == nil {
 			continue
 		}
-		// read one record of either packet or queue type
-		bytesRead, err := file.Read(recordArray)
 		if err == io.EOF {
+			if m.replay != nil {
+				//Aggregation and persistence are closed in turn
+				return
+			}
 			r.ReportInfo(fmt.Errorf("EOF while reading recordArray"))
 		}
 
@@ -266,33 +327,33 @@ func (m *MeasureSession) poll(r util.RoutineReport) {
 			r.ReportInfo(fmt.Errorf("bytesRead != 64 while reading recordArray"))
 			continue
 		}
+		if capture != nil {
+			if err := capture.Write(recordArray); err != nil {
+				r.ReportWarn(fmt.Errorf("could not capture record: %w", err))
+			}
+		}
 		timestampMs := uint64(binary.LittleEndian.Uint64(recordArray[0:8])) / 1e6
 		switch recordArray.type_id() {
 		case RECORD_TYPE_P: // PacketMeasure MP
-			packetMeasure, err := recordArray.AsPacketMeasure(m.session.Session_id)
+			packetMeasure, err := recordArray.AsPacketMeasure(source.session.Session_id)
 			if err != nil {
 				r.ReportWarn(fmt.Errorf("could not parse packetMeasure: %w", err))
 			}
 			if packetMeasure != nil {
+				packetMeasure.source = source
 				m.chan_to_aggregation <- *packetMeasure
 
 			} else {
 				//DEBUG.Printf("non ip packet ignored\n")
 			}
-		case RECORD_TYPE_Q: // QueueMeasure MQ
-			numberOfPacketsInQueue := uint16(binary.LittleEndian.Uint16(recordArray[10:12]))
-			memUsageBytes := uint32(binary.LittleEndian.Uint32(recordArray[12:16]))
-			currentCapacityKbits = uint64(binary.LittleEndian.Uint64(recordArray[16:24])) / 1000
-			currentEpochMs := timestampMs + m.time_diff
-			queueMeasure := DB_measure_queue{
-				Time:              currentEpochMs,
-				Memoryusagebytes:  memUsageBytes,
-				PacketsInQueue:    numberOfPacketsInQueue,
-				CapacityKbits:     currentCapacityKbits,
-				Fk_session_tag_id: m.session.Session_id,
-			}
+		case RECORD_TYPE_Q, RECORD_TYPE_STATS: // QueueMeasure MQ
+			queueMeasure, _ := recordArray.AsDB_measure_queue(source.session.Session_id)
+			atomic.StoreUint64(&source.capacityKbits, queueMeasure.CapacityKbits)
+			queueMeasure.Time = timestampMs + m.time_diff
+			queueMeasure.Direction = source.direction
+			queueMeasure.Ue = source.session.Ue
 			if !m.should_end {
-				m.chan_to_persistence <- queueMeasure
+				m.chan_to_persistence <- *queueMeasure
 			} else {
 				return
 			}
@@ -301,9 +362,45 @@ func (m *MeasureSession) poll(r util.RoutineReport) {
 		}
 	}
 }
+
+// Opens the records of the replayed capture or the backend of source and,
+// if session.CaptureFile is set, the capture they are written to.
+func (m *MeasureSession) openRecords(source *recordSource) (trafficcontrol.RecordReader, *CaptureWriter, error) {
+	var records trafficcontrol.RecordReader
+	if m.replay != nil {
+		records = m.replay
+	} else {
+		var err error
+		if records, err = source.tc.OpenRecords(); err != nil {
+			return nil, nil, err
+		}
+		/* Clear recordArray due to records in WarmupTime*/
+		if source.session.ChildDRP.WarmupTimeMs > 0 {
+			records.Discard()
+		}
+	}
+	if source.session.CaptureFile == "" {
+		return records, nil, nil
+	}
+	capture, err := NewCaptureWriter(capturePath(source.session.CaptureFile, source.direction),
+		newCaptureHeader(source.session, source.direction, m.time_diff))
+	if err != nil {
+		records.Close()
+		return nil, nil, err
+	}
+	return records, capture, nil
+}
+
+// Flows are aggregated per source
+type aggregateKey struct {
+	source *recordSource
+	flow   string
+}
+
 func (m MeasureSession) aggregateMeasures(r util.RoutineReport) {
-	sampleDuration := SAMPLE_DURATION_MS * time.Millisecond
-	ticker := time.NewTicker(sampleDuration)
+	sampleDuration := time.Duration(m.sample_duration_ms) * time.Millisecond
+	//Replayed captures may deliver samples faster than real time
+	ticker := time.NewTicker(time.Duration(float64(sampleDuration) / m.speed))
 	defer func() {
 		DEBUG.Println("Closed AggregateMeasures")
 		close(m.chan_to_persistence)
@@ -316,7 +413,7 @@ func (m MeasureSession) aggregateMeasures(r util.RoutineReport) {
 		return
 	}
 	for range ticker.C {
-		mapMeasures := make(map[string]*AggregateMeasure)
+		mapMeasures := make(map[aggregateKey]*AggregateMeasure)
 		readMessages := true
 		var packetStartTimeMs uint64 = 0
 		message, is_open := <-m.chan_to_aggregation
@@ -343,13 +440,14 @@ func (m MeasureSession) aggregateMeasures(r util.RoutineReport) {
 					r.ReportFatal(fmt.Errorf("aggregateMeasure: %w", err))
 					return
 				}
-				measure, keyExists := mapMeasures[message.net_flow.MeasureIdStr()]
+				key := aggregateKey{message.source, message.net_flow.MeasureIdStr()}
+				measure, keyExists := mapMeasures[key]
 				if !keyExists {
-					measure = NewAggregateMeasure(message.net_flow)
-					mapMeasures[message.net_flow.MeasureIdStr()] = measure
+					measure = NewAggregateMeasure(message.net_flow, message.source)
+					mapMeasures[key] = measure
 				}
 
-				measure.add(&message, currentCapacityKbits)
+				measure.add(&message, atomic.LoadUint64(&message.source.capacityKbits))
 
 			default:
 				readMessages = false
@@ -365,7 +463,7 @@ func (m MeasureSession) aggregateMeasures(r util.RoutineReport) {
 			}
 			// send to persist measure sample
 			currentEpochMs := message.timestampMs + m.time_diff
-			sample := aggregated_measure.toDB_measure_packet(currentEpochMs)
+			sample := aggregated_measure.toDB_measure_packet(currentEpochMs, m.sample_duration_ms)
 			if m.session.ParentBenchmark.CsvOuptut {
 				if sample.Capacitykbits == 0 {
 					//this sometimes happens
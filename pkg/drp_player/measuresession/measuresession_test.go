@@ -0,0 +1,73 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package measuresession
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/telekom/aml-jens/internal/persistence/datatypes"
+)
+
+func TestSampleDurationMs(t *testing.T) {
+	for freq, want := range map[int]int{1: 10, 100: 10, 200: 5, 333: 3, 1000: 1} {
+		if got := SampleDurationMs(freq); got != want {
+			t.Fatalf("SampleDurationMs(%d) = %d, want %d", freq, got, want)
+		}
+	}
+}
+
+func TestAggregateMeasureLoad(t *testing.T) {
+	session := &datatypes.DB_session{}
+	measure := NewAggregateMeasure(&datatypes.DB_network_flow{}, &recordSource{session: session, direction: datatypes.DIRECTION_UPLINK})
+	//1500 byte per ms = 12000 kbit/s
+	for ts := uint64(100); ts < 105; ts++ {
+		measure.add(&PacketMeasure{timestampMs: ts, packetSizeByte: 1500}, 20000)
+	}
+	sample := measure.toDB_measure_packet(105, SampleDurationMs(1000))
+	if sample.LoadKbits != 7500*8/4 || sample.Capacitykbits != 20000 {
+		t.Fatalf("Unexpected sample %+v", sample)
+	}
+}
+
+func TestStatsRecordAsMeasureQueue(t *testing.T) {
+	record := newTestRecord(2*time.Second, RECORD_TYPE_STATS)
+	binary.LittleEndian.PutUint16(record[10:12], 3)
+	binary.LittleEndian.PutUint32(record[12:16], 4500)
+	binary.LittleEndian.PutUint64(record[16:24], 2000000)
+	binary.LittleEndian.PutUint32(record[24:28], 7)
+	binary.LittleEndian.PutUint32(record[28:32], 11)
+	measure, err := record.AsDB_measure_queue(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := DB_measure_queue{Time: 2000, Memoryusagebytes: 4500, PacketsInQueue: 3, CapacityKbits: 2000, Dropped: 7, EcnMarked: 11, Fk_session_tag_id: 1}
+	if *measure != expected {
+		t.Fatalf("Parsed %+v, expected %+v", *measure, expected)
+	}
+	//Queue records of janz carry no drops and marks
+	record[8] = byte(RECORD_TYPE_Q)
+	if measure, _ := record.AsDB_measure_queue(1); measure.Dropped != 0 || measure.EcnMarked != 0 {
+		t.Fatalf("Queue record parsed with stats: %+v", *measure)
+	}
+}
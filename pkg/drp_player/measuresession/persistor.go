@@ -86,7 +86,7 @@ func (s *MeasureSessionPersistor) init_csv() error {
 	}
 
 	s.csv.QueueWriter = csv.NewWriter(s.csv.QueueFile)
-	heading = []string{"timestampMs", "memUsageBytes", "packetsinqueue"}
+	heading = []string{"timestampMs", "memUsageBytes", "packetsinqueue", "direction", "ue", "dropped", "ecnmarked"}
 	if err := s.csv.QueueWriter.Write(heading); err != nil {
 		return fmt.Errorf("persistMeasures: %w", err)
 	}
@@ -144,7 +144,9 @@ func (s *MeasureSessionPersistor) persist(sample interface{}) error {
 	return nil
 }
 
-// Stars Loop, which persits any samples coming in through the samples channel
+// Stars Loop, which persits any samples coming in through the samples channel.
+// Samples are persisted as they arrive, so that high sample rates don't fill the channel;
+// the db is committed and csv files are flushed every persist_frequency.
 //
 // Blocking, releases Wg
 func (s *MeasureSessionPersistor) Run(samples chan interface{}, report_error func(err error, lvl util.ErrorLevel), done func()) {
@@ -161,44 +163,37 @@ func (s *MeasureSessionPersistor) Run(samples chan interface{}, report_error fun
 			s.close()
 			done()
 			return
-		case <-tickerPersist.C:
-			readSamples := true
-			for readSamples {
-				select {
-				case sampleInterface, ok := <-samples:
-					if !ok {
-						DEBUG.Println("Closing persistor due to closed channel")
-						s.close()
-						done()
-						return
-					}
-					switch sample := sampleInterface.(type) {
-					// write measure to db
-					case DB_measure_packet:
-						err := s.persist(sample)
-						if err != nil {
-							report_error(err, util.ErrFatal)
-						}
-					case DB_measure_queue:
-						err := s.persist(&sample)
-						if err != nil {
-							report_error(err, util.ErrFatal)
-						}
-					default:
-						report_error(
-							fmt.Errorf("unexpected Input in persistMeasures %v", sampleInterface),
-							util.ErrWarn)
-					}
-				default:
-					readSamples = false
+		case sampleInterface, ok := <-samples:
+			if !ok {
+				DEBUG.Println("Closing persistor due to closed channel")
+				s.close()
+				done()
+				return
+			}
+			switch sample := sampleInterface.(type) {
+			// write measure to db
+			case DB_measure_packet:
+				err := s.persist(sample)
+				if err != nil {
+					report_error(err, util.ErrFatal)
+				}
+			case DB_measure_queue:
+				err := s.persist(&sample)
+				if err != nil {
+					report_error(err, util.ErrFatal)
 				}
+			default:
+				report_error(
+					fmt.Errorf("unexpected Input in persistMeasures %v", sampleInterface),
+					util.ErrWarn)
+			}
+		case <-tickerPersist.C:
+			(*s.db).Commit()
+			//to csv
+			if s.csv != nil {
+				s.csv.PacketWriter.Flush()
+				s.csv.QueueWriter.Flush()
 			}
-		}
-		(*s.db).Commit()
-		//to csv
-		if s.csv != nil {
-			s.csv.PacketWriter.Flush()
-			s.csv.QueueWriter.Flush()
 		}
 	}
 }
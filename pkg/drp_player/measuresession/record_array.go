@@ -18,6 +18,9 @@ const (
 const (
 	RECORD_TYPE_Q RecoordArrayType = 6
 	RECORD_TYPE_P RecoordArrayType = 7
+	//Queue record of the fallback backends, additionally carrying
+	//the drops and ECN marks since the previous one
+	RECORD_TYPE_STATS RecoordArrayType = 8
 )
 
 type RecoordArrayType byte
@@ -42,16 +45,21 @@ func (r RecordArray) timestamp() uint64 {
 //   - nil, err               -> in event of actual error
 //   - &DB_measure_queue, nil -> everything OK
 func (record RecordArray) AsDB_measure_queue(session_id int) (*DB_measure_queue, error) {
-	if record.type_id() != RECORD_TYPE_Q {
+	if record.type_id() != RECORD_TYPE_Q && record.type_id() != RECORD_TYPE_STATS {
 		return nil, fmt.Errorf("Cant Parse recordarray %v as DB_measure_queue: invalid type", record)
 	}
-	return &DB_measure_queue{
+	measure := &DB_measure_queue{
 		Time:              record.timestamp(),
 		Memoryusagebytes:  uint32(binary.LittleEndian.Uint32(record[12:16])),
 		PacketsInQueue:    uint16(binary.LittleEndian.Uint16(record[10:12])),
 		CapacityKbits:     uint64(binary.LittleEndian.Uint64(record[16:24])) / 1000,
 		Fk_session_tag_id: session_id,
-	}, nil
+	}
+	if record.type_id() == RECORD_TYPE_STATS {
+		measure.Dropped = binary.LittleEndian.Uint32(record[24:28])
+		measure.EcnMarked = binary.LittleEndian.Uint32(record[28:32])
+	}
+	return measure, nil
 }
 
 type PacketMeasure struct {
@@ -66,6 +74,8 @@ type PacketMeasure struct {
 	ipVersion      uint8
 	packetSizeByte uint32
 	net_flow       *datatypes.DB_network_flow
+	//Set by the poll of the source
+	source *recordSource
 }
 
 // Creates a new PacketMeasure from the supplied Record.
@@ -10,6 +10,7 @@ import (
 	"github.com/telekom/aml-jens/internal/persistence"
 	"github.com/telekom/aml-jens/internal/persistence/datatypes"
 	"github.com/telekom/aml-jens/internal/util"
+	"github.com/telekom/aml-jens/pkg/drp_player/control"
 	"github.com/telekom/aml-jens/pkg/drp_player/measuresession"
 	"github.com/telekom/aml-jens/pkg/drp_player/trafficcontrol"
 )
@@ -17,11 +18,19 @@ import (
 var DEBUG, INFO, WARN, FATAL = logging.GetLogger()
 
 type DrpPlayer struct {
-	session             *datatypes.DB_session
-	tc                  *trafficcontrol.TrafficControl
+	session *datatypes.DB_session
+	//Queues of every UE, the first one shapes session
+	ues     []*ueQueues
+	control *control.Server
+	//Loads patterns swapped to through the control api
+	load_pattern        control.PatternLoader
 	r                   util.RoutineReport
 	is_shutting_down    bool
 	close_channel_mutex *sync.Mutex
+	//Rate changes are written to session.TimingFile as they happen
+	timing *trafficcontrol.TimingWriter
+	//exit_clean may run more than once, timing is reported once
+	report_timing sync.Once
 }
 
 func NewDrpPlayer(session *datatypes.DB_session) *DrpPlayer {
@@ -87,12 +96,40 @@ func (s *DrpPlayer) Start() error {
 		}
 	}()
 
-	INFO.Printf("play data rate pattern %s on dev %s with %d samples/s in loop mode %t\n", s.session.ChildDRP.GetName(), s.session.Dev, s.session.ChildDRP.Freq, s.session.ChildDRP.IsLooping())
+	if s.session.ReplayFile != "" {
+		return s.startReplay()
+	}
+	for _, ue := range s.session.Ues() {
+		INFO.Printf("play data rate pattern %s on dev %s with %d samples/s in loop mode %t\n", ue.ChildDRP.GetName(), ue.Dev, ue.ChildDRP.Freq, ue.ChildDRP.IsLooping())
+		if ue.IsBidirectional() {
+			INFO.Printf("play downlink data rate pattern %s via %s\n", ue.ChildDRPDownlink.GetName(), ue.IfbDev)
+		}
+	}
 	if err := s.initTC(); err != nil {
 		return fmt.Errorf("initTC returned %w", err)
 	}
+	if s.session.TimingFile != "" {
+		timing, err := trafficcontrol.NewTimingWriter(s.session.TimingFile, "ue", "direction")
+		if err != nil {
+			return fmt.Errorf("could not create timing file: %w", err)
+		}
+		s.timing = timing
+		for _, ue := range s.ues {
+			ue.writeTimingTo(timing)
+		}
+	}
+	if s.session.ControlAddress != "" {
+		if err := s.startControl(); err != nil {
+			return err
+		}
+	}
 
-	s.tc.ChangeTo(s.session.ChildDRP.Peek() * 1.33)
+	for _, ue := range s.ues {
+		ue.uplink.ChangeTo(ue.session.ChildDRP.Peek() * 1.33)
+		if ue.downlink != nil {
+			ue.downlink.ChangeTo(ue.session.ChildDRPDownlink.Peek() * 1.33)
+		}
+	}
 	select {
 	case <-time.After(time.Millisecond * time.Duration(s.session.ChildDRP.WarmupTimeMs)):
 	case <-s.r.On_extern_exit_c:
@@ -100,23 +137,85 @@ func (s *DrpPlayer) Start() error {
 	}
 
 	if !s.session.ChildDRP.Nomeasure {
-		ms := measuresession.NewMeasureSession(s.session, s.tc)
+		//One measure session for all UEs: same clock offset and persistor
+		ms := measuresession.NewMeasureSession(s.session, s.ues[0].uplink)
+		for i, ue := range s.ues {
+			if i > 0 {
+				ms.AddSource(ue.session, datatypes.DIRECTION_UPLINK, ue.uplink)
+			}
+			if ue.downlink != nil {
+				ms.AddSource(ue.session, datatypes.DIRECTION_DOWNLINK, ue.downlink)
+			}
+		}
 		s.r.Wg.Add(1)
 		go ms.Start(s.r)
 	}
+	//All patterns start together
+	for _, ue := range s.ues {
+		s.launchChangeLoop(ue.uplink, ue.session.ChildDRP)
+		if ue.downlink != nil {
+			s.launchChangeLoop(ue.downlink, ue.session.ChildDRPDownlink)
+		}
+	}
+	return nil
+}
+
+// Sets how patterns swapped to through the control api are loaded
+func (s *DrpPlayer) SetPatternLoader(load control.PatternLoader) {
+	s.load_pattern = load
+}
+
+// Serves the control api on session.ControlAddress
+func (s *DrpPlayer) startControl() error {
+	targets := make([]control.Target, 0, len(s.ues))
+	for _, ue := range s.ues {
+		targets = append(targets, control.Target{Ue: ue.session.Ue, Direction: datatypes.DIRECTION_UPLINK, Tc: ue.uplink})
+		if ue.downlink != nil {
+			targets = append(targets, control.Target{Ue: ue.session.Ue, Direction: datatypes.DIRECTION_DOWNLINK, Tc: ue.downlink})
+		}
+	}
+	server, err := control.Listen(s.session.ControlAddress, targets, s.load_pattern)
+	if err != nil {
+		return err
+	}
+	s.control = server
+	go server.Serve()
+	return nil
+}
+
+func (s *DrpPlayer) launchChangeLoop(tc *trafficcontrol.TrafficControl, drp *datatypes.DB_data_rate_pattern) {
 	s.r.Wg.Add(1)
-	go s.tc.LaunchChangeLoop(
-		time.Duration(1000/s.session.ChildDRP.Freq)*time.Millisecond,
-		s.session.ChildDRP,
-		s.r,
-	)
+	go tc.LaunchChangeLoop(drp, s.r)
+}
 
+// Replays the records of session.ReplayFile into the measure session,
+// no pattern is played
+func (s *DrpPlayer) startReplay() error {
+	replay, err := measuresession.OpenCapture(s.session.ReplayFile, s.session.ReplaySpeed)
+	if err != nil {
+		return err
+	}
+	INFO.Printf("replay capture %s of session '%s' at %gx speed\n", s.session.ReplayFile, replay.Header().Session, s.session.ReplaySpeed)
+	ms := measuresession.NewReplayMeasureSession(s.session, replay)
+	s.r.Wg.Add(1)
+	go ms.Start(s.r)
 	return nil
 }
+
 func (s *DrpPlayer) exit_clean() {
-	if err := s.tc.Close(); err != nil {
-		WARN.Printf("Exit: error closing TrafficControl: %+v", err)
+	if s.control != nil {
+		if err := s.control.Close(); err != nil {
+			WARN.Printf("Exit: error closing control api: %+v", err)
+		}
 	}
+	for _, ue := range s.ues {
+		ue.close()
+	}
+	s.report_timing.Do(func() {
+		if err := s.reportTiming(); err != nil {
+			WARN.Printf("Exit: error writing rate change timing: %+v", err)
+		}
+	})
 	if !s.session.ChildDRP.Nomeasure {
 		p_ptr, err := persistence.GetPersistence()
 		if err != nil {
@@ -125,6 +224,19 @@ func (s *DrpPlayer) exit_clean() {
 		(*p_ptr).Commit()
 	}
 }
+
+// Reports the rate change timing of all queues
+// and closes session.TimingFile if set
+func (s *DrpPlayer) reportTiming() error {
+	for _, ue := range s.ues {
+		ue.reportTiming()
+	}
+	if s.timing == nil {
+		return nil
+	}
+	return s.timing.Close()
+}
+
 func (s *DrpPlayer) Wait() {
 	s.r.Wg.Wait()
 	s.exit_clean()
@@ -152,21 +264,19 @@ func (s *DrpPlayer) Exit() {
 	s.ExitNoWait()
 	s.Wait()
 }
+
+// Sets up the queues of every UE
 func (s *DrpPlayer) initTC() error {
-	s.tc = trafficcontrol.NewTrafficControl(s.session.Dev)
-	settings := trafficcontrol.TrafficControlStartParams{
-		Datarate:     uint32(s.session.ChildDRP.Peek() * 2),
-		QueueSize:    int(s.session.Queuesizepackets),
-		AddonLatency: int(s.session.ExtralatencyMs),
-		Markfree:     int(s.session.Markfree),
-		Markfull:     int(s.session.Markfull),
-		Qosmode:      s.session.Qosmode,
-	}
-	DEBUG.Printf("Init Tc: %+v", settings)
-	err := s.tc.Init(settings,
-		trafficcontrol.NftStartParams{
-			L4sPremarking: s.session.L4sEnablePreMarking,
-			SignalStart:   s.session.SignalDrpStart,
-		})
-	return err
+	for _, session := range s.session.Ues() {
+		ue := &ueQueues{session: session}
+		//Queues are appended before Init, so that they get closed on errors
+		s.ues = append(s.ues, ue)
+		if err := ue.init(); err != nil {
+			if session.Ue > 0 {
+				return fmt.Errorf("ue%d: %w", session.Ue, err)
+			}
+			return err
+		}
+	}
+	return nil
 }
@@ -0,0 +1,131 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package trafficcontrol
+
+import (
+	"strings"
+	"time"
+
+	"github.com/telekom/aml-jens/internal/errortypes"
+	"github.com/telekom/aml-jens/internal/persistence/datatypes"
+	"github.com/telekom/aml-jens/pkg/drp"
+)
+
+const (
+	//Custom janz qdisc, needs the sch_janz kernel module and root
+	BACKEND_JANZ = "janz"
+	//Userspace fluid-model simulation of a rate limited queue
+	BACKEND_SIM = "sim"
+	//Fallbacks using standard qdiscs, see qdiscBackend
+	BACKEND_TBF      = "tbf"
+	BACKEND_HTB      = "htb"
+	BACKEND_FQ_CODEL = "fq_codel"
+	BACKEND_CAKE     = "cake"
+	//Janz if available, else the first supported fallback, see ResolveBackend
+	BACKEND_AUTO = "auto"
+)
+
+// Size of a single P or Q record
+const RECORD_SIZE = 64
+
+// Control and measure endpoints of a rate limited queue.
+//
+// Measurements are delivered as 64 byte P/Q records in the format
+// of the janz qdisc, or as stats records by the fallback backends.
+type Backend interface {
+	// Name of the backend (BACKEND_*)
+	Name() string
+	// Sets up the queue on dev.
+	// After calling Init Close has to be called.
+	Init(dev string, params TrafficControlStartParams, nft NftStartParams) error
+	// Changes the current bandwidth limit to rate (kbit/s)
+	ChangeRate(rate float64) error
+	// Changes latency and marking of the running queue
+	ChangeParams(params TrafficControlStartParams) error
+	// Drops packets with the given probability [0,1]
+	ChangeLoss(probability float64) error
+	// Changes the random loss and jitter of the impairment stage,
+	// only called if Init was given an Impairment
+	ChangeImpairment(imp drp.Impairment) error
+	// Marks the first packets after the start of a pattern.
+	//
+	// Blocking
+	SignalStart() error
+	// Opens the stream of measure records
+	OpenRecords() (RecordReader, error)
+	// Removes the queue and resets all changes made
+	Close() error
+}
+
+// Stream of 64 byte measure records of a Backend
+type RecordReader interface {
+	// Reads one record into buf.
+	// Returns 0, nil if no record arrived within timeout.
+	ReadRecord(buf []byte, timeout time.Duration) (int, error)
+	// Drops all records buffered so far
+	Discard() error
+	Close() error
+}
+
+// Returns the backend called name ("" defaults to janz).
+// Auto has to be resolved by ResolveBackend first.
+func NewBackend(name string) (Backend, error) {
+	name = strings.ToLower(name)
+	switch name {
+	case "", BACKEND_JANZ:
+		return &janzBackend{shaper: shaper{handle: JANZ_HANDLE_UPLINK}}, nil
+	case BACKEND_SIM:
+		return NewSimulator(DefaultSimulatorParams()), nil
+	case BACKEND_TBF, BACKEND_HTB, BACKEND_FQ_CODEL, BACKEND_CAKE:
+		return &qdiscBackend{shaper: shaper{handle: JANZ_HANDLE_UPLINK}, name: name}, nil
+	case BACKEND_AUTO:
+		return nil, errortypes.NewUserInputError("Backend %s has to be resolved before use", BACKEND_AUTO)
+	default:
+		return nil, errortypes.NewUserInputError("Unknown backend '%s', expected %s, %s, %s or one of %v",
+			name, BACKEND_AUTO, BACKEND_JANZ, BACKEND_SIM, FALLBACK_BACKENDS)
+	}
+}
+
+// Returns the backend called name for direction of the ue-th UE.
+//
+// Each UE and direction gets its own qdisc handle; the downlink is
+// redirected to ifb and shaped by a second qdisc there.
+func NewUeBackend(name string, ue int, direction string, ifb string) (Backend, error) {
+	backend, err := NewBackend(name)
+	if err != nil {
+		return nil, err
+	}
+	var s *shaper
+	switch b := backend.(type) {
+	case *janzBackend:
+		s = &b.shaper
+	case *qdiscBackend:
+		s = &b.shaper
+	default:
+		return backend, nil
+	}
+	s.handle = JanzHandle(ue, direction)
+	if direction == datatypes.DIRECTION_DOWNLINK {
+		s.ifb = ifb
+	}
+	return backend, nil
+}
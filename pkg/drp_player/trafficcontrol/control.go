@@ -0,0 +1,240 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package trafficcontrol
+
+import (
+	"time"
+
+	"github.com/telekom/aml-jens/internal/errortypes"
+	"github.com/telekom/aml-jens/internal/persistence/datatypes"
+)
+
+// Runtime state of a change loop, changed through the control api.
+// Guarded by TrafficControl.mutex
+type loopControl struct {
+	//Pattern currently played, may be swapped
+	drp     *datatypes.DB_data_rate_pattern
+	started time.Time
+	paused  bool
+	//Rate overriding the pattern, 0 = none
+	forced float64
+	//End of the override, zero = until cleared
+	forced_until time.Time
+	//Marking overriding the session and the pattern's samples, nil = none
+	marking *markingOverride
+}
+
+// Marking (ms) set through the control api
+type markingOverride struct {
+	markfree int
+	markfull int
+}
+
+// Returns the forced rate, if one is active
+func (c *loopControl) forcedRate() (float64, bool) {
+	if c.forced == 0 {
+		return 0, false
+	}
+	if !c.forced_until.IsZero() && time.Now().After(c.forced_until) {
+		c.forced = 0
+		return 0, false
+	}
+	return c.forced, true
+}
+
+// State of a change loop, returned by Status
+type LoopStatus struct {
+	Pattern string
+	//Position of the current sample in playing direction, -1 before the first one
+	Position int
+	//Samples of the pattern, 0 if streamed
+	Samples int
+	Played  int
+	//Rate currently applied (kbit/s)
+	RateKbits float64
+	//Rate overriding the pattern, 0 if none
+	ForcedKbits float64
+	Paused      bool
+	ElapsedMs   int64
+	Markfree    int
+	Markfull    int
+}
+
+// Returns the state of the change loop
+func (tc *TrafficControl) Status() LoopStatus {
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+	status := LoopStatus{
+		RateKbits: tc.current_data_rate,
+		Paused:    tc.control.paused,
+		Markfree:  tc.params.Markfree,
+		Markfull:  tc.params.Markfull,
+		Position:  -1,
+	}
+	status.ForcedKbits, _ = tc.control.forcedRate()
+	if !tc.control.started.IsZero() {
+		status.ElapsedMs = time.Since(tc.control.started).Milliseconds()
+	}
+	if drp := tc.control.drp; drp != nil {
+		status.Pattern = drp.GetOrigin()
+		status.Position = drp.Position()
+		status.Samples = drp.SampleCount()
+		status.Played = drp.Played()
+	}
+	return status
+}
+
+// Returns the pattern of the running loop, if it is played at a fixed freq.
+// Needs tc.mutex
+func (tc *TrafficControl) controllablePattern() (*datatypes.DB_data_rate_pattern, error) {
+	drp := tc.control.drp
+	if drp == nil {
+		return nil, errortypes.NewUserInputError("No pattern is playing")
+	}
+	if drp.IsTimed() || drp.IsStreamed() {
+		return nil, errortypes.NewUserInputError("Only patterns played at a fixed freq can be controlled")
+	}
+	return drp, nil
+}
+
+// Holds the current rate until Resume is called, measuring continues
+func (tc *TrafficControl) Pause() error {
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+	if _, err := tc.controllablePattern(); err != nil {
+		return err
+	}
+	tc.control.paused = true
+	return nil
+}
+
+// Continues the pattern after Pause
+func (tc *TrafficControl) Resume() {
+	tc.mutex.Lock()
+	tc.control.paused = false
+	tc.mutex.Unlock()
+}
+
+// Continues the pattern at position (in playing direction)
+func (tc *TrafficControl) Seek(position int) error {
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+	drp, err := tc.controllablePattern()
+	if err != nil {
+		return err
+	}
+	return drp.Seek(position)
+}
+
+// Continues the pattern at the sample played d into it
+func (tc *TrafficControl) SeekTime(d time.Duration) error {
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+	drp, err := tc.controllablePattern()
+	if err != nil {
+		return err
+	}
+	return drp.SeekTime(d)
+}
+
+// Applies rate (kbit/s) instead of the pattern for d (0 = until cleared).
+// The pattern keeps advancing. A rate of 0 clears the override.
+func (tc *TrafficControl) ForceRate(rate float64, d time.Duration) error {
+	if rate < 0 || d < 0 {
+		return errortypes.NewUserInputError("Rate and duration can't be negative")
+	}
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+	tc.control.forced = rate
+	tc.control.forced_until = time.Time{}
+	if d > 0 {
+		tc.control.forced_until = time.Now().Add(d)
+	}
+	if rate == 0 {
+		if tc.control.drp == nil {
+			return nil
+		}
+		rate = tc.control.drp.Peek()
+	}
+	return tc.ChangeTo(rate)
+}
+
+// Continues with drp instead of the current pattern.
+// drp has to be played at the freq of the current one, it is closed if rejected.
+func (tc *TrafficControl) SwapPattern(drp *datatypes.DB_data_rate_pattern) error {
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+	current, err := tc.controllablePattern()
+	if err != nil {
+		drp.Close()
+		return err
+	}
+	if drp.IsTimed() || drp.IsStreamed() || drp.Freq != current.Freq {
+		drp.Close()
+		return errortypes.NewUserInputError("Pattern has to be played at %d samples/s", current.Freq)
+	}
+	INFO.Printf("Swapping pattern %s for %s", current.GetOrigin(), drp.GetOrigin())
+	tc.control.drp = drp
+	return nil
+}
+
+// Changes markfree and markfull (ms) of the running queue.
+// The marking of the pattern's samples is overridden until ClearMarking.
+func (tc *TrafficControl) ChangeMarking(markfree int, markfull int) error {
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+	if markfree < 0 {
+		return errortypes.NewUserInputError("Markfree can't be negative")
+	}
+	if err := tc.changeMarking(markfree, markfull); err != nil {
+		return err
+	}
+	tc.control.marking = &markingOverride{markfree: markfree, markfull: markfull}
+	return nil
+}
+
+// Restores the session marking, samples setting a marking change it again
+func (tc *TrafficControl) ClearMarking() error {
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+	if err := tc.changeMarking(tc.session_params.Markfree, tc.session_params.Markfull); err != nil {
+		return err
+	}
+	tc.control.marking = nil
+	return nil
+}
+
+// Needs tc.mutex
+func (tc *TrafficControl) changeMarking(markfree int, markfull int) error {
+	params := tc.params
+	params.Markfree = markfree
+	params.Markfull = markfull
+	if err := params.validate(); err != nil {
+		return err
+	}
+	params.Datarate = uint32(tc.current_data_rate)
+	if err := tc.backend.ChangeParams(params); err != nil {
+		return err
+	}
+	tc.params = params
+	return nil
+}
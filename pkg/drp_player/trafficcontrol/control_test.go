@@ -0,0 +1,164 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package trafficcontrol
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/telekom/aml-jens/internal/assets/paths"
+	"github.com/telekom/aml-jens/internal/persistence/datatypes"
+	"github.com/telekom/aml-jens/pkg/drp"
+)
+
+func newControlTestPattern(t *testing.T, identifier string) *datatypes.DB_data_rate_pattern {
+	pattern := datatypes.NewDB_data_rate_pattern()
+	pattern.Freq = 10
+	provider, err := drp.NewDataRatePatternProvider(identifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pattern.ParseDRP(provider); err != nil {
+		t.Fatal(err)
+	}
+	if err := pattern.SetPlaybackMode(drp.PlaybackMode{}); err != nil {
+		t.Fatal(err)
+	}
+	return pattern
+}
+
+func newControlTestTc(t *testing.T) *TrafficControl {
+	tc := NewTrafficControl(BACKEND_SIM, NewSimulator(DefaultSimulatorParams()))
+	if err := tc.Init(TrafficControlStartParams{Datarate: 10000, Markfree: 4, Markfull: 14}, NftStartParams{}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { tc.Close() })
+	return tc
+}
+
+func TestControl(t *testing.T) {
+	tc := newControlTestTc(t)
+	if err := tc.Pause(); err == nil {
+		t.Fatal("Pausing without a pattern did not fail")
+	}
+	pattern := newControlTestPattern(t, "gen:sawtooth?min=1000&max=2000&period=10s")
+	tc.control.drp = pattern
+	if err := tc.Pause(); err != nil || !tc.Status().Paused {
+		t.Fatalf("Could not pause: %v", err)
+	}
+	tc.Resume()
+	if err := tc.SeekTime(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	pattern.Next()
+	if status := tc.Status(); status.Position != 50 || status.Samples != 100 {
+		t.Fatalf("Position %d of %d after seeking to 5s", status.Position, status.Samples)
+	}
+	if err := tc.ForceRate(500, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if status := tc.Status(); status.RateKbits != 500 || status.ForcedKbits != 500 {
+		t.Fatalf("Forced rate was not applied: %+v", status)
+	}
+	if err := tc.ForceRate(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if status := tc.Status(); status.ForcedKbits != 0 || status.RateKbits != pattern.Peek() {
+		t.Fatalf("Clearing the forced rate did not restore the pattern: %+v", status)
+	}
+	if err := tc.ChangeMarking(2, 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := tc.ChangeMarking(12, 10); err == nil {
+		t.Fatal("Markfree > markfull did not fail")
+	}
+	if status := tc.Status(); status.Markfree != 2 || status.Markfull != 10 {
+		t.Fatalf("Marking was not changed: %+v", status)
+	}
+	swapped := newControlTestPattern(t, "gen:square?min=1000&max=2000&period=2s")
+	if err := tc.SwapPattern(swapped); err != nil || tc.control.drp != swapped {
+		t.Fatalf("Could not swap pattern: %v", err)
+	}
+	other := newControlTestPattern(t, "gen:square?min=1000&max=2000&period=2s")
+	other.Freq = 20
+	if err := tc.SwapPattern(other); err == nil {
+		t.Fatal("Swapping to a pattern with another freq did not fail")
+	}
+	socket := filepath.Join(t.TempDir(), "rates.sock")
+	streamed := newControlTestPattern(t, "stream:unix:"+socket)
+	if err := tc.SwapPattern(streamed); err == nil {
+		t.Fatal("Swapping to a streamed pattern did not fail")
+	}
+	if _, err := os.Stat(socket); !os.IsNotExist(err) {
+		t.Fatalf("Rejected stream was not closed: %v", err)
+	}
+}
+
+func TestControlMarkingOverridesSamples(t *testing.T) {
+	tc := newControlTestTc(t)
+	pattern := newControlTestPattern(t, filepath.Join(paths.TESTDATA_DRP(), "multicol", "saw_settings.csv"))
+	tc.control.drp = pattern
+	if err := tc.ChangeMarking(3, 12); err != nil {
+		t.Fatal(err)
+	}
+	play := func() {
+		value, err := pattern.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tc.ChangeTo(value); err != nil {
+			t.Fatal(err)
+		}
+		settings, _ := pattern.Settings()
+		if err := tc.ChangeSettings(settings); err != nil {
+			t.Fatal(err)
+		}
+	}
+	play()
+	play()
+	if status := tc.Status(); status.Markfree != 3 || status.Markfull != 12 {
+		t.Fatalf("Sample marking replaced the override: %+v", status)
+	}
+	if err := tc.ClearMarking(); err != nil {
+		t.Fatal(err)
+	}
+	if status := tc.Status(); status.Markfree != 4 || status.Markfull != 14 {
+		t.Fatalf("Clearing did not restore the session marking: %+v", status)
+	}
+	play()
+	if status := tc.Status(); status.Markfree != 2 || status.Markfull != 10 {
+		t.Fatalf("Sample marking was not applied after clearing: %+v", status)
+	}
+}
+
+func TestControlForcedRateExpires(t *testing.T) {
+	tc := newControlTestTc(t)
+	if err := tc.ForceRate(500, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if status := tc.Status(); status.ForcedKbits != 0 {
+		t.Fatalf("Forced rate did not expire: %+v", status)
+	}
+}
@@ -0,0 +1,165 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package trafficcontrol
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/telekom/aml-jens/internal/netlink"
+)
+
+// Host prerequisites of the backends, checked by drplay doctor.
+// Each check returns nil if the prerequisite is met.
+
+// Directory of the loaded kernel modules
+const SYS_MODULE = "/sys/module/"
+
+// Bit of CAP_NET_ADMIN in the capability sets, see capability.h
+const CAP_NET_ADMIN = 12
+
+// Returns the path of tc, the fallback backends configure their qdiscs with it
+func CheckTc() (string, error) {
+	return exec.LookPath("tc")
+}
+
+// Returns an error if the sch_janz module is not loaded
+func CheckJanzModule() error {
+	if _, err := os.Stat(SYS_MODULE + "sch_janz"); err != nil {
+		return errors.New("sch_janz is not loaded")
+	}
+	return nil
+}
+
+// Returns an error if debugfs is not mounted at the parent of
+// JANZ_DEBUGFS or the sch_janz directory is missing
+func CheckJanzDebugfs() error {
+	mounts, err := os.ReadFile("/proc/mounts")
+	if err != nil {
+		return err
+	}
+	if !isDebugfsMounted(string(mounts)) {
+		return fmt.Errorf("debugfs is not mounted at %s", debugfsRoot())
+	}
+	if _, err := os.Stat(JANZ_DEBUGFS); err != nil {
+		return fmt.Errorf("%s is missing", JANZ_DEBUGFS)
+	}
+	return nil
+}
+
+// Returns the mount point of debugfs JANZ_DEBUGFS is part of
+func debugfsRoot() string {
+	return filepath.Dir(filepath.Clean(JANZ_DEBUGFS))
+}
+
+// Returns true if mounts (as in /proc/mounts) lists debugfs at debugfsRoot
+func isDebugfsMounted(mounts string) bool {
+	root := debugfsRoot()
+	for _, line := range strings.Split(mounts, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 3 && fields[1] == root && fields[2] == "debugfs" {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns an error if nftables can't be configured over netlink;
+// the nft binary is not needed
+func CheckNftables() error {
+	c, err := netlink.DialNftables()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	//Listing a missing table fails with ENOENT if nftables is available
+	if _, err := c.Rules(PROBE_LINK); err != nil && !netlink.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Returns an error if the effective capabilities
+// of this process lack CAP_NET_ADMIN
+func CheckNetAdmin() error {
+	file, err := os.Open("/proc/self/status")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	caps, err := effectiveCapabilities(bufio.NewScanner(file))
+	if err != nil {
+		return err
+	}
+	if caps&(1<<CAP_NET_ADMIN) == 0 {
+		return errors.New("CAP_NET_ADMIN is missing")
+	}
+	return nil
+}
+
+// Returns the CapEff mask of a /proc/PID/status file
+func effectiveCapabilities(status *bufio.Scanner) (uint64, error) {
+	for status.Scan() {
+		if strings.HasPrefix(status.Text(), "CapEff:") {
+			return strconv.ParseUint(strings.TrimSpace(strings.TrimPrefix(status.Text(), "CapEff:")), 16, 64)
+		}
+	}
+	if err := status.Err(); err != nil {
+		return 0, err
+	}
+	return 0, errors.New("no CapEff in status")
+}
+
+// Returns an error if dev does not exist or is down
+func CheckLink(dev string) error {
+	nic, err := net.InterfaceByName(dev)
+	if err != nil {
+		return fmt.Errorf("%s does not exist", dev)
+	}
+	if nic.Flags&net.FlagUp == 0 {
+		return fmt.Errorf("%s is down", dev)
+	}
+	return nil
+}
+
+// Resolves name (see ResolveBackend) and returns an error
+// if the kernel lacks a qdisc the resolved backend needs
+func CheckBackend(name string) (string, error) {
+	resolved, err := ResolveBackend(name)
+	if err != nil {
+		return "", err
+	}
+	switch resolved {
+	case BACKEND_SIM:
+		return resolved, nil
+	case BACKEND_JANZ:
+		return resolved, ProbeQdisc("janz")
+	}
+	return resolved, probeQdiscs(FALLBACK_QDISCS[resolved])
+}
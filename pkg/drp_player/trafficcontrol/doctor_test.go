@@ -0,0 +1,58 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package trafficcontrol
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestIsDebugfsMounted(t *testing.T) {
+	mounts := "sysfs /sys sysfs rw,nosuid 0 0\ndebugfs /sys/kernel/debug debugfs rw,relatime 0 0\n"
+	if !isDebugfsMounted(mounts) {
+		t.Fatal("debugfs was not found")
+	}
+	if isDebugfsMounted("debugfs /mnt/debug debugfs rw 0 0\ntmpfs /sys/kernel/debug tmpfs rw 0 0\n") {
+		t.Fatal("debugfs at another path or a tmpfs was taken as debugfs")
+	}
+}
+
+func TestEffectiveCapabilities(t *testing.T) {
+	status := "Name:\tdrplay\nCapInh:\t0000000000000000\nCapPrm:\t0000000000001000\nCapEff:\t0000000000001000\n"
+	caps, err := effectiveCapabilities(bufio.NewScanner(strings.NewReader(status)))
+	if err != nil || caps != 1<<CAP_NET_ADMIN {
+		t.Fatalf("Expected only CAP_NET_ADMIN, got %x (%v)", caps, err)
+	}
+	if _, err := effectiveCapabilities(bufio.NewScanner(strings.NewReader("Name:\tdrplay\n"))); err == nil {
+		t.Fatal("Missing CapEff was accepted")
+	}
+}
+
+func TestCheckLink(t *testing.T) {
+	if err := CheckLink("lo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckLink("jens_missing0"); err == nil {
+		t.Fatal("Missing link was accepted")
+	}
+}
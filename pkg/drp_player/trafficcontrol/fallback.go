@@ -0,0 +1,357 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package trafficcontrol
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/telekom/aml-jens/internal/commands"
+	"github.com/telekom/aml-jens/internal/errortypes"
+	"github.com/telekom/aml-jens/internal/netlink"
+	"github.com/telekom/aml-jens/internal/util"
+)
+
+// Fallback backends, in the order auto prefers them
+var FALLBACK_BACKENDS = []string{BACKEND_CAKE, BACKEND_FQ_CODEL, BACKEND_HTB, BACKEND_TBF}
+
+// Qdisc kinds the kernel has to provide for each fallback backend
+var FALLBACK_QDISCS = map[string][]string{
+	BACKEND_TBF:      {"tbf"},
+	BACKEND_HTB:      {"htb", "pfifo"},
+	BACKEND_FQ_CODEL: {"htb", "fq_codel"},
+	BACKEND_CAKE:     {"cake"},
+}
+
+// Interval the qdisc stats are read at, each read yields one queue record
+const STATS_INTERVAL = 10 * time.Millisecond
+
+// Rates below are raised to this, as tc rejects a rate of 0 (kbit/s)
+const MIN_FALLBACK_RATE = 8
+
+// Size of a full frame, used to convert packet limits to bytes
+const FRAME_SIZE = 1514
+
+// Returns the handle of the leaf qdisc below the htb class of handle
+func LeafHandle(handle uint16) uint16 {
+	return 0x4000 | handle
+}
+
+// Backend shaping dev with standard qdiscs if the janz qdisc is not available:
+// tbf, htb with a pfifo leaf, htb with an fq_codel (ECN) leaf or cake.
+//
+// Rates are changed by tc change. There are no per packet records,
+// the queue records carry the qdisc stats (backlog, drops, ECN marks).
+type qdiscBackend struct {
+	shaper
+	name   string
+	params TrafficControlStartParams
+	mutex  sync.Mutex
+	//Current rate in kbit/s
+	rate float64
+}
+
+func (q *qdiscBackend) Name() string {
+	return q.name
+}
+
+func (q *qdiscBackend) Init(dev string, params TrafficControlStartParams, nft NftStartParams) error {
+	if params.AddonLatency > 0 || params.Qosmode > 0 {
+		WARN.Printf("Backend %s ignores extralatency and qosmode", q.name)
+	}
+	if err := q.setup(dev, params, nft); err != nil {
+		return err
+	}
+	q.params = params
+	q.rate = math.Max(float64(params.Datarate), MIN_FALLBACK_RATE)
+	switch q.name {
+	case BACKEND_TBF:
+		return q.addQdisc(q.qdisc("tbf"), q.rootArgs("add"))
+	case BACKEND_CAKE:
+		return q.addQdisc(q.qdisc("cake"), q.rootArgs("add"))
+	}
+	root := append([]string{"qdisc", "add", "dev", q.dev}, q.parentArgs()...)
+	root = append(root, "handle", q.handleArg(), "htb", "default", "1")
+	if err := q.addQdisc(q.qdisc("htb"), root); err != nil {
+		return err
+	}
+	if err := commands.ExecCommand("tc", q.classArgs("add")...).Error(); err != nil {
+		return err
+	}
+	return q.addQdisc(q.leafQdisc(), q.leafArgs("add"))
+}
+
+// Returns the tc args adding or changing the root qdisc of tbf and cake
+func (q *qdiscBackend) rootArgs(op string) []string {
+	args := append([]string{"qdisc", op, "dev", q.dev}, q.parentArgs()...)
+	args = append(args, "handle", q.handleArg())
+	if q.name == BACKEND_CAKE {
+		return append(args, "cake", "bandwidth", q.rateArg(), "besteffort")
+	}
+	return append(args, "tbf", "rate", q.rateArg(), "burst", q.burstArg(), "limit", fmt.Sprint(q.queueSize()*FRAME_SIZE))
+}
+
+// Returns the tc args adding or changing the htb class holding the rate
+func (q *qdiscBackend) classArgs(op string) []string {
+	return []string{"class", op, "dev", q.dev, "parent", q.handleArg(), "classid", q.handleArg() + "1",
+		"htb", "rate", q.rateArg(), "ceil", q.rateArg(), "burst", q.burstArg()}
+}
+
+// Returns the tc args adding or changing the leaf qdisc below the htb class
+func (q *qdiscBackend) leafArgs(op string) []string {
+	args := []string{"qdisc", op, "dev", q.dev, "parent", q.handleArg() + "1", "handle", fmt.Sprintf("%x:", LeafHandle(q.handle))}
+	limit := fmt.Sprint(q.queueSize())
+	if q.name == BACKEND_HTB {
+		return append(args, "pfifo", "limit", limit)
+	}
+	//Marking starts at markfree, codel's interval has to exceed its target
+	target := util.MaxInt(1, q.params.Markfree)
+	interval := util.MaxInt(target+1, q.params.Markfull)
+	return append(args, "fq_codel", "limit", limit,
+		"target", fmt.Sprintf("%dms", target), "interval", fmt.Sprintf("%dms", interval), "ecn")
+}
+
+func (q *qdiscBackend) leafQdisc() netlink.Qdisc {
+	kind := "fq_codel"
+	if q.name == BACKEND_HTB {
+		kind = "pfifo"
+	}
+	return netlink.Qdisc{Ifindex: q.ifindex, Handle: netlink.MakeHandle(LeafHandle(q.handle), 0), Parent: netlink.MakeHandle(q.handle, 1), Kind: kind}
+}
+
+// Returns the handle of the qdisc holding the queue, the one stats are read from
+func (q *qdiscBackend) queueHandle() uint32 {
+	if q.name == BACKEND_HTB || q.name == BACKEND_FQ_CODEL {
+		return netlink.MakeHandle(LeafHandle(q.handle), 0)
+	}
+	return netlink.MakeHandle(q.handle, 0)
+}
+
+func (q *qdiscBackend) queueSize() int {
+	if q.params.QueueSize > 0 {
+		return q.params.QueueSize
+	}
+	return 1000
+}
+
+func (q *qdiscBackend) rateArg() string {
+	return fmt.Sprintf("%dkbit", uint64(q.rate))
+}
+
+// Returns the bucket size: 4ms at the current rate, at least two frames
+func (q *qdiscBackend) burstArg() string {
+	return fmt.Sprint(util.MaxInt(2*FRAME_SIZE, int(q.rate*1000/8*0.004)))
+}
+
+// Changes the rate by tc change, unchanged rates are skipped
+func (q *qdiscBackend) ChangeRate(rate float64) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	rate = math.Max(rate, MIN_FALLBACK_RATE)
+	if uint64(rate) == uint64(q.rate) {
+		return nil
+	}
+	q.rate = rate
+	if q.name == BACKEND_HTB || q.name == BACKEND_FQ_CODEL {
+		return commands.ExecCommand("tc", q.classArgs("change")...).Error()
+	}
+	return commands.ExecCommand("tc", q.rootArgs("change")...).Error()
+}
+
+// Changes the queue size and, for fq_codel, target and interval
+func (q *qdiscBackend) ChangeParams(params TrafficControlStartParams) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.params = params
+	switch q.name {
+	case BACKEND_TBF:
+		return commands.ExecCommand("tc", q.rootArgs("change")...).Error()
+	case BACKEND_CAKE:
+		return nil
+	}
+	return commands.ExecCommand("tc", q.leafArgs("change")...).Error()
+}
+
+func (q *qdiscBackend) currentRate() float64 {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.rate
+}
+
+func (q *qdiscBackend) OpenRecords() (RecordReader, error) {
+	c, err := netlink.DialRoute()
+	if err != nil {
+		return nil, err
+	}
+	r := &qdiscStatsReader{backend: q, conn: c, ticker: time.NewTicker(STATS_INTERVAL)}
+	//Counters are reported relative to the start of the records
+	if current, err := c.Qdisc(q.ifindex, q.queueHandle()); err == nil {
+		r.last = current.Stats
+	}
+	return r, nil
+}
+
+func (q *qdiscBackend) Close() error {
+	q.teardown()
+	return nil
+}
+
+// Reads the stats of the queue qdisc every STATS_INTERVAL as a queue record
+type qdiscStatsReader struct {
+	backend *qdiscBackend
+	conn    *netlink.Conn
+	ticker  *time.Ticker
+	last    netlink.QdiscStats
+}
+
+func (r *qdiscStatsReader) ReadRecord(buf []byte, timeout time.Duration) (int, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-r.ticker.C:
+	case <-timer.C:
+		return 0, nil
+	}
+	q, err := r.conn.Qdisc(r.backend.ifindex, r.backend.queueHandle())
+	if err != nil {
+		return 0, err
+	}
+	record := statsRecord(MonotonicNs(), q.Stats, r.last, r.backend.currentRate())
+	r.last = q.Stats
+	return copy(buf, record), nil
+}
+
+// Stats are read live, there is nothing buffered
+func (r *qdiscStatsReader) Discard() error {
+	return nil
+}
+
+func (r *qdiscStatsReader) Close() error {
+	r.ticker.Stop()
+	return r.conn.Close()
+}
+
+// Returns a stats record: a queue record
+// with the drops and ECN marks since last at [24:28] and [28:32]
+func statsRecord(timestampNs uint64, stats netlink.QdiscStats, last netlink.QdiscStats, rate float64) []byte {
+	record := make([]byte, RECORD_SIZE)
+	binary.LittleEndian.PutUint64(record[0:8], timestampNs)
+	record[8] = record_type_stats
+	binary.LittleEndian.PutUint16(record[10:12], uint16(math.Min(float64(stats.Qlen), math.MaxUint16)))
+	binary.LittleEndian.PutUint32(record[12:16], stats.Backlog)
+	binary.LittleEndian.PutUint64(record[16:24], uint64(rate*1000))
+	//Counters wrap at 2^32, unsigned subtraction handles that
+	binary.LittleEndian.PutUint32(record[24:28], stats.Drops-last.Drops)
+	binary.LittleEndian.PutUint32(record[28:32], stats.EcnMarks-last.EcnMarks)
+	return record
+}
+
+// Prefix of the link ProbeQdisc adds qdiscs to, followed by the pid
+// to stay within IFNAMSIZ and apart from other processes probing
+const PROBE_LINK = "jprobe"
+
+// Link kinds tried in order for the probe link, the first the kernel provides is used
+var PROBE_LINK_KINDS = []string{"dummy", "ifb"}
+
+// Guards the probe link of this process
+var probe_mutex sync.Mutex
+
+// Checks that the kernel provides the qdisc kind by adding it to a
+// temporary dummy (or ifb) link. Returns an error satisfying netlink.IsNotExist
+// if the kind is unknown, any other error if it could not be probed.
+func ProbeQdisc(kind string) error {
+	probe_mutex.Lock()
+	defer probe_mutex.Unlock()
+	c, err := netlink.DialRoute()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	link := fmt.Sprintf("%s%d", PROBE_LINK, os.Getpid())
+	if _, err := netlink.LinkIndex(link); err == nil {
+		return fmt.Errorf("probe link %s already exists, delete it with 'ip link del %s'", link, link)
+	}
+	for _, link_kind := range PROBE_LINK_KINDS {
+		if err = c.AddLink(link, link_kind); err == nil {
+			break
+		}
+		DEBUG.Printf("ProbeQdisc: could not add %s link: %v", link_kind, err)
+	}
+	if err != nil {
+		return fmt.Errorf("could not add probe link (%v): %w", PROBE_LINK_KINDS, err)
+	}
+	index, err := netlink.LinkIndex(link)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		logReset("ProbeQdisc", c.DeleteLink(index))
+	}()
+	err = c.AddQdisc(netlink.Qdisc{Ifindex: index, Handle: netlink.MakeHandle(1, 0), Parent: netlink.TC_H_ROOT, Kind: kind})
+	//Known kinds may reject the missing options
+	if err == nil || errors.Is(err, syscall.EINVAL) {
+		return nil
+	}
+	return fmt.Errorf("qdisc %s: %w", kind, err)
+}
+
+// Returns name, or for auto the backend the host supports:
+// janz if its qdisc is available, else the first of FALLBACK_BACKENDS.
+// A candidate that can not be probed is skipped like an unsupported one.
+func ResolveBackend(name string) (string, error) {
+	if name != BACKEND_AUTO {
+		backend, err := NewBackend(name)
+		if err != nil {
+			return "", err
+		}
+		return backend.Name(), nil
+	}
+	err := ProbeQdisc("janz")
+	if err == nil {
+		INFO.Printf("Backend auto: using %s", BACKEND_JANZ)
+		return BACKEND_JANZ, nil
+	}
+	DEBUG.Printf("Backend auto: %s: %v", BACKEND_JANZ, err)
+	for _, fallback := range FALLBACK_BACKENDS {
+		if err = probeQdiscs(FALLBACK_QDISCS[fallback]); err == nil {
+			INFO.Printf("Backend auto: %s is not available, using %s", BACKEND_JANZ, fallback)
+			return fallback, nil
+		}
+		DEBUG.Printf("Backend auto: %s: %v", fallback, err)
+	}
+	return "", errortypes.NewUserInputError("no backend is supported by this host, tried %s and %v: %v", BACKEND_JANZ, FALLBACK_BACKENDS, err)
+}
+
+func probeQdiscs(kinds []string) error {
+	for _, kind := range kinds {
+		if err := ProbeQdisc(kind); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package trafficcontrol
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/telekom/aml-jens/internal/netlink"
+	"github.com/telekom/aml-jens/internal/persistence/datatypes"
+)
+
+func TestQdiscBackendArgs(t *testing.T) {
+	params := TrafficControlStartParams{Datarate: 8000, QueueSize: 100, Markfree: 4, Markfull: 14}
+	expected := map[string][]string{
+		BACKEND_TBF:      {"qdisc add dev eth0 root handle 3: tbf rate 8000kbit burst 4000 limit 151400"},
+		BACKEND_CAKE:     {"qdisc add dev eth0 root handle 3: cake bandwidth 8000kbit besteffort"},
+		BACKEND_HTB:      {"class add dev eth0 parent 3: classid 3:1 htb rate 8000kbit ceil 8000kbit burst 4000", "qdisc add dev eth0 parent 3:1 handle 4003: pfifo limit 100"},
+		BACKEND_FQ_CODEL: {"class add dev eth0 parent 3: classid 3:1 htb rate 8000kbit ceil 8000kbit burst 4000", "qdisc add dev eth0 parent 3:1 handle 4003: fq_codel limit 100 target 4ms interval 14ms ecn"},
+	}
+	for name, args := range expected {
+		backend, err := NewUeBackend(name, 1, datatypes.DIRECTION_UPLINK, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		q := backend.(*qdiscBackend)
+		q.dev, q.params, q.rate = "eth0", params, float64(params.Datarate)
+		var got []string
+		if name == BACKEND_TBF || name == BACKEND_CAKE {
+			got = []string{strings.Join(q.rootArgs("add"), " ")}
+		} else {
+			got = []string{strings.Join(q.classArgs("add"), " "), strings.Join(q.leafArgs("add"), " ")}
+		}
+		if strings.Join(got, "; ") != strings.Join(args, "; ") {
+			t.Fatalf("%s: unexpected args %v", name, got)
+		}
+	}
+}
+
+func TestStatsRecord(t *testing.T) {
+	last := netlink.QdiscStats{Drops: 0xfffffffe, EcnMarks: 5}
+	stats := netlink.QdiscStats{Qlen: 70000, Backlog: 3028, Drops: 3, EcnMarks: 9}
+	record := statsRecord(42, stats, last, 1500)
+	if len(record) != RECORD_SIZE || record[8] != record_type_stats {
+		t.Fatalf("Unexpected record %v", record)
+	}
+	if qlen := binary.LittleEndian.Uint16(record[10:12]); qlen != 0xffff {
+		t.Fatalf("Queue length %d was not capped", qlen)
+	}
+	if rate := binary.LittleEndian.Uint64(record[16:24]); rate != 1500000 {
+		t.Fatalf("Unexpected rate %d", rate)
+	}
+	if drops := binary.LittleEndian.Uint32(record[24:28]); drops != 5 {
+		t.Fatalf("Expected 5 drops across the wrap, got %d", drops)
+	}
+	if marks := binary.LittleEndian.Uint32(record[28:32]); marks != 4 {
+		t.Fatalf("Expected 4 marks, got %d", marks)
+	}
+}
+
+// Sends n raw frames of size bytes out of the link ifindex
+func sendFrames(t *testing.T, ifindex int, n int, size int) {
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(fd)
+	frame := make([]byte, size)
+	frame[0], frame[12], frame[13] = 0xff, 0x88, 0xb5
+	for i := 0; i < n; i++ {
+		if err := syscall.Sendto(fd, frame, 0, &syscall.SockaddrLinklayer{Ifindex: ifindex}); err != nil && !errors.Is(err, syscall.ENOBUFS) {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestProbeQdiscKernel(t *testing.T) {
+	c, err := netlink.DialRoute()
+	if err != nil {
+		t.Skip(err)
+	}
+	defer c.Close()
+	if err := ProbeQdisc("htb"); err != nil {
+		t.Skipf("Could not probe: %v", err)
+	}
+	if err := ProbeQdisc("jens_unknown"); !netlink.IsNotExist(err) {
+		t.Fatalf("Unknown qdisc kind returned %v", err)
+	}
+	link := fmt.Sprintf("%s%d", PROBE_LINK, os.Getpid())
+	if err := c.AddLink(link, "ifb"); err != nil {
+		t.Skipf("Could not add %s: %v", link, err)
+	}
+	index, _ := netlink.LinkIndex(link)
+	defer c.DeleteLink(index)
+	if err := ProbeQdisc("htb"); err == nil {
+		t.Fatal("Probing with an existing probe link did not fail")
+	}
+	if _, err := netlink.LinkIndex(link); err != nil {
+		t.Fatalf("Existing probe link was deleted: %v", err)
+	}
+}
+
+func TestQdiscBackendKernel(t *testing.T) {
+	if _, err := exec.LookPath("tc"); err != nil {
+		t.Skip(err)
+	}
+	c, err := netlink.DialRoute()
+	if err != nil {
+		t.Skip(err)
+	}
+	defer c.Close()
+	const dev = "jens_fb0"
+	if err := c.AddLink(dev, "ifb"); err != nil {
+		t.Skipf("Could not add %s: %v", dev, err)
+	}
+	index, _ := netlink.LinkIndex(dev)
+	defer c.DeleteLink(index)
+	if err := c.SetLinkUp(index); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{BACKEND_TBF, BACKEND_HTB} {
+		if err := probeQdiscs(FALLBACK_QDISCS[name]); err != nil {
+			t.Logf("Skipping %s: %v", name, err)
+			continue
+		}
+		//A high UE keeps the nft tables of a running drplay untouched
+		backend, _ := NewUeBackend(name, 7, datatypes.DIRECTION_UPLINK, "")
+		if err := backend.Init(dev, TrafficControlStartParams{Datarate: 100, QueueSize: 10}, NftStartParams{}); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if err := backend.ChangeRate(200); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		records, err := backend.OpenRecords()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sendFrames(t, index, 100, 1000)
+		record := make([]byte, RECORD_SIZE)
+		if n, err := records.ReadRecord(record, time.Second); n != RECORD_SIZE || err != nil {
+			t.Fatalf("%s: read %d, %v", name, n, err)
+		}
+		records.Close()
+		backlog := binary.LittleEndian.Uint32(record[12:16])
+		drops := binary.LittleEndian.Uint32(record[24:28])
+		rate := binary.LittleEndian.Uint64(record[16:24])
+		if backlog == 0 || drops == 0 || rate != 200000 {
+			t.Fatalf("%s: expected backlog and drops at 200 kbit/s, got %d bytes, %d drops at %d bit/s", name, backlog, drops, rate)
+		}
+		backend.Close()
+		qdiscs, err := c.Qdiscs(index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, q := range qdiscs {
+			if q.Handle>>16 == uint32(JanzHandle(7, datatypes.DIRECTION_UPLINK)) {
+				t.Fatalf("%s: %s was not removed", name, q)
+			}
+		}
+	}
+}
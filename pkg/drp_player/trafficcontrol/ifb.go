@@ -0,0 +1,99 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package trafficcontrol
+
+import (
+	"github.com/telekom/aml-jens/internal/netlink"
+)
+
+// Default IFB device the ingress is redirected to
+const DEFAULT_IFB = "ifb0"
+
+// Handle of the ingress qdisc, tc: ffff:
+var INGRESS_HANDLE = netlink.MakeHandle(0xffff, 0)
+
+// Redirects all ingress traffic of dev to the egress of ifb,
+// creating ifb if needed. Qdiscs on ifb then shape the downlink of dev.
+// The ingress qdisc and its filter are read back after being added.
+func SetupIfb(dev string, ifb string) error {
+	ResetIfb(dev, ifb)
+	c, err := netlink.DialRoute()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	devIndex, err := netlink.LinkIndex(dev)
+	if err != nil {
+		return err
+	}
+	DEBUG.Printf("Ifb: adding %s, redirecting ingress of %s", ifb, dev)
+	if err := c.AddLink(ifb, "ifb"); err != nil {
+		return err
+	}
+	ifbIndex, err := netlink.LinkIndex(ifb)
+	if err != nil {
+		return err
+	}
+	if err := c.SetLinkUp(ifbIndex); err != nil {
+		return err
+	}
+	ingress := netlink.Qdisc{Ifindex: devIndex, Handle: INGRESS_HANDLE, Parent: netlink.TC_H_INGRESS, Kind: "ingress"}
+	if err := c.AddQdisc(ingress); err != nil {
+		return err
+	}
+	if err := c.VerifyQdisc(ingress); err != nil {
+		return err
+	}
+	if err := c.AddRedirectFilter(devIndex, INGRESS_HANDLE, ifbIndex); err != nil {
+		return err
+	}
+	return c.VerifyFilter(devIndex, INGRESS_HANDLE, "u32")
+}
+
+// Removes the ingress redirect of dev and deletes ifb
+func ResetIfb(dev string, ifb string) {
+	c, err := netlink.DialRoute()
+	if err != nil {
+		WARN.Printf("IfbReset: %v", err)
+		return
+	}
+	defer c.Close()
+	if index, err := netlink.LinkIndex(dev); err == nil {
+		logReset("IfbReset", c.DeleteQdisc(netlink.Qdisc{Ifindex: index, Parent: netlink.TC_H_INGRESS}))
+	}
+	if index, err := netlink.LinkIndex(ifb); err == nil {
+		logReset("IfbReset", c.DeleteLink(index))
+	}
+}
+
+// Logs the result of removing state that might not exist:
+// a missing object is expected, anything else is not
+func logReset(op string, err error) {
+	if err == nil {
+		return
+	}
+	if netlink.IsNotExist(err) {
+		DEBUG.Printf("%s: %v", op, err)
+		return
+	}
+	WARN.Printf("%s: %v", op, err)
+}
@@ -0,0 +1,144 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package trafficcontrol
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/telekom/aml-jens/internal/netlink"
+	"github.com/telekom/aml-jens/pkg/drp"
+)
+
+// Packets netem can hold while delaying them
+const NETEM_LIMIT = 100000
+
+// Returns the handle of the netem qdisc impairing the janz qdisc with handle
+func NetemHandle(handle uint16) uint16 {
+	return 0x8000 | handle
+}
+
+// Entries of the netem delay distributions
+const NETEM_DIST_SIZE = 4096
+
+// Returns the netem options applying imp
+func netemOptions(imp drp.Impairment) netlink.NetemOptions {
+	ms := func(v float64) time.Duration { return time.Duration(v * float64(time.Millisecond)) }
+	res := netlink.NetemOptions{Limit: NETEM_LIMIT, Latency: ms(imp.DelayMs), Jitter: ms(imp.JitterMs)}
+	if imp.JitterMs > 0 {
+		res.DelayDist = netemDistTable(imp.Distribution)
+	}
+	switch imp.Loss {
+	case drp.LOSS_BERNOULLI:
+		res.Loss = imp.P
+	case drp.LOSS_GILBERT_ELLIOTT:
+		res.GE = &netlink.NetemGEModel{P: imp.P, R: imp.R, LossBad: imp.LossBad, LossGood: imp.LossGood}
+	}
+	return res
+}
+
+// Returns the netem table of dist (default normal): the deviates the
+// impairmentModel draws, at evenly spaced quantiles, in units of
+// 1/NETEM_DIST_SCALE. The tail beyond 4 deviations is clamped, which
+// lowers the deviation of the pareto table to about 3/4.
+func netemDistTable(dist drp.JitterDistribution) []int16 {
+	table := make([]int16, NETEM_DIST_SIZE)
+	for i := range table {
+		quantile := (float64(i) + 0.5) / NETEM_DIST_SIZE
+		var deviate float64
+		if dist == drp.JITTER_PARETO {
+			deviate = paretoDeviate(quantile)
+		} else {
+			deviate = normalDeviate(quantile)
+		}
+		table[i] = int16(math.Max(math.MinInt16, math.Min(math.MaxInt16, math.Round(deviate*netlink.NETEM_DIST_SCALE))))
+	}
+	return table
+}
+
+// Returns the standard normal deviate at quantile (0,1)
+func normalDeviate(quantile float64) float64 {
+	return math.Sqrt2 * math.Erfinv(2*quantile-1)
+}
+
+// Returns the deviate of Pareto(1, alpha) at quantile (0,1),
+// scaled to mean 0 and deviation 1
+func paretoDeviate(quantile float64) float64 {
+	x := 1 / math.Pow(1-quantile, 1.0/pareto_alpha)
+	mean := pareto_alpha / (pareto_alpha - 1.0)
+	deviation := math.Sqrt(pareto_alpha/(pareto_alpha-2.0)) / (pareto_alpha - 1.0)
+	return (x - mean) / deviation
+}
+
+// In-tool model of an Impairment, deciding per packet.
+// Used by the Simulator.
+type impairmentModel struct {
+	impairment drp.Impairment
+	rand       *rand.Rand
+	//Gilbert-Elliott state
+	bad bool
+}
+
+func newImpairmentModel(imp drp.Impairment, seed int64) *impairmentModel {
+	return &impairmentModel{
+		impairment: imp,
+		rand:       rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Returns true if the next packet is lost
+func (m *impairmentModel) lost() bool {
+	switch m.impairment.Loss {
+	case drp.LOSS_BERNOULLI:
+		return m.rand.Float64() < m.impairment.P
+	case drp.LOSS_GILBERT_ELLIOTT:
+		if m.bad {
+			m.bad = m.rand.Float64() >= m.impairment.R
+		} else {
+			m.bad = m.rand.Float64() < m.impairment.P
+		}
+		if m.bad {
+			return m.rand.Float64() < m.impairment.LossBad
+		}
+		return m.rand.Float64() < m.impairment.LossGood
+	}
+	return false
+}
+
+// Pareto shape of the jitter; like the netem table, mean and deviation are finite
+const pareto_alpha = 3
+
+// Returns the delay of the next packet in ms
+func (m *impairmentModel) delayMs() float64 {
+	delay := m.impairment.DelayMs
+	if m.impairment.JitterMs > 0 {
+		var deviate float64
+		if m.impairment.Distribution == drp.JITTER_PARETO {
+			deviate = paretoDeviate(m.rand.Float64())
+		} else {
+			deviate = m.rand.NormFloat64()
+		}
+		delay += m.impairment.JitterMs * deviate
+	}
+	return math.Max(0, delay)
+}
@@ -0,0 +1,131 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package trafficcontrol
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/telekom/aml-jens/internal/netlink"
+	"github.com/telekom/aml-jens/pkg/drp"
+)
+
+func TestNetemOptions(t *testing.T) {
+	imp, err := drp.ParseImpairment("loss=ge,p=0.01,r=0.25,bad=0.5,delay=20,jitter=2.5,dist=pareto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := netemOptions(imp)
+	if got.Limit != NETEM_LIMIT || got.Latency != 20*time.Millisecond || got.Jitter != 2500*time.Microsecond || len(got.DelayDist) != NETEM_DIST_SIZE {
+		t.Fatalf("Unexpected netem options: %+v", got)
+	}
+	if got.GE == nil || *got.GE != (netlink.NetemGEModel{P: 0.01, R: 0.25, LossBad: 0.5}) {
+		t.Fatalf("Unexpected loss model: %+v", got.GE)
+	}
+	got = netemOptions(drp.Impairment{Loss: drp.LOSS_BERNOULLI, P: 0.001})
+	if got.Loss != 0.001 || got.GE != nil || got.DelayDist != nil || got.Latency != 0 {
+		t.Fatalf("Unexpected netem options: %+v", got)
+	}
+}
+
+func TestNetemDistTable(t *testing.T) {
+	for _, dist := range drp.JITTER_DISTRIBUTIONS {
+		var sum, sq float64
+		table := netemDistTable(dist)
+		for i, v := range table {
+			if i > 0 && v < table[i-1] {
+				t.Fatalf("%s: table is not sorted at %d", dist, i)
+			}
+			x := float64(v) / netlink.NETEM_DIST_SCALE
+			sum += x
+			sq += x * x
+		}
+		mean := sum / NETEM_DIST_SIZE
+		deviation := math.Sqrt(sq/NETEM_DIST_SIZE - mean*mean)
+		//Quantiles and the clamped tail of pareto lower its deviation
+		min_deviation := 0.99
+		if dist == drp.JITTER_PARETO {
+			min_deviation = 0.7
+		}
+		if math.Abs(mean) > 0.05 || deviation < min_deviation || deviation > 1.01 {
+			t.Fatalf("%s: mean %f, deviation %f, expected 0, 1", dist, mean, deviation)
+		}
+	}
+}
+
+func TestImpairmentModel(t *testing.T) {
+	const n = 200000
+	lossRate := func(imp drp.Impairment) float64 {
+		m := newImpairmentModel(imp, 1)
+		lost := 0
+		for i := 0; i < n; i++ {
+			if m.lost() {
+				lost++
+			}
+		}
+		return float64(lost) / n
+	}
+	if rate := lossRate(drp.Impairment{Loss: drp.LOSS_BERNOULLI, P: 0.05}); math.Abs(rate-0.05) > 0.005 {
+		t.Fatalf("Bernoulli lost %f, expected 0.05", rate)
+	}
+	//Stationary: bad 0.02/(0.02+0.18) = 10% of the time
+	if rate := lossRate(drp.Impairment{Loss: drp.LOSS_GILBERT_ELLIOTT, P: 0.02, R: 0.18, LossBad: 1}); math.Abs(rate-0.1) > 0.01 {
+		t.Fatalf("Gilbert-Elliott lost %f, expected 0.1", rate)
+	}
+	for _, dist := range drp.JITTER_DISTRIBUTIONS {
+		m := newImpairmentModel(drp.Impairment{DelayMs: 50, JitterMs: 5, Distribution: dist}, 1)
+		var sum, sq float64
+		for i := 0; i < n; i++ {
+			d := m.delayMs()
+			sum += d
+			sq += d * d
+		}
+		mean := sum / n
+		deviation := math.Sqrt(sq/n - mean*mean)
+		if math.Abs(mean-50) > 0.5 || math.Abs(deviation-5) > 0.5 {
+			t.Fatalf("%s: mean %f, deviation %f, expected 50, 5", dist, mean, deviation)
+		}
+	}
+}
+
+func TestChangeSettingsImpairment(t *testing.T) {
+	sim := NewSimulator(DefaultSimulatorParams())
+	tc := NewTrafficControl(BACKEND_SIM, sim)
+	imp := drp.Impairment{Loss: drp.LOSS_GILBERT_ELLIOTT, P: 0.01, R: 0.3, LossBad: 1, JitterMs: 2}
+	if err := tc.Init(TrafficControlStartParams{Datarate: 10000, Markfree: 4, Markfull: 14, Impairment: &imp}, NftStartParams{}); err != nil {
+		t.Fatal(err)
+	}
+	defer tc.Close()
+	if err := tc.ChangeSettings(drp.SampleSettings{Loss: 0.5, MarkfreeMs: -1, MarkfullMs: -1, JitterMs: 7}); err != nil {
+		t.Fatal(err)
+	}
+	sim.mutex.Lock()
+	got := sim.impairment.impairment
+	sim.mutex.Unlock()
+	if got.LossBad != 0.5 || got.JitterMs != 7 || got.P != 0.01 {
+		t.Fatalf("Sample was not applied to the impairment: %+v", got)
+	}
+	if tc.current_loss != 0 || sim.loss != 0 {
+		t.Fatal("Loss was applied besides the impairment stage")
+	}
+}
@@ -0,0 +1,162 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package trafficcontrol
+
+/*
+ #include "poll.h"
+ #include <time.h>
+ static unsigned long long get_nsecs(void)
+ {
+	 struct timespec ts;
+	 clock_gettime(CLOCK_MONOTONIC, &ts);
+	 return (unsigned long long)ts.tv_sec * 1000000000UL + ts.tv_nsec;
+ }
+*/
+import "C"
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/telekom/aml-jens/internal/persistence/datatypes"
+)
+
+// Handles of the janz qdiscs of the first UE, each has its own debugfs files
+const (
+	JANZ_HANDLE_UPLINK   uint16 = 1
+	JANZ_HANDLE_DOWNLINK uint16 = 2
+)
+
+// Returns the handle of the janz qdisc shaping direction of the ue-th UE
+func JanzHandle(ue int, direction string) uint16 {
+	if direction == datatypes.DIRECTION_DOWNLINK {
+		return JANZ_HANDLE_DOWNLINK + uint16(2*ue)
+	}
+	return JANZ_HANDLE_UPLINK + uint16(2*ue)
+}
+
+const JANZ_DEBUGFS = "/sys/kernel/debug/sch_janz/"
+
+// Returns the file rates of the janz qdisc handle are written to
+func JanzCtrlFile(handle uint16) string {
+	return fmt.Sprintf("%s%04x:v1", JANZ_DEBUGFS, handle)
+}
+
+// Returns the file the janz qdisc handle writes its records to
+func JanzMeasureFile(handle uint16) string {
+	return fmt.Sprintf("%s%04x:0", JANZ_DEBUGFS, handle)
+}
+
+// Returns CLOCK_MONOTONIC in ns, the clock records are timestamped with
+func MonotonicNs() uint64 {
+	return uint64(C.get_nsecs())
+}
+
+// Backend using the custom janz qdisc and nft
+type janzBackend struct {
+	shaper
+	control_file *os.File
+	//Rate last written to control_file in bit/s, and the buffer used to write it;
+	//at high freq most samples repeat the previous rate
+	current_rate uint64
+	rate_buffer  [8]byte
+}
+
+func (j *janzBackend) Name() string {
+	return BACKEND_JANZ
+}
+
+// Sets NFT and TC to workable state, connects to custom qdisk.
+// The qdisc is added over rtnetlink and read back.
+func (j *janzBackend) Init(dev string, params TrafficControlStartParams, nft NftStartParams) error {
+	if err := j.setup(dev, params, nft); err != nil {
+		return err
+	}
+	if err := j.addQdiscWithOptions(j.qdisc("janz"), params.janzOptions()); err != nil {
+		return err
+	}
+	var err error
+	j.control_file, err = os.OpenFile(JanzCtrlFile(j.handle), os.O_WRONLY, os.ModeAppend)
+	return err
+}
+
+func (j *janzBackend) ChangeRate(rate float64) error {
+	currentDataRateBit := uint64(rate) * 1000
+	if currentDataRateBit == j.current_rate {
+		return nil
+	}
+	binary.LittleEndian.PutUint64(j.rate_buffer[:], currentDataRateBit)
+	if _, err := j.control_file.Write(j.rate_buffer[:]); err != nil {
+		return err
+	}
+	j.current_rate = currentDataRateBit
+	return nil
+}
+
+func (j *janzBackend) ChangeParams(params TrafficControlStartParams) error {
+	return j.changeQdisc(j.qdisc("janz"), params.janzOptions())
+}
+
+func (j *janzBackend) OpenRecords() (RecordReader, error) {
+	file, err := os.Open(JanzMeasureFile(j.handle))
+	if err != nil {
+		return nil, err
+	}
+	return &janzRecordReader{file: file}, nil
+}
+
+// Closes all open contexts; Resets NFT_TABLE, tc markings etc.
+func (j *janzBackend) Close() error {
+	j.teardown()
+	if err := j.control_file.Close(); err == nil {
+		//This is to be expected: File gets closed beforehand
+		WARN.Printf("control_file TC had to be closed")
+	} else {
+		DEBUG.Printf("Could not close control_file TC, %s", err)
+	}
+	return nil
+}
+
+// Reads records from the debugfs file of the janz qdisc
+type janzRecordReader struct {
+	file *os.File
+}
+
+func (r *janzRecordReader) ReadRecord(buf []byte, timeout time.Duration) (int, error) {
+	var fdint C.int = C.int(uint(r.file.Fd()))
+	pfd := C.struct_pollfd{fdint, C.POLLIN, 0}
+	if rc := C.poll(&pfd, 1, C.int(timeout.Milliseconds())); rc <= 0 {
+		return 0, nil
+	}
+	return r.file.Read(buf)
+}
+
+func (r *janzRecordReader) Discard() error {
+	dummy := make([]byte, 0xffffffff)
+	_, err := r.file.Read(dummy)
+	return err
+}
+
+func (r *janzRecordReader) Close() error {
+	return r.file.Close()
+}
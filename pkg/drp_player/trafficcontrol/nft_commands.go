@@ -22,38 +22,76 @@
 package trafficcontrol
 
 import (
-	"github.com/telekom/aml-jens/internal/commands"
+	"github.com/telekom/aml-jens/internal/errortypes"
+	"github.com/telekom/aml-jens/internal/netlink"
 )
 
-func CreateNftRuleECT(dev string, nftTable string, chainForward string, chainOutput string, ect string, priority string) error {
-	if res := commands.ExecCommand("nft", "add", "table", "inet", nftTable); res.Error() != nil {
-		return res.Error()
-	}
+// Resolution of the random number used to drop packets
+const NFT_LOSS_RESOLUTION = 1000000
 
-	if res := commands.ExecCommand("nft", "add", "chain", "inet", nftTable, chainForward, "{", "type", "filter", "hook", "forward", "priority", priority, ";}"); res.Error() != nil {
-		return res.Error()
-	}
+// ECN codepoints the ECT rules can set
+var ECN_CODEPOINTS = map[string]uint8{
+	"ect1": 0x1,
+	"ect0": 0x2,
+}
 
-	if res := commands.ExecCommand("nft", "add", "chain", "inet", nftTable, chainOutput, "{", "type", "filter", "hook", "output", "priority", priority, ";}"); res.Error() != nil {
-		return res.Error()
+// Replaces nftTable, if any, by one with a forward and an output chain,
+// each holding rule, in one transaction and reads the rules back
+func createNftTable(nftTable string, chainForward string, chainOutput string, priority int32, rule []netlink.Expr) error {
+	c, err := netlink.DialNftables()
+	if err != nil {
+		return err
 	}
-
-	if res := commands.ExecCommand("nft", "add", "rule", "inet", nftTable, chainForward, "ip", "ecn", "set", ect, "oifname", dev); res.Error() != nil {
-		return res.Error()
+	defer c.Close()
+	chains := []netlink.Chain{
+		{Name: chainForward, Hook: netlink.NF_INET_FORWARD, Priority: priority},
+		{Name: chainOutput, Hook: netlink.NF_INET_LOCAL_OUT, Priority: priority},
 	}
-
-	if res := commands.ExecCommand("nft", "add", "rule", "inet", nftTable, chainOutput, "ip", "ecn", "set", ect, "oifname", dev); res.Error() != nil {
-		return res.Error()
+	rules := make([]netlink.Rule, len(chains))
+	for i, chain := range chains {
+		rules[i] = netlink.Rule{Chain: chain.Name, Exprs: rule}
 	}
+	if err := c.ReplaceTable(nftTable, chains, rules); err != nil {
+		return err
+	}
+	return c.VerifyRules(nftTable, rules)
+}
 
+// Sets the ECN field of IPv4 packets leaving dev to ect (ect0, ect1)
+func CreateNftRuleECT(dev string, nftTable string, chainForward string, chainOutput string, ect string, priority int32) error {
+	codepoint, ok := ECN_CODEPOINTS[ect]
+	if !ok {
+		return errortypes.NewUserInputError("unknown ECN codepoint %s", ect)
+	}
+	rule := append(append(netlink.MatchOifname(dev), netlink.MatchIPv4()...), netlink.SetIPv4ECN(codepoint)...)
+	if err := createNftTable(nftTable, chainForward, chainOutput, priority, rule); err != nil {
+		return err
+	}
 	DEBUG.Printf("enabled nft rules for %s %s", nftTable, ect)
 	return nil
 }
 
-func ResetECTMarking(nftTable string) {
-	res := commands.ExecCommand("nft", "delete", "table", "inet", nftTable)
-	err := res.Error()
+// Drops packets leaving dev with the given probability [0,1]
+func CreateNftRuleLoss(dev string, nftTable string, chainForward string, chainOutput string, probability float64, priority int32) error {
+	threshold := uint32(probability * NFT_LOSS_RESOLUTION)
+	rule := append(append(netlink.MatchOifname(dev), netlink.MatchRandomBelow(NFT_LOSS_RESOLUTION, threshold)...), netlink.Drop()...)
+	if err := createNftTable(nftTable, chainForward, chainOutput, priority, rule); err != nil {
+		return err
+	}
+	DEBUG.Printf("enabled nft loss for %s with p=%f", nftTable, probability)
+	return nil
+}
+
+// Deletes nftTable with all its rules, a missing table is not an error
+func ResetECTMarking(nftTable string) error {
+	c, err := netlink.DialNftables()
 	if err != nil {
-		WARN.Println(err)
+		return err
+	}
+	defer c.Close()
+	err = c.DeleteTable(nftTable)
+	if netlink.IsNotExist(err) {
+		return nil
 	}
+	return err
 }
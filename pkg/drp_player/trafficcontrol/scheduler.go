@@ -0,0 +1,124 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package trafficcontrol
+
+import (
+	"time"
+
+	"github.com/telekom/aml-jens/internal/errortypes"
+)
+
+// What the scheduler does with deadlines that passed while the loop was busy
+type CatchUpPolicy string
+
+const (
+	//Missed deadlines are skipped, the pattern advances with them
+	CATCHUP_SKIP CatchUpPolicy = "skip"
+	//Missed deadlines are applied back to back until the schedule is met again
+	CATCHUP_BURST CatchUpPolicy = "burst"
+)
+
+var CATCHUP_POLICIES = []CatchUpPolicy{CATCHUP_SKIP, CATCHUP_BURST}
+
+// Returns the CatchUpPolicy named policy; "" results in CATCHUP_SKIP
+func ParseCatchUpPolicy(policy string) (CatchUpPolicy, error) {
+	if policy == "" {
+		return CATCHUP_SKIP, nil
+	}
+	for _, v := range CATCHUP_POLICIES {
+		if string(v) == policy {
+			return v, nil
+		}
+	}
+	return "", errortypes.NewUserInputError("Unknown catch up policy '%s', expected one of %v", policy, CATCHUP_POLICIES)
+}
+
+// Schedules freq changes per second on deadlines relative to a fixed start.
+//
+// Deadline n is start + n/freq, so errors don't accumulate and freq
+// needs neither be integer nor divide a second into whole ms.
+// Uses the monotonic clock.
+type Scheduler struct {
+	freq   float64
+	policy CatchUpPolicy
+	start  time.Time
+	//Index of the next deadline
+	next  int64
+	timer *time.Timer
+}
+
+// Creates a Scheduler starting now; the first deadline is one period later.
+func NewScheduler(freq float64, policy CatchUpPolicy) *Scheduler {
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	return &Scheduler{
+		freq:   freq,
+		policy: policy,
+		start:  time.Now(),
+		next:   1,
+		timer:  timer,
+	}
+}
+
+// Returns the time between two deadlines
+func (s *Scheduler) Period() time.Duration {
+	return time.Duration(float64(time.Second) / s.freq)
+}
+
+// Returns deadline n
+func (s *Scheduler) Deadline(n int64) time.Time {
+	return s.start.Add(time.Duration(float64(n) * float64(time.Second) / s.freq))
+}
+
+// Blocks until the next deadline or until exit is closed (ok == false).
+//
+// Returns the deadline and how many deadlines were skipped before it.
+// With CATCHUP_SKIP the latest deadline that passed is returned,
+// with CATCHUP_BURST passed deadlines are returned one by one, without waiting.
+func (s *Scheduler) Wait(exit <-chan uint8) (deadline time.Time, skipped int64, ok bool) {
+	n := s.next
+	if s.policy == CATCHUP_SKIP {
+		if late := time.Since(s.Deadline(n)); late > 0 {
+			skipped = int64(float64(late) * s.freq / float64(time.Second))
+			n += skipped
+		}
+	}
+	s.next = n + 1
+	deadline = s.Deadline(n)
+	wait := time.Until(deadline)
+	if wait <= 0 {
+		select {
+		case <-exit:
+			return deadline, skipped, false
+		default:
+			return deadline, skipped, true
+		}
+	}
+	s.timer.Reset(wait)
+	select {
+	case <-exit:
+		s.timer.Stop()
+		return deadline, skipped, false
+	case <-s.timer.C:
+		return deadline, skipped, true
+	}
+}
@@ -0,0 +1,173 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package trafficcontrol
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSchedulerDeadline(t *testing.T) {
+	s := NewScheduler(3, CATCHUP_SKIP)
+	if got := s.Deadline(3).Sub(s.start); got != time.Second {
+		t.Fatalf("Deadline 3 @3Hz is %s after start, want 1s", got)
+	}
+	s = NewScheduler(1000, CATCHUP_SKIP)
+	if got := s.Deadline(123456).Sub(s.start); got != 123456*time.Millisecond {
+		t.Fatalf("Deadline 123456 @1kHz drifted: %s", got)
+	}
+}
+
+func TestSchedulerWait(t *testing.T) {
+	s := NewScheduler(200, CATCHUP_SKIP)
+	exit := make(chan uint8)
+	for i := 0; i < 5; i++ {
+		deadline, skipped, ok := s.Wait(exit)
+		if !ok || skipped != 0 {
+			t.Fatalf("Wait %d: ok %t, skipped %d", i, ok, skipped)
+		}
+		if time.Now().Before(deadline) {
+			t.Fatalf("Wait %d returned before its deadline", i)
+		}
+	}
+	close(exit)
+	if _, _, ok := s.Wait(exit); ok {
+		t.Fatal("Wait did not notice exit")
+	}
+}
+
+func TestSchedulerCatchUp(t *testing.T) {
+	exit := make(chan uint8)
+	//10.5 periods late
+	skip := NewScheduler(100, CATCHUP_SKIP)
+	skip.start = skip.start.Add(-105 * time.Millisecond)
+	deadline, skipped, ok := skip.Wait(exit)
+	if !ok || skipped != 9 || deadline != skip.Deadline(10) {
+		t.Fatalf("skip: skipped %d, deadline %s after start", skipped, deadline.Sub(skip.start))
+	}
+	burst := NewScheduler(100, CATCHUP_BURST)
+	burst.start = burst.start.Add(-105 * time.Millisecond)
+	begin := time.Now()
+	for n := int64(1); n <= 10; n++ {
+		deadline, skipped, ok := burst.Wait(exit)
+		if !ok || skipped != 0 || deadline != burst.Deadline(n) {
+			t.Fatalf("burst %d: skipped %d, deadline %s after start", n, skipped, deadline.Sub(burst.start))
+		}
+	}
+	if waited := time.Since(begin); waited > 5*time.Millisecond {
+		t.Fatalf("burst waited %s for passed deadlines", waited)
+	}
+}
+
+func TestParseCatchUpPolicy(t *testing.T) {
+	if policy, err := ParseCatchUpPolicy(""); err != nil || policy != CATCHUP_SKIP {
+		t.Fatalf("Default policy: %s, %v", policy, err)
+	}
+	if policy, err := ParseCatchUpPolicy("burst"); err != nil || policy != CATCHUP_BURST {
+		t.Fatalf("burst: %s, %v", policy, err)
+	}
+	if _, err := ParseCatchUpPolicy("drop"); err == nil {
+		t.Fatal("Unknown policy was accepted")
+	}
+}
+
+func TestTimingRecorder(t *testing.T) {
+	var timing TimingRecorder
+	start := time.Now()
+	for i := 1; i <= 100; i++ {
+		deadline := start.Add(time.Duration(i) * 10 * time.Millisecond)
+		timing.Record(deadline, deadline.Add(time.Duration(i)*time.Microsecond), int64(i%2))
+	}
+	stats := timing.Stats()
+	if stats.Changes != 100 || stats.Skipped != 50 {
+		t.Fatalf("Counted %d changes, %d skipped", stats.Changes, stats.Skipped)
+	}
+	if stats.P50 != 50*time.Microsecond || stats.P99 != 99*time.Microsecond || stats.Max != 100*time.Microsecond {
+		t.Fatalf("Percentiles: %s", stats)
+	}
+	if stats.Mean != 50500*time.Nanosecond {
+		t.Fatalf("Mean lateness %s", stats.Mean)
+	}
+	if stats.Jitter < 28*time.Microsecond || stats.Jitter > 29*time.Microsecond {
+		t.Fatalf("Jitter %s", stats.Jitter)
+	}
+}
+
+func TestTimingRecorder_percentileBuckets(t *testing.T) {
+	var timing TimingRecorder
+	start := time.Now()
+	for i := 1; i <= 1000; i++ {
+		timing.Record(start, start.Add(time.Duration(i)*time.Millisecond), 0)
+	}
+	stats := timing.Stats()
+	//Bucketed above 64µs: at most 1/64 below the exact value
+	for _, c := range []struct {
+		got, want time.Duration
+	}{{stats.P50, 500 * time.Millisecond}, {stats.P95, 950 * time.Millisecond}, {stats.P99, 990 * time.Millisecond}} {
+		if c.got > c.want || c.got < c.want-c.want/64 {
+			t.Fatalf("Percentile %s, want ~%s", c.got, c.want)
+		}
+	}
+	if stats.Max != time.Second {
+		t.Fatalf("Max %s", stats.Max)
+	}
+	var early TimingRecorder
+	early.Record(start, start.Add(-time.Millisecond), 0)
+	if stats := early.Stats(); stats.P50 != -time.Millisecond || stats.Mean != -time.Millisecond {
+		t.Fatalf("Early change: %s", stats)
+	}
+}
+
+func TestTimingWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "timing.csv")
+	w, err := NewTimingWriter(path, "ue", "direction")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var uplink, downlink TimingRecorder
+	uplink.WriteTo(w, "0", "uplink")
+	downlink.WriteTo(w, "0", "downlink")
+	start := time.Now()
+	for i := 1; i <= 100; i++ {
+		deadline := start.Add(time.Duration(i) * 10 * time.Millisecond)
+		uplink.Record(deadline, deadline.Add(time.Duration(i)*time.Microsecond), int64(i%2))
+		downlink.Record(deadline, deadline, 0)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 201 || lines[0] != "ue,direction,deadlineUs,appliedUs,latenessUs,skipped" {
+		t.Fatalf("Unexpected csv of %d lines, heading: %s", len(lines), lines[0])
+	}
+	if !strings.HasPrefix(lines[1], "0,uplink,") || !strings.HasSuffix(lines[1], ",1,1") ||
+		!strings.HasPrefix(lines[2], "0,downlink,") || !strings.HasSuffix(lines[2], ",0,0") {
+		t.Fatalf("Unexpected csv, first lines: %s %s", lines[1], lines[2])
+	}
+}
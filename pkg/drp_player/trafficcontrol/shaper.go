@@ -0,0 +1,225 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package trafficcontrol
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/telekom/aml-jens/internal/assets"
+	"github.com/telekom/aml-jens/internal/commands"
+	"github.com/telekom/aml-jens/internal/netlink"
+	"github.com/telekom/aml-jens/pkg/drp"
+)
+
+// Queue of qdiscs on dev, shared by the janz and the fallback backends:
+// redirect of the downlink to ifb, nft marking and loss, and the
+// netem impairment stage in front of the queue.
+type shaper struct {
+	dev     string
+	ifindex int
+	handle  uint16
+	//If set, the ingress of dev is redirected to ifb and shaped there
+	ifb          string
+	ingress_dev  string
+	nft          NftStartParams
+	current_loss float64
+	//If set, a netem qdisc (NetemHandle) is the root and the queue its child
+	impaired bool
+}
+
+// Redirects the ingress to ifb if needed, enables nft premarking,
+// resets the root qdisc of dev and adds the netem stage if params impair.
+func (s *shaper) setup(dev string, params TrafficControlStartParams, nft NftStartParams) error {
+	if s.ifb != "" {
+		if err := SetupIfb(dev, s.ifb); err != nil {
+			return fmt.Errorf("could not redirect ingress of %s to %s: %w", dev, s.ifb, err)
+		}
+		s.ingress_dev = dev
+		dev = s.ifb
+	}
+	s.dev = dev
+	s.nft = nft
+	var err error
+	if s.ifindex, err = netlink.LinkIndex(dev); err != nil {
+		return err
+	}
+	if nft.L4sPremarking {
+		err := CreateNftRuleECT(s.dev, s.table(assets.NFT_TABLE_PREMARK), assets.NFT_CHAIN_FORWARD, assets.NFT_CHAIN_OUTPUT, "ect1", 0)
+		if err != nil {
+			return err
+		}
+	} else if err := ResetECTMarking(s.table(assets.NFT_TABLE_PREMARK)); err != nil {
+		return fmt.Errorf("could not remove premarking: %w", err)
+	}
+	if err := s.reset(); err != nil {
+		return fmt.Errorf("could not reset the qdisc of %s: %w", s.dev, err)
+	}
+	if params.Impairment != nil {
+		if err := s.addQdiscWithOptions(s.netemQdisc(), netemOptions(*params.Impairment)); err != nil {
+			return fmt.Errorf("could not add netem impairment: %w", err)
+		}
+		s.impaired = true
+	}
+	return nil
+}
+
+// Returns the nft table of this qdisc, tables of
+// further UEs are suffixed by their handle
+func (s *shaper) table(name string) string {
+	if s.handle == JANZ_HANDLE_UPLINK {
+		return name
+	}
+	return fmt.Sprintf("%s_%x", name, s.handle)
+}
+
+func (s *shaper) handleArg() string {
+	return fmt.Sprintf("%x:", s.handle)
+}
+
+// Returns where the queue is attached: root, or below netem if impaired
+func (s *shaper) parentArgs() []string {
+	if s.impaired {
+		return []string{"parent", fmt.Sprintf("%x:1", NetemHandle(s.handle))}
+	}
+	return []string{"root"}
+}
+
+// Returns the queue qdisc of kind as setup attaches it
+func (s *shaper) qdisc(kind string) netlink.Qdisc {
+	parent := netlink.TC_H_ROOT
+	if s.impaired {
+		parent = netlink.MakeHandle(NetemHandle(s.handle), 1)
+	}
+	return netlink.Qdisc{Ifindex: s.ifindex, Handle: netlink.MakeHandle(s.handle, 0), Parent: parent, Kind: kind}
+}
+
+func (s *shaper) netemQdisc() netlink.Qdisc {
+	return netlink.Qdisc{Ifindex: s.ifindex, Handle: netlink.MakeHandle(NetemHandle(s.handle), 0), Parent: netlink.TC_H_ROOT, Kind: "netem"}
+}
+
+// Adds a qdisc with tc args and verifies it reads back as want
+func (s *shaper) addQdisc(want netlink.Qdisc, args []string) error {
+	DEBUG.Printf("Starting tc: %+v", args)
+	if err := commands.ExecCommand("tc", args...).Error(); err != nil {
+		return err
+	}
+	c, err := netlink.DialRoute()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	return c.VerifyQdisc(want)
+}
+
+// Adds a qdisc configured with options and verifies it reads back
+func (s *shaper) addQdiscWithOptions(q netlink.Qdisc, options netlink.QdiscOptions) error {
+	c, err := netlink.DialRoute()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if err := c.AddQdiscWithOptions(q, options); err != nil {
+		return err
+	}
+	return c.VerifyQdisc(q)
+}
+
+// Changes the options of the qdisc q
+func (s *shaper) changeQdisc(q netlink.Qdisc, options netlink.QdiscOptions) error {
+	c, err := netlink.DialRoute()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	return c.ChangeQdisc(q, options)
+}
+
+// Rests Qdisc to default, there being none to delete is not an error
+func (s *shaper) reset() error {
+	c, err := netlink.DialRoute()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	err = c.DeleteQdisc(netlink.Qdisc{Ifindex: s.ifindex, Parent: netlink.TC_H_ROOT})
+	if netlink.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *shaper) ChangeImpairment(imp drp.Impairment) error {
+	return s.changeQdisc(s.netemQdisc(), netemOptions(imp))
+}
+
+func (s *shaper) ChangeLoss(probability float64) error {
+	if s.ifb != "" {
+		//Redirected ingress traffic does not pass the nft forward/output chains
+		if probability > 0 {
+			WARN.Printf("Loss is not supported on the downlink, ignoring %g", probability)
+		}
+		return nil
+	}
+	var err error
+	if probability > 0 {
+		err = CreateNftRuleLoss(s.dev, s.table(assets.NFT_TABLE_LOSS), assets.NFT_CHAIN_FORWARD, assets.NFT_CHAIN_OUTPUT, probability, 0)
+	} else {
+		err = ResetECTMarking(s.table(assets.NFT_TABLE_LOSS))
+	}
+	if err != nil {
+		return err
+	}
+	s.current_loss = probability
+	return nil
+}
+
+func (s *shaper) SignalStart() error {
+	if !s.nft.SignalStart {
+		return nil
+	}
+	err := CreateNftRuleECT(s.dev, s.table(assets.NFT_TABLE_SIGNAL), assets.NFT_CHAIN_FORWARD, assets.NFT_CHAIN_OUTPUT, "ect0", 1)
+	if err != nil {
+		return err
+	}
+	<-time.NewTimer(200 * time.Millisecond).C
+	return ResetECTMarking(s.table(assets.NFT_TABLE_SIGNAL))
+}
+
+// Removes the nft tables, the qdiscs of dev and the ifb redirect
+func (s *shaper) teardown() {
+	if s.nft.L4sPremarking {
+		logReset("NftReset", ResetECTMarking(s.table(assets.NFT_TABLE_PREMARK)))
+	}
+	if s.nft.SignalStart {
+		logReset("NftReset", ResetECTMarking(s.table(assets.NFT_TABLE_SIGNAL)))
+	}
+	if s.current_loss > 0 {
+		logReset("NftReset", ResetECTMarking(s.table(assets.NFT_TABLE_LOSS)))
+	}
+	if err := s.reset(); err != nil {
+		WARN.Printf("TcReset: %v", err)
+	}
+	if s.ingress_dev != "" {
+		ResetIfb(s.ingress_dev, s.ifb)
+	}
+}
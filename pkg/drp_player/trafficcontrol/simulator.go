@@ -0,0 +1,452 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package trafficcontrol
+
+import (
+	"encoding/binary"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/telekom/aml-jens/pkg/drp"
+)
+
+// ECN codepoints
+const (
+	ecn_not_ect byte = 0
+	ecn_ect1    byte = 1
+	ecn_ect0    byte = 2
+	ecn_ce      byte = 3
+)
+
+// Record flags and types (see measuresession.RecordArray)
+const (
+	record_type_q byte = 6
+	record_type_p byte = 7
+	//Queue record with the drops and ECN marks since the previous one, see qdiscBackend
+	record_type_stats  byte = 8
+	record_ecn_valid   byte = 1 << 2
+	record_sojourn_mrk byte = 1 << 6
+	record_sojourn_drp byte = 1 << 7
+)
+
+// Parameters of the Simulator and the traffic offered to it
+type SimulatorParams struct {
+	// Round trip time of the simulated flows without queuing delay
+	BaseRtt time.Duration
+	// Number of greedy scalable flows (ECT(1), reducing per mark, e.g. Prague)
+	ScalableFlows int
+	// Number of greedy classic flows (ECT(0), halving per mark, e.g. Reno)
+	ClassicFlows int
+	// Duration of a single step of the fluid model
+	Step time.Duration
+	// Interval of Q records
+	QueueInterval time.Duration
+	// Size of the simulated packets in byte
+	PacketSize int
+}
+
+func DefaultSimulatorParams() SimulatorParams {
+	return SimulatorParams{
+		BaseRtt:       20 * time.Millisecond,
+		ScalableFlows: 1,
+		ClassicFlows:  1,
+		Step:          time.Millisecond,
+		QueueInterval: 10 * time.Millisecond,
+		PacketSize:    1500,
+	}
+}
+
+// A greedy flow of the Simulator
+type simFlow struct {
+	scalable bool
+	src_port uint16
+	//Congestion window in packets
+	cwnd float64
+	//Bytes in the queue
+	backlog float64
+	//Bytes dequeued/dropped, but not yet emitted as a record
+	sent    float64
+	dropped float64
+	//Fractions of marked/lost packets not yet applied
+	mark_credit float64
+	loss_credit float64
+	//Fraction of a packet not yet passed through the impairment stage
+	impair_credit float64
+}
+
+func (f *simFlow) ecn() byte {
+	if f.scalable {
+		return ecn_ect1
+	}
+	return ecn_ect0
+}
+
+// Userspace fluid-model of a rate limited queue with markfree/markfull ECN marking.
+//
+// The queue is filled by greedy scalable and classic flows reacting to its
+// marks and drops. It emits the same 64 byte P/Q records as the janz qdisc,
+// so everything behind the Backend can be run without root or kernel module.
+type Simulator struct {
+	params SimulatorParams
+	mutex  sync.Mutex
+	//Settings of the queue, Datarate is ignored in favor of rate
+	queue TrafficControlStartParams
+	//kbit/s
+	rate float64
+	loss float64
+	//Impairment stage, nil for none
+	impairment *impairmentModel
+	flows      []*simFlow
+	//Simulated time since Init
+	now    time.Duration
+	next_q time.Duration
+	//MonotonicNs at Init
+	start_ns uint64
+	records  chan []byte
+	overflow uint64
+	done     chan struct{}
+	close    sync.Once
+	wg       sync.WaitGroup
+}
+
+func NewSimulator(params SimulatorParams) *Simulator {
+	s := &Simulator{
+		params:  params,
+		records: make(chan []byte, 10000),
+		done:    make(chan struct{}),
+	}
+	for i := 0; i < params.ScalableFlows+params.ClassicFlows; i++ {
+		s.flows = append(s.flows, &simFlow{
+			scalable: i < params.ScalableFlows,
+			src_port: uint16(5001 + i),
+			cwnd:     10,
+		})
+	}
+	return s
+}
+
+func (s *Simulator) Name() string {
+	return BACKEND_SIM
+}
+
+// Starts the simulation, dev and nft are ignored
+func (s *Simulator) Init(dev string, params TrafficControlStartParams, nft NftStartParams) error {
+	s.queue = params
+	s.rate = float64(params.Datarate)
+	if params.Impairment != nil {
+		s.impairment = newImpairmentModel(*params.Impairment, time.Now().UnixNano())
+	}
+	s.start_ns = MonotonicNs()
+	s.wg.Add(1)
+	go s.run()
+	return nil
+}
+
+// Steps the model in real time until Close is called
+func (s *Simulator) run() {
+	defer s.wg.Done()
+	start := time.Now()
+	ticker := time.NewTicker(s.params.Step)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.mutex.Lock()
+			elapsed := time.Since(start)
+			if elapsed-s.now > time.Second {
+				WARN.Printf("Simulator is lagging %s behind, skipping", elapsed-s.now)
+				s.now = elapsed - s.params.Step
+			}
+			for s.now+s.params.Step <= elapsed {
+				s.step(s.params.Step)
+			}
+			s.mutex.Unlock()
+		}
+	}
+}
+
+// Returns the sojourn time of the queue in ms
+func (s *Simulator) sojournMs() float64 {
+	if s.rate <= 0 {
+		return 0
+	}
+	backlog := 0.0
+	for _, f := range s.flows {
+		backlog += f.backlog
+	}
+	return backlog*8/s.rate + float64(s.queue.AddonLatency)
+}
+
+// Returns the probability of marking a packet with the given sojourn time,
+// linearly increasing from 0 at markfree to 1 at markfull
+func (s *Simulator) markProbability(sojournMs float64) float64 {
+	free, full := float64(s.queue.Markfree), float64(s.queue.Markfull)
+	if full <= 0 {
+		return 0
+	}
+	if full <= free {
+		if sojournMs >= full {
+			return 1
+		}
+		return 0
+	}
+	return math.Min(1, math.Max(0, (sojournMs-free)/(full-free)))
+}
+
+// Advances the model by dt
+func (s *Simulator) step(dt time.Duration) {
+	s.now += dt
+	size := float64(s.params.PacketSize)
+	sojourn := s.sojournMs()
+	p := s.markProbability(sojourn)
+	limit := math.Inf(1)
+	if s.queue.QueueSize > 0 {
+		limit = float64(s.queue.QueueSize) * size
+	}
+	backlog := 0.0
+	for _, f := range s.flows {
+		backlog += f.backlog
+	}
+	//Enqueue
+	for _, f := range s.flows {
+		rtt := s.params.BaseRtt.Seconds() + sojourn/1000
+		if s.impairment != nil {
+			rtt += s.impairment.delayMs() / 1000
+		}
+		arriving := f.cwnd * size / rtt * dt.Seconds()
+		lost := arriving * s.loss
+		if s.impairment != nil {
+			lost = s.impair(f, arriving)
+		}
+		arriving -= lost
+		f.loss_credit += lost / size
+		if excess := backlog + arriving - limit; excess > 0 {
+			excess = math.Min(excess, arriving)
+			arriving -= excess
+			f.dropped += excess
+			f.loss_credit += excess / size
+		}
+		f.backlog += arriving
+		backlog += arriving
+	}
+	//Dequeue (fluid FIFO: every flow in proportion to its backlog)
+	capacity := s.rate * 1000 / 8 * dt.Seconds()
+	departing := math.Min(capacity, backlog)
+	for _, f := range s.flows {
+		if backlog <= 0 {
+			break
+		}
+		dep := departing * f.backlog / backlog
+		f.backlog -= dep
+		f.sent += dep
+		s.react(f, dep/size, p)
+	}
+	s.emitPackets(sojourn, p)
+	if s.now >= s.next_q {
+		s.next_q = s.now + s.params.QueueInterval
+		s.emit(s.queueRecord(backlog - departing))
+	}
+}
+
+// Passes the bytes arriving from f through the impairment stage,
+// packet by packet. Returns the bytes lost.
+func (s *Simulator) impair(f *simFlow, arriving float64) float64 {
+	size := float64(s.params.PacketSize)
+	lost := 0.0
+	for f.impair_credit += arriving / size; f.impair_credit >= 1; f.impair_credit-- {
+		if s.impairment.lost() {
+			lost += size
+		}
+	}
+	return math.Min(lost, arriving)
+}
+
+// Adapts the congestion window of f to acked packets with marking probability p
+func (s *Simulator) react(f *simFlow, acked float64, p float64) {
+	if f.scalable {
+		f.cwnd += acked/f.cwnd - acked*p/2
+	} else {
+		f.cwnd += acked/f.cwnd - acked*p*p*f.cwnd/2
+	}
+	if f.loss_credit >= 1 {
+		f.cwnd /= 2
+		f.loss_credit = 0
+	}
+	f.cwnd = math.Max(2, f.cwnd)
+}
+
+// Emits a P record for every complete packet dequeued or dropped
+func (s *Simulator) emitPackets(sojourn float64, p float64) {
+	size := float64(s.params.PacketSize)
+	for _, f := range s.flows {
+		mark := p
+		if !f.scalable {
+			mark = p * p
+		}
+		for f.sent >= size {
+			f.sent -= size
+			f.mark_credit += mark
+			ecn_out := f.ecn()
+			if f.mark_credit >= 1 {
+				f.mark_credit--
+				ecn_out = ecn_ce
+			}
+			s.emit(s.packetRecord(f, sojourn, ecn_out, false))
+		}
+		for f.dropped >= size {
+			f.dropped -= size
+			s.emit(s.packetRecord(f, sojourn, f.ecn(), true))
+		}
+	}
+}
+
+// Returns a new record of type_id at the current simulated time
+func (s *Simulator) newRecord(type_id byte) []byte {
+	record := make([]byte, RECORD_SIZE)
+	binary.LittleEndian.PutUint64(record[0:8], s.start_ns+uint64(s.now.Nanoseconds()))
+	record[8] = type_id
+	return record
+}
+
+func (s *Simulator) packetRecord(f *simFlow, sojournMs float64, ecn_out byte, drop bool) []byte {
+	record := s.newRecord(record_type_p)
+	record[9] = f.ecn() | record_ecn_valid | ecn_out<<3
+	if ecn_out == ecn_ce {
+		record[9] |= record_sojourn_mrk
+	}
+	if drop {
+		record[9] |= record_sojourn_drp
+	}
+	binary.LittleEndian.PutUint32(record[12:16], uint32(sojournMs*1000))
+	//IPv4 mapped addresses 10.0.0.1 -> 10.0.0.2
+	record[26], record[27] = 0xff, 0xff
+	copy(record[28:32], []byte{10, 0, 0, 1})
+	record[42], record[43] = 0xff, 0xff
+	copy(record[44:48], []byte{10, 0, 0, 2})
+	binary.LittleEndian.PutUint32(record[48:52], uint32(s.params.PacketSize))
+	record[52] = 4
+	record[53] = 6
+	binary.LittleEndian.PutUint16(record[54:56], f.src_port)
+	binary.LittleEndian.PutUint16(record[56:58], 443)
+	return record
+}
+
+func (s *Simulator) queueRecord(backlog float64) []byte {
+	record := s.newRecord(record_type_q)
+	binary.LittleEndian.PutUint16(record[10:12], uint16(math.Min(backlog/float64(s.params.PacketSize), math.MaxUint16)))
+	binary.LittleEndian.PutUint32(record[12:16], uint32(backlog))
+	binary.LittleEndian.PutUint64(record[16:24], uint64(s.rate*1000))
+	return record
+}
+
+// Queues record for OpenRecords; drops it if nobody is reading
+func (s *Simulator) emit(record []byte) {
+	select {
+	case s.records <- record:
+	default:
+		s.overflow++
+	}
+}
+
+func (s *Simulator) ChangeRate(rate float64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.rate = rate
+	return nil
+}
+
+func (s *Simulator) ChangeParams(params TrafficControlStartParams) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.queue = params
+	return nil
+}
+
+func (s *Simulator) ChangeLoss(probability float64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.loss = probability
+	return nil
+}
+
+func (s *Simulator) ChangeImpairment(imp drp.Impairment) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.impairment == nil {
+		s.impairment = newImpairmentModel(imp, time.Now().UnixNano())
+	}
+	s.impairment.impairment = imp
+	return nil
+}
+
+// No-op, the simulated flows start with the simulation
+func (s *Simulator) SignalStart() error {
+	return nil
+}
+
+func (s *Simulator) OpenRecords() (RecordReader, error) {
+	return &simRecordReader{records: s.records}, nil
+}
+
+func (s *Simulator) Close() error {
+	s.close.Do(func() {
+		close(s.done)
+		s.wg.Wait()
+		if s.overflow > 0 {
+			WARN.Printf("Simulator dropped %d records nobody read", s.overflow)
+		}
+	})
+	return nil
+}
+
+// Reads the records emitted by a Simulator
+type simRecordReader struct {
+	records chan []byte
+}
+
+func (r *simRecordReader) ReadRecord(buf []byte, timeout time.Duration) (int, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case record := <-r.records:
+		return copy(buf, record), nil
+	case <-timer.C:
+		return 0, nil
+	}
+}
+
+func (r *simRecordReader) Discard() error {
+	for {
+		select {
+		case <-r.records:
+		default:
+			return nil
+		}
+	}
+}
+
+func (r *simRecordReader) Close() error {
+	return nil
+}
@@ -0,0 +1,165 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package trafficcontrol
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/telekom/aml-jens/internal/persistence/datatypes"
+)
+
+// Steps s for d and returns all emitted records
+func stepSimulator(s *Simulator, d time.Duration) [][]byte {
+	res := make([][]byte, 0)
+	for end := s.now + d; s.now < end; {
+		s.step(s.params.Step)
+		for len(s.records) > 0 {
+			res = append(res, <-s.records)
+		}
+	}
+	return res
+}
+
+func TestSimulator(t *testing.T) {
+	s := NewSimulator(DefaultSimulatorParams())
+	s.queue = TrafficControlStartParams{Datarate: 10000, QueueSize: 10000, Markfree: 4, Markfull: 14}
+	s.rate = 10000
+	//warm up
+	stepSimulator(s, 5*time.Second)
+	records := stepSimulator(s, 5*time.Second)
+	var bytes, packets, marked, queue_records int
+	var sojourn_us uint64
+	for _, record := range records {
+		if len(record) != RECORD_SIZE {
+			t.Fatalf("Record has %d bytes", len(record))
+		}
+		switch record[8] {
+		case record_type_p:
+			if record[9]&record_sojourn_drp != 0 {
+				continue
+			}
+			packets++
+			bytes += int(binary.LittleEndian.Uint32(record[48:52]))
+			sojourn_us += uint64(binary.LittleEndian.Uint32(record[12:16]))
+			if (record[9]&24)>>3 == ecn_ce {
+				marked++
+			}
+		case record_type_q:
+			queue_records++
+			if rate := binary.LittleEndian.Uint64(record[16:24]); rate != 10000*1000 {
+				t.Fatalf("Q record has rate %d", rate)
+			}
+		default:
+			t.Fatalf("Unknown record type %d", record[8])
+		}
+	}
+	if queue_records != 500 {
+		t.Fatalf("Expected a Q record every 10ms, got %d", queue_records)
+	}
+	if kbits := bytes * 8 / 1000 / 5; kbits < 9500 || kbits > 10000 {
+		t.Fatalf("Expected the link to be utilized, got %d kbit/s", kbits)
+	}
+	if avg := float64(sojourn_us) / float64(packets) / 1000; avg < 4 || avg > 14 {
+		t.Fatalf("Expected sojourn time between markfree and markfull, got %fms", avg)
+	}
+	if marked == 0 {
+		t.Fatal("Expected marked packets")
+	}
+}
+
+func TestSimulatorRateChange(t *testing.T) {
+	s := NewSimulator(DefaultSimulatorParams())
+	s.queue = TrafficControlStartParams{Datarate: 20000, QueueSize: 100, Markfree: 4, Markfull: 14}
+	s.rate = 20000
+	stepSimulator(s, 5*time.Second)
+	s.rate = 2000
+	dropped := 0
+	for _, record := range stepSimulator(s, 5*time.Second) {
+		if record[8] == record_type_p && record[9]&record_sojourn_drp != 0 {
+			dropped++
+		}
+	}
+	if s.sojournMs() > 14 {
+		t.Fatalf("Flows did not adapt to the lower rate, sojourn is %fms", s.sojournMs())
+	}
+	if dropped > 100 {
+		t.Fatalf("Expected flows to react to marks instead of drops, got %d drops", dropped)
+	}
+}
+
+func TestNewBackend(t *testing.T) {
+	for name, expected := range map[string]string{"": BACKEND_JANZ, "janz": BACKEND_JANZ, "SIM": BACKEND_SIM, "htb": BACKEND_HTB, "fq_codel": BACKEND_FQ_CODEL} {
+		backend, err := NewBackend(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if backend.Name() != expected {
+			t.Fatalf("NewBackend(%s) returned %s", name, backend.Name())
+		}
+	}
+	for _, name := range []string{"pfifo", BACKEND_AUTO} {
+		if _, err := NewBackend(name); err == nil {
+			t.Fatalf("Expected error for backend %s", name)
+		}
+	}
+}
+
+func TestNewUeBackend(t *testing.T) {
+	backend, err := NewUeBackend(BACKEND_JANZ, 0, datatypes.DIRECTION_DOWNLINK, DEFAULT_IFB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	janz := backend.(*janzBackend)
+	if janz.handle != JANZ_HANDLE_DOWNLINK || janz.ifb != DEFAULT_IFB || janz.handleArg() != "2:" {
+		t.Fatalf("Downlink janz is not set up for ifb: %+v", janz)
+	}
+	if JanzCtrlFile(JANZ_HANDLE_UPLINK) != "/sys/kernel/debug/sch_janz/0001:v1" ||
+		JanzMeasureFile(JANZ_HANDLE_DOWNLINK) != "/sys/kernel/debug/sch_janz/0002:0" {
+		t.Fatalf("Unexpected debugfs files %s, %s", JanzCtrlFile(JANZ_HANDLE_UPLINK), JanzMeasureFile(JANZ_HANDLE_DOWNLINK))
+	}
+	if backend, _ := NewUeBackend(BACKEND_SIM, 0, datatypes.DIRECTION_DOWNLINK, DEFAULT_IFB); backend.Name() != BACKEND_SIM {
+		t.Fatalf("Expected simulated downlink, got %s", backend.Name())
+	}
+}
+
+func TestJanzHandle(t *testing.T) {
+	for _, c := range []struct {
+		ue        int
+		direction string
+		expected  uint16
+	}{
+		{0, datatypes.DIRECTION_UPLINK, 1},
+		{0, datatypes.DIRECTION_DOWNLINK, 2},
+		{1, datatypes.DIRECTION_UPLINK, 3},
+		{2, datatypes.DIRECTION_DOWNLINK, 6},
+	} {
+		if h := JanzHandle(c.ue, c.direction); h != c.expected {
+			t.Fatalf("JanzHandle(%d, %s) = %d, expected %d", c.ue, c.direction, h, c.expected)
+		}
+	}
+	backend, _ := NewUeBackend(BACKEND_JANZ, 1, datatypes.DIRECTION_UPLINK, DEFAULT_IFB)
+	if janz := backend.(*janzBackend); janz.ifb != "" || janz.handleArg() != "3:" {
+		t.Fatalf("Uplink of ue1 is not set up correctly: %+v", janz)
+	}
+}
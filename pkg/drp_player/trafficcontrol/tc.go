@@ -22,15 +22,14 @@
 package trafficcontrol
 
 import (
-	"encoding/binary"
 	"fmt"
 
-	"github.com/telekom/aml-jens/internal/assets"
-	"github.com/telekom/aml-jens/internal/commands"
+	"github.com/telekom/aml-jens/internal/netlink"
 	"github.com/telekom/aml-jens/internal/persistence/datatypes"
 	"github.com/telekom/aml-jens/internal/util"
+	"github.com/telekom/aml-jens/pkg/drp"
 
-	"os"
+	"sync"
 	"time"
 
 	"github.com/telekom/aml-jens/internal/errortypes"
@@ -39,8 +38,6 @@ import (
 
 var DEBUG, INFO, WARN, FATAL = logging.GetLogger()
 
-const CTRL_FILE = "/sys/kernel/debug/sch_janz/0001:v1"
-
 type TrafficControlStartParams struct {
 	Datarate     uint32
 	QueueSize    int
@@ -48,6 +45,8 @@ type TrafficControlStartParams struct {
 	Markfree     int
 	Markfull     int
 	Qosmode      uint8
+	//Random loss and jitter stage in front of the queue, nil for none
+	Impairment *drp.Impairment
 }
 type NftStartParams struct {
 	L4sPremarking bool
@@ -73,81 +72,73 @@ func (p TrafficControlStartParams) validate() error {
 	if p.Qosmode < 0 || p.Qosmode > 2 {
 		return errortypes.NewUserInputError("valid values for qosmode are 0,1,2")
 	}
+	if p.Impairment != nil {
+		return p.Impairment.Validate()
+	}
 
 	return nil
 }
 
-func (p TrafficControlStartParams) asArgs() []string {
-	args := make([]string, 0, 5)
-	args = append(args, "rate", fmt.Sprintf("%dkbit", p.Datarate))
-
-	if p.QueueSize > 0 {
-		args = append(args, "limit", fmt.Sprintf("%d", p.QueueSize))
-	}
-	if p.AddonLatency > 0 {
-		args = append(args, "extralatency", fmt.Sprintf("%dms", p.AddonLatency))
-	}
-	if p.Markfree > 0 {
-		args = append(args, "markfree", fmt.Sprintf("%dms", p.Markfree))
-	}
-	if p.Markfull > 0 {
-		args = append(args, "markfull", fmt.Sprintf("%dms", p.Markfull))
+// Returns the options of the janz qdisc applying p; all but the
+// queue size are set explicitly, so a change to 0 is applied too
+func (p TrafficControlStartParams) janzOptions() netlink.JanzOptions {
+	return netlink.JanzOptions{
+		Rate:         uint64(p.Datarate) * 1000 / 8,
+		Limit:        uint32(util.MaxInt(p.QueueSize, 0)),
+		ExtraLatency: time.Duration(p.AddonLatency) * time.Millisecond,
+		Markfree:     time.Duration(p.Markfree) * time.Millisecond,
+		Markfull:     time.Duration(p.Markfull) * time.Millisecond,
+		Qosmode:      uint32(p.Qosmode),
 	}
-	if p.Qosmode > 0 {
-		args = append(args, "qosmode", fmt.Sprintf("%d", p.Qosmode))
-	}
-
-	return args
 }
 
 type TrafficControl struct {
 	dev               string
+	backend           Backend
 	current_data_rate float64
-	control_file      *os.File
-	nft               NftStartParams
+	//Parameters the qdisc is currently configured with
+	params TrafficControlStartParams
+	//Parameters passed to Init
+	session_params TrafficControlStartParams
+	current_loss   float64
+	//Impairment currently applied, if params has an impairment stage
+	current_impairment drp.Impairment
+	//Guards the pattern and settings against the control api
+	mutex   sync.Mutex
+	control loopControl
+	//What happens to deadlines missed by the change loop
+	catch_up CatchUpPolicy
+	timing   TimingRecorder
 }
 
-func NewTrafficControl(dev string) *TrafficControl {
+func NewTrafficControl(dev string, backend Backend) *TrafficControl {
 	tc := &TrafficControl{
-		dev: dev,
+		dev:      dev,
+		backend:  backend,
+		catch_up: CATCHUP_SKIP,
 	}
 	return tc
 }
 
-// Init sets NFT and TC to workable state, connects to custom qdisk.
+// Init sets the backend to a workable state (e.g. NFT and TC for janz).
 // After calling Init Close has to be called.
 func (tc *TrafficControl) Init(params TrafficControlStartParams, nft NftStartParams) error {
-	ResetECTMarking(assets.NFT_TABLE_PREMARK)
-	if nft.L4sPremarking {
-		err := CreateNftRuleECT(tc.dev, assets.NFT_TABLE_PREMARK, assets.NFT_CHAIN_FORWARD, assets.NFT_CHAIN_OUTPUT, "ect1", "0")
-		if err != nil {
-			return err
-		}
-	}
-
 	if err := params.validate(); err != nil {
 		return err
 	}
-	if err := tc.Reset(); true {
-		DEBUG.Printf("TcReset: %v", err)
+	tc.params = params
+	tc.session_params = params
+	tc.current_data_rate = float64(params.Datarate)
+	if params.Impairment != nil {
+		tc.current_impairment = *params.Impairment
 	}
-	args := []string{"qdisc", "add", "dev", tc.dev, "root", "handle", "1:", "janz"}
-
-	args = append(args, params.asArgs()...)
-	time.Sleep(1 * time.Second)
-	DEBUG.Printf("Starting tc: %+v", args)
-	res := commands.ExecCommand("tc", args...)
-	if res.Error() != nil {
-		return res.Error()
-	}
-	var err error
-	tc.control_file, err = os.OpenFile(CTRL_FILE, os.O_WRONLY, os.ModeAppend)
-	return err
+	DEBUG.Printf("Init backend %s", tc.backend.Name())
+	return tc.backend.Init(tc.dev, params, nft)
 }
 
-// Rests Qdisc to default
-func (tc *TrafficControl) Reset() error {
-	return commands.ExecCommand("tc", "qdisc", "delete", "dev", tc.dev, "root").Error()
+// Opens the measure records of the backend
+func (tc *TrafficControl) OpenRecords() (RecordReader, error) {
+	return tc.backend.OpenRecords()
 }
 
 // Closes all open contexts; Resets NFT_TABLE, tc markings etc.
@@ -155,79 +146,254 @@ func (tc *TrafficControl) Reset() error {
 // This function needs to be called after tc is Done.
 func (tc *TrafficControl) Close() error {
 	DEBUG.Println("Closing tc")
-	if tc.nft.L4sPremarking {
-		ResetECTMarking(assets.NFT_TABLE_PREMARK)
+	return tc.backend.Close()
+}
+
+// Changes the current bandwidth limit to rate
+func (tc *TrafficControl) ChangeTo(rate float64) error {
+	tc.current_data_rate = rate
+	return tc.backend.ChangeRate(rate)
+}
+
+// Applies the per sample settings of a multi-column DRP.
+//
+// Only settings that differ from the current ones are changed:
+// latency and marking (janz: 'tc qdisc change'), loss (janz: nft).
+// Markfree/Markfull not set by the sample keep their session value,
+// a marking set through the control api (ChangeMarking) wins over both.
+// With an impairment stage, loss and jitter change the impairment
+// (see drp.Impairment.WithSample) instead.
+func (tc *TrafficControl) ChangeSettings(settings drp.SampleSettings) error {
+	params := tc.params
+	params.AddonLatency = int(settings.ExtralatencyMs)
+	if settings.HasMarking() {
+		params.Markfree = int(settings.MarkfreeMs)
+		params.Markfull = int(settings.MarkfullMs)
 	}
-	if tc.nft.SignalStart {
-		ResetECTMarking(assets.NFT_TABLE_SIGNAL)
+	if m := tc.control.marking; m != nil {
+		params.Markfree = m.markfree
+		params.Markfull = m.markfull
 	}
-
-	_ = tc.Reset()
-	if err := tc.control_file.Close(); err == nil {
-		//This is to be expected: File gets closed beforehand
-		WARN.Printf("control_file TC had to be closed")
-	} else {
-		DEBUG.Printf("Could not close control_file TC, %s", err)
+	if params.AddonLatency != tc.params.AddonLatency ||
+		params.Markfree != tc.params.Markfree ||
+		params.Markfull != tc.params.Markfull {
+		if err := params.validate(); err != nil {
+			return err
+		}
+		params.Datarate = uint32(tc.current_data_rate)
+		if err := tc.backend.ChangeParams(params); err != nil {
+			return err
+		}
+		tc.params = params
+	}
+	if tc.params.Impairment != nil {
+		imp := tc.params.Impairment.WithSample(settings)
+		if imp != tc.current_impairment {
+			if err := tc.backend.ChangeImpairment(imp); err != nil {
+				return err
+			}
+			tc.current_impairment = imp
+		}
+		return nil
+	}
+	if settings.Loss != tc.current_loss {
+		if err := tc.backend.ChangeLoss(settings.Loss); err != nil {
+			return err
+		}
+		tc.current_loss = settings.Loss
 	}
 	return nil
 }
 
-// Changes the current bandwidth limit to rate
-func (tc *TrafficControl) ChangeTo(rate float64) error {
-	changeRateArray := make([]byte, 8)
-	currentDataRateBit := uint64(rate) * 1000
-	tc.current_data_rate = rate
-	binary.LittleEndian.PutUint64(changeRateArray, currentDataRateBit)
-	_, err := tc.control_file.Write(changeRateArray)
-	return err
+// Sets what the change loop does with deadlines it missed, CATCHUP_SKIP by default.
+// Has to be called before LaunchChangeLoop.
+func (tc *TrafficControl) SetCatchUpPolicy(policy CatchUpPolicy) {
+	tc.catch_up = policy
+}
+
+// Returns the timing of the rate changes applied by the change loop.
+// Changes of streamed patterns have no deadline and are not recorded.
+func (tc *TrafficControl) Timing() *TimingRecorder {
+	return &tc.timing
 }
 
 // Starts a goroutine that will change the current bandwidth restriciton.
-// A change will occur after the waitTime is exceeded.
+// Changes are applied drp.Freq times per second, each on a deadline
+// relative to the start of the loop (see Scheduler).
+// Timed patterns apply each value at its offset,
+// streamed patterns apply each value as soon as it arrives.
 //
 // # Uses util.RoutineReport
 //
 // Blockig - also spawns 1 short lived routine
-func (tc *TrafficControl) LaunchChangeLoop(waitTime time.Duration, drp *datatypes.DB_data_rate_pattern, r util.RoutineReport) {
-	ticker := time.NewTicker(waitTime)
-	INFO.Printf("start playing DataRatePattern @%s", waitTime.String())
-	if tc.nft.SignalStart {
-		go func() {
-			ResetECTMarking(assets.NFT_TABLE_SIGNAL)
-			err := CreateNftRuleECT(tc.dev, assets.NFT_TABLE_SIGNAL, assets.NFT_CHAIN_FORWARD, assets.NFT_CHAIN_OUTPUT, "ect0", "1")
-			if err != nil {
-				r.ReportFatal(err)
+func (tc *TrafficControl) LaunchChangeLoop(drp *datatypes.DB_data_rate_pattern, r util.RoutineReport) {
+	if drp.IsStreamed() {
+		INFO.Println("start playing streamed DataRatePattern")
+	} else if drp.IsTimed() {
+		INFO.Println("start playing timed DataRatePattern")
+	} else if drp.Freq < 1 {
+		r.ReportFatal(errortypes.NewUserInputError("LaunchChangeLoop: freq must be at least 1, is %d", drp.Freq))
+		r.Wg.Done()
+		return
+	} else {
+		INFO.Printf("start playing DataRatePattern @%dHz, catch up: %s", drp.Freq, tc.catch_up)
+	}
+	tc.mutex.Lock()
+	tc.control.drp = drp
+	tc.control.started = time.Now()
+	tc.mutex.Unlock()
+	go func() {
+		if err := tc.backend.SignalStart(); err != nil {
+			r.ReportFatal(err)
+		}
+	}()
+	if drp.IsStreamed() {
+		tc.streamedChangeLoop(drp, r)
+		return
+	}
+	if drp.IsTimed() {
+		tc.timedChangeLoop(drp, r)
+		return
+	}
+	scheduler := NewScheduler(float64(drp.Freq), tc.catch_up)
+	for {
+		deadline, skipped, ok := scheduler.Wait(r.On_extern_exit_c)
+		if !ok {
+			DEBUG.Println("Closing TC-loop")
+			r.Wg.Done()
+			return
+		}
+		tc.mutex.Lock()
+		//The pattern may have been swapped
+		drp, paused := tc.control.drp, tc.control.paused
+		tc.mutex.Unlock()
+		if paused {
+			continue
+		}
+		if skipped > 0 {
+			DEBUG.Printf("TC-loop skipped %d deadlines", skipped)
+		}
+		//Skipped samples are dropped, keeping the pattern in time
+		for i := int64(0); i < skipped; i++ {
+			if _, ok := tc.next(drp, r); !ok {
 				return
 			}
-			<-time.NewTimer(200 * time.Millisecond).C
-			ResetECTMarking(assets.NFT_TABLE_SIGNAL)
-		}()
+		}
+		value, ok := tc.next(drp, r)
+		if !ok {
+			return
+		}
+		//change data rate in control file
+		if !tc.apply(value, drp, r) {
+			return
+		}
+		tc.timing.Record(deadline, time.Now(), skipped)
 	}
+}
+
+// Applies every value of a timed pattern at its recorded offset,
+// relative to the start of the loop.
+//
+// Blocking
+func (tc *TrafficControl) timedChangeLoop(drp *datatypes.DB_data_rate_pattern, r util.RoutineReport) {
+	start := time.Now()
+	timer := time.NewTimer(0)
+	<-timer.C
 	for {
+		value, ok := tc.next(drp, r)
+		if !ok {
+			return
+		}
+		deadline := start.Add(drp.Offset())
+		timer.Reset(time.Until(deadline))
 		select {
 		case <-r.On_extern_exit_c:
+			timer.Stop()
 			DEBUG.Println("Closing TC-loop")
 			r.Wg.Done()
 			return
-		case <-ticker.C:
-			value, err := drp.Next()
-			if err != nil {
-				if _, ok := err.(*errortypes.IterableStopError); ok {
-					r.Application_has_finished <- "DataRatePattern has finished"
-					r.Wg.Done()
-					return
-				} else {
-					r.ReportWarn(fmt.Errorf("LaunchChangeLoop could retrieve next Value: %w", err))
-					r.Wg.Done()
-					return
-				}
-			}
-			//change data rate in control file
-			if err := tc.ChangeTo(value); err != nil {
-				r.ReportFatal(fmt.Errorf("LaunchChangeLoop could not change Value: %w", err))
-				r.Wg.Done()
+		case <-timer.C:
+			if !tc.apply(value, drp, r) {
 				return
 			}
+			tc.timing.Record(deadline, time.Now(), 0)
+		}
+	}
+}
+
+// Applies every value of a streamed pattern as soon as it arrives.
+// Waiting for a value ends on exit requests, without waiting for the underrun timeout.
+//
+// Blocking
+func (tc *TrafficControl) streamedChangeLoop(drp *datatypes.DB_data_rate_pattern, r util.RoutineReport) {
+	drp.StopStreamOn(r.On_extern_exit_c)
+	for {
+		select {
+		case <-r.On_extern_exit_c:
+			drp.SetToDone()
+			DEBUG.Println("Closing TC-loop")
+			r.Wg.Done()
+			return
+		default:
+		}
+		value, ok := tc.next(drp, r)
+		if !ok {
+			return
+		}
+		if !tc.apply(value, drp, r) {
+			return
+		}
+	}
+}
+
+// Retrieves the next value of drp.
+// On failure the error is reported, Wg released and false returned.
+func (tc *TrafficControl) next(drp *datatypes.DB_data_rate_pattern, r util.RoutineReport) (float64, bool) {
+	var value float64
+	var err error
+	if drp.IsStreamed() {
+		//Blocks until a value arrives; streams can't be controlled
+		value, err = drp.Next()
+	} else {
+		tc.mutex.Lock()
+		value, err = drp.Next()
+		tc.mutex.Unlock()
+	}
+	if err != nil {
+		if _, ok := err.(*errortypes.IterableStopError); ok {
+			//With a downlink pattern, the other loop may have finished first
+			select {
+			case r.Application_has_finished <- "DataRatePattern has finished":
+			case <-r.On_extern_exit_c:
+			}
+		} else {
+			r.ReportWarn(fmt.Errorf("LaunchChangeLoop could retrieve next Value: %w", err))
+		}
+		r.Wg.Done()
+		return 0, false
+	}
+	return value, true
+}
+
+// Changes the rate to value (or the forced rate) and applies the per sample settings of drp.
+// On failure the error is reported, Wg released and false returned.
+func (tc *TrafficControl) apply(value float64, drp *datatypes.DB_data_rate_pattern, r util.RoutineReport) bool {
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+	if forced, ok := tc.control.forcedRate(); ok {
+		value = forced
+	}
+	if err := tc.ChangeTo(value); err != nil {
+		r.ReportFatal(fmt.Errorf("LaunchChangeLoop could not change Value: %w", err))
+		r.Wg.Done()
+		return false
+	}
+	if settings, ok := drp.Settings(); ok {
+		if err := tc.ChangeSettings(settings); err != nil {
+			r.ReportFatal(fmt.Errorf("LaunchChangeLoop could not change settings: %w", err))
+			r.Wg.Done()
+			return false
 		}
 	}
+	return true
 }
@@ -0,0 +1,42 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package trafficcontrol
+
+import (
+	"testing"
+	"time"
+
+	"github.com/telekom/aml-jens/internal/netlink"
+)
+
+func TestJanzOptions(t *testing.T) {
+	params := TrafficControlStartParams{Datarate: 5000, QueueSize: 100, AddonLatency: 20, Markfree: 4, Markfull: 14, Qosmode: 1}
+	want := netlink.JanzOptions{Rate: 625000, Limit: 100, ExtraLatency: 20 * time.Millisecond, Markfree: 4 * time.Millisecond, Markfull: 14 * time.Millisecond, Qosmode: 1}
+	if got := params.janzOptions(); got != want {
+		t.Fatalf("Unexpected options %+v", got)
+	}
+	params.AddonLatency, params.Markfree, params.Markfull, params.Qosmode = 0, 0, 0, 0
+	want.ExtraLatency, want.Markfree, want.Markfull, want.Qosmode = 0, 0, 0, 0
+	if got := params.janzOptions(); got != want {
+		t.Fatalf("Unexpected options after a change to 0 %+v", got)
+	}
+}
@@ -0,0 +1,232 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package trafficcontrol
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"math/bits"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Timing of one applied rate change
+type ChangeTiming struct {
+	//When the change was due
+	Deadline time.Time
+	//When the backend had applied it
+	Applied time.Time
+	//Deadlines skipped right before this change
+	Skipped int64
+}
+
+// Returns how long after its deadline the change was applied
+func (c ChangeTiming) Lateness() time.Duration {
+	return c.Applied.Sub(c.Deadline)
+}
+
+// Lateness statistics of the rate changes of one loop
+type TimingStats struct {
+	Changes int
+	Skipped int64
+	Mean    time.Duration
+	//Standard deviation of the lateness
+	Jitter time.Duration
+	P50    time.Duration
+	P95    time.Duration
+	P99    time.Duration
+	Max    time.Duration
+}
+
+func (s TimingStats) String() string {
+	return fmt.Sprintf("%d changes, %d skipped, lateness mean %s p50 %s p95 %s p99 %s max %s, jitter %s",
+		s.Changes, s.Skipped, s.Mean, s.P50, s.P95, s.P99, s.Max, s.Jitter)
+}
+
+// Lateness below 2^TIMING_PRECISION_BITS µs is counted exactly, above
+// with a relative error of at most 2^-TIMING_PRECISION_BITS
+const TIMING_PRECISION_BITS = 6
+
+const timing_sub_buckets = 1 << TIMING_PRECISION_BITS
+
+// Returns the histogram bucket of a lateness of us µs (>= 0)
+func timingBucket(us int64) int {
+	if us < timing_sub_buckets {
+		return int(us)
+	}
+	shift := bits.Len64(uint64(us)) - TIMING_PRECISION_BITS - 1
+	return (shift+1)*timing_sub_buckets + int(us>>shift) - timing_sub_buckets
+}
+
+// Returns the lowest lateness in µs counted in bucket
+func timingBucketValue(bucket int) int64 {
+	if bucket < timing_sub_buckets {
+		return int64(bucket)
+	}
+	shift := bucket/timing_sub_buckets - 1
+	return int64(bucket%timing_sub_buckets+timing_sub_buckets) << shift
+}
+
+// Records the timing of every rate change in running statistics:
+// mean and jitter (Welford) and a log-linear histogram for the
+// percentiles, so memory does not grow with the playtime.
+// Changes are written to a TimingWriter as they happen, see WriteTo.
+//
+// Safe for concurrent use
+type TimingRecorder struct {
+	mutex   sync.Mutex
+	changes int
+	skipped int64
+	//Running mean and sum of squared differences from it, in ns
+	mean float64
+	m2   float64
+	max  time.Duration
+	//Changes per lateness bucket (see timingBucket), grown as needed
+	histogram []uint64
+	csv       *TimingWriter
+	prefix    []string
+}
+
+// Writes every change recorded from now on to w, prefixed by prefix
+func (t *TimingRecorder) WriteTo(w *TimingWriter, prefix ...string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.csv = w
+	t.prefix = prefix
+}
+
+func (t *TimingRecorder) Record(deadline time.Time, applied time.Time, skipped int64) {
+	change := ChangeTiming{Deadline: deadline, Applied: applied, Skipped: skipped}
+	lateness := change.Lateness()
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.changes++
+	t.skipped += skipped
+	delta := float64(lateness) - t.mean
+	t.mean += delta / float64(t.changes)
+	t.m2 += delta * (float64(lateness) - t.mean)
+	if t.changes == 1 || lateness > t.max {
+		t.max = lateness
+	}
+	//Early changes are counted as on time
+	bucket := 0
+	if lateness > 0 {
+		bucket = timingBucket(lateness.Microseconds())
+	}
+	if bucket >= len(t.histogram) {
+		t.histogram = append(t.histogram, make([]uint64, bucket+1-len(t.histogram))...)
+	}
+	t.histogram[bucket]++
+	if t.csv != nil {
+		t.csv.write(t.prefix, change)
+	}
+}
+
+func (t *TimingRecorder) Stats() TimingStats {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	stats := TimingStats{Changes: t.changes, Skipped: t.skipped}
+	if t.changes == 0 {
+		return stats
+	}
+	percentile := func(p float64) time.Duration {
+		rank := uint64(math.Ceil(p / 100 * float64(t.changes)))
+		var count uint64
+		for bucket, n := range t.histogram {
+			count += n
+			if count >= rank {
+				//Bounded by max, as buckets hold a range
+				if value := time.Duration(timingBucketValue(bucket)) * time.Microsecond; value < t.max {
+					return value
+				}
+				return t.max
+			}
+		}
+		return t.max
+	}
+	stats.Mean = time.Duration(t.mean)
+	stats.Jitter = time.Duration(math.Sqrt(t.m2 / float64(t.changes)))
+	stats.P50 = percentile(50)
+	stats.P95 = percentile(95)
+	stats.P99 = percentile(99)
+	stats.Max = t.max
+	return stats
+}
+
+// Columns written by TimingWriter after the prefix of the TimingRecorder
+var TIMING_HEADING = []string{"deadlineUs", "appliedUs", "latenessUs", "skipped"}
+
+// Csv file rate changes are written to as they are recorded.
+// Timestamps are unix µs, lateness is µs.
+//
+// Safe for concurrent use, shared by the recorders of all queues
+type TimingWriter struct {
+	mutex sync.Mutex
+	file  *os.File
+	w     *csv.Writer
+	//First error writing, returned by Close
+	err error
+}
+
+// Creates the csv file path, its heading is prefix_heading followed by TIMING_HEADING
+func NewTimingWriter(path string, prefix_heading ...string) (*TimingWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	t := &TimingWriter{file: file, w: csv.NewWriter(file)}
+	if err := t.w.Write(append(append([]string(nil), prefix_heading...), TIMING_HEADING...)); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *TimingWriter) write(prefix []string, c ChangeTiming) {
+	line := append(append(make([]string, 0, len(prefix)+len(TIMING_HEADING)), prefix...),
+		strconv.FormatInt(c.Deadline.UnixMicro(), 10),
+		strconv.FormatInt(c.Applied.UnixMicro(), 10),
+		strconv.FormatInt(c.Lateness().Microseconds(), 10),
+		strconv.FormatInt(c.Skipped, 10))
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.err == nil {
+		t.err = t.w.Write(line)
+	}
+}
+
+// Flushes and closes the file, returns the first error writing it
+func (t *TimingWriter) Close() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.w.Flush()
+	if t.err == nil {
+		t.err = t.w.Error()
+	}
+	if err := t.file.Close(); t.err == nil {
+		t.err = err
+	}
+	return t.err
+}
@@ -0,0 +1,140 @@
+/*
+ * aml-jens
+ *
+ * (C) 2023 Deutsche Telekom AG
+ *
+ * Deutsche Telekom AG and all other contributors /
+ * copyright owners license this file to you under the Apache
+ * License, Version 2.0 (the "License"); you may not use this
+ * file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package drpplayer
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/telekom/aml-jens/internal/persistence/datatypes"
+	"github.com/telekom/aml-jens/pkg/drp"
+	"github.com/telekom/aml-jens/pkg/drp_player/trafficcontrol"
+)
+
+// Queues shaping one UE
+type ueQueues struct {
+	session  *datatypes.DB_session
+	uplink   *trafficcontrol.TrafficControl
+	downlink *trafficcontrol.TrafficControl
+}
+
+// Sets up the uplink and, if the session is bidirectional, the downlink
+func (u *ueQueues) init() error {
+	backend, err := trafficcontrol.NewUeBackend(u.session.Backend, u.session.Ue, datatypes.DIRECTION_UPLINK, "")
+	if err != nil {
+		return err
+	}
+	policy, err := trafficcontrol.ParseCatchUpPolicy(u.session.CatchUp)
+	if err != nil {
+		return err
+	}
+	u.uplink = trafficcontrol.NewTrafficControl(u.session.Dev, backend)
+	u.uplink.SetCatchUpPolicy(policy)
+	settings := trafficcontrol.TrafficControlStartParams{
+		Datarate:     uint32(u.session.ChildDRP.Peek() * 2),
+		QueueSize:    int(u.session.Queuesizepackets),
+		AddonLatency: int(u.session.ExtralatencyMs),
+		Markfree:     int(u.session.Markfree),
+		Markfull:     int(u.session.Markfull),
+		Qosmode:      u.session.Qosmode,
+		Impairment:   u.impairment(u.session.ChildDRP),
+	}
+	DEBUG.Printf("Init Tc (ue%d): %+v", u.session.Ue, settings)
+	err = u.uplink.Init(settings,
+		trafficcontrol.NftStartParams{
+			L4sPremarking: u.session.L4sEnablePreMarking,
+			SignalStart:   u.session.SignalDrpStart,
+		})
+	if err != nil || !u.session.IsBidirectional() {
+		return err
+	}
+	return u.initDownlink(settings, policy)
+}
+
+// Shapes the ingress of session.Dev with the downlink pattern.
+// Nft marking is only applied to the uplink.
+func (u *ueQueues) initDownlink(settings trafficcontrol.TrafficControlStartParams, policy trafficcontrol.CatchUpPolicy) error {
+	backend, err := trafficcontrol.NewUeBackend(u.session.Backend, u.session.Ue, datatypes.DIRECTION_DOWNLINK, u.session.IfbDev)
+	if err != nil {
+		return err
+	}
+	u.downlink = trafficcontrol.NewTrafficControl(u.session.Dev, backend)
+	u.downlink.SetCatchUpPolicy(policy)
+	settings.Datarate = uint32(u.session.ChildDRPDownlink.Peek() * 2)
+	settings.Impairment = u.impairment(u.session.ChildDRPDownlink)
+	DEBUG.Printf("Init downlink Tc (ue%d) on %s: %+v", u.session.Ue, u.session.IfbDev, settings)
+	if err := u.downlink.Init(settings, trafficcontrol.NftStartParams{}); err != nil {
+		return fmt.Errorf("downlink: %w", err)
+	}
+	return nil
+}
+
+// Returns the impairment stage of the queue playing pattern,
+// nil if neither the session nor the pattern impair
+func (u *ueQueues) impairment(pattern *datatypes.DB_data_rate_pattern) *drp.Impairment {
+	if !u.session.Impairment.Enabled() && !pattern.HasSampleJitter() {
+		return nil
+	}
+	imp := u.session.Impairment
+	return &imp
+}
+
+// Writes the rate changes of the queues to w as they happen
+func (u *ueQueues) writeTimingTo(w *trafficcontrol.TimingWriter) {
+	ue := strconv.Itoa(u.session.Ue)
+	u.uplink.Timing().WriteTo(w, ue, datatypes.DIRECTION_UPLINK)
+	if u.downlink != nil {
+		u.downlink.Timing().WriteTo(w, ue, datatypes.DIRECTION_DOWNLINK)
+	}
+}
+
+// Reports the rate change timing of the queues
+func (u *ueQueues) reportTiming() {
+	u.reportQueueTiming(u.uplink, datatypes.DIRECTION_UPLINK)
+	u.reportQueueTiming(u.downlink, datatypes.DIRECTION_DOWNLINK)
+}
+
+func (u *ueQueues) reportQueueTiming(tc *trafficcontrol.TrafficControl, direction string) {
+	if tc == nil {
+		return
+	}
+	stats := tc.Timing().Stats()
+	if stats.Changes == 0 {
+		return
+	}
+	INFO.Printf("rate change timing (ue%d %s): %s", u.session.Ue, direction, stats)
+	fmt.Fprintf(os.Stderr, "rate change timing (ue%d %s): %s\n", u.session.Ue, direction, stats)
+}
+
+func (u *ueQueues) close() {
+	if u.uplink != nil {
+		if err := u.uplink.Close(); err != nil {
+			WARN.Printf("Exit: error closing TrafficControl (ue%d): %+v", u.session.Ue, err)
+		}
+	}
+	if u.downlink != nil {
+		if err := u.downlink.Close(); err != nil {
+			WARN.Printf("Exit: error closing downlink TrafficControl (ue%d): %+v", u.session.Ue, err)
+		}
+	}
+}